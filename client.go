@@ -4,9 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/icholy/digest"
@@ -30,6 +34,8 @@ type Client struct {
 	log   *slog.Logger
 
 	connAddr sip.Addr
+	failover bool
+	overload *overloadThrottle
 
 	// TxRequester allows you to use your transaction requester instead default from transaction layer
 	// Useful only for testing
@@ -92,6 +98,18 @@ func WithClientNAT() ClientOption {
 	}
 }
 
+// WithClientFailover enables RFC 3263 server location on Do.
+// Request is sent to resolved targets in order and on transport error, timeout
+// or 503 response next target is tried with new transaction.
+// Failed targets are blacklisted, see sip.WithTransportLayerBlacklistTTL.
+// It is not used when request destination is set with SetDestination
+func WithClientFailover() ClientOption {
+	return func(s *Client) error {
+		s.failover = true
+		return nil
+	}
+}
+
 // WithClientAddr is merge of WithClientHostname and WithClientPort
 // addr is format <host>:<port>
 func WithClientAddr(addr string) ClientOption {
@@ -107,6 +125,16 @@ func WithClientAddr(addr string) ClientOption {
 	}
 }
 
+// WithClientOverloadControl enables RFC 7339 overload control as client.
+// Requests advertise support with oc Via parameter, and new out of dialog requests to destination
+// which reported overload are throttled with loss based algorithm, returning ErrClientOverloadThrottled.
+func WithClientOverloadControl() ClientOption {
+	return func(c *Client) error {
+		c.overload = newOverloadThrottle()
+		return nil
+	}
+}
+
 // NewClient creates client handle for user agent
 func NewClient(ua *UserAgent, options ...ClientOption) (*Client, error) {
 	c := &Client{
@@ -149,16 +177,26 @@ func (c *Client) TransactionRequest(ctx context.Context, req *sip.Request, optio
 		return nil, fmt.Errorf("ACK request must be sent directly through transport. Use WriteRequest")
 	}
 
+	if err := clientRequestApply(c, req, options); err != nil {
+		return nil, err
+	}
+	return c.transactionRequest(ctx, req)
+}
+
+func clientRequestApply(c *Client, req *sip.Request, options []ClientRequestOption) error {
 	if len(options) == 0 {
 		clientRequestBuildReq(c, req)
-	} else {
-		for _, o := range options {
-			if err := o(c, req); err != nil {
-				return nil, err
-			}
+		return nil
+	}
+	for _, o := range options {
+		if err := o(c, req); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+func (c *Client) transactionRequest(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
 	if c.TxRequester != nil {
 		return c.TxRequester.Request(ctx, req)
 	}
@@ -171,7 +209,28 @@ func (c *Client) TransactionRequest(ctx context.Context, req *sip.Request, optio
 		c.log.Warn("Missing Content-Length for reliable transport")
 	}
 
-	return c.tx.Request(ctx, req)
+	if c.overload == nil {
+		return c.tx.Request(ctx, req)
+	}
+
+	dest := req.Destination()
+	if c.overload.throttle(req, dest) {
+		return nil, ErrClientOverloadThrottled
+	}
+	c.overload.advertise(req)
+
+	tx, err := c.tx.NewClientTransaction(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	tx.OnResponse(func(res *sip.Response) {
+		c.overload.feedback(dest, res)
+	})
+	if err := tx.Init(); err != nil {
+		tx.Terminate()
+		return nil, err
+	}
+	return tx, nil
 }
 
 func (c *Client) newTransaction(ctx context.Context, req *sip.Request, onConnection func(conn sip.Connection) error, options ...ClientRequestOption) (sip.ClientTransaction, error) {
@@ -211,11 +270,18 @@ func (c *Client) newTransaction(ctx context.Context, req *sip.Request, onConnect
 // NOTE: Canceling ctx WILL not send Cancel Request which is needed for INVITE. Use dialog API for dealing with dialogs
 // For more lower API use TransactionRequest directly
 func (c *Client) Do(ctx context.Context, req *sip.Request, opts ...ClientRequestOption) (*sip.Response, error) {
+	if c.failover && req.MessageData.Destination() == "" && !req.IsAck() {
+		return c.doFailover(ctx, req, opts...)
+	}
+
 	tx, err := c.TransactionRequest(ctx, req, opts...)
 	if err != nil {
 		return nil, err
 	}
+	return c.doTransaction(ctx, tx)
+}
 
+func (c *Client) doTransaction(ctx context.Context, tx sip.ClientTransaction) (*sip.Response, error) {
 	defer tx.Terminate()
 
 	for {
@@ -235,6 +301,103 @@ func (c *Client) Do(ctx context.Context, req *sip.Request, opts ...ClientRequest
 	}
 }
 
+// doFailover sends request to targets located by RFC 3263. Next target is tried
+// with new transaction on transport error, timeout or 503 response.
+// First target is sent with passed request, and for next ones request is cloned with new Via branch.
+// https://datatracker.ietf.org/doc/html/rfc3263#section-4.3
+func (c *Client) doFailover(ctx context.Context, req *sip.Request, opts ...ClientRequestOption) (*sip.Response, error) {
+	targets, err := c.tp.ResolveTargets(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate server: %w", err)
+	}
+
+	if err := clientRequestApply(c, req, opts); err != nil {
+		return nil, err
+	}
+	// Keep our Via before transport layer sets sent-by from connection
+	var via *sip.ViaHeader
+	if v := req.Via(); v != nil {
+		via = v.Clone()
+	}
+
+	resolver := c.tp.ServerResolver()
+	for i, target := range targets {
+		r := req
+		if i > 0 {
+			r = req.Clone()
+			if via != nil {
+				v := via.Clone()
+				v.Params.Add("branch", sip.GenerateBranchN(16))
+				r.ReplaceHeader(v)
+			}
+		}
+		r.SetTransport(sip.NetworkToUpper(target.Transport))
+		r.SetDestination(target.Addr.String())
+		if v := r.Via(); v != nil && via != nil {
+			v.Transport = r.Transport()
+		}
+
+		var res *sip.Response
+		tx, err := c.transactionRequest(ctx, r)
+		// Request not sent due to connection failure is treated as transport error
+		sent := err == nil
+		if sent {
+			res, err = c.doTransaction(ctx, tx)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		last := i == len(targets)-1
+		switch {
+		case err == nil && res.StatusCode != sip.StatusServiceUnavailable:
+			return res, nil
+		case err == nil:
+			// https://datatracker.ietf.org/doc/html/rfc3263#section-4.3
+			// 503 means server is overloaded, and for Retry-After time it should not be tried
+			resolver.Blacklist(target, retryAfter(res))
+			if last {
+				return res, nil
+			}
+		case sent && !errors.Is(err, sip.ErrTransactionTimeout) && !errors.Is(err, sip.ErrTransactionTransport):
+			return nil, err
+		default:
+			resolver.Blacklist(target, 0)
+			if last {
+				return nil, err
+			}
+		}
+		if err == nil {
+			err = fmt.Errorf("target responded with %d", res.StatusCode)
+		}
+		c.log.Debug("Request failed, trying next target", "target", target.String(), "error", err)
+	}
+	return nil, fmt.Errorf("failed to locate server: %w", sip.ErrServerResolverNoTargets)
+}
+
+// timers returns transaction layer timers. Package timers are returned if user agent is not created
+func (c *Client) timers() sip.Timers {
+	if c == nil || c.UserAgent == nil || c.tx == nil {
+		return sip.DefaultTimers()
+	}
+	return c.tx.Timers()
+}
+
+func retryAfter(res *sip.Response) time.Duration {
+	h := res.GetHeader("Retry-After")
+	if h == nil {
+		return 0
+	}
+	// Retry-After can have comment and params after delta seconds
+	val, _, _ := strings.Cut(h.Value(), " ")
+	val, _, _ = strings.Cut(val, ";")
+	sec, err := strconv.Atoi(val)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(sec) * time.Second
+}
+
 type DigestAuth struct {
 	Username string
 	Password string
@@ -235,6 +235,98 @@ func TestClientViaRouting(t *testing.T) {
 	assert.Equal(t, 5060, via.Port)
 }
 
+type clientTxRequesterFunc func(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error)
+
+func (f clientTxRequesterFunc) Request(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
+	return f(ctx, req)
+}
+
+func TestClientFailover(t *testing.T) {
+	dns := &siptest.DNSResolver{
+		Hosts: map[string][]net.IP{
+			"sip1.example.com": {net.ParseIP("10.0.0.1")},
+			"sip2.example.com": {net.ParseIP("10.0.0.2")},
+			"sip3.example.com": {net.ParseIP("10.0.0.3")},
+		},
+		SRV: map[string][]*net.SRV{
+			"_sip._udp.example.com": {
+				{Target: "sip1.example.com.", Port: 5060, Priority: 10},
+				{Target: "sip2.example.com.", Port: 5060, Priority: 20},
+			},
+			"_sip._tcp.example.com": {
+				{Target: "sip3.example.com.", Port: 5070, Priority: 10},
+			},
+		},
+	}
+	ua, err := NewUA(WithUserAgentDNSResolver(dns))
+	require.NoError(t, err)
+	defer ua.Close()
+
+	client, err := NewClient(ua, WithClientHostname("10.1.1.1"), WithClientFailover())
+	require.NoError(t, err)
+
+	var destinations []string
+	var branches []string
+	responder := &siptest.ClientTxRequesterResponder{
+		OnRequest: func(req *sip.Request, w *siptest.ClientTxResponder) {
+			code, reason := sip.StatusOK, "OK"
+			if req.Destination() == "10.0.0.2:5060" {
+				code, reason = sip.StatusServiceUnavailable, "Service Unavailable"
+			}
+			w.Receive(sip.NewResponseFromRequest(req, code, reason, nil))
+		},
+	}
+	client.TxRequester = clientTxRequesterFunc(func(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
+		destinations = append(destinations, req.Transport()+":"+req.Destination())
+		via := req.Via()
+		assert.Equal(t, req.Transport(), via.Transport)
+		branch, _ := via.Params.Get("branch")
+		branches = append(branches, branch)
+
+		if req.Destination() == "10.0.0.1:5060" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return responder.Request(ctx, req)
+	})
+
+	req := sip.NewRequest(sip.OPTIONS, sip.Uri{Scheme: "sip", Host: "example.com"})
+	res, err := client.Do(context.TODO(), req)
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"UDP:10.0.0.1:5060", "UDP:10.0.0.2:5060", "TCP:10.0.0.3:5070"}, destinations)
+	require.Len(t, branches, 3)
+	assert.NotEqual(t, branches[0], branches[1])
+	assert.NotEqual(t, branches[1], branches[2])
+
+	// Failed targets are blacklisted and tried last
+	resolver := ua.TransportLayer().ServerResolver()
+	targets, err := ua.TransportLayer().ResolveTargets(context.TODO(), sip.NewRequest(sip.OPTIONS, sip.Uri{Scheme: "sip", Host: "example.com"}))
+	require.NoError(t, err)
+	require.Len(t, targets, 3)
+	assert.Equal(t, "tcp:10.0.0.3:5070", targets[0].String())
+	assert.True(t, resolver.IsBlacklisted(targets[1]))
+	assert.True(t, resolver.IsBlacklisted(targets[2]))
+
+	t.Run("AllFailed", func(t *testing.T) {
+		destinations = nil
+		req := sip.NewRequest(sip.OPTIONS, sip.Uri{Scheme: "sip", Host: "example.com", UriParams: sip.HeaderParams{{K: "transport", V: "udp"}}})
+		res, err := client.Do(context.TODO(), req)
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusServiceUnavailable, res.StatusCode)
+		assert.Len(t, destinations, 2)
+	})
+
+	t.Run("Destination", func(t *testing.T) {
+		destinations = nil
+		req := sip.NewRequest(sip.OPTIONS, sip.Uri{Scheme: "sip", Host: "example.com"})
+		req.SetDestination("10.0.0.2:5060")
+		res, err := client.Do(context.TODO(), req)
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, []string{"UDP:10.0.0.2:5060"}, destinations)
+	})
+}
+
 func TestIntegrationClientViaBindHost(t *testing.T) {
 	if os.Getenv("TEST_INTEGRATION") == "" {
 		t.Skip("Use TEST_INTEGRATION env value to run this test")
@@ -42,6 +42,11 @@ type Dialog struct {
 
 	state atomic.Int32
 
+	// replaced is set once dialog is replaced with Replaces RFC 3891
+	replaced atomic.Bool
+	// replacing is set once INVITE with Replaces is accepted for this dialog
+	replacing atomic.Bool
+
 	ctx    context.Context
 	cancel context.CancelCauseFunc
 
@@ -19,6 +19,11 @@ type DialogClientSession struct {
 
 	// onClose triggers when user calls Close
 	onClose func()
+
+	sessTimer *sessionTimer
+
+	// implicit subscriptions of sent REFER requests
+	refers referSubscriptions
 }
 
 func (s *DialogClientSession) ReadBye(req *sip.Request, tx sip.ServerTransaction) error {
@@ -56,6 +61,7 @@ func (s *DialogClientSession) Do(ctx context.Context, req *sip.Request) (*sip.Re
 			if res.IsProvisional() {
 				continue
 			}
+			s.sessionTimerUpdate(req, res)
 			return res, nil
 
 		case <-tx.Done():
@@ -72,7 +78,11 @@ func (s *DialogClientSession) Do(ctx context.Context, req *sip.Request) (*sip.Re
 // This ensures that you have proper request done within dialog. You should avoid setting any Dialog header (cseq, from, to, callid)
 func (s *DialogClientSession) TransactionRequest(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
 	s.buildReq(req)
+	return s.transactionRequest(ctx, req)
+}
 
+// transactionRequest sends request already built with buildReq
+func (s *DialogClientSession) transactionRequest(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
 	// Passing option to avoid CSEQ apply
 	return s.UA.Client.TransactionRequest(ctx, req, s.requestValidate)
 }
@@ -126,12 +136,12 @@ func (s *DialogClientSession) buildReq(req *sip.Request) {
 		req.PrependHeader(mustHaveHeaders...)
 	}
 
-	// For safety make sure we are starting with our last dialog cseq num
-	cseq.SeqNo = s.lastCSeqNo.Load()
-
+	// ACK and CANCEL keep CSeq of INVITE as requests like PRACK could increase it meanwhile
 	if !req.IsAck() && !req.IsCancel() {
-		// Do cseq increment within dialog
-		cseq.SeqNo++
+		// For safety make sure we are starting with our last dialog cseq num
+		// and do cseq increment within dialog
+		cseq.SeqNo = s.lastCSeqNo.Load() + 1
+		s.lastCSeqNo.Store(cseq.SeqNo)
 	}
 
 	// Check record route header
@@ -161,7 +171,6 @@ func (s *DialogClientSession) buildReq(req *sip.Request) {
 		req.AppendHeader(sip.HeaderClone(&s.UA.ContactHDR))
 	}
 
-	s.lastCSeqNo.Store(cseq.SeqNo)
 	// Make sure transport matches original invite
 	req.SetTransport(s.InviteRequest.Transport())
 }
@@ -238,6 +247,7 @@ func (s *DialogClientSession) WaitAnswer(ctx context.Context, opts AnswerOptions
 	tx, inviteRequest := s.inviteTx, s.InviteRequest
 	var r *sip.Response
 	var err error
+	var lastRSeq uint32
 	for i := 0; ; i++ {
 		if i > 10 {
 			// Preventing some long loops
@@ -260,6 +270,19 @@ func (s *DialogClientSession) WaitAnswer(ctx context.Context, opts AnswerOptions
 			return errors.Join(fmt.Errorf("transaction terminated"), tx.Err())
 		}
 
+		if rseq := r.RSeq(); rseq != nil && r.IsProvisional() && hasOptionTag(r, "Require", "100rel") {
+			// https://datatracker.ietf.org/doc/html/rfc3262#section-4
+			// Retransmissions and out of order responses are not acknowledged
+			if lastRSeq != 0 && rseq.Val() != lastRSeq+1 {
+				i-- // Retransmissions are not counted
+				continue
+			}
+			lastRSeq = rseq.Val()
+			if err := s.writePrack(ctx, r); err != nil {
+				return err
+			}
+		}
+
 		if opts.OnResponse != nil {
 			if err := opts.OnResponse(r); err != nil {
 				return err
@@ -274,6 +297,22 @@ func (s *DialogClientSession) WaitAnswer(ctx context.Context, opts AnswerOptions
 			continue
 		}
 
+		if r.StatusCode == sip.StatusSessionIntervalTooSmall && s.sessTimer != nil {
+			// https://datatracker.ietf.org/doc/html/rfc4028#section-7.4
+			if minse := r.MinSE(); minse != nil && sessionTimerRetryApply(inviteRequest, *minse) {
+				tx.Terminate()
+
+				// Resend with higher interval within same dialog transaction
+				inviteRequest.RemoveHeader("Via")
+				tx, err = s.TransactionRequest(ctx, inviteRequest)
+				if err != nil {
+					return err
+				}
+				s.inviteTx = tx
+				continue
+			}
+		}
+
 		if (r.StatusCode == sip.StatusProxyAuthRequired) && opts.Password != "" {
 			h := inviteRequest.GetHeader("Proxy-Authorization")
 			if h == nil {
@@ -343,6 +382,9 @@ func (s *DialogClientSession) WaitAnswer(ctx context.Context, opts AnswerOptions
 	s.InviteResponse = r
 	s.ID = id
 	s.setState(sip.DialogStateEstablished)
+	if s.sessTimer != nil {
+		s.sessTimer.reset(sessionTimerUAC(r))
+	}
 	return nil
 }
 
@@ -392,7 +434,7 @@ loop_487:
 			break loop_487
 		case <-tx.Done():
 			return tx.Err()
-		case <-time.After(64 * sip.T1):
+		case <-time.After(64 * s.UA.Client.timers().T1):
 			break loop_487
 		}
 	}
@@ -0,0 +1,234 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	ErrDialogPrackTimeout    = errors.New("no PRACK received for reliable provisional response")
+	ErrDialogPrackNotMatched = errors.New("PRACK does not match any reliable provisional response")
+)
+
+// reliableResponse is reliable provisional response waiting PRACK
+// https://datatracker.ietf.org/doc/html/rfc3262
+type reliableResponse struct {
+	rseq  uint32
+	acked chan struct{}
+	done  chan struct{}
+	err   error
+}
+
+func (r *reliableResponse) finish(err error) {
+	r.err = err
+	close(r.done)
+}
+
+// reliableProvisional checks should provisional response be sent reliably
+func (s *DialogServerSession) reliableProvisional(res *sip.Response) bool {
+	if res.StatusCode == sip.StatusTrying {
+		// https://datatracker.ietf.org/doc/html/rfc3262#section-3
+		// 100 response MUST NOT be sent reliably
+		return false
+	}
+
+	if hasOptionTag(res, "Require", "100rel") || hasOptionTag(s.InviteRequest, "Require", "100rel") {
+		return true
+	}
+	return s.ua.ReliableProvisional && hasOptionTag(s.InviteRequest, "Supported", "100rel")
+}
+
+// writeReliableProvisional sends provisional response with RSeq and retransmits it
+// until PRACK is received. Previous reliable provisional must be acknowledged before
+// https://datatracker.ietf.org/doc/html/rfc3262#section-3
+func (s *DialogServerSession) writeReliableProvisional(res *sip.Response) error {
+	if err := s.waitPrack(); err != nil {
+		return err
+	}
+
+	s.prackMu.Lock()
+	if s.rseq == 0 {
+		// The value of the RSeq in each response MUST be between 1 and 2**31 - 1
+		s.rseq = rand.Uint32N(1<<31-1) + 1
+	} else {
+		s.rseq++
+	}
+	rr := &reliableResponse{
+		rseq:  s.rseq,
+		acked: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	s.prack = rr
+	s.prackMu.Unlock()
+
+	res.RemoveHeader("RSeq")
+	addOptionTag(res, "Require", "100rel")
+	rseq := sip.RSeqHeader(rr.rseq)
+	res.AppendHeader(&rseq)
+
+	if err := s.inviteTx.Respond(res); err != nil {
+		rr.finish(err)
+		return err
+	}
+
+	// Clone for race safety as caller could reuse response
+	go s.retransmitReliableProvisional(res.Clone(), rr)
+	return nil
+}
+
+func (s *DialogServerSession) retransmitReliableProvisional(res *sip.Response, rr *reliableResponse) {
+	tx := s.inviteTx
+
+	// The reliable provisional response is passed to the transaction layer periodically
+	// with an interval that starts at T1 seconds and doubles for each retransmission
+	timers := s.ua.Client.timers()
+	interval := timers.T1
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	timeout := time.NewTimer(64 * timers.T1)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-rr.acked:
+			rr.finish(nil)
+			return
+		case <-timer.C:
+			if err := tx.Respond(res); err != nil {
+				rr.finish(err)
+				return
+			}
+			interval *= 2
+			timer.Reset(interval)
+		case <-timeout.C:
+			// If a reliable provisional response is retransmitted for 64*T1 seconds
+			// without reception of a corresponding PRACK, the UAS SHOULD reject the
+			// original request with a 5xx response.
+			rr.finish(ErrDialogPrackTimeout)
+			res := sip.NewResponseFromRequest(s.InviteRequest, sip.StatusInternalServerError, "Server Internal Error", nil)
+			if err := s.WriteResponse(res); err != nil {
+				s.ua.Client.log.Info("Failed to reject INVITE on PRACK timeout", "error", err)
+			}
+			return
+		case <-tx.Done():
+			rr.finish(errors.Join(ErrDialogPrackTimeout, tx.Err()))
+			return
+		}
+	}
+}
+
+// waitPrack blocks until last reliable provisional response is acknowledged
+func (s *DialogServerSession) waitPrack() error {
+	s.prackMu.Lock()
+	rr := s.prack
+	s.prackMu.Unlock()
+	if rr == nil {
+		return nil
+	}
+
+	<-rr.done
+	return rr.err
+}
+
+// ReadPrack should be called from your OnPrack handler. It acknowledges reliable provisional response
+// and responds 200 OK. In case PRACK does not match it responds with 481
+func (s *DialogServerSession) ReadPrack(req *sip.Request, tx sip.ServerTransaction) error {
+	rack := req.RAck()
+	if rack == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - missing RAck", nil)
+		if err := tx.Respond(res); err != nil {
+			return err
+		}
+		return ErrDialogPrackNotMatched
+	}
+
+	cseq := s.InviteRequest.CSeq()
+
+	s.prackMu.Lock()
+	rr := s.prack
+	matched := rr != nil && rr.rseq == rack.RSeq && cseq.SeqNo == rack.CSeq && cseq.MethodName == rack.MethodName
+	s.prackMu.Unlock()
+
+	if !matched {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		if err := tx.Respond(res); err != nil {
+			return err
+		}
+		return ErrDialogPrackNotMatched
+	}
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	if err := tx.Respond(res); err != nil {
+		return err
+	}
+
+	s.prackMu.Lock()
+	select {
+	case <-rr.acked:
+	default:
+		close(rr.acked)
+	}
+	s.prackMu.Unlock()
+	return nil
+}
+
+// ReadPrack should read from your OnPrack handler
+func (s *DialogServerCache) ReadPrack(req *sip.Request, tx sip.ServerTransaction) error {
+	dt, err := s.MatchDialogRequest(req)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return errors.Join(err, tx.Respond(res))
+	}
+	return dt.ReadPrack(req, tx)
+}
+
+// writePrack sends PRACK for reliable provisional response. Final response is handled in background
+func (s *DialogClientSession) writePrack(ctx context.Context, res *sip.Response) error {
+	prack := newPrackRequestUAC(s.InviteRequest, res)
+	tx, err := s.TransactionRequest(ctx, prack)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer tx.Terminate()
+		for {
+			select {
+			case r := <-tx.Responses():
+				if r.IsProvisional() {
+					continue
+				}
+				if !r.IsSuccess() {
+					s.UA.Client.log.Info("PRACK failed", "status", r.StatusCode)
+				}
+				return
+			case <-tx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func newPrackRequestUAC(inviteRequest *sip.Request, res *sip.Response) *sip.Request {
+	recipient := &inviteRequest.Recipient
+	if cont := res.Contact(); cont != nil {
+		// PRACK is sent within early dialog
+		recipient = &cont.Address
+	}
+
+	prack := sip.NewRequest(sip.PRACK, *recipient.Clone())
+	prack.SipVersion = inviteRequest.SipVersion
+
+	cseq := inviteRequest.CSeq()
+	prack.AppendHeader(&sip.RAckHeader{
+		RSeq:       res.RSeq().Val(),
+		CSeq:       cseq.SeqNo,
+		MethodName: cseq.MethodName,
+	})
+	return prack
+}
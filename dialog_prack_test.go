@@ -0,0 +1,181 @@
+package sipgo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialogPrackUAC(t *testing.T) {
+	pracks := make(chan *sip.Request, 2)
+	acks := make(chan *sip.Request, 1)
+	client := testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+		switch req.Method {
+		case sip.PRACK:
+			pracks <- req
+			w.Receive(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+			return
+		case sip.ACK:
+			acks <- req
+			return
+		}
+
+		assert.True(t, hasOptionTag(req, "Supported", "100rel"))
+		ringing := sip.NewResponseFromRequest(req, sip.StatusSessionInProgress, "Session Progress", nil)
+		ringing.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "uas.sipgo.com"}})
+		ringing.AppendHeader(sip.NewHeader("Require", "100rel"))
+		rseq := sip.RSeqHeader(10)
+		ringing.AppendHeader(&rseq)
+
+		w.Receive(ringing)
+		// Retransmission must not be acknowledged again
+		w.Receive(ringing)
+
+		select {
+		case <-pracks:
+		case <-time.After(time.Second):
+			t.Error("PRACK not received")
+			return
+		}
+		pracks <- nil
+
+		res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		res.ReplaceHeader(sip.HeaderClone(ringing.To()))
+		res.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "uas.sipgo.com"}})
+		w.Receive(res)
+	})
+
+	dua := DialogUA{
+		Client:              client,
+		ReliableProvisional: true,
+	}
+	d, err := dua.Invite(context.TODO(), sip.Uri{User: "test", Host: "localhost"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, d.WaitAnswer(context.TODO(), AnswerOptions{}))
+	require.Nil(t, <-pracks)
+	require.Empty(t, pracks)
+
+	require.NoError(t, d.Ack(context.TODO()))
+	ack := <-acks
+
+	// PRACK is part of early dialog, but ACK keeps INVITE CSeq
+	inviteCSeq := d.InviteRequest.CSeq().SeqNo
+	assert.Equal(t, inviteCSeq, ack.CSeq().SeqNo)
+	assert.Equal(t, inviteCSeq+1, d.lastCSeqNo.Load())
+}
+
+func TestDialogPrackNewRequest(t *testing.T) {
+	invite, _, _ := createTestInvite(t, "sip:uas@127.0.0.1", "udp", "127.0.0.1:5090")
+	res := sip.NewResponseFromRequest(invite, sip.StatusRinging, "Ringing", nil)
+	res.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "127.0.0.2"}})
+	rseq := sip.RSeqHeader(1)
+	res.AppendHeader(&rseq)
+
+	prack := newPrackRequestUAC(invite, res)
+	assert.Equal(t, sip.PRACK, prack.Method)
+	assert.Equal(t, "127.0.0.2", prack.Recipient.Host)
+	assert.Equal(t, "RAck: 1 10 INVITE", prack.RAck().String())
+}
+
+// prackTestTx records responses safely as reliable provisionals are retransmitted in background
+type prackTestTx struct {
+	sip.ServerTransaction
+	mu        sync.Mutex
+	responses []*sip.Response
+}
+
+func (tx *prackTestTx) Respond(res *sip.Response) error {
+	tx.mu.Lock()
+	tx.responses = append(tx.responses, res.Clone())
+	tx.mu.Unlock()
+	return tx.ServerTransaction.Respond(res)
+}
+
+func (tx *prackTestTx) Result() []*sip.Response {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return append([]*sip.Response(nil), tx.responses...)
+}
+
+func TestDialogPrackUAS(t *testing.T) {
+	dua := DialogUA{
+		Client:              testClient(t, nil),
+		ContactHDR:          sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "127.0.0.200", Port: 5099}},
+		ReliableProvisional: true,
+	}
+
+	invite, _, _ := createTestInvite(t, "sip:uas@127.0.0.1", "tcp", "127.0.0.1:5090")
+	invite.AppendHeader(&sip.ContactHeader{Address: sip.Uri{Host: "uac", Port: 1234}})
+	invite.AppendHeader(sip.NewHeader("Supported", "100rel"))
+	tx := &prackTestTx{ServerTransaction: siptest.NewServerTxRecorder(invite)}
+
+	d, err := dua.ReadInvite(invite, tx)
+	require.NoError(t, err)
+
+	require.NoError(t, d.WriteResponse(sip.NewResponseFromRequest(d.InviteRequest, sip.StatusTrying, "Trying", nil)))
+	require.NoError(t, d.Respond(sip.StatusRinging, "Ringing", nil))
+
+	res := tx.Result()
+	require.Len(t, res, 2)
+	assert.Nil(t, res[0].RSeq())
+	ringing := res[1]
+	assert.True(t, hasOptionTag(ringing, "Require", "100rel"))
+	require.NotNil(t, ringing.RSeq())
+
+	answered := make(chan error)
+	go func() {
+		answered <- d.Respond(sip.StatusOK, "OK", nil)
+	}()
+
+	// Ringing is retransmitted and 200 OK waits for PRACK
+	require.Eventually(t, func() bool {
+		return len(tx.Result()) > 2
+	}, 2*sip.T1, 10*time.Millisecond)
+	select {
+	case err := <-answered:
+		t.Fatalf("answered before PRACK err=%v", err)
+	default:
+	}
+	assert.Equal(t, ringing.RSeq().Val(), tx.Result()[2].RSeq().Val())
+
+	newPrack := func(rseq uint32) (*sip.Request, *siptest.ServerTxRecorder) {
+		prack := newPrackRequestUAC(d.InviteRequest, ringing)
+		prack.AppendHeader(sip.NewHeader("Via", "SIP/2.0/TCP 127.0.0.1:5090;branch="+sip.GenerateBranch()))
+		prack.AppendHeader(sip.HeaderClone(d.InviteRequest.From()))
+		prack.AppendHeader(sip.HeaderClone(ringing.To()))
+		prack.AppendHeader(sip.HeaderClone(d.InviteRequest.CallID()))
+		prack.AppendHeader(&sip.CSeqHeader{SeqNo: 11, MethodName: sip.PRACK})
+		prack.ReplaceHeader(&sip.RAckHeader{RSeq: rseq, CSeq: 10, MethodName: sip.INVITE})
+		return prack, siptest.NewServerTxRecorder(prack)
+	}
+
+	t.Run("NotMatched", func(t *testing.T) {
+		prack, prackTx := newPrack(ringing.RSeq().Val() + 1)
+		err := d.ReadPrack(prack, prackTx)
+		require.ErrorIs(t, err, ErrDialogPrackNotMatched)
+		require.Len(t, prackTx.Result(), 1)
+		assert.Equal(t, sip.StatusCallTransactionDoesNotExists, prackTx.Result()[0].StatusCode)
+	})
+
+	prack, prackTx := newPrack(ringing.RSeq().Val())
+	require.NoError(t, d.ReadPrack(prack, prackTx))
+	require.Len(t, prackTx.Result(), 1)
+	assert.Equal(t, sip.StatusOK, prackTx.Result()[0].StatusCode)
+
+	// Now 2xx is sent and we can confirm dialog
+	require.Eventually(t, func() bool {
+		res := tx.Result()
+		return res[len(res)-1].IsSuccess()
+	}, sip.T1, 10*time.Millisecond)
+	res = tx.Result()
+	ack := newAckRequestUAC(d.InviteRequest, res[len(res)-1], nil)
+	require.NoError(t, d.ReadAck(ack, tx))
+	require.NoError(t, <-answered)
+	assert.Equal(t, sip.DialogStateConfirmed, d.LoadState())
+}
@@ -0,0 +1,568 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	ErrDialogReferNoReferTo = errors.New("no or multiple Refer-To header")
+	ErrDialogReferNoSipFrag = errors.New("invalid message/sipfrag body")
+)
+
+// referSubscriptionExpires is duration of implicit subscription advertised by transferee
+const referSubscriptionExpires = 180 * time.Second
+
+// ReferOptions are options for sending REFER within dialog
+type ReferOptions struct {
+	// ReferredBy is added as Referred-By header
+	ReferredBy *sip.ReferredByHeader
+
+	// NoReferSub asks transferee to not create implicit subscription RFC 4488.
+	// If transferee accepts it, no NOTIFY is received and transfer result is unknown
+	NoReferSub bool
+
+	// OnNotify is called for every NOTIFY with transfer progress.
+	// Frag is parsed status line of message/sipfrag body and can be nil
+	OnNotify func(frag *sip.Response)
+}
+
+// referDialog is in dialog session able to send or receive REFER
+type referDialog interface {
+	Do(ctx context.Context, req *sip.Request) (*sip.Response, error)
+	Context() context.Context
+	remoteTarget() sip.Uri
+	buildReq(req *sip.Request)
+	transactionRequest(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error)
+}
+
+// referSubscriptions holds implicit subscriptions created by REFER sent within dialog
+type referSubscriptions struct {
+	mu   sync.Mutex
+	subs map[uint32]*ReferSubscription
+}
+
+// ReferSubscription is implicit subscription created by REFER. Transferee reports
+// transfer progress with NOTIFY carrying message/sipfrag body
+// https://datatracker.ietf.org/doc/html/rfc3515#section-2.4.4
+type ReferSubscription struct {
+	// ID is event id of subscription and it is equal to CSeq of REFER request
+	ID uint32
+
+	refers *referSubscriptions
+	opts   ReferOptions
+	dctx   context.Context
+
+	mu    sync.Mutex
+	done  chan struct{}
+	final *sip.Response
+	err   error
+}
+
+// Wait blocks until transfer is completed and returns final sipfrag response.
+// In case transferee accepted REFER without subscription nil response is returned.
+// Returns ErrSubscriptionTerminated in case subscription is terminated without final response
+func (r *ReferSubscription) Wait(ctx context.Context) (*sip.Response, error) {
+	select {
+	case <-r.done:
+		return r.final, r.err
+	default:
+	}
+
+	select {
+	case <-r.done:
+		return r.final, r.err
+	case <-r.dctx.Done():
+		return nil, context.Cause(r.dctx)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done is closed when subscription is terminated
+func (r *ReferSubscription) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *ReferSubscription) finish(final *sip.Response, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	r.final, r.err = final, err
+	close(r.done)
+
+	r.refers.mu.Lock()
+	delete(r.refers.subs, r.ID)
+	r.refers.mu.Unlock()
+}
+
+func (r *ReferSubscription) notify(frag *sip.Response, state *sip.SubscriptionStateHeader) {
+	if r.opts.OnNotify != nil {
+		r.opts.OnNotify(frag)
+	}
+
+	if frag != nil && !frag.IsProvisional() {
+		r.finish(frag, nil)
+		return
+	}
+
+	if state.State == sip.SubscriptionStateTerminated {
+		retry, _ := state.RetryAfter()
+		r.finish(nil, ErrSubscriptionTerminated{
+			Reason:     state.Reason(),
+			RetryAfter: time.Duration(retry) * time.Second,
+		})
+	}
+}
+
+// refer sends REFER and creates implicit subscription
+func (r *referSubscriptions) refer(ctx context.Context, d referDialog, referTo sip.Uri, opts ReferOptions) (*ReferSubscription, error) {
+	req := sip.NewRequest(sip.REFER, d.remoteTarget())
+	req.AppendHeader(&sip.ReferToHeader{Address: referTo})
+	if opts.ReferredBy != nil {
+		req.AppendHeader(opts.ReferredBy)
+	}
+	if opts.NoReferSub {
+		req.AppendHeader(sip.NewHeader("Refer-Sub", "false"))
+	}
+
+	sub := &ReferSubscription{
+		refers: r,
+		opts:   opts,
+		dctx:   d.Context(),
+		done:   make(chan struct{}),
+	}
+
+	// NOTIFY can arrive before REFER response so subscription
+	// is stored with CSeq of request before it is sent
+	d.buildReq(req)
+	sub.ID = req.CSeq().SeqNo
+	r.mu.Lock()
+	if r.subs == nil {
+		r.subs = make(map[uint32]*ReferSubscription)
+	}
+	r.subs[sub.ID] = sub
+	r.mu.Unlock()
+
+	tx, err := d.transactionRequest(ctx, req)
+	if err != nil {
+		sub.finish(nil, err)
+		return nil, err
+	}
+
+	res, err := func() (*sip.Response, error) {
+		defer tx.Terminate()
+		for {
+			select {
+			case res := <-tx.Responses():
+				if res.IsProvisional() {
+					continue
+				}
+				return res, nil
+			case <-tx.Done():
+				return nil, tx.Err()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}()
+	if err != nil {
+		sub.finish(nil, err)
+		return nil, err
+	}
+
+	if !res.IsSuccess() {
+		err := &ErrDialogResponse{Res: res}
+		sub.finish(nil, err)
+		return nil, err
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc4488#section-4
+	// Subscription is not created only if transferee confirms it with Refer-Sub: false
+	if h := res.GetHeader("Refer-Sub"); h != nil && strings.EqualFold(h.Value(), "false") {
+		sub.finish(nil, nil)
+	}
+	return sub, nil
+}
+
+// readNotify handles NOTIFY of implicit subscription
+func (r *referSubscriptions) readNotify(req *sip.Request, tx sip.ServerTransaction) error {
+	ev := req.Event()
+	if ev == nil || ev.Event != "refer" {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadEvent, "Bad Event", nil)
+		res.AppendHeader(&sip.AllowEventsHeader{"refer"})
+		return errors.Join(ErrSubscriptionBadEvent, tx.Respond(res))
+	}
+
+	sub := r.match(ev.ID())
+	if sub == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return errors.Join(ErrDialogDoesNotExists, tx.Respond(res))
+	}
+
+	state := req.SubscriptionState()
+	if state == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - missing Subscription-State", nil)
+		return errors.Join(fmt.Errorf("no Subscription-State header"), tx.Respond(res))
+	}
+
+	var frag *sip.Response
+	if body := req.Body(); len(body) > 0 {
+		var err error
+		frag, err = parseSipFrag(body)
+		if err != nil {
+			res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request", nil)
+			return errors.Join(err, tx.Respond(res))
+		}
+	}
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	if err := tx.Respond(res); err != nil {
+		return err
+	}
+
+	sub.notify(frag, state)
+	return nil
+}
+
+// match finds subscription by event id. First REFER in dialog can be notified without id
+// https://datatracker.ietf.org/doc/html/rfc3515#section-2.4.6
+func (r *referSubscriptions) match(id string) *ReferSubscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id != "" {
+		cseq, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil
+		}
+		return r.subs[uint32(cseq)]
+	}
+
+	var first *ReferSubscription
+	for _, sub := range r.subs {
+		if first == nil || sub.ID < first.ID {
+			first = sub
+		}
+	}
+	return first
+}
+
+// ReferNotifier is transferee side of REFER. It reports transfer progress
+// to transferor with NOTIFY within dialog where REFER is received
+type ReferNotifier struct {
+	// Refer is received REFER request
+	Refer *sip.Request
+	// ReferTo is target where transfer should be done
+	ReferTo *sip.ReferToHeader
+
+	d     referDialog
+	id    uint32
+	noSub bool
+
+	mu         sync.Mutex
+	terminated bool
+}
+
+// readRefer accepts REFER with 202 and sends initial NOTIFY
+func readRefer(d referDialog, req *sip.Request, tx sip.ServerTransaction) (*ReferNotifier, error) {
+	// https://datatracker.ietf.org/doc/html/rfc3515#section-2.4.1
+	// REFER request MUST contain exactly one Refer-To header field value
+	if len(req.GetHeaders("Refer-To")) != 1 || req.ReferTo() == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - invalid Refer-To", nil)
+		return nil, errors.Join(ErrDialogReferNoReferTo, tx.Respond(res))
+	}
+
+	n := &ReferNotifier{
+		Refer:   req,
+		ReferTo: req.ReferTo(),
+		d:       d,
+		id:      req.CSeq().SeqNo,
+	}
+	if h := req.GetHeader("Refer-Sub"); h != nil && strings.EqualFold(h.Value(), "false") {
+		n.noSub = true
+	}
+
+	res := sip.NewResponseFromRequest(req, sip.StatusAccepted, "Accepted", nil)
+	if n.noSub {
+		res.AppendHeader(sip.NewHeader("Refer-Sub", "false"))
+	}
+	if err := tx.Respond(res); err != nil {
+		return nil, err
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc3515#section-2.4.4
+	// NOTIFY MUST be sent immediately to establish subscription
+	return n, n.Notify(d.Context(), sip.StatusTrying, "Trying")
+}
+
+// Notify reports transfer progress with status line of response received from transfer target.
+// Final status terminates subscription. It does nothing if REFER was received with Refer-Sub: false
+func (n *ReferNotifier) Notify(ctx context.Context, statusCode int, reason string) error {
+	if n.noSub {
+		return nil
+	}
+
+	final := statusCode >= 200
+	n.mu.Lock()
+	if n.terminated {
+		n.mu.Unlock()
+		return fmt.Errorf("refer subscription terminated")
+	}
+	n.terminated = final
+	n.mu.Unlock()
+
+	req := sip.NewRequest(sip.NOTIFY, n.d.remoteTarget())
+	req.AppendHeader(&sip.EventHeader{Event: "refer", Params: sip.HeaderParams{{K: "id", V: strconv.FormatUint(uint64(n.id), 10)}}})
+	state := &sip.SubscriptionStateHeader{State: sip.SubscriptionStateActive, Params: sip.NewParams()}
+	if final {
+		state.State = sip.SubscriptionStateTerminated
+		state.Params.Add("reason", sip.SubscriptionReasonNoresource)
+	} else {
+		state.Params.Add("expires", strconv.Itoa(int(referSubscriptionExpires.Seconds())))
+	}
+	req.AppendHeader(state)
+	req.AppendHeader(sip.NewHeader("Content-Type", "message/sipfrag;version=2.0"))
+	req.SetBody([]byte(sip.NewResponse(statusCode, reason).StartLine() + "\r\n"))
+
+	res, err := n.d.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !res.IsSuccess() {
+		return &ErrDialogResponse{Res: res}
+	}
+	return nil
+}
+
+// Follow sends INVITE to Refer-To target and reports every response back to transferor.
+// Headers embedded in Refer-To URI like Replaces are added to INVITE and Referred-By is copied.
+// Dialog is returned once answered and caller must Ack it as with any other INVITE.
+func (n *ReferNotifier) Follow(ctx context.Context, ua *DialogUA, opts AnswerOptions) (*DialogClientSession, error) {
+	req := newReferInviteRequest(n.Refer, n.ReferTo)
+	log := ua.Client.log
+
+	d, err := ua.WriteInvite(ctx, req)
+	if err != nil {
+		if err := n.Notify(context.WithoutCancel(ctx), sip.StatusServiceUnavailable, "Service Unavailable"); err != nil {
+			log.Info("Failed to notify REFER progress", "error", err)
+		}
+		return nil, err
+	}
+
+	onResponse := opts.OnResponse
+	opts.OnResponse = func(res *sip.Response) error {
+		if res.IsProvisional() && res.StatusCode != sip.StatusTrying {
+			if err := n.Notify(ctx, res.StatusCode, res.Reason); err != nil {
+				log.Info("Failed to notify REFER progress", "error", err)
+			}
+		}
+		if onResponse != nil {
+			return onResponse(res)
+		}
+		return nil
+	}
+
+	err = d.WaitAnswer(ctx, opts)
+	var statusCode int
+	var reason string
+	var errRes *ErrDialogResponse
+	switch {
+	case err == nil:
+		statusCode, reason = d.InviteResponse.StatusCode, d.InviteResponse.Reason
+	case errors.As(err, &errRes):
+		statusCode, reason = errRes.Res.StatusCode, errRes.Res.Reason
+	case errors.Is(err, context.Canceled):
+		statusCode, reason = sip.StatusRequestTerminated, "Request Terminated"
+	default:
+		statusCode, reason = sip.StatusServiceUnavailable, "Service Unavailable"
+	}
+
+	// Context may be canceled but transferor still needs final result
+	if err := n.Notify(context.WithoutCancel(ctx), statusCode, reason); err != nil {
+		log.Info("Failed to notify REFER result", "error", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// newReferInviteRequest creates INVITE to Refer-To target
+// https://datatracker.ietf.org/doc/html/rfc3515#section-2.4.3
+func newReferInviteRequest(refer *sip.Request, referTo *sip.ReferToHeader) *sip.Request {
+	recipient := referTo.Address.Clone()
+	recipient.Headers = nil
+	req := sip.NewRequest(sip.INVITE, *recipient)
+	if recipient.UriParams != nil {
+		if tran, _ := recipient.UriParams.Get("transport"); tran != "" {
+			req.SetTransport(tran)
+		}
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc3261#section-19.1.5
+	// Headers that are built by dialog are ignored
+	for _, kv := range referTo.Address.Headers {
+		switch strings.ToLower(kv.K) {
+		case "from", "to", "call-id", "cseq", "via", "route", "record-route", "contact", "max-forwards", "content-length":
+			continue
+		}
+		val, err := url.PathUnescape(kv.V)
+		if err != nil {
+			continue
+		}
+		req.AppendHeader(sip.NewHeader(kv.K, val))
+	}
+
+	if h := refer.ReferredBy(); h != nil {
+		req.AppendHeader(sip.HeaderClone(h))
+	}
+	return req
+}
+
+// referToReplaces adds Replaces header to target URI. Tags are from perspective of UA
+// that receives INVITE with Replaces
+// https://datatracker.ietf.org/doc/html/rfc3891#section-6.1
+func referToReplaces(target sip.Uri, callID string, toTag string, fromTag string) sip.Uri {
+	replaces := sip.ReplacesHeader{CallID: callID, ToTag: toTag, FromTag: fromTag}
+	uri := target.Clone()
+	uri.Headers = sip.HeaderParams{{K: replaces.Name(), V: strings.ReplaceAll(url.QueryEscape(replaces.Value()), "+", "%20")}}
+	return *uri
+}
+
+// parseSipFrag parses status line of message/sipfrag body
+func parseSipFrag(body []byte) (*sip.Response, error) {
+	line, _, _ := strings.Cut(string(body), "\n")
+	line = strings.TrimSpace(line)
+
+	version, rest, _ := strings.Cut(line, " ")
+	code, reason, _ := strings.Cut(rest, " ")
+	if !strings.HasPrefix(version, "SIP/") {
+		return nil, ErrDialogReferNoSipFrag
+	}
+	statusCode, err := strconv.Atoi(code)
+	if err != nil || statusCode < 100 || statusCode > 699 {
+		return nil, ErrDialogReferNoSipFrag
+	}
+
+	res := sip.NewResponse(statusCode, reason)
+	res.SipVersion = version
+	return res, nil
+}
+
+func (s *DialogClientSession) remoteTarget() sip.Uri {
+	if s.InviteResponse != nil {
+		if cont := s.InviteResponse.Contact(); cont != nil {
+			return *cont.Address.Clone()
+		}
+	}
+	return *s.InviteRequest.Recipient.Clone()
+}
+
+// Refer sends REFER within dialog for transfering remote party to referTo target.
+// For attended transfer use ReferToReplaces of dialog that should be replaced as referTo.
+// Returned subscription is used for tracking transfer progress. NOTIFY must be passed with ReadNotify
+func (s *DialogClientSession) Refer(ctx context.Context, referTo sip.Uri, opts ReferOptions) (*ReferSubscription, error) {
+	return s.refers.refer(ctx, s, referTo, opts)
+}
+
+// ReferToReplaces returns remote target of this dialog with Replaces header.
+// It is used as Refer-To for attended transfer where this dialog is replaced
+func (s *DialogClientSession) ReferToReplaces() sip.Uri {
+	localTag, _ := s.InviteRequest.From().Params.Get("tag")
+	remoteTag, _ := s.InviteResponse.To().Params.Get("tag")
+	return referToReplaces(s.remoteTarget(), s.InviteRequest.CallID().Value(), remoteTag, localTag)
+}
+
+// ReadRefer accepts REFER with 202 Accepted and returns ReferNotifier for following transfer
+func (s *DialogClientSession) ReadRefer(req *sip.Request, tx sip.ServerTransaction) (*ReferNotifier, error) {
+	return readRefer(s, req, tx)
+}
+
+// ReadNotify should be called from your OnNotify handler for NOTIFY of REFER sent within dialog
+func (s *DialogClientSession) ReadNotify(req *sip.Request, tx sip.ServerTransaction) error {
+	return s.refers.readNotify(req, tx)
+}
+
+func (s *DialogServerSession) remoteTarget() sip.Uri {
+	if cont := s.InviteRequest.Contact(); cont != nil {
+		return *cont.Address.Clone()
+	}
+	return *s.InviteRequest.Recipient.Clone()
+}
+
+// Refer sends REFER within dialog for transfering remote party to referTo target.
+// For attended transfer use ReferToReplaces of dialog that should be replaced as referTo.
+// Returned subscription is used for tracking transfer progress. NOTIFY must be passed with ReadNotify
+func (s *DialogServerSession) Refer(ctx context.Context, referTo sip.Uri, opts ReferOptions) (*ReferSubscription, error) {
+	return s.refers.refer(ctx, s, referTo, opts)
+}
+
+// ReferToReplaces returns remote target of this dialog with Replaces header.
+// It is used as Refer-To for attended transfer where this dialog is replaced
+func (s *DialogServerSession) ReferToReplaces() sip.Uri {
+	localTag, _ := s.InviteRequest.To().Params.Get("tag")
+	remoteTag, _ := s.InviteRequest.From().Params.Get("tag")
+	return referToReplaces(s.remoteTarget(), s.InviteRequest.CallID().Value(), remoteTag, localTag)
+}
+
+// ReadRefer accepts REFER with 202 Accepted and returns ReferNotifier for following transfer
+func (s *DialogServerSession) ReadRefer(req *sip.Request, tx sip.ServerTransaction) (*ReferNotifier, error) {
+	return readRefer(s, req, tx)
+}
+
+// ReadNotify should be called from your OnNotify handler for NOTIFY of REFER sent within dialog
+func (s *DialogServerSession) ReadNotify(req *sip.Request, tx sip.ServerTransaction) error {
+	return s.refers.readNotify(req, tx)
+}
+
+// ReadRefer should read from your OnRefer handler
+func (s *DialogServerCache) ReadRefer(req *sip.Request, tx sip.ServerTransaction) (*ReferNotifier, error) {
+	dt, err := s.MatchDialogRequest(req)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return nil, errors.Join(err, tx.Respond(res))
+	}
+	return dt.ReadRefer(req, tx)
+}
+
+// ReadNotify should read from your OnNotify handler
+func (s *DialogServerCache) ReadNotify(req *sip.Request, tx sip.ServerTransaction) error {
+	dt, err := s.MatchDialogRequest(req)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return errors.Join(err, tx.Respond(res))
+	}
+	return dt.ReadNotify(req, tx)
+}
+
+// ReadRefer should read from your OnRefer handler
+func (c *DialogClientCache) ReadRefer(req *sip.Request, tx sip.ServerTransaction) (*ReferNotifier, error) {
+	dt, err := c.MatchRequestDialog(req)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return nil, errors.Join(err, tx.Respond(res))
+	}
+	return dt.ReadRefer(req, tx)
+}
+
+// ReadNotify should read from your OnNotify handler
+func (c *DialogClientCache) ReadNotify(req *sip.Request, tx sip.ServerTransaction) error {
+	dt, err := c.MatchRequestDialog(req)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return errors.Join(err, tx.Respond(res))
+	}
+	return dt.ReadNotify(req, tx)
+}
@@ -0,0 +1,230 @@
+package sipgo
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReferDialogs creates confirmed dialog where transferor is UAS and transferee is UAC
+func testReferDialogs(t *testing.T, transferor *Client, transferee *Client) (*DialogServerSession, *DialogClientSession) {
+	invite, _, _ := createTestInvite(t, "sip:transferor@127.0.0.1", "udp", "127.0.0.2:5060")
+	invite.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "transferee", Host: "127.0.0.2", Port: 5060}})
+	invite.To().Params.Add("tag", "transferor")
+
+	res := sip.NewResponseFromRequest(invite, sip.StatusOK, "OK", nil)
+	res.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "transferor", Host: "127.0.0.1", Port: 5060}})
+	id, err := sip.DialogIDFromResponse(res)
+	require.NoError(t, err)
+
+	uas := &DialogServerSession{
+		Dialog: Dialog{ID: id, InviteRequest: invite, InviteResponse: res},
+		ua:     &DialogUA{Client: transferor, ContactHDR: *res.Contact()},
+	}
+	uas.InitWithState(sip.DialogStateConfirmed)
+
+	uac := &DialogClientSession{
+		Dialog: Dialog{ID: id, InviteRequest: invite, InviteResponse: res},
+		UA:     &DialogUA{Client: transferee, ContactHDR: *invite.Contact()},
+	}
+	uac.InitWithState(sip.DialogStateConfirmed)
+	return uas, uac
+}
+
+func TestDialogRefer(t *testing.T) {
+	var transferor *DialogServerSession
+	var transferee *DialogClientSession
+	refers := make(chan *ReferNotifier, 1)
+
+	transferorClient := testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+		require.Equal(t, sip.REFER, req.Method)
+		n, err := transferee.ReadRefer(req, &respondTx{siptest.NewServerTxRecorder(req), w})
+		require.NoError(t, err)
+		refers <- n
+	})
+	transfereeClient := testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+		require.Equal(t, sip.NOTIFY, req.Method)
+		assert.Equal(t, "message/sipfrag;version=2.0", req.ContentType().Value())
+		require.NoError(t, transferor.ReadNotify(req, &respondTx{siptest.NewServerTxRecorder(req), w}))
+	})
+	transferor, transferee = testReferDialogs(t, transferorClient, transfereeClient)
+
+	// Dialog with transfer target which will be replaced
+	target := &DialogClientSession{
+		Dialog: Dialog{
+			InviteRequest: sip.NewRequest(sip.INVITE, sip.Uri{User: "target", Host: "127.0.0.3"}),
+		},
+	}
+	target.InviteRequest.AppendHeader(&sip.FromHeader{Address: sip.Uri{User: "transferor", Host: "127.0.0.1"}, Params: sip.HeaderParams{{K: "tag", V: "local"}}})
+	target.InviteRequest.AppendHeader(sip.NewHeader("Call-ID", "target@127.0.0.1"))
+	target.InviteResponse = sip.NewResponseFromRequest(target.InviteRequest, sip.StatusOK, "OK", nil)
+	target.InviteResponse.AppendHeader(&sip.ToHeader{Address: sip.Uri{User: "target", Host: "127.0.0.3"}, Params: sip.HeaderParams{{K: "tag", V: "remote"}}})
+	target.InviteResponse.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "target", Host: "127.0.0.3", Port: 5060}})
+
+	referTo := target.ReferToReplaces()
+	assert.Equal(t, "sip:target@127.0.0.3:5060?Replaces=target%40127.0.0.1%3Bto-tag%3Dremote%3Bfrom-tag%3Dlocal", referTo.String())
+
+	var mu sync.Mutex
+	var frags []int
+	sub, err := transferor.Refer(context.TODO(), referTo, ReferOptions{
+		ReferredBy: &sip.ReferredByHeader{Address: sip.Uri{User: "transferor", Host: "127.0.0.1"}},
+		OnNotify: func(frag *sip.Response) {
+			mu.Lock()
+			frags = append(frags, frag.StatusCode)
+			mu.Unlock()
+		},
+	})
+	require.NoError(t, err)
+	n := <-refers
+	assert.Equal(t, sub.ID, n.Refer.CSeq().SeqNo)
+
+	invites := make(chan *sip.Request, 1)
+	ua := &DialogUA{
+		Client: testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+			if req.IsAck() {
+				return
+			}
+			invites <- req
+			ringing := sip.NewResponseFromRequest(req, sip.StatusRinging, "Ringing", nil)
+			ringing.To().Params.Add("tag", "target")
+			w.Receive(ringing)
+			res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+			res.ReplaceHeader(ringing.To())
+			res.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "target", Host: "127.0.0.3"}})
+			w.Receive(res)
+		}),
+		ContactHDR: sip.ContactHeader{Address: sip.Uri{User: "transferee", Host: "127.0.0.2", Port: 5060}},
+	}
+	d, err := n.Follow(context.TODO(), ua, AnswerOptions{})
+	require.NoError(t, err)
+	require.NoError(t, d.Ack(context.TODO()))
+
+	invite := <-invites
+	assert.Equal(t, "sip:target@127.0.0.3:5060", invite.Recipient.String())
+	assert.Equal(t, "target@127.0.0.1;to-tag=remote;from-tag=local", invite.GetHeader("Replaces").Value())
+	assert.Equal(t, "<sip:transferor@127.0.0.1>", invite.ReferredBy().Value())
+
+	final, err := sub.Wait(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusOK, final.StatusCode)
+	mu.Lock()
+	assert.Equal(t, []int{sip.StatusTrying, sip.StatusRinging, sip.StatusOK}, frags)
+	mu.Unlock()
+
+	// Subscription is terminated with final NOTIFY
+	require.Error(t, n.Notify(context.TODO(), sip.StatusOK, "OK"))
+	assert.Nil(t, transferor.refers.match(""))
+}
+
+func TestDialogReferNoSubscription(t *testing.T) {
+	var transferee *DialogClientSession
+	transferorClient := testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+		assert.Equal(t, "false", req.GetHeader("Refer-Sub").Value())
+		n, err := transferee.ReadRefer(req, &respondTx{siptest.NewServerTxRecorder(req), w})
+		require.NoError(t, err)
+		// No NOTIFY is sent
+		require.NoError(t, n.Notify(context.TODO(), sip.StatusOK, "OK"))
+	})
+	transfereeClient := testClient(t, func(req *sip.Request) *sip.Response {
+		t.Errorf("unexpected request %s", req.Method)
+		return nil
+	})
+	transferor, td := testReferDialogs(t, transferorClient, transfereeClient)
+	transferee = td
+
+	sub, err := transferor.Refer(context.TODO(), sip.Uri{User: "target", Host: "127.0.0.3"}, ReferOptions{NoReferSub: true})
+	require.NoError(t, err)
+	final, err := sub.Wait(context.TODO())
+	require.NoError(t, err)
+	assert.Nil(t, final)
+}
+
+func TestDialogReferNotifyWhileSending(t *testing.T) {
+	var transferor *DialogServerSession
+	// NOTIFY can be read while REFER is still being sent
+	transferorClient := testClient(t, func(req *sip.Request) *sip.Response {
+		matched := make(chan *ReferSubscription)
+		go func() {
+			matched <- transferor.refers.match(strconv.FormatUint(uint64(req.CSeq().SeqNo), 10))
+		}()
+		select {
+		case sub := <-matched:
+			assert.NotNil(t, sub)
+		case <-time.After(time.Second):
+			t.Error("subscription is locked while sending REFER")
+		}
+		return sip.NewResponseFromRequest(req, sip.StatusAccepted, "Accepted", nil)
+	})
+	transfereeClient := testClient(t, func(req *sip.Request) *sip.Response {
+		t.Errorf("unexpected request %s", req.Method)
+		return nil
+	})
+	transferor, _ = testReferDialogs(t, transferorClient, transfereeClient)
+
+	sub, err := transferor.Refer(context.TODO(), sip.Uri{User: "target", Host: "127.0.0.3"}, ReferOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, sub, transferor.refers.match(""))
+}
+
+func TestDialogReadReferNotify(t *testing.T) {
+	transferor, transferee := testReferDialogs(t, testClient(t, nil), testClient(t, func(req *sip.Request) *sip.Response {
+		return sip.NewResponseFromRequest(req, sip.StatusAccepted, "Accepted", nil)
+	}))
+
+	sub, err := transferee.Refer(context.TODO(), sip.Uri{User: "target", Host: "127.0.0.3"}, ReferOptions{})
+	require.NoError(t, err)
+
+	newNotify := func(event string, state string, body string) (*sip.Request, *siptest.ServerTxRecorder) {
+		req := sip.NewRequest(sip.NOTIFY, sip.Uri{User: "transferee", Host: "127.0.0.2"})
+		req.AppendHeader(sip.NewHeader("Via", "SIP/2.0/UDP 127.0.0.1:5060;branch="+sip.GenerateBranch()))
+		req.AppendHeader(sip.NewHeader("Event", event))
+		req.AppendHeader(sip.NewHeader("Subscription-State", state))
+		req.AppendHeader(sip.NewHeader("CSeq", "1 NOTIFY"))
+		req.SetBody([]byte(body))
+		return req, siptest.NewServerTxRecorder(req)
+	}
+
+	t.Run("BadEvent", func(t *testing.T) {
+		req, tx := newNotify("presence", "active", "")
+		require.ErrorIs(t, transferee.ReadNotify(req, tx), ErrSubscriptionBadEvent)
+		assert.Equal(t, sip.StatusBadEvent, tx.Result()[0].StatusCode)
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		req, tx := newNotify("refer;id=1000", "active", "SIP/2.0 100 Trying\r\n")
+		require.ErrorIs(t, transferee.ReadNotify(req, tx), ErrDialogDoesNotExists)
+		assert.Equal(t, sip.StatusCallTransactionDoesNotExists, tx.Result()[0].StatusCode)
+	})
+
+	t.Run("BadSipFrag", func(t *testing.T) {
+		req, tx := newNotify("refer", "active", "100 Trying")
+		require.ErrorIs(t, transferee.ReadNotify(req, tx), ErrDialogReferNoSipFrag)
+		assert.Equal(t, sip.StatusBadRequest, tx.Result()[0].StatusCode)
+	})
+
+	t.Run("Terminated", func(t *testing.T) {
+		req, tx := newNotify("refer", "terminated;reason=noresource", "SIP/2.0 180 Ringing\r\n")
+		require.NoError(t, transferee.ReadNotify(req, tx))
+		assert.Equal(t, sip.StatusOK, tx.Result()[0].StatusCode)
+
+		_, err := sub.Wait(context.TODO())
+		assert.Equal(t, ErrSubscriptionTerminated{Reason: sip.SubscriptionReasonNoresource}, err)
+	})
+
+	t.Run("ReadReferNoReferTo", func(t *testing.T) {
+		req := sip.NewRequest(sip.REFER, sip.Uri{User: "transferor", Host: "127.0.0.1"})
+		req.AppendHeader(sip.NewHeader("Via", "SIP/2.0/UDP 127.0.0.2:5060;branch="+sip.GenerateBranch()))
+		req.AppendHeader(sip.NewHeader("CSeq", "2 REFER"))
+		tx := siptest.NewServerTxRecorder(req)
+		_, err := transferor.ReadRefer(req, tx)
+		require.ErrorIs(t, err, ErrDialogReferNoReferTo)
+		assert.Equal(t, sip.StatusBadRequest, tx.Result()[0].StatusCode)
+	})
+}
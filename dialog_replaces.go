@@ -0,0 +1,144 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	ErrDialogReplaced             = errors.New("dialog replaced")
+	ErrDialogReplacesInvalid      = errors.New("invalid Replaces header")
+	ErrDialogReplacesTerminated   = errors.New("replaced dialog is terminated")
+	ErrDialogReplacesNotEarlyOnly = errors.New("replaced dialog is not early dialog")
+	ErrDialogReplacesInProgress   = errors.New("replaced dialog is already replaced by other INVITE")
+)
+
+// readReplaces checks can dialog be replaced and responds to INVITE in case it can not.
+// UAS early dialog can not be replaced as it was not initiated by this UA
+// https://datatracker.ietf.org/doc/html/rfc3891#section-3
+// Dialog is claimed by first accepted INVITE and any other INVITE replacing same dialog is rejected with 486
+func readReplaces(d *Dialog, uas bool, replaces *sip.ReplacesHeader, req *sip.Request, tx sip.ServerTransaction) error {
+	state := d.LoadState()
+
+	var res *sip.Response
+	var err error
+	switch {
+	case state == sip.DialogStateEnded || d.replaced.Load():
+		res = sip.NewResponseFromRequest(req, sip.StatusGlobalDecline, "Decline", nil)
+		err = ErrDialogReplacesTerminated
+	case state < sip.DialogStateEstablished && uas:
+		res = sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		err = ErrDialogDoesNotExists
+	case state >= sip.DialogStateEstablished && replaces.EarlyOnly:
+		res = sip.NewResponseFromRequest(req, sip.StatusBusyHere, "Busy Here", nil)
+		err = ErrDialogReplacesNotEarlyOnly
+	case !d.replacing.CompareAndSwap(false, true):
+		res = sip.NewResponseFromRequest(req, sip.StatusBusyHere, "Busy Here", nil)
+		err = ErrDialogReplacesInProgress
+	default:
+		return nil
+	}
+	return errors.Join(err, tx.Respond(res))
+}
+
+// replacesHeader reads Replaces header and responds with 400 if it is invalid
+func replacesHeader(req *sip.Request, tx sip.ServerTransaction) (*sip.ReplacesHeader, error) {
+	replaces := req.Replaces()
+	if replaces == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - invalid Replaces", nil)
+		return nil, errors.Join(ErrDialogReplacesInvalid, tx.Respond(res))
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc3891#section-3
+	// If more than one Replaces header field is present in an INVITE, the UAS MUST reject the request with a 400
+	if len(req.GetHeaders("Replaces")) > 1 {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - multiple Replaces", nil)
+		return nil, errors.Join(ErrDialogReplacesInvalid, tx.Respond(res))
+	}
+	return replaces, nil
+}
+
+// Replace terminates this dialog as it is replaced by new dialog created with INVITE with Replaces.
+// It should be called once new dialog is answered. Dialog context is canceled with ErrDialogReplaced cause
+// and BYE is sent. Dialog can be replaced only once, otherwise ErrDialogReplaced is returned
+func (s *DialogServerSession) Replace(ctx context.Context) error {
+	if !s.replaced.CompareAndSwap(false, true) {
+		return ErrDialogReplaced
+	}
+	s.cancel(ErrDialogReplaced)
+	defer s.Close()
+	return s.Bye(ctx)
+}
+
+// Replace terminates this dialog as it is replaced by new dialog created with INVITE with Replaces.
+// It should be called once new dialog is answered. Dialog context is canceled with ErrDialogReplaced cause.
+// Confirmed dialog is terminated with BYE and early dialog with CANCEL.
+// Dialog can be replaced only once, otherwise ErrDialogReplaced is returned
+func (s *DialogClientSession) Replace(ctx context.Context) error {
+	if !s.replaced.CompareAndSwap(false, true) {
+		return ErrDialogReplaced
+	}
+	s.cancel(ErrDialogReplaced)
+
+	if s.LoadState() < sip.DialogStateEstablished {
+		defer s.Close()
+		res, err := s.Do(ctx, newCancelRequest(s.InviteRequest))
+		if err != nil {
+			return err
+		}
+		if !res.IsSuccess() {
+			return fmt.Errorf("cancel failed with non 200. code=%d", res.StatusCode)
+		}
+		return nil
+	}
+	return s.Bye(ctx)
+}
+
+// ReadReplaces should be called from your OnInvite handler when INVITE has Replaces header.
+// It returns dialog which should be replaced once new dialog is answered with Replace.
+// If dialog does not exist, or it can not be replaced, INVITE is rejected with 481, 486 or 603 response.
+// Only first INVITE can replace dialog, others are rejected with 486 response
+func (s *DialogServerCache) ReadReplaces(req *sip.Request, tx sip.ServerTransaction) (*DialogServerSession, error) {
+	replaces, err := replacesHeader(req, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// UAS dialog id is built from local and remote tag
+	dt := s.loadDialog(sip.DialogIDMake(replaces.CallID, replaces.ToTag, replaces.FromTag))
+	if dt == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return nil, errors.Join(ErrDialogDoesNotExists, tx.Respond(res))
+	}
+
+	if err := readReplaces(&dt.Dialog, true, replaces, req, tx); err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// ReadReplaces should be called from your OnInvite handler when INVITE has Replaces header.
+// It returns dialog which should be replaced once new dialog is answered with Replace.
+// If dialog does not exist, or it can not be replaced, INVITE is rejected with 481, 486 or 603 response.
+// Only first INVITE can replace dialog, others are rejected with 486 response
+func (c *DialogClientCache) ReadReplaces(req *sip.Request, tx sip.ServerTransaction) (*DialogClientSession, error) {
+	replaces, err := replacesHeader(req, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// UAC dialog id is built from remote and local tag
+	dt := c.loadDialog(sip.DialogIDMake(replaces.CallID, replaces.FromTag, replaces.ToTag))
+	if dt == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return nil, errors.Join(ErrDialogDoesNotExists, tx.Respond(res))
+	}
+
+	if err := readReplaces(&dt.Dialog, false, replaces, req, tx); err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
@@ -0,0 +1,178 @@
+package sipgo
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testInviteReplaces(t *testing.T, replaces string) (*sip.Request, *siptest.ServerTxRecorder) {
+	invite, _, _ := createTestInvite(t, "sip:uas@127.0.0.1", "udp", "127.0.0.3:5060")
+	invite.AppendHeader(sip.NewHeader("Replaces", replaces))
+	return invite, siptest.NewServerTxRecorder(invite)
+}
+
+func TestDialogServerCacheReplaces(t *testing.T) {
+	byes := make(chan *sip.Request, 1)
+	cache := NewDialogServerCache(testClient(t, func(req *sip.Request) *sip.Response {
+		byes <- req
+		return sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	}), sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "127.0.0.1", Port: 5060}})
+
+	invite, callID, fromTag := createTestInvite(t, "sip:uas@127.0.0.1", "udp", "127.0.0.2:5060")
+	invite.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "uac", Host: "127.0.0.2", Port: 5060}})
+	dt, err := cache.ReadInvite(invite, siptest.NewServerTxRecorder(invite))
+	require.NoError(t, err)
+	toTag, _ := dt.InviteRequest.To().Params.Get("tag")
+	replaces := callID + ";to-tag=" + toTag + ";from-tag=" + fromTag
+
+	t.Run("EarlyUAS", func(t *testing.T) {
+		req, tx := testInviteReplaces(t, replaces)
+		_, err := cache.ReadReplaces(req, tx)
+		require.ErrorIs(t, err, ErrDialogDoesNotExists)
+		assert.Equal(t, sip.StatusCallTransactionDoesNotExists, tx.Result()[0].StatusCode)
+	})
+
+	dt.InviteResponse = sip.NewResponseFromRequest(dt.InviteRequest, sip.StatusOK, "OK", nil)
+	dt.setState(sip.DialogStateConfirmed)
+
+	t.Run("Invalid", func(t *testing.T) {
+		req, tx := testInviteReplaces(t, callID+";to-tag="+toTag)
+		_, err := cache.ReadReplaces(req, tx)
+		require.ErrorIs(t, err, ErrDialogReplacesInvalid)
+		assert.Equal(t, sip.StatusBadRequest, tx.Result()[0].StatusCode)
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		req, tx := testInviteReplaces(t, callID+";to-tag="+fromTag+";from-tag="+toTag)
+		_, err := cache.ReadReplaces(req, tx)
+		require.ErrorIs(t, err, ErrDialogDoesNotExists)
+		assert.Equal(t, sip.StatusCallTransactionDoesNotExists, tx.Result()[0].StatusCode)
+	})
+
+	t.Run("EarlyOnly", func(t *testing.T) {
+		req, tx := testInviteReplaces(t, replaces+";early-only")
+		_, err := cache.ReadReplaces(req, tx)
+		require.ErrorIs(t, err, ErrDialogReplacesNotEarlyOnly)
+		assert.Equal(t, sip.StatusBusyHere, tx.Result()[0].StatusCode)
+	})
+
+	// Only one of concurrent INVITEs replaces dialog
+	var wg sync.WaitGroup
+	results := make([]*siptest.ServerTxRecorder, 5)
+	replacedDialogs := make([]*DialogServerSession, len(results))
+	for i := range results {
+		req, tx := testInviteReplaces(t, replaces)
+		results[i] = tx
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replacedDialogs[i], _ = cache.ReadReplaces(req, tx)
+		}()
+	}
+	wg.Wait()
+
+	var replaced *DialogServerSession
+	for i, tx := range results {
+		if replacedDialogs[i] == nil {
+			assert.Equal(t, sip.StatusBusyHere, tx.Result()[0].StatusCode)
+			continue
+		}
+		require.Nil(t, replaced)
+		replaced = replacedDialogs[i]
+	}
+	require.Equal(t, dt, replaced)
+
+	req, tx := testInviteReplaces(t, replaces)
+	_, err = cache.ReadReplaces(req, tx)
+	require.ErrorIs(t, err, ErrDialogReplacesInProgress)
+	assert.Equal(t, sip.StatusBusyHere, tx.Result()[0].StatusCode)
+
+	require.NoError(t, replaced.Replace(context.TODO()))
+	bye := <-byes
+	assert.Equal(t, sip.BYE, bye.Method)
+	assert.ErrorIs(t, context.Cause(replaced.Context()), ErrDialogReplaced)
+	assert.Equal(t, sip.DialogStateEnded, replaced.LoadState())
+	require.ErrorIs(t, replaced.Replace(context.TODO()), ErrDialogReplaced)
+
+	// Replaced dialog is removed from cache
+	req, tx = testInviteReplaces(t, replaces)
+	_, err = cache.ReadReplaces(req, tx)
+	require.ErrorIs(t, err, ErrDialogDoesNotExists)
+}
+
+func TestDialogClientCacheReplaces(t *testing.T) {
+	requests := make(chan *sip.Request, 3)
+	client := testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+		requests <- req
+		if req.IsAck() {
+			return
+		}
+		res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		if req.IsInvite() {
+			res.To().Params.Add("tag", "remote")
+			res.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "127.0.0.2"}})
+		}
+		w.Receive(res)
+	})
+	cache := NewDialogClientCache(client, sip.ContactHeader{Address: sip.Uri{User: "uac", Host: "127.0.0.1", Port: 5060}})
+
+	dt, err := cache.Invite(context.TODO(), sip.Uri{User: "uas", Host: "127.0.0.2"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, dt.WaitAnswer(context.TODO(), AnswerOptions{}))
+	require.NoError(t, dt.Ack(context.TODO()))
+	<-requests
+	<-requests
+
+	localTag, _ := dt.InviteRequest.From().Params.Get("tag")
+	replaces := dt.InviteRequest.CallID().Value() + ";to-tag=" + localTag + ";from-tag=remote"
+
+	t.Run("EarlyOnly", func(t *testing.T) {
+		req, tx := testInviteReplaces(t, replaces+";early-only")
+		_, err := cache.ReadReplaces(req, tx)
+		require.ErrorIs(t, err, ErrDialogReplacesNotEarlyOnly)
+		assert.Equal(t, sip.StatusBusyHere, tx.Result()[0].StatusCode)
+	})
+
+	req, tx := testInviteReplaces(t, replaces)
+	replaced, err := cache.ReadReplaces(req, tx)
+	require.NoError(t, err)
+	require.Equal(t, dt, replaced)
+
+	require.NoError(t, replaced.Replace(context.TODO()))
+	assert.Equal(t, sip.BYE, (<-requests).Method)
+	assert.ErrorIs(t, context.Cause(replaced.Context()), ErrDialogReplaced)
+
+	req, tx = testInviteReplaces(t, replaces)
+	_, err = cache.ReadReplaces(req, tx)
+	require.ErrorIs(t, err, ErrDialogDoesNotExists)
+}
+
+func TestDialogClientReplaceEarly(t *testing.T) {
+	cancels := make(chan *sip.Request, 1)
+	ua := DialogUA{
+		Client: testClient(t, func(req *sip.Request) *sip.Response {
+			cancels <- req
+			return sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		}),
+	}
+
+	invite, _, _ := createTestInvite(t, "sip:uas@127.0.0.1", "udp", "127.0.0.2:5060")
+	dt := &DialogClientSession{
+		Dialog: Dialog{InviteRequest: invite},
+		UA:     &ua,
+	}
+	dt.Init()
+	dt.InviteResponse = sip.NewResponseFromRequest(invite, sip.StatusRinging, "Ringing", nil)
+
+	require.NoError(t, dt.Replace(context.TODO()))
+	cancel := <-cancels
+	assert.Equal(t, sip.CANCEL, cancel.Method)
+	assert.Equal(t, invite.CSeq().SeqNo, cancel.CSeq().SeqNo)
+	assert.ErrorIs(t, context.Cause(dt.Context()), ErrDialogReplaced)
+}
@@ -18,6 +18,16 @@ type DialogServerSession struct {
 	ua *DialogUA
 
 	onClose func()
+
+	sessTimer *sessionTimer
+
+	// reliable provisional responses RFC 3262
+	prackMu sync.Mutex
+	rseq    uint32
+	prack   *reliableResponse
+
+	// implicit subscriptions of sent REFER requests
+	refers referSubscriptions
 }
 
 // ReadAck changes dialog state to confiremed
@@ -61,6 +71,7 @@ func (s *DialogServerSession) Do(ctx context.Context, req *sip.Request) (*sip.Re
 			if res.IsProvisional() {
 				continue
 			}
+			s.sessionTimerUpdate(req, res)
 			return res, nil
 
 		case <-tx.Done():
@@ -77,6 +88,11 @@ func (s *DialogServerSession) Do(ctx context.Context, req *sip.Request) (*sip.Re
 // This ensures that you have proper request done within dialog
 func (s *DialogServerSession) TransactionRequest(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
 	s.buildReq(req)
+	return s.transactionRequest(ctx, req)
+}
+
+// transactionRequest sends request already built with buildReq
+func (s *DialogServerSession) transactionRequest(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
 	// Passing option to avoid CSEQ apply
 	return s.ua.Client.TransactionRequest(ctx, req, func(c *Client, req *sip.Request) error {
 		if req.Via() == nil {
@@ -278,6 +294,9 @@ func (s *DialogServerSession) WriteResponse(res *sip.Response) error {
 
 	if !res.IsSuccess() {
 		if res.IsProvisional() {
+			if s.reliableProvisional(res) {
+				return s.writeReliableProvisional(res)
+			}
 			// This will not create dialog so we will just respond
 			return tx.Respond(res)
 		}
@@ -306,6 +325,16 @@ func (s *DialogServerSession) WriteResponse(res *sip.Response) error {
 		return fmt.Errorf("ID do not match. Invite request has changed headers?")
 	}
 
+	// 2xx is not sent until reliable provisional responses are acknowledged
+	if err := s.waitPrack(); err != nil {
+		return err
+	}
+
+	if s.sessTimer != nil {
+		interval, refresher := sessionTimerUAS(s.InviteRequest, res, s.sessTimer.opts)
+		defer s.sessTimer.reset(interval, refresher)
+	}
+
 	s.setState(sip.DialogStateEstablished)
 
 	// Register dialog state read channel before transmitting 200 OK. This prevents a race
@@ -320,7 +349,8 @@ func (s *DialogServerSession) WriteResponse(res *sip.Response) error {
 	// https://datatracker.ietf.org/doc/html/rfc3261#section-13.3.1.4
 
 	// We are following RFC 6026, which states that this is TU thing and not Transaction layer.
-	timer := time.NewTimer(sip.T1)
+	timers := s.ua.Client.timers()
+	timer := time.NewTimer(timers.T1)
 	defer timer.Stop()
 
 	state := sip.DialogStateEstablished
@@ -334,9 +364,9 @@ func (s *DialogServerSession) WriteResponse(res *sip.Response) error {
 			//    interval that starts at T1 seconds and doubles for each
 			//    retransmission until it reaches T2 seconds (T1 and T2 are defined in
 			//    Section 17).
-			timer.Reset(max(2*sip.T1, sip.T2))
+			timer.Reset(max(2*timers.T1, timers.T2))
 
-		case <-time.After(64 * sip.T1):
+		case <-time.After(64 * timers.T1):
 			// If the server retransmits the 2xx response for 64*T1 seconds without
 			// receiving an ACK, the dialog is confirmed, but the session SHOULD be
 			// terminated.  This is accomplished with a BYE, as described in Section
@@ -389,7 +419,7 @@ func (s *DialogServerSession) WriteBye(ctx context.Context, bye *sip.Request) er
 			select {
 			case <-s.inviteTx.Done():
 				// Wait until we timeout
-			case <-time.After(sip.T1):
+			case <-time.After(s.ua.Client.timers().T1):
 				// Recheck state
 				continue
 			case <-ctx.Done():
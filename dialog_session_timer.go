@@ -0,0 +1,506 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	ErrDialogSessionExpired          = errors.New("session expired")
+	ErrDialogSessionIntervalTooSmall = errors.New("session interval too small")
+)
+
+const (
+	// SessionTimerMinSE is lowest allowed Min-SE
+	// https://datatracker.ietf.org/doc/html/rfc4028#section-4
+	SessionTimerMinSE = 90 * time.Second
+)
+
+// SessionTimerOptions enables session timers on dialog
+// https://datatracker.ietf.org/doc/html/rfc4028
+type SessionTimerOptions struct {
+	// Interval is session interval we request or grant. Default 1800s
+	Interval time.Duration
+	// MinSE is smallest session interval we accept. Default 90s
+	MinSE time.Duration
+	// RefreshMethod is sip.UPDATE or sip.INVITE used for refreshing.
+	// Default is UPDATE if remote allows it, otherwise INVITE
+	RefreshMethod sip.RequestMethod
+}
+
+func (o SessionTimerOptions) normalize() SessionTimerOptions {
+	if o.MinSE < SessionTimerMinSE {
+		o.MinSE = SessionTimerMinSE
+	}
+	if o.Interval <= 0 {
+		o.Interval = 1800 * time.Second
+	}
+	if o.Interval < o.MinSE {
+		o.Interval = o.MinSE
+	}
+	return o
+}
+
+// sessionTimer keeps session alive by refreshing or terminates session
+// when refresh is not received in time
+type sessionTimer struct {
+	opts SessionTimerOptions
+
+	// refresh sends refresh request within dialog
+	refresh func(ctx context.Context, interval time.Duration) error
+	// expire terminates dialog
+	expire func()
+
+	mu        sync.Mutex
+	interval  time.Duration
+	refresher bool
+	expiresAt time.Time
+	timer     *time.Timer
+	gen       uint64
+	stopped   bool
+}
+
+func newSessionTimer(opts SessionTimerOptions) *sessionTimer {
+	opts = opts.normalize()
+	return &sessionTimer{
+		opts:     opts,
+		interval: opts.Interval,
+	}
+}
+
+// Interval returns current session interval
+func (t *sessionTimer) Interval() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interval
+}
+
+// Refresher returns true if we are responsible for refreshing session
+func (t *sessionTimer) Refresher() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.refresher
+}
+
+// reset starts session interval again. Zero interval stops timer as session has no expiration
+func (t *sessionTimer) reset(interval time.Duration, refresher bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+
+	t.gen++
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.interval = interval
+	t.refresher = refresher
+	if interval <= 0 {
+		return
+	}
+
+	t.expiresAt = time.Now().Add(interval)
+	gen := t.gen
+	if refresher {
+		t.timer = time.AfterFunc(interval/2, func() { t.onRefresh(gen) })
+		return
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc4028#section-10
+	// BYE is sent before session expiration, at interval - min(32, interval/3)
+	t.timer = time.AfterFunc(interval-min(32*time.Second, interval/3), func() { t.onExpire(gen) })
+}
+
+func (t *sessionTimer) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	t.gen++
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+func (t *sessionTimer) onRefresh(gen uint64) {
+	t.mu.Lock()
+	if t.gen != gen {
+		t.mu.Unlock()
+		return
+	}
+	interval, expiresAt := t.interval, t.expiresAt
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithDeadline(context.Background(), expiresAt)
+	defer cancel()
+	err := t.refresh(ctx, interval)
+	if err == nil {
+		return
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc4028#section-10
+	// 408 or 481 on refresh terminates session
+	var errRes *ErrDialogResponse
+	if !errors.As(err, &errRes) || errRes.Res.StatusCode == sip.StatusRequestTimeout || errRes.Res.StatusCode == sip.StatusCallTransactionDoesNotExists {
+		t.onExpire(gen)
+		return
+	}
+
+	// Retry until session expires
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.gen != gen {
+		return
+	}
+	retry := time.Until(t.expiresAt) / 2
+	if retry < time.Second {
+		t.timer = time.AfterFunc(time.Until(t.expiresAt), func() { t.onExpire(gen) })
+		return
+	}
+	t.timer = time.AfterFunc(retry, func() { t.onRefresh(gen) })
+}
+
+func (t *sessionTimer) onExpire(gen uint64) {
+	t.mu.Lock()
+	if t.gen != gen || t.stopped {
+		t.mu.Unlock()
+		return
+	}
+	t.stopped = true
+	t.mu.Unlock()
+	t.expire()
+}
+
+// sessionTimerRequestApply adds session timer headers on request if not present
+func sessionTimerRequestApply(req *sip.Request, opts SessionTimerOptions, interval time.Duration, refresher string) {
+	addOptionTag(req, "Supported", "timer")
+	if req.SessionExpires() == nil {
+		se := &sip.SessionExpiresHeader{Delta: uint32(interval.Seconds())}
+		if refresher != "" {
+			se.Params = sip.HeaderParams{{K: "refresher", V: refresher}}
+		}
+		req.AppendHeader(se)
+	}
+	if req.MinSE() == nil && opts.MinSE > SessionTimerMinSE {
+		minse := sip.MinSEHeader(opts.MinSE.Seconds())
+		req.AppendHeader(&minse)
+	}
+}
+
+// sessionTimerUAC reads negotiated session interval from 2xx response on our request.
+// Zero interval means no session expiration
+// https://datatracker.ietf.org/doc/html/rfc4028#section-7.2
+func sessionTimerUAC(res *sip.Response) (interval time.Duration, refresher bool) {
+	se := res.SessionExpires()
+	if se == nil {
+		return 0, false
+	}
+	// UAS must set refresher, in case it does not we will refresh
+	return time.Duration(se.Delta) * time.Second, se.Refresher() != "uas"
+}
+
+// sessionTimerUASCheck validates requested session interval. On too small interval
+// 422 response is returned which should be sent
+// https://datatracker.ietf.org/doc/html/rfc4028#section-8
+func sessionTimerUASCheck(req *sip.Request, opts SessionTimerOptions) *sip.Response {
+	se := req.SessionExpires()
+	if se == nil || time.Duration(se.Delta)*time.Second >= opts.MinSE {
+		return nil
+	}
+	res := sip.NewResponseFromRequest(req, sip.StatusSessionIntervalTooSmall, "Session Interval Too Small", nil)
+	minse := sip.MinSEHeader(opts.MinSE.Seconds())
+	res.AppendHeader(&minse)
+	return res
+}
+
+// sessionTimerUAS negotiates session interval for request and applies
+// Session-Expires and Require headers on 2xx response.
+// https://datatracker.ietf.org/doc/html/rfc4028#section-9
+func sessionTimerUAS(req *sip.Request, res *sip.Response, opts SessionTimerOptions) (interval time.Duration, refresher bool) {
+	interval = opts.Interval
+	minSE := opts.MinSE
+	if h := req.MinSE(); h != nil {
+		minSE = max(minSE, time.Duration(h.Val())*time.Second)
+	}
+
+	supported := hasOptionTag(req, "Supported", "timer")
+	role := ""
+	se := req.SessionExpires()
+	if se != nil {
+		// We can only reduce interval but not bellow Min-SE
+		interval = max(min(interval, time.Duration(se.Delta)*time.Second), minSE)
+		role = se.Refresher()
+	}
+
+	if !supported {
+		role = "uas"
+	} else if role == "" {
+		role = "uac"
+	}
+
+	if h := res.SessionExpires(); h != nil {
+		// Already applied by caller
+		interval = time.Duration(h.Delta) * time.Second
+		role = h.Refresher()
+	} else {
+		res.AppendHeader(&sip.SessionExpiresHeader{
+			Delta:  uint32(interval.Seconds()),
+			Params: sip.HeaderParams{{K: "refresher", V: role}},
+		})
+	}
+
+	if role == "uac" {
+		addOptionTag(res, "Require", "timer")
+	}
+	return interval, role == "uas"
+}
+
+// sessionRefreshMethod picks UPDATE if remote allows it
+func sessionRefreshMethod(opts SessionTimerOptions, remote sip.Message) sip.RequestMethod {
+	if opts.RefreshMethod != "" {
+		return opts.RefreshMethod
+	}
+	if remote != nil && hasOptionTag(remote, "Allow", string(sip.UPDATE)) {
+		return sip.UPDATE
+	}
+	return sip.INVITE
+}
+
+// hasOptionTag checks comma separated header values like Supported, Require or Allow
+func hasOptionTag(msg sip.Message, name string, tag string) bool {
+	hdrs := msg.GetHeaders(name)
+	if name == "Supported" {
+		hdrs = append(hdrs, msg.GetHeaders("k")...)
+	}
+	for _, h := range hdrs {
+		for _, v := range strings.Split(h.Value(), ",") {
+			if strings.EqualFold(strings.TrimSpace(v), tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func addOptionTag(msg sip.Message, name string, tag string) {
+	if hasOptionTag(msg, name, tag) {
+		return
+	}
+	msg.AppendHeader(sip.NewHeader(name, tag))
+}
+
+// sessionTimerRefresh sends refresh request and retries on 422 with higher interval
+func sessionTimerRefresh(ctx context.Context, opts SessionTimerOptions, interval time.Duration,
+	newReq func() *sip.Request,
+	do func(ctx context.Context, req *sip.Request) (*sip.Response, error),
+	ack func(req *sip.Request, res *sip.Response) error,
+) error {
+	for {
+		req := newReq()
+		sessionTimerRequestApply(req, opts, interval, "uac")
+		res, err := do(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		if res.IsSuccess() {
+			if req.IsInvite() {
+				return ack(req, res)
+			}
+			return nil
+		}
+
+		if res.StatusCode == sip.StatusSessionIntervalTooSmall {
+			if minse := res.MinSE(); minse != nil && time.Duration(minse.Val())*time.Second > interval {
+				interval = time.Duration(minse.Val()) * time.Second
+				continue
+			}
+		}
+		return &ErrDialogResponse{Res: res}
+	}
+}
+
+// sessionTimerReadRefresh answers refresh request received within dialog.
+// local is our message within dialog carrying SDP, which is resent on re-INVITE
+func sessionTimerReadRefresh(t *sessionTimer, req *sip.Request, tx sip.ServerTransaction, contact *sip.ContactHeader, local sip.Message) error {
+	if t != nil {
+		if res := sessionTimerUASCheck(req, t.opts); res != nil {
+			if err := tx.Respond(res); err != nil {
+				return err
+			}
+			return ErrDialogSessionIntervalTooSmall
+		}
+	}
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	if req.IsInvite() && local != nil && local.Body() != nil {
+		res.SetBody(local.Body())
+		if h := local.GetHeaders("Content-Type"); len(h) > 0 {
+			res.AppendHeader(sip.HeaderClone(h[0]))
+		}
+	}
+	res.AppendHeader(sip.HeaderClone(contact))
+
+	if t == nil {
+		return tx.Respond(res)
+	}
+
+	interval, refresher := sessionTimerUAS(req, res, t.opts)
+	if err := tx.Respond(res); err != nil {
+		return err
+	}
+	t.reset(interval, refresher)
+	return nil
+}
+
+func (s *DialogClientSession) initSessionTimer(opts SessionTimerOptions) {
+	t := newSessionTimer(opts)
+	t.refresh = s.sessionRefresh
+	t.expire = s.sessionExpire
+	s.sessTimer = t
+	s.OnState(func(state sip.DialogState) {
+		if state == sip.DialogStateEnded {
+			t.stop()
+		}
+	})
+}
+
+// ReadRefresh handles session refresh re-INVITE or UPDATE received within dialog.
+// It responds 200 OK and restarts session timer. On re-INVITE our last SDP is sent again.
+// Use it only for refreshes, request changing session should be handled by caller
+func (s *DialogClientSession) ReadRefresh(req *sip.Request, tx sip.ServerTransaction) error {
+	return sessionTimerReadRefresh(s.sessTimer, req, tx, &s.UA.ContactHDR, s.InviteRequest)
+}
+
+func (s *DialogClientSession) sessionTimerUpdate(req *sip.Request, res *sip.Response) {
+	if s.sessTimer == nil || !res.IsSuccess() {
+		return
+	}
+	if req.Method != sip.INVITE && req.Method != sip.UPDATE {
+		return
+	}
+	s.sessTimer.reset(sessionTimerUAC(res))
+}
+
+func (s *DialogClientSession) sessionRefresh(ctx context.Context, interval time.Duration) error {
+	method := sessionRefreshMethod(s.sessTimer.opts, s.InviteResponse)
+	newReq := func() *sip.Request {
+		recipient := s.InviteRequest.Recipient
+		if cont := s.InviteResponse.Contact(); cont != nil {
+			recipient = cont.Address
+		}
+		req := sip.NewRequest(method, *recipient.Clone())
+		if method == sip.INVITE && s.InviteRequest.Body() != nil {
+			req.SetBody(s.InviteRequest.Body())
+			sip.CopyHeaders("Content-Type", s.InviteRequest, req)
+		}
+		return req
+	}
+	ack := func(req *sip.Request, res *sip.Response) error {
+		return s.WriteRequest(newAckRequestUAC(req, res, nil))
+	}
+	return sessionTimerRefresh(ctx, s.sessTimer.opts, interval, newReq, s.Do, ack)
+}
+
+func (s *DialogClientSession) sessionExpire() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.UA.Client.timers().TimerF)
+	defer cancel()
+
+	bye := newByeRequestUAC(s.InviteRequest, s.InviteResponse, nil)
+	if _, err := s.Do(ctx, bye); err != nil {
+		s.UA.Client.log.Info("Session expired BYE failed", "error", err)
+	}
+	s.inviteTx.Terminate()
+	s.endWithCause(ErrDialogSessionExpired)
+}
+
+func (s *DialogServerSession) initSessionTimer(opts SessionTimerOptions) {
+	t := newSessionTimer(opts)
+	t.refresh = s.sessionRefresh
+	t.expire = s.sessionExpire
+	s.sessTimer = t
+	s.OnState(func(state sip.DialogState) {
+		if state == sip.DialogStateEnded {
+			t.stop()
+		}
+	})
+}
+
+// ReadRefresh handles session refresh re-INVITE or UPDATE received within dialog.
+// It responds 200 OK and restarts session timer. On re-INVITE our last SDP is sent again.
+// Use it only for refreshes, request changing session should be handled by caller
+func (s *DialogServerSession) ReadRefresh(req *sip.Request, tx sip.ServerTransaction) error {
+	if err := s.ReadRequest(req, tx); err != nil {
+		return err
+	}
+	var local sip.Message
+	if s.InviteResponse != nil {
+		local = s.InviteResponse
+	}
+	return sessionTimerReadRefresh(s.sessTimer, req, tx, &s.ua.ContactHDR, local)
+}
+
+func (s *DialogServerSession) sessionTimerUpdate(req *sip.Request, res *sip.Response) {
+	if s.sessTimer == nil || !res.IsSuccess() {
+		return
+	}
+	if req.Method != sip.INVITE && req.Method != sip.UPDATE {
+		return
+	}
+	s.sessTimer.reset(sessionTimerUAC(res))
+}
+
+func (s *DialogServerSession) sessionRefresh(ctx context.Context, interval time.Duration) error {
+	method := sessionRefreshMethod(s.sessTimer.opts, s.InviteRequest)
+	newReq := func() *sip.Request {
+		req := sip.NewRequest(method, *s.InviteRequest.Contact().Address.Clone())
+		req.SetTransport(s.InviteRequest.Transport())
+		if method == sip.INVITE && s.InviteResponse.Body() != nil {
+			req.SetBody(s.InviteResponse.Body())
+			sip.CopyHeaders("Content-Type", s.InviteResponse, req)
+		}
+		return req
+	}
+	ack := func(req *sip.Request, res *sip.Response) error {
+		return s.WriteRequest(newAckRequestUAC(req, res, nil))
+	}
+	return sessionTimerRefresh(ctx, s.sessTimer.opts, interval, newReq, s.Do, ack)
+}
+
+func (s *DialogServerSession) sessionExpire() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.ua.Client.timers().TimerF)
+	defer cancel()
+
+	bye := sip.NewRequest(sip.BYE, *s.InviteRequest.Contact().Address.Clone())
+	bye.SetTransport(s.InviteRequest.Transport())
+	if _, err := s.Do(ctx, bye); err != nil {
+		s.ua.Client.log.Info("Session expired BYE failed", "error", err)
+	}
+	s.inviteTx.Terminate()
+	s.endWithCause(ErrDialogSessionExpired)
+}
+
+// sessionTimerRetryApply raises Session-Expires and Min-SE on request after 422 response.
+// Returns false if interval can not be raised
+func sessionTimerRetryApply(req *sip.Request, minse sip.MinSEHeader) bool {
+	se := req.SessionExpires()
+	if se == nil || minse.Val() <= se.Delta {
+		return false
+	}
+
+	se.Delta = minse.Val()
+	req.ReplaceHeader(se)
+	if req.MinSE() != nil {
+		req.ReplaceHeader(&minse)
+	} else {
+		req.AppendHeader(&minse)
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package sipgo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialogSessionTimerUAC(t *testing.T) {
+	var mu sync.Mutex
+	var updates []*sip.Request
+	client := testClient(t, func(req *sip.Request) *sip.Response {
+		se := req.SessionExpires()
+		require.NotNil(t, se)
+		assert.True(t, hasOptionTag(req, "Supported", "timer"))
+
+		if req.IsInvite() && se.Delta < 300 {
+			res := sip.NewResponseFromRequest(req, sip.StatusSessionIntervalTooSmall, "Session Interval Too Small", nil)
+			minse := sip.MinSEHeader(300)
+			res.AppendHeader(&minse)
+			return res
+		}
+
+		if req.Method == sip.UPDATE {
+			mu.Lock()
+			updates = append(updates, req)
+			mu.Unlock()
+		}
+		res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		res.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "uas.sipgo.com"}})
+		res.AppendHeader(sip.NewHeader("Allow", "INVITE, ACK, BYE, UPDATE"))
+		res.AppendHeader(&sip.SessionExpiresHeader{Delta: se.Delta, Params: sip.HeaderParams{{K: "refresher", V: "uac"}}})
+		return res
+	})
+
+	dua := DialogUA{
+		Client:       client,
+		SessionTimer: &SessionTimerOptions{Interval: 120 * time.Second},
+	}
+	d, err := dua.Invite(context.TODO(), sip.Uri{User: "test", Host: "localhost"}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.sessTimer.stop() })
+
+	require.NoError(t, d.WaitAnswer(context.TODO(), AnswerOptions{}))
+	assert.Equal(t, 300*time.Second, d.sessTimer.Interval())
+	assert.True(t, d.sessTimer.Refresher())
+	assert.Equal(t, uint32(300), d.InviteRequest.MinSE().Val())
+
+	// Speed up refresh
+	d.sessTimer.reset(200*time.Millisecond, true)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(updates) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	update := updates[0]
+	mu.Unlock()
+	assert.Equal(t, "uac", update.SessionExpires().Refresher())
+	assert.Equal(t, "uas.sipgo.com", update.Recipient.Host)
+	assert.Equal(t, d.InviteRequest.CallID().Value(), update.CallID().Value())
+	require.Eventually(t, func() bool {
+		return d.sessTimer.Interval() == time.Duration(update.SessionExpires().Delta)*time.Second
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDialogSessionTimerUAS(t *testing.T) {
+	byes := make(chan *sip.Request, 1)
+	client := testClient(t, func(req *sip.Request) *sip.Response {
+		if req.Method == sip.BYE {
+			byes <- req
+		}
+		return sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	})
+	dua := DialogUA{
+		Client:       client,
+		ContactHDR:   sip.ContactHeader{Address: sip.Uri{User: "uas", Host: "127.0.0.200", Port: 5099}},
+		SessionTimer: &SessionTimerOptions{Interval: 600 * time.Second, MinSE: 120 * time.Second},
+	}
+
+	newInvite := func(se string) *sip.Request {
+		invite, _, _ := createTestInvite(t, "sip:uas@127.0.0.1", "tcp", "127.0.0.1:5090")
+		invite.AppendHeader(&sip.ContactHeader{Address: sip.Uri{Host: "uac", Port: 1234}})
+		invite.AppendHeader(sip.NewHeader("Supported", "timer"))
+		invite.AppendHeader(sip.NewHeader("Session-Expires", se))
+		return invite
+	}
+
+	t.Run("IntervalTooSmall", func(t *testing.T) {
+		invite := newInvite("90")
+		tx := siptest.NewServerTxRecorder(invite)
+		_, err := dua.ReadInvite(invite, tx)
+		require.ErrorIs(t, err, ErrDialogSessionIntervalTooSmall)
+
+		res := tx.Result()
+		require.Len(t, res, 1)
+		assert.Equal(t, sip.StatusSessionIntervalTooSmall, res[0].StatusCode)
+		assert.Equal(t, uint32(120), res[0].MinSE().Val())
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		invite := newInvite("1800")
+		tx := siptest.NewServerTxRecorder(invite)
+		d, err := dua.ReadInvite(invite, tx)
+		require.NoError(t, err)
+
+		res := sip.NewResponseFromRequest(d.InviteRequest, sip.StatusOK, "OK", nil)
+		ack := newAckRequestUAC(d.InviteRequest, res, nil)
+		go func() {
+			time.Sleep(sip.T1)
+			d.ReadAck(ack, tx)
+		}()
+		require.NoError(t, d.WriteResponse(res))
+
+		// Interval is reduced to ours and UAC refreshes
+		se := res.SessionExpires()
+		require.NotNil(t, se)
+		assert.Equal(t, uint32(600), se.Delta)
+		assert.Equal(t, "uac", se.Refresher())
+		assert.True(t, hasOptionTag(res, "Require", "timer"))
+		assert.False(t, d.sessTimer.Refresher())
+
+		// Refresh is not received
+		d.sessTimer.reset(100*time.Millisecond, false)
+		select {
+		case bye := <-byes:
+			assert.Equal(t, "uac", bye.Recipient.Host)
+		case <-time.After(2 * time.Second):
+			t.Fatal("BYE not sent")
+		}
+		<-d.Context().Done()
+		assert.ErrorIs(t, d.err(), ErrDialogSessionExpired)
+		assert.Equal(t, sip.DialogStateEnded, d.LoadState())
+	})
+}
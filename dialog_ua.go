@@ -19,6 +19,14 @@ type DialogUA struct {
 
 	// RewriteContact sends request on source IP instead Contact. Should be used when behind NAT.
 	RewriteContact bool
+
+	// SessionTimer enables session timers RFC 4028 on created dialogs.
+	// Dialog is refreshed with re-INVITE or UPDATE and terminated with BYE if refresh is not received in time
+	SessionTimer *SessionTimerOptions
+
+	// ReliableProvisional enables reliable provisional responses RFC 3262.
+	// UAC advertises 100rel support and UAS sends provisional responses reliably when UAC supports it
+	ReliableProvisional bool
 }
 
 func (c *DialogUA) ReadInvite(inviteRequest *sip.Request, tx sip.ServerTransaction) (*DialogServerSession, error) {
@@ -30,6 +38,15 @@ func (c *DialogUA) ReadInvite(inviteRequest *sip.Request, tx sip.ServerTransacti
 		return nil, fmt.Errorf("no CSEQ header present")
 	}
 
+	if c.SessionTimer != nil {
+		if res := sessionTimerUASCheck(inviteRequest, c.SessionTimer.normalize()); res != nil {
+			if err := tx.Respond(res); err != nil {
+				return nil, err
+			}
+			return nil, ErrDialogSessionIntervalTooSmall
+		}
+	}
+
 	// Prebuild already to tag for response as it must be same for all responds
 	// NewResponseFromRequest will skip this for all 100
 	uuid, err := uuid.NewRandom()
@@ -53,6 +70,9 @@ func (c *DialogUA) ReadInvite(inviteRequest *sip.Request, tx sip.ServerTransacti
 		ua:       c,
 	}
 	dtx.Init()
+	if c.SessionTimer != nil {
+		dtx.initSessionTimer(*c.SessionTimer)
+	}
 
 	if !tx.OnCancel(func(r *sip.Request) {
 		state := dtx.LoadState()
@@ -122,6 +142,13 @@ func (c *DialogUA) WriteInvite(ctx context.Context, inviteReq *sip.Request, opti
 	}
 	// Init our dialog
 	dtx.Dialog.Init()
+	if c.ReliableProvisional {
+		addOptionTag(inviteReq, "Supported", "100rel")
+	}
+	if c.SessionTimer != nil {
+		dtx.initSessionTimer(*c.SessionTimer)
+		sessionTimerRequestApply(inviteReq, dtx.sessTimer.opts, dtx.sessTimer.opts.Interval, "")
+	}
 
 	return dtx, dtx.Invite(ctx, options...)
 }
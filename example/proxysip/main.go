@@ -38,7 +38,6 @@ func main() {
 	transportType := flag.String("t", "udp", "Transport, default will be determined by request")
 	flag.Parse()
 
-	sip.UDPMTUSize = 10000
 	if *pprof {
 		runtime.SetBlockProfileRate(1)
 		runtime.SetMutexProfileFraction(1)
@@ -98,7 +97,7 @@ func setupSipProxy(proxydst string, ip string) *sipgo.Server {
 	log := slog.Default()
 	// Prepare all variables we need for our service
 	host, port, _ := sip.ParseAddr(ip)
-	ua, err := sipgo.NewUA()
+	ua, err := sipgo.NewUA(sipgo.WithUserAgentUDPMTU(10000))
 	if err != nil {
 		log.Error("Fail to setup user agent", "error", err)
 		return nil
@@ -0,0 +1,289 @@
+package sipgo
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	// ErrClientOverloadThrottled is returned when request is not sent as upstream server
+	// requested reduction of traffic with RFC 7339 overload control
+	ErrClientOverloadThrottled = errors.New("request throttled due to server overload")
+
+	// DefaultOverloadRetryAfter is Retry-After of 503 response sent when server is overloaded
+	DefaultOverloadRetryAfter = 5 * time.Second
+	// DefaultOverloadValidity is oc-validity advertised to clients. It is also used
+	// by client when server does not send oc-validity
+	DefaultOverloadValidity = 500 * time.Millisecond
+)
+
+// RFC 7339 Via parameters
+const (
+	overloadParamOC       = "oc"
+	overloadParamAlgo     = "oc-algo"
+	overloadParamValidity = "oc-validity"
+	overloadParamSeq      = "oc-seq"
+	overloadAlgoLoss      = "loss"
+)
+
+// OverloadConfig configures server overload control.
+// Server is overloaded when number of server transactions waiting final response is above MaxInFlight
+// or smoothed time to final response is above MaxLatency. Reduction is percentage how much traffic
+// is above threshold, and same percentage of new requests is rejected with 503 and Retry-After.
+// Requests within dialog, ACK and CANCEL are always processed.
+//
+// Clients supporting RFC 7339 (oc parameter in Via) get reduction in oc Via parameter of response
+// with loss based algorithm, so they can throttle before sending.
+type OverloadConfig struct {
+	// MaxInFlight is number of server transactions waiting for final response. 0 disables
+	MaxInFlight int
+	// MaxLatency is smoothed time from request to final response. 0 disables
+	MaxLatency time.Duration
+	// Methods are methods of new requests rejected under overload. Default INVITE and REGISTER
+	Methods []sip.RequestMethod
+	// RetryAfter is Retry-After of 503 response. Default DefaultOverloadRetryAfter
+	RetryAfter time.Duration
+	// Validity is oc-validity advertised to clients. Default DefaultOverloadValidity
+	Validity time.Duration
+}
+
+// OverloadStats are server overload control metrics
+type OverloadStats struct {
+	// InFlight is number of server transactions waiting final response
+	InFlight int
+	// Latency is smoothed time from request to final response
+	Latency time.Duration
+	// Reduction is percentage of new requests rejected and advertised to clients
+	Reduction int
+	// Rejected is number of requests rejected with 503
+	Rejected uint64
+}
+
+type overloadController struct {
+	conf OverloadConfig
+
+	mu       sync.Mutex
+	inFlight int
+	latency  time.Duration
+	samples  uint64
+	rejected uint64
+}
+
+func newOverloadController(conf OverloadConfig) *overloadController {
+	if len(conf.Methods) == 0 {
+		conf.Methods = []sip.RequestMethod{sip.INVITE, sip.REGISTER}
+	}
+	if conf.RetryAfter <= 0 {
+		conf.RetryAfter = DefaultOverloadRetryAfter
+	}
+	if conf.Validity <= 0 {
+		conf.Validity = DefaultOverloadValidity
+	}
+	return &overloadController{conf: conf}
+}
+
+// reduction returns percentage of traffic above thresholds. Caller must hold lock
+func (o *overloadController) reduction() int {
+	r := 0
+	if limit := o.conf.MaxInFlight; limit > 0 && o.inFlight > limit {
+		r = 100 * (o.inFlight - limit) / o.inFlight
+	}
+	if limit := o.conf.MaxLatency; limit > 0 && o.latency > limit {
+		r = max(r, int(100*(o.latency-limit)/o.latency))
+	}
+	return min(r, 100)
+}
+
+// serve tracks server transaction and returns false if request must be rejected.
+// In that case 503 is already sent
+func (o *overloadController) serve(req *sip.Request, tx *sip.ServerTx) bool {
+	start := time.Now()
+	var once sync.Once
+	release := func(final bool) {
+		once.Do(func() {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			o.inFlight--
+			if !final {
+				return
+			}
+			sample := time.Since(start)
+			if o.samples == 0 {
+				o.latency = sample
+			} else {
+				o.latency = (7*o.latency + sample) / 8
+			}
+			o.samples++
+		})
+	}
+
+	o.mu.Lock()
+	reduction := o.reduction()
+	reject := reduction > 0 && o.shed(req) && int(randUniformRange32(0, 100)) < reduction
+	if reject {
+		o.rejected++
+	} else {
+		o.inFlight++
+	}
+	o.mu.Unlock()
+
+	if reject {
+		res := sip.NewResponseFromRequest(req, sip.StatusServiceUnavailable, "Service Unavailable", nil)
+		res.AppendHeader(sip.NewHeader("Retry-After", strconv.Itoa(int(o.conf.RetryAfter.Seconds()))))
+		o.feedback(res)
+		tx.Respond(res)
+		return false
+	}
+
+	tx.OnResponse(func(res *sip.Response) {
+		o.feedback(res)
+		if !res.IsProvisional() {
+			release(true)
+		}
+	})
+	if !tx.OnTerminate(func(key string, err error) { release(false) }) {
+		release(false)
+	}
+	return true
+}
+
+// shed checks can request be rejected. Requests within dialog, ACK and CANCEL are always processed
+func (o *overloadController) shed(req *sip.Request) bool {
+	if req.IsAck() || req.IsCancel() {
+		return false
+	}
+	if to := req.To(); to != nil && to.Params.Has("tag") {
+		return false
+	}
+	return slices.Contains(o.conf.Methods, req.Method)
+}
+
+// feedback adds RFC 7339 parameters to top Via of response if client supports overload control
+func (o *overloadController) feedback(res *sip.Response) {
+	via := res.Via()
+	if via == nil || !via.Params.Has(overloadParamOC) {
+		return
+	}
+
+	o.mu.Lock()
+	reduction := o.reduction()
+	o.mu.Unlock()
+
+	via.Params.Add(overloadParamOC, strconv.Itoa(reduction))
+	via.Params.Add(overloadParamAlgo, `"`+overloadAlgoLoss+`"`)
+	via.Params.Add(overloadParamValidity, strconv.FormatInt(o.conf.Validity.Milliseconds(), 10))
+	// Sequence is timestamp, so client can detect stale feedback
+	via.Params.Add(overloadParamSeq, strconv.FormatFloat(float64(time.Now().UnixMilli())/1000, 'f', 3, 64))
+}
+
+func (o *overloadController) stats() OverloadStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return OverloadStats{
+		InFlight:  o.inFlight,
+		Latency:   o.latency,
+		Reduction: o.reduction(),
+		Rejected:  o.rejected,
+	}
+}
+
+// overloadThrottle is RFC 7339 client side with loss based algorithm.
+// Reduction is kept per destination of request
+type overloadThrottle struct {
+	mu      sync.Mutex
+	servers map[string]overloadState
+}
+
+type overloadState struct {
+	reduction int
+	seq       float64
+	expires   time.Time
+}
+
+func newOverloadThrottle() *overloadThrottle {
+	return &overloadThrottle{
+		servers: make(map[string]overloadState),
+	}
+}
+
+// throttle returns true if request must not be sent. Only new out of dialog requests are throttled
+func (o *overloadThrottle) throttle(req *sip.Request, dest string) bool {
+	if req.IsCancel() {
+		return false
+	}
+	if to := req.To(); to != nil && to.Params.Has("tag") {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, exists := o.servers[dest]
+	if !exists {
+		return false
+	}
+	if time.Now().After(s.expires) {
+		delete(o.servers, dest)
+		return false
+	}
+	return int(randUniformRange32(0, 100)) < s.reduction
+}
+
+// advertise adds oc parameters to top Via of request, indicating support of overload control
+func (o *overloadThrottle) advertise(req *sip.Request) {
+	via := req.Via()
+	if via == nil {
+		return
+	}
+	via.Params.Add(overloadParamOC, "")
+	via.Params.Add(overloadParamAlgo, `"`+overloadAlgoLoss+`"`)
+}
+
+// feedback updates reduction of destination from response Via
+func (o *overloadThrottle) feedback(dest string, res *sip.Response) {
+	via := res.Via()
+	if via == nil {
+		return
+	}
+	val, exists := via.Params.Get(overloadParamOC)
+	if !exists || val == "" {
+		return
+	}
+	reduction, err := strconv.Atoi(val)
+	if err != nil || reduction < 0 {
+		return
+	}
+	if algo, _ := via.Params.GetUnquoted(overloadParamAlgo); algo != "" && algo != overloadAlgoLoss {
+		return
+	}
+
+	validity := DefaultOverloadValidity
+	if v, exists := via.Params.Get(overloadParamValidity); exists {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return
+		}
+		validity = time.Duration(ms) * time.Millisecond
+	}
+	seq, _ := strconv.ParseFloat(via.Params.GetOr(overloadParamSeq, "0"), 64)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if s, exists := o.servers[dest]; exists && seq > 0 && seq < s.seq {
+		// Stale feedback
+		return
+	}
+	if reduction == 0 || validity == 0 {
+		delete(o.servers, dest)
+		return
+	}
+	o.servers[dest] = overloadState{
+		reduction: min(reduction, 100),
+		seq:       seq,
+		expires:   time.Now().Add(validity),
+	}
+}
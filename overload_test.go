@@ -0,0 +1,184 @@
+package sipgo
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerOverloadControl(t *testing.T) {
+	mem := sip.NewMemoryNetwork()
+	newMemoryUA := func(t *testing.T) *UserAgent {
+		ua, err := NewUA()
+		require.NoError(t, err)
+		require.NoError(t, ua.TransportLayer().RegisterTransport("memory", sip.NewTransportMemory(mem, sip.NewParser())))
+		return ua
+	}
+	newOptions := func() *sip.Request {
+		return sip.NewRequest(sip.OPTIONS, sip.Uri{Host: "uas", Port: 5060, UriParams: sip.HeaderParams{{K: "transport", V: "memory"}}})
+	}
+	newInDialog := func(tag string) *sip.Request {
+		req := newOptions()
+		to := &sip.ToHeader{Address: req.Recipient, Params: sip.NewParams()}
+		to.Params.Add("tag", tag)
+		req.AppendHeader(to)
+		return req
+	}
+
+	uas := newMemoryUA(t)
+	defer uas.Close()
+	srv, err := NewServer(uas, WithServerOverloadControl(OverloadConfig{
+		MaxInFlight: 1,
+		Methods:     []sip.RequestMethod{sip.OPTIONS},
+		RetryAfter:  time.Second,
+	}))
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		if tag, _ := req.To().Params.Get("tag"); tag == "hold" {
+			<-release
+		}
+		tx.Respond(sip.NewResponseFromRequest(req, 200, "OK", nil))
+	})
+
+	l, err := mem.Listen("uas:5060")
+	require.NoError(t, err)
+	go srv.Serve("memory", l)
+
+	uac := newMemoryUA(t)
+	defer uac.Close()
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+	ocClient, err := NewClient(uac, WithClientOverloadControl())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Hold transactions above limit. Requests within dialog are never rejected
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Do(ctx, newInDialog("hold"))
+			assert.NoError(t, err)
+			assert.Equal(t, sip.StatusOK, res.StatusCode)
+		}()
+	}
+	require.Eventually(t, func() bool {
+		stats, _ := srv.OverloadStats()
+		return stats.InFlight == 10
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats, ok := srv.OverloadStats()
+	require.True(t, ok)
+	assert.Equal(t, 90, stats.Reduction)
+
+	// New requests are shed
+	rejected := 0
+	for i := 0; i < 20; i++ {
+		res, err := client.Do(ctx, newOptions())
+		require.NoError(t, err)
+		if res.StatusCode == sip.StatusServiceUnavailable {
+			rejected++
+			assert.Equal(t, "1", res.GetHeader("Retry-After").Value())
+			// Client did not advertise support
+			assert.False(t, res.Via().Params.Has("oc"))
+		}
+	}
+	assert.Greater(t, rejected, 0)
+
+	// Requests within dialog are processed
+	for i := 0; i < 5; i++ {
+		res, err := client.Do(ctx, newInDialog("in-dialog"))
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusOK, res.StatusCode)
+	}
+
+	t.Run("ClientThrottle", func(t *testing.T) {
+		res, err := ocClient.Do(ctx, newOptions())
+		require.NoError(t, err)
+		oc, _ := res.Via().Params.Get("oc")
+		reduction, err := strconv.Atoi(oc)
+		require.NoError(t, err)
+		assert.Greater(t, reduction, 0)
+		assert.Equal(t, `"loss"`, res.Via().Params.GetOr("oc-algo", ""))
+		assert.Equal(t, "500", res.Via().Params.GetOr("oc-validity", ""))
+
+		throttled := 0
+		for i := 0; i < 20; i++ {
+			_, err := ocClient.Do(ctx, newOptions())
+			if err == ErrClientOverloadThrottled {
+				throttled++
+				continue
+			}
+			require.NoError(t, err)
+		}
+		assert.Greater(t, throttled, 0)
+	})
+
+	close(release)
+	wg.Wait()
+	require.Eventually(t, func() bool {
+		stats, _ := srv.OverloadStats()
+		return stats.InFlight == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	stats, _ = srv.OverloadStats()
+	assert.Equal(t, 0, stats.Reduction)
+	assert.Greater(t, stats.Rejected, uint64(0))
+	assert.Greater(t, stats.Latency, time.Duration(0))
+}
+
+func TestOverloadThrottleFeedback(t *testing.T) {
+	newResponse := func(params ...sip.HeaderKV) *sip.Response {
+		res := sip.NewResponse(200, "OK")
+		via := &sip.ViaHeader{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: "UDP", Host: "127.0.0.1", Params: sip.HeaderParams{{K: "branch", V: sip.GenerateBranch()}}}
+		via.Params = append(via.Params, params...)
+		res.AppendHeader(via)
+		return res
+	}
+	newRequest := func() *sip.Request {
+		req := sip.NewRequest(sip.INVITE, sip.Uri{Host: "uas"})
+		req.AppendHeader(&sip.ToHeader{Address: req.Recipient, Params: sip.NewParams()})
+		return req
+	}
+
+	o := newOverloadThrottle()
+	o.feedback("uas", newResponse(sip.HeaderKV{K: "oc", V: "100"}, sip.HeaderKV{K: "oc-validity", V: "1000"}, sip.HeaderKV{K: "oc-seq", V: "2.000"}))
+	assert.True(t, o.throttle(newRequest(), "uas"))
+	assert.False(t, o.throttle(newRequest(), "other"))
+
+	// In dialog request and CANCEL are not throttled
+	req := newRequest()
+	req.To().Params.Add("tag", "1234")
+	assert.False(t, o.throttle(req, "uas"))
+	cancelReq := newRequest()
+	cancelReq.Method = sip.CANCEL
+	assert.False(t, o.throttle(cancelReq, "uas"))
+
+	// Stale feedback is ignored
+	o.feedback("uas", newResponse(sip.HeaderKV{K: "oc", V: "0"}, sip.HeaderKV{K: "oc-seq", V: "1.000"}))
+	assert.True(t, o.throttle(newRequest(), "uas"))
+
+	// Unsupported algorithm is ignored
+	o.feedback("uas", newResponse(sip.HeaderKV{K: "oc", V: "0"}, sip.HeaderKV{K: "oc-algo", V: "rate"}, sip.HeaderKV{K: "oc-seq", V: "3.000"}))
+	assert.True(t, o.throttle(newRequest(), "uas"))
+
+	// Zero reduction stops throttling
+	o.feedback("uas", newResponse(sip.HeaderKV{K: "oc", V: "0"}, sip.HeaderKV{K: "oc-seq", V: "3.000"}))
+	assert.False(t, o.throttle(newRequest(), "uas"))
+
+	// Reduction expires after validity
+	o.feedback("uas", newResponse(sip.HeaderKV{K: "oc", V: "100"}, sip.HeaderKV{K: "oc-validity", V: "10"}, sip.HeaderKV{K: "oc-seq", V: "4.000"}))
+	assert.True(t, o.throttle(newRequest(), "uas"))
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, o.throttle(newRequest(), "uas"))
+}
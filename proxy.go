@@ -0,0 +1,549 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+const (
+	// ProxyTimerC is default timer C for INVITE branches. Must be larger than 3 minutes
+	// https://datatracker.ietf.org/doc/html/rfc3261#section-16.6
+	ProxyTimerC = 3*time.Minute + 1*time.Second
+)
+
+type ProxyForkMode int
+
+const (
+	// Branches are created for all targets at once
+	ProxyForkParallel ProxyForkMode = 0
+	// Targets are tried in order of q-value, targets with same q-value in parallel
+	ProxyForkSequential ProxyForkMode = 1
+)
+
+// ProxyTarget is single target from target set
+type ProxyTarget struct {
+	Uri sip.Uri
+	// Q is preference 0.0 - 1.0 used for sequential forking
+	Q float64
+	// Destination is optional host:port where request is sent.
+	// If empty it is resolved from Route or Request-URI
+	Destination string
+}
+
+type ProxyOption func(p *Proxy)
+
+// WithProxyForking sets forking mode. Default is parallel
+func WithProxyForking(mode ProxyForkMode) ProxyOption {
+	return func(p *Proxy) {
+		p.forkMode = mode
+	}
+}
+
+// WithProxyRecordRoute adds Record-Route on dialog initiating requests
+func WithProxyRecordRoute() ProxyOption {
+	return func(p *Proxy) {
+		p.recordRoute = true
+	}
+}
+
+// WithProxyTimerC overrides timer C for INVITE branches
+func WithProxyTimerC(d time.Duration) ProxyOption {
+	return func(p *Proxy) {
+		p.timerC = d
+	}
+}
+
+// WithProxyLogger sets proxy logger
+func WithProxyLogger(l *slog.Logger) ProxyOption {
+	return func(p *Proxy) {
+		p.log = l
+	}
+}
+
+// Proxy is stateful proxy based on https://datatracker.ietf.org/doc/html/rfc3261#section-16
+// It forwards request received on server transaction to target set using client transactions.
+//
+// Experimental
+type Proxy struct {
+	client      *Client
+	forkMode    ProxyForkMode
+	recordRoute bool
+	timerC      time.Duration
+	log         *slog.Logger
+
+	// cancelTimeout is time to wait final response after CANCEL
+	cancelTimeout time.Duration
+}
+
+func NewProxy(client *Client, options ...ProxyOption) *Proxy {
+	p := &Proxy{
+		client:        client,
+		timerC:        ProxyTimerC,
+		cancelTimeout: client.timers().TimerB,
+		log:           client.log.With("caller", "Proxy"),
+	}
+	for _, o := range options {
+		o(p)
+	}
+	return p
+}
+
+// Forward forwards request to targets and relays responses on tx.
+// If targets are empty Request-URI is used as target.
+// It returns when final response is forwarded.
+//
+// Usage in request handler:
+//
+//	srv.OnInvite(func(req *sip.Request, tx sip.ServerTransaction) {
+//		proxy.Forward(req, tx, []sipgo.ProxyTarget{{Uri: bobUri}})
+//	})
+func (p *Proxy) Forward(req *sip.Request, tx sip.ServerTransaction, targets []ProxyTarget) error {
+	if maxfwd := req.MaxForwards(); maxfwd != nil && maxfwd.Val() == 0 {
+		res := sip.NewResponseFromRequest(req, sip.StatusTooManyHops, "Too Many Hops", nil)
+		return tx.Respond(res)
+	}
+
+	if len(targets) == 0 {
+		targets = []ProxyTarget{{Uri: req.Recipient, Q: 1}}
+	}
+
+	p.removeOwnRoute(req)
+
+	if req.IsInvite() {
+		// https://datatracker.ietf.org/doc/html/rfc3261#section-16.2
+		res := sip.NewResponseFromRequest(req, sip.StatusTrying, "Trying", nil)
+		if err := tx.Respond(res); err != nil {
+			return err
+		}
+	}
+
+	f := &proxyFork{
+		p:   p,
+		req: req,
+		tx:  tx,
+	}
+	tx.OnCancel(func(r *sip.Request) {
+		f.cancel()
+	})
+
+	for _, group := range p.targetGroups(targets) {
+		f.forkGroup(group)
+		if f.stopForking() {
+			break
+		}
+	}
+
+	return f.respondBest()
+}
+
+// ForwardAck forwards ACK for 2xx. ACK for non 2xx is handled by transaction layer
+func (p *Proxy) ForwardAck(req *sip.Request) error {
+	if maxfwd := req.MaxForwards(); maxfwd != nil {
+		if maxfwd.Val() == 0 {
+			return errors.New("max forwards reached")
+		}
+		maxfwd.Dec()
+	}
+	p.removeOwnRoute(req)
+	req.SetDestination("")
+	req.SetTransport("")
+	return p.client.WriteRequest(req, ClientRequestAddVia)
+}
+
+// targetGroups splits targets for forking. In sequential mode targets are grouped by q-value
+func (p *Proxy) targetGroups(targets []ProxyTarget) [][]ProxyTarget {
+	if p.forkMode != ProxyForkSequential {
+		return [][]ProxyTarget{targets}
+	}
+
+	targets = slices.Clone(targets)
+	slices.SortStableFunc(targets, func(a, b ProxyTarget) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return 0
+	})
+
+	groups := [][]ProxyTarget{}
+	for i, t := range targets {
+		if i > 0 && t.Q == targets[i-1].Q {
+			groups[len(groups)-1] = append(groups[len(groups)-1], t)
+			continue
+		}
+		groups = append(groups, []ProxyTarget{t})
+	}
+	return groups
+}
+
+// removeOwnRoute removes top Route header if it points to us
+// https://datatracker.ietf.org/doc/html/rfc3261#section-16.4
+func (p *Proxy) removeOwnRoute(req *sip.Request) {
+	route := req.Route()
+	if route == nil || route.Address.Host != p.client.host {
+		return
+	}
+
+	port := p.client.tp.GetListenPort(sip.NetworkToLower(req.Transport()))
+	if route.Address.Port > 0 && port > 0 && route.Address.Port != port {
+		return
+	}
+	req.RemoveHeader("Route")
+}
+
+var errProxyForkStopped = errors.New("proxy forking stopped")
+
+type proxyBranch struct {
+	req *sip.Request
+	tx  sip.ClientTransaction
+
+	// protected by fork mu
+	provisional   bool
+	final         bool
+	cancelPending bool
+	timerC        *time.Timer
+}
+
+// proxyFork is response context of single forwarded request
+type proxyFork struct {
+	p   *Proxy
+	req *sip.Request
+	tx  sip.ServerTransaction
+
+	mu        sync.Mutex
+	branches  []*proxyBranch
+	responses []*sip.Response
+	answered  bool
+	canceled  bool
+	global    bool
+}
+
+func (f *proxyFork) forkGroup(targets []ProxyTarget) {
+	wg := sync.WaitGroup{}
+	for _, t := range targets {
+		b, err := f.newBranch(t)
+		if errors.Is(err, errProxyForkStopped) {
+			break
+		}
+		if err != nil {
+			f.p.log.Error("Failed to create branch", "error", err, "target", t.Uri.String())
+			f.addResponse(sip.NewResponseFromRequest(f.req, sip.StatusServiceUnavailable, "Service Unavailable", nil))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.runBranch(b)
+		}()
+	}
+	wg.Wait()
+}
+
+func (f *proxyFork) newBranch(t ProxyTarget) (*proxyBranch, error) {
+	req := f.req.Clone()
+	req.Recipient = *t.Uri.Clone()
+	req.SetDestination(t.Destination)
+	req.SetTransport("")
+	req.Laddr = sip.Addr{}
+	// Max-Forwards header is shared between clones
+	maxfwd := sip.MaxForwardsHeader(70)
+	if h := req.MaxForwards(); h != nil {
+		maxfwd = sip.MaxForwardsHeader(h.Val() - 1)
+	}
+	req.ReplaceHeader(&maxfwd)
+
+	options := []ClientRequestOption{ClientRequestAddVia}
+	if f.p.recordRoute && !req.To().Params.Has("tag") {
+		options = append(options, ClientRequestAddRecordRoute)
+	}
+
+	b := &proxyBranch{req: req}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.canceled || f.answered || f.global {
+		return nil, errProxyForkStopped
+	}
+
+	tx, err := f.p.client.TransactionRequest(context.Background(), req, options...)
+	if err != nil {
+		return nil, err
+	}
+	b.tx = tx
+	f.branches = append(f.branches, b)
+
+	if req.IsInvite() {
+		b.timerC = time.AfterFunc(f.p.timerC, func() {
+			f.onTimerC(b)
+		})
+	}
+	return b, nil
+}
+
+func (f *proxyFork) runBranch(b *proxyBranch) {
+	defer func() {
+		if b.timerC != nil {
+			b.timerC.Stop()
+		}
+	}()
+
+	tx := b.tx
+	for {
+		select {
+		case res := <-tx.Responses():
+			if f.handleResponse(b, res) {
+				return
+			}
+		case <-tx.Done():
+			f.mu.Lock()
+			final := b.final
+			b.final = true
+			f.mu.Unlock()
+			if final {
+				return
+			}
+
+			// https://datatracker.ietf.org/doc/html/rfc3261#section-16.7 point 3
+			err := tx.Err()
+			code, reason := sip.StatusRequestTimeout, "Request Timeout"
+			if errors.Is(err, sip.ErrTransactionTransport) {
+				code, reason = sip.StatusServiceUnavailable, "Service Unavailable"
+			}
+			f.p.log.Debug("Branch terminated without final response", "error", err, "branch", b.req.Recipient.String())
+			f.addResponse(sip.NewResponseFromRequest(f.req, code, reason, nil))
+			return
+		}
+	}
+}
+
+// handleResponse processes branch response. Returns true if response is final
+func (f *proxyFork) handleResponse(b *proxyBranch, res *sip.Response) bool {
+	// Remove our Via
+	res.RemoveHeader("Via")
+
+	if res.IsProvisional() {
+		f.mu.Lock()
+		b.provisional = true
+		if b.timerC != nil && res.StatusCode > sip.StatusTrying {
+			b.timerC.Reset(f.p.timerC)
+		}
+		cancelPending := b.cancelPending
+		stopped := f.canceled || f.answered
+		f.mu.Unlock()
+
+		if cancelPending {
+			f.cancelBranch(b)
+		}
+
+		// 100 Trying is not forwarded
+		if res.StatusCode == sip.StatusTrying || stopped {
+			return false
+		}
+		if err := f.tx.Respond(res); err != nil {
+			f.p.log.Debug("Failed to forward provisional response", "error", err)
+		}
+		return false
+	}
+
+	f.mu.Lock()
+	b.final = true
+	f.mu.Unlock()
+
+	if res.IsSuccess() {
+		f.mu.Lock()
+		f.answered = true
+		f.mu.Unlock()
+
+		// 2xx retransmissions are forwarded as well
+		b.tx.OnRetransmission(func(r *sip.Response) {
+			r.RemoveHeader("Via")
+			if err := f.tx.Respond(r); err != nil {
+				f.p.log.Debug("Failed to forward 2xx retransmission", "error", err)
+			}
+		})
+
+		// Every 2xx must be forwarded
+		// https://datatracker.ietf.org/doc/html/rfc3261#section-16.7 point 5
+		if err := f.tx.Respond(res); err != nil {
+			f.p.log.Error("Failed to forward 2xx response", "error", err)
+		}
+
+		if f.req.IsInvite() {
+			f.cancelPending()
+		}
+		return true
+	}
+
+	f.addResponse(res)
+	if res.StatusCode >= 600 {
+		f.mu.Lock()
+		f.global = true
+		f.mu.Unlock()
+		f.cancelPending()
+	}
+	return true
+}
+
+func (f *proxyFork) addResponse(res *sip.Response) {
+	f.mu.Lock()
+	f.responses = append(f.responses, res)
+	f.mu.Unlock()
+}
+
+func (f *proxyFork) onTimerC(b *proxyBranch) {
+	f.mu.Lock()
+	provisional := b.provisional
+	final := b.final
+	f.mu.Unlock()
+	if final {
+		return
+	}
+
+	f.p.log.Debug("Timer C fired", "branch", b.req.Recipient.String())
+	if provisional {
+		f.cancelBranch(b)
+		return
+	}
+	// Treat as 408
+	b.tx.Terminate()
+}
+
+// cancel is called when CANCEL is received for request
+func (f *proxyFork) cancel() {
+	f.mu.Lock()
+	f.canceled = true
+	f.mu.Unlock()
+	f.cancelPending()
+}
+
+func (f *proxyFork) stopForking() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.canceled || f.answered || f.global
+}
+
+// cancelPending sends CANCEL to all branches without final response
+// https://datatracker.ietf.org/doc/html/rfc3261#section-16.10
+func (f *proxyFork) cancelPending() {
+	if !f.req.IsInvite() {
+		return
+	}
+
+	f.mu.Lock()
+	pending := make([]*proxyBranch, 0, len(f.branches))
+	for _, b := range f.branches {
+		if b.final {
+			continue
+		}
+		if !b.provisional {
+			// CANCEL must not be sent before provisional response
+			b.cancelPending = true
+			continue
+		}
+		pending = append(pending, b)
+	}
+	f.mu.Unlock()
+
+	for _, b := range pending {
+		f.cancelBranch(b)
+	}
+}
+
+func (f *proxyFork) cancelBranch(b *proxyBranch) {
+	f.mu.Lock()
+	b.cancelPending = false
+	f.mu.Unlock()
+
+	cancelReq := newCancelRequest(b.req)
+	cancelReq.SetDestination(b.req.Destination())
+	cancelReq.SetTransport(b.req.Transport())
+	cancelReq.AppendHeader(&sip.CSeqHeader{SeqNo: b.req.CSeq().SeqNo, MethodName: sip.CANCEL})
+	maxfwd := sip.MaxForwardsHeader(70)
+	cancelReq.AppendHeader(&maxfwd)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), f.p.client.timers().TimerF)
+		defer cancel()
+		res, err := f.p.client.Do(ctx, cancelReq, ClientRequestBuild)
+		if err != nil {
+			f.p.log.Debug("Canceling branch failed", "error", err, "branch", b.req.Recipient.String())
+		} else if res.StatusCode != sip.StatusOK {
+			f.p.log.Debug("Canceling branch failed with non 200 code", "code", res.StatusCode, "branch", b.req.Recipient.String())
+		}
+
+		// https://datatracker.ietf.org/doc/html/rfc3261#section-9.1
+		// If there is no final response for the original request in 64*T1 seconds
+		// client transaction is considered terminated
+		select {
+		case <-b.tx.Done():
+		case <-time.After(f.p.cancelTimeout):
+			b.tx.Terminate()
+		}
+	}()
+}
+
+// respondBest sends best final response if no 2xx was forwarded
+func (f *proxyFork) respondBest() error {
+	f.mu.Lock()
+	answered, canceled := f.answered, f.canceled
+	responses := f.responses
+	f.mu.Unlock()
+
+	if answered || canceled {
+		// On cancel server transaction already responded with 487
+		return nil
+	}
+
+	res := proxyBestResponse(f.req, responses)
+	return f.tx.Respond(res)
+}
+
+// proxyBestResponse chooses best final response
+// https://datatracker.ietf.org/doc/html/rfc3261#section-16.7 point 6
+func proxyBestResponse(req *sip.Request, responses []*sip.Response) *sip.Response {
+	if len(responses) == 0 {
+		return sip.NewResponseFromRequest(req, sip.StatusRequestTimeout, "Request Timeout", nil)
+	}
+
+	var best *sip.Response
+	for _, r := range responses {
+		if r.StatusCode >= 600 {
+			best = r
+			break
+		}
+		if best == nil || r.StatusCode/100 < best.StatusCode/100 {
+			best = r
+		}
+	}
+
+	switch best.StatusCode {
+	case sip.StatusServiceUnavailable:
+		// 503 should not be forwarded upstream
+		res := sip.NewResponseFromRequest(req, sip.StatusInternalServerError, "Server Internal Error", nil)
+		return res
+	case sip.StatusUnauthorized, sip.StatusProxyAuthRequired:
+		// Aggregate all challenges
+		orig := best
+		best = best.Clone()
+		for _, r := range responses {
+			if r == orig || (r.StatusCode != sip.StatusUnauthorized && r.StatusCode != sip.StatusProxyAuthRequired) {
+				continue
+			}
+			for _, name := range []string{"WWW-Authenticate", "Proxy-Authenticate"} {
+				for _, h := range r.GetHeaders(name) {
+					best.AppendHeader(sip.HeaderClone(h))
+				}
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,255 @@
+package sipgo
+
+import (
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	ErrStatelessProxyLoop = errors.New("loop detected")
+)
+
+// StatelessProxyRouter returns target for request which becomes new Request-URI.
+// Returning zero Uri keeps Request-URI. It can also call req.SetDestination to force destination.
+// For same request it must return same target, as retransmissions, CANCEL and ACK are routed independently.
+type StatelessProxyRouter func(req *sip.Request) (sip.Uri, error)
+
+type StatelessProxyOption func(p *StatelessProxy)
+
+// WithStatelessProxyHost sets host and port used in Via sent-by.
+// Default is host and listen port of transport
+func WithStatelessProxyHost(host string, port int) StatelessProxyOption {
+	return func(p *StatelessProxy) {
+		p.host = host
+		p.port = port
+	}
+}
+
+// WithStatelessProxyLogger sets proxy logger
+func WithStatelessProxyLogger(l *slog.Logger) StatelessProxyOption {
+	return func(p *StatelessProxy) {
+		p.log = l
+	}
+}
+
+// StatelessProxy forwards messages without creating transactions
+// https://datatracker.ietf.org/doc/html/rfc3261#section-16.11
+//
+// It must be attached to transport layer which has no transaction layer:
+//
+//	tp := sip.NewTransportLayer(net.DefaultResolver, sip.NewParser(), nil)
+//	sipgo.NewStatelessProxy(tp, router, sipgo.WithStatelessProxyHost("10.0.0.1", 5060))
+//	tp.ServeUDP(conn)
+//
+// Messages are forwarded in transport read loop.
+//
+// Experimental
+type StatelessProxy struct {
+	tp     *sip.TransportLayer
+	router StatelessProxyRouter
+	host   string
+	port   int
+	log    *slog.Logger
+}
+
+func NewStatelessProxy(tp *sip.TransportLayer, router StatelessProxyRouter, options ...StatelessProxyOption) *StatelessProxy {
+	p := &StatelessProxy{
+		tp:     tp,
+		router: router,
+		log:    sip.DefaultLogger().With("caller", "StatelessProxy"),
+	}
+	for _, o := range options {
+		o(p)
+	}
+
+	tp.OnMessage(p.handleMessage)
+	return p
+}
+
+func (p *StatelessProxy) handleMessage(msg sip.Message) {
+	switch m := msg.(type) {
+	case *sip.Request:
+		if err := p.forwardRequest(m); err != nil {
+			p.log.Debug("Failed to forward request", "error", err, "req", m.StartLine())
+		}
+	case *sip.Response:
+		if err := p.forwardResponse(m); err != nil {
+			p.log.Debug("Failed to forward response", "error", err, "res", m.StartLine())
+		}
+	}
+}
+
+func (p *StatelessProxy) forwardRequest(req *sip.Request) error {
+	topVia := req.Via()
+	if topVia == nil {
+		return errors.New("missing Via header")
+	}
+
+	maxfwd := sip.MaxForwardsHeader(70)
+	if h := req.MaxForwards(); h != nil {
+		if h.Val() == 0 {
+			return p.respond(req, sip.StatusTooManyHops, "Too Many Hops")
+		}
+		maxfwd = sip.MaxForwardsHeader(h.Val() - 1)
+	}
+
+	if p.isLoop(req) {
+		p.respond(req, sip.StatusLoopDetected, "Loop Detected")
+		return ErrStatelessProxyLoop
+	}
+
+	// Branch must be computed on request as received
+	branch := statelessProxyBranch(req, topVia)
+
+	target, err := p.router(req)
+	if err != nil {
+		return errors.Join(err, p.respond(req, sip.StatusNotFound, "Not Found"))
+	}
+
+	p.removeOwnRoute(req)
+	if target.Host != "" {
+		req.Recipient = target
+	}
+	if req.MaxForwards() != nil {
+		req.ReplaceHeader(&maxfwd)
+	} else {
+		req.AppendHeader(&maxfwd)
+	}
+
+	// Response is routed by this Via, so it must carry real source
+	// https://datatracker.ietf.org/doc/html/rfc3261#section-18.2.1
+	// https://datatracker.ietf.org/doc/html/rfc3581#section-4
+	if host, port, err := net.SplitHostPort(req.Source()); err == nil {
+		if topVia.Params.Has("rport") {
+			topVia.Params.Add("rport", port)
+			topVia.Params.Add("received", host)
+		} else if topVia.Host != host {
+			topVia.Params.Add("received", host)
+		}
+	}
+
+	// Transport is determined by target
+	req.SetTransport("")
+	transport := req.Transport()
+	req.SetTransport(transport)
+
+	via := &sip.ViaHeader{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       transport,
+		Host:            p.host,
+		Port:            p.sentByPort(transport),
+		Params:          sip.NewParams(),
+	}
+	via.Params.Add("branch", branch)
+	req.PrependHeader(via)
+
+	return p.tp.WriteMsg(req)
+}
+
+// forwardResponse strips our Via and sends response based on next Via
+func (p *StatelessProxy) forwardResponse(res *sip.Response) error {
+	via := res.Via()
+	if via == nil || !p.isOurVia(via) {
+		return errors.New("response top Via is not ours")
+	}
+
+	res.RemoveHeader("Via")
+	if res.Via() == nil {
+		return errors.New("response has no more Via headers")
+	}
+
+	res.SetTransport("")
+	res.SetDestination("")
+	return p.tp.WriteMsg(res)
+}
+
+func (p *StatelessProxy) respond(req *sip.Request, code int, reason string) error {
+	if req.IsAck() {
+		return nil
+	}
+	res := sip.NewResponseFromRequest(req, code, reason, nil)
+	return p.tp.WriteMsg(res)
+}
+
+// isLoop checks all our Via headers. If branch computed from request
+// matches branch in our Via, request is looping, otherwise it is spiral.
+// https://datatracker.ietf.org/doc/html/rfc3261#section-16.3 point 4
+func (p *StatelessProxy) isLoop(req *sip.Request) bool {
+	vias := req.GetHeaders("Via")
+	for i := 0; i < len(vias)-1; i++ {
+		via, ok := vias[i].(*sip.ViaHeader)
+		if !ok || !p.isOurVia(via) {
+			continue
+		}
+		prev, ok := vias[i+1].(*sip.ViaHeader)
+		if !ok {
+			continue
+		}
+		if via.Params.GetOr("branch", "") == statelessProxyBranch(req, prev) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *StatelessProxy) isOurVia(via *sip.ViaHeader) bool {
+	if via.Host != p.host {
+		return false
+	}
+	port := via.Port
+	if port == 0 {
+		port = int(sip.DefaultPort(via.Transport))
+	}
+	return port == p.sentByPort(via.Transport)
+}
+
+func (p *StatelessProxy) sentByPort(transport string) int {
+	if p.port > 0 {
+		return p.port
+	}
+	return p.tp.GetListenPort(sip.NetworkToLower(transport))
+}
+
+// removeOwnRoute removes top Route header if it points to us
+func (p *StatelessProxy) removeOwnRoute(req *sip.Request) {
+	route := req.Route()
+	if route == nil || route.Address.Host != p.host {
+		return
+	}
+	if route.Address.Port > 0 && route.Address.Port != p.sentByPort(req.Transport()) {
+		return
+	}
+	req.RemoveHeader("Route")
+}
+
+// statelessProxyBranch computes deterministic branch so that retransmissions and CANCEL
+// get same branch as original request.
+// https://datatracker.ietf.org/doc/html/rfc3261#section-16.11
+func statelessProxyBranch(req *sip.Request, topVia *sip.ViaHeader) string {
+	h := fnv.New128a()
+	h.Write([]byte(req.Recipient.String()))
+	// To tag is excluded as non 2xx ACK has To tag of response, which INVITE does not have
+	if from := req.From(); from != nil {
+		h.Write([]byte(from.Params.GetOr("tag", "")))
+	}
+	if callid := req.CallID(); callid != nil {
+		h.Write([]byte(callid.Value()))
+	}
+	if cseq := req.CSeq(); cseq != nil {
+		// Method is excluded as CANCEL and non 2xx ACK must match INVITE branch
+		h.Write([]byte(strconv.FormatUint(uint64(cseq.SeqNo), 10)))
+	}
+	h.Write([]byte(topVia.Host))
+	h.Write([]byte(strconv.Itoa(topVia.Port)))
+	h.Write([]byte(topVia.Params.GetOr("branch", "")))
+
+	var buf [16]byte
+	return sip.RFC3261BranchMagicCookie + hex.EncodeToString(h.Sum(buf[:0]))
+}
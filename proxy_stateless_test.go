@@ -0,0 +1,203 @@
+package sipgo
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatelessProxyBranch(t *testing.T) {
+	req, _, _ := createTestInvite(t, "sip:bob@proxy.sipgo.com", "UDP", "10.1.1.1:5060")
+
+	branch := statelessProxyBranch(req, req.Via())
+	assert.Equal(t, branch, statelessProxyBranch(req.Clone(), req.Via()), "retransmission must have same branch")
+
+	cancel := newCancelRequest(req)
+	cancel.AppendHeader(&sip.CSeqHeader{SeqNo: req.CSeq().SeqNo, MethodName: sip.CANCEL})
+	assert.Equal(t, branch, statelessProxyBranch(cancel, cancel.Via()), "CANCEL must have same branch as INVITE")
+
+	// ACK of non 2xx has same top Via as INVITE and To tag of response
+	ack := req.Clone()
+	ack.Method = sip.ACK
+	ack.CSeq().MethodName = sip.ACK
+	ack.To().Params.Add("tag", "uas")
+	assert.Equal(t, branch, statelessProxyBranch(ack, ack.Via()), "non 2xx ACK must have same branch as INVITE")
+
+	other := req.Clone()
+	other.CSeq().SeqNo++
+	assert.NotEqual(t, branch, statelessProxyBranch(other, other.Via()))
+}
+
+func testStatelessProxyConn(t testing.TB) (net.PacketConn, int) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func testStatelessProxyRead(t testing.TB, conn net.PacketConn) sip.Message {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	msg, err := sip.ParseMessage(buf[:n])
+	require.NoError(t, err)
+	return msg
+}
+
+func TestStatelessProxy(t *testing.T) {
+	proxyConn, proxyPort := testStatelessProxyConn(t)
+	uacConn, uacPort := testStatelessProxyConn(t)
+	uasConn, uasPort := testStatelessProxyConn(t)
+
+	tp := sip.NewTransportLayer(net.DefaultResolver, sip.NewParser(), nil)
+	t.Cleanup(func() { tp.Close() })
+	NewStatelessProxy(tp, func(req *sip.Request) (sip.Uri, error) {
+		return sip.Uri{User: req.Recipient.User, Host: "127.0.0.1", Port: uasPort}, nil
+	}, WithStatelessProxyHost("127.0.0.1", proxyPort))
+	go tp.ServeUDP(proxyConn)
+
+	proxyAddr := proxyConn.LocalAddr()
+	req, _, _ := createTestInvite(t, "sip:bob@127.0.0.1", "UDP", uacConn.LocalAddr().String())
+	req.Via().Port = uacPort
+	maxfwd := sip.MaxForwardsHeader(70)
+	req.AppendHeader(&maxfwd)
+
+	var branch string
+	t.Run("Request", func(t *testing.T) {
+		// Retransmission must be forwarded with same branch
+		for i := 0; i < 2; i++ {
+			_, err := uacConn.WriteTo([]byte(req.String()), proxyAddr)
+			require.NoError(t, err)
+
+			fwd := testStatelessProxyRead(t, uasConn).(*sip.Request)
+			vias := fwd.GetHeaders("Via")
+			require.Len(t, vias, 2)
+			via := fwd.Via()
+			assert.Equal(t, "127.0.0.1", via.Host)
+			assert.Equal(t, proxyPort, via.Port)
+			assert.Equal(t, uasPort, fwd.Recipient.Port)
+			assert.Equal(t, uint32(69), uint32(*fwd.MaxForwards()))
+			if branch == "" {
+				branch = via.Params.GetOr("branch", "")
+			}
+			assert.Equal(t, branch, via.Params.GetOr("branch", ""))
+		}
+	})
+
+	t.Run("Response", func(t *testing.T) {
+		fwd := req.Clone()
+		via := &sip.ViaHeader{
+			ProtocolName:    "SIP",
+			ProtocolVersion: "2.0",
+			Transport:       "UDP",
+			Host:            "127.0.0.1",
+			Port:            proxyPort,
+			Params:          sip.HeaderParams{{K: "branch", V: branch}},
+		}
+		fwd.PrependHeader(via)
+		res := sip.NewResponseFromRequest(fwd, sip.StatusRinging, "Ringing", nil)
+		_, err := uasConn.WriteTo([]byte(res.String()), proxyAddr)
+		require.NoError(t, err)
+
+		msg := testStatelessProxyRead(t, uacConn).(*sip.Response)
+		assert.Equal(t, sip.StatusRinging, msg.StatusCode)
+		require.Len(t, msg.GetHeaders("Via"), 1)
+		assert.Equal(t, uacPort, msg.Via().Port)
+	})
+
+	t.Run("LoopDetected", func(t *testing.T) {
+		loop := req.Clone()
+		via := &sip.ViaHeader{
+			ProtocolName:    "SIP",
+			ProtocolVersion: "2.0",
+			Transport:       "UDP",
+			Host:            "127.0.0.1",
+			Port:            proxyPort,
+			Params:          sip.HeaderParams{{K: "branch", V: statelessProxyBranch(req, req.Via())}},
+		}
+		loop.PrependHeader(via)
+		// Request came back to us through UAC
+		loop.PrependHeader(req.Via().Clone())
+
+		_, err := uacConn.WriteTo([]byte(loop.String()), proxyAddr)
+		require.NoError(t, err)
+
+		msg := testStatelessProxyRead(t, uacConn).(*sip.Response)
+		assert.Equal(t, sip.StatusLoopDetected, msg.StatusCode)
+	})
+
+	t.Run("TooManyHops", func(t *testing.T) {
+		hops := req.Clone()
+		maxfwd := sip.MaxForwardsHeader(0)
+		hops.ReplaceHeader(&maxfwd)
+		_, err := uacConn.WriteTo([]byte(hops.String()), proxyAddr)
+		require.NoError(t, err)
+
+		msg := testStatelessProxyRead(t, uacConn).(*sip.Response)
+		assert.Equal(t, sip.StatusTooManyHops, msg.StatusCode)
+	})
+}
+
+// BenchmarkProxy compares stateless and stateful forwarding of MESSAGE over UDP.
+// Each iteration is full transaction UAC -> proxy -> UAS
+func BenchmarkProxy(b *testing.B) {
+	uasConn, uasPort := testStatelessProxyConn(b)
+	uasUA, _ := NewUA()
+	defer uasUA.Close()
+	uas, _ := NewServer(uasUA)
+	uas.OnMessage(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+	})
+	go uas.ServeUDP(uasConn)
+
+	uacUA, _ := NewUA()
+	defer uacUA.Close()
+	uac, _ := NewClient(uacUA, WithClientHostname("127.0.0.1"))
+
+	target := sip.Uri{User: "bob", Host: "127.0.0.1", Port: uasPort}
+
+	run := func(b *testing.B, proxyPort int) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			req := sip.NewRequest(sip.MESSAGE, sip.Uri{User: "bob", Host: "127.0.0.1", Port: proxyPort})
+			res, err := uac.Do(context.Background(), req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if res.StatusCode != sip.StatusOK {
+				b.Fatal(res.StartLine())
+			}
+		}
+	}
+
+	b.Run("Stateless", func(b *testing.B) {
+		conn, port := testStatelessProxyConn(b)
+		tp := sip.NewTransportLayer(net.DefaultResolver, sip.NewParser(), nil)
+		defer tp.Close()
+		NewStatelessProxy(tp, func(req *sip.Request) (sip.Uri, error) {
+			return target, nil
+		}, WithStatelessProxyHost("127.0.0.1", port))
+		go tp.ServeUDP(conn)
+		run(b, port)
+	})
+
+	b.Run("Stateful", func(b *testing.B) {
+		conn, port := testStatelessProxyConn(b)
+		ua, _ := NewUA()
+		defer ua.Close()
+		srv, _ := NewServer(ua)
+		client, _ := NewClient(ua, WithClientHostname("127.0.0.1"))
+		p := NewProxy(client)
+		srv.OnMessage(func(req *sip.Request, tx sip.ServerTransaction) {
+			p.Forward(req, tx, []ProxyTarget{{Uri: target}})
+		})
+		go srv.ServeUDP(conn)
+		run(b, port)
+	})
+}
@@ -0,0 +1,167 @@
+package sipgo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testProxyInvite(t *testing.T) *sip.Request {
+	req, _, _ := createTestInvite(t, "sip:bob@proxy.sipgo.com", "TCP", "10.1.1.1:5060")
+	maxfwd := sip.MaxForwardsHeader(70)
+	req.AppendHeader(&maxfwd)
+	return req
+}
+
+func testProxyFinal(t *testing.T, rec *siptest.ServerTxRecorder) *sip.Response {
+	responses := rec.Result()
+	require.NotEmpty(t, responses)
+	res := responses[len(responses)-1]
+	require.False(t, res.IsProvisional(), res.StartLine())
+	return res
+}
+
+func TestProxyForward(t *testing.T) {
+	t.Run("TooManyHops", func(t *testing.T) {
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			t.Fatal("request should not be forwarded")
+			return nil
+		})
+		p := NewProxy(client)
+
+		req := testProxyInvite(t)
+		maxfwd := sip.MaxForwardsHeader(0)
+		req.ReplaceHeader(&maxfwd)
+		rec := siptest.NewServerTxRecorder(req)
+		require.NoError(t, p.Forward(req, rec, nil))
+		assert.Equal(t, sip.StatusTooManyHops, testProxyFinal(t, rec).StatusCode)
+	})
+
+	t.Run("ChallengeAggregation", func(t *testing.T) {
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			assert.Equal(t, uint32(69), uint32(*req.MaxForwards()))
+			assert.Len(t, req.GetHeaders("Via"), 2)
+			switch req.Recipient.User {
+			case "alice":
+				res := sip.NewResponseFromRequest(req, sip.StatusUnauthorized, "Unauthorized", nil)
+				res.AppendHeader(sip.NewHeader("WWW-Authenticate", `Digest realm="a", nonce="1"`))
+				return res
+			default:
+				res := sip.NewResponseFromRequest(req, sip.StatusProxyAuthRequired, "Proxy Authentication Required", nil)
+				res.AppendHeader(sip.NewHeader("Proxy-Authenticate", `Digest realm="b", nonce="2"`))
+				return res
+			}
+		})
+		p := NewProxy(client)
+
+		req := testProxyInvite(t)
+		rec := siptest.NewServerTxRecorder(req)
+		err := p.Forward(req, rec, []ProxyTarget{
+			{Uri: sip.Uri{User: "alice", Host: "10.2.2.2"}},
+			{Uri: sip.Uri{User: "bob", Host: "10.2.2.3"}},
+		})
+		require.NoError(t, err)
+
+		res := testProxyFinal(t, rec)
+		assert.Contains(t, []int{sip.StatusUnauthorized, sip.StatusProxyAuthRequired}, res.StatusCode)
+		assert.Len(t, res.GetHeaders("WWW-Authenticate"), 1)
+		assert.Len(t, res.GetHeaders("Proxy-Authenticate"), 1)
+		assert.Len(t, res.GetHeaders("Via"), 1)
+	})
+
+	t.Run("Global6xxCancelsPending", func(t *testing.T) {
+		var mu sync.Mutex
+		var pending *siptest.ClientTxResponder
+		var pendingReq *sip.Request
+		canceled := make(chan struct{})
+
+		client := testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+			switch {
+			case req.IsCancel():
+				w.Receive(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+				mu.Lock()
+				pending.Receive(sip.NewResponseFromRequest(pendingReq, sip.StatusRequestTerminated, "Request Terminated", nil))
+				mu.Unlock()
+				close(canceled)
+			case req.Recipient.User == "alice":
+				mu.Lock()
+				pending, pendingReq = w, req
+				mu.Unlock()
+				w.Receive(sip.NewResponseFromRequest(req, sip.StatusRinging, "Ringing", nil))
+			default:
+				time.Sleep(50 * time.Millisecond)
+				w.Receive(sip.NewResponseFromRequest(req, sip.StatusGlobalDecline, "Decline", nil))
+			}
+		})
+		p := NewProxy(client)
+
+		req := testProxyInvite(t)
+		rec := siptest.NewServerTxRecorder(req)
+		err := p.Forward(req, rec, []ProxyTarget{
+			{Uri: sip.Uri{User: "alice", Host: "10.2.2.2"}},
+			{Uri: sip.Uri{User: "bob", Host: "10.2.2.3"}},
+		})
+		require.NoError(t, err)
+
+		<-canceled
+		res := testProxyFinal(t, rec)
+		assert.Equal(t, sip.StatusGlobalDecline, res.StatusCode)
+
+		responses := rec.Result()
+		assert.Equal(t, sip.StatusTrying, responses[0].StatusCode)
+		assert.Equal(t, sip.StatusRinging, responses[1].StatusCode)
+	})
+
+	t.Run("Sequential", func(t *testing.T) {
+		var mu sync.Mutex
+		order := []string{}
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			mu.Lock()
+			order = append(order, req.Recipient.User)
+			mu.Unlock()
+			if req.Recipient.User == "bob" {
+				return sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+			}
+			return sip.NewResponseFromRequest(req, sip.StatusBusyHere, "Busy Here", nil)
+		})
+		p := NewProxy(client, WithProxyForking(ProxyForkSequential))
+
+		req := testProxyInvite(t)
+		rec := siptest.NewServerTxRecorder(req)
+		err := p.Forward(req, rec, []ProxyTarget{
+			{Uri: sip.Uri{User: "carol", Host: "10.2.2.4"}, Q: 0.1},
+			{Uri: sip.Uri{User: "bob", Host: "10.2.2.3"}, Q: 0.5},
+			{Uri: sip.Uri{User: "alice", Host: "10.2.2.2"}, Q: 1},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, sip.StatusOK, testProxyFinal(t, rec).StatusCode)
+		mu.Lock()
+		assert.Equal(t, []string{"alice", "bob"}, order)
+		mu.Unlock()
+	})
+
+	t.Run("TimerC", func(t *testing.T) {
+		client := testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+			if req.IsCancel() {
+				w.Receive(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+				return
+			}
+			w.Receive(sip.NewResponseFromRequest(req, sip.StatusRinging, "Ringing", nil))
+		})
+		p := NewProxy(client, WithProxyTimerC(50*time.Millisecond))
+		// Without final response after CANCEL branch is terminated and 408 is returned
+		p.cancelTimeout = 200 * time.Millisecond
+
+		req := testProxyInvite(t)
+		rec := siptest.NewServerTxRecorder(req)
+		err := p.Forward(req, rec, []ProxyTarget{{Uri: sip.Uri{User: "alice", Host: "10.2.2.2"}}})
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusRequestTimeout, testProxyFinal(t, rec).StatusCode)
+	})
+}
@@ -0,0 +1,334 @@
+// Package registrar implements SIP registrar and location service (RFC 3261 Section 10).
+package registrar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	// ErrOutOfOrder is returned when REGISTER has same Call-ID and not higher CSeq than existing binding
+	ErrOutOfOrder = errors.New("registrar: request out of order")
+)
+
+const (
+	DefaultExpires    = 3600 * time.Second
+	DefaultMinExpires = 60 * time.Second
+	DefaultMaxExpires = 24 * time.Hour
+)
+
+type RegistrarOption func(r *Registrar)
+
+// WithStore sets bindings storage. Default is MemoryStore
+func WithStore(s Store) RegistrarOption {
+	return func(r *Registrar) {
+		r.store = s
+	}
+}
+
+// WithExpires sets default, minimum and maximum binding expiration.
+// Requests below min are rejected with 423 Interval Too Brief, above max are shortened.
+func WithExpires(def time.Duration, min time.Duration, max time.Duration) RegistrarOption {
+	return func(r *Registrar) {
+		r.defaultExpires = def
+		r.minExpires = min
+		r.maxExpires = max
+	}
+}
+
+// WithLogger sets registrar logger
+func WithLogger(l *slog.Logger) RegistrarOption {
+	return func(r *Registrar) {
+		r.log = l
+	}
+}
+
+// Registrar handles REGISTER requests and keeps AOR bindings in Store.
+//
+// Usage:
+//
+//	reg := registrar.NewRegistrar()
+//	srv.OnRegister(reg.ServeRegister)
+//	go reg.Sweep(ctx, time.Minute)
+type Registrar struct {
+	store          Store
+	defaultExpires time.Duration
+	minExpires     time.Duration
+	maxExpires     time.Duration
+	log            *slog.Logger
+
+	// locks serialize binding updates per AOR
+	locks [32]sync.Mutex
+}
+
+func NewRegistrar(options ...RegistrarOption) *Registrar {
+	r := &Registrar{
+		defaultExpires: DefaultExpires,
+		minExpires:     DefaultMinExpires,
+		maxExpires:     DefaultMaxExpires,
+		log:            sip.DefaultLogger().With("caller", "Registrar"),
+	}
+
+	for _, o := range options {
+		o(r)
+	}
+
+	if r.store == nil {
+		r.store = NewMemoryStore()
+	}
+	return r
+}
+
+// AOR returns canonical address of record of uri in form sip:user@host
+func AOR(uri sip.Uri) string {
+	return "sip:" + uri.User + "@" + strings.ToLower(uri.Host)
+}
+
+// Lookup returns current bindings for uri ordered by q value, highest first.
+// It can be used by proxy to find targets for Request-URI.
+func (r *Registrar) Lookup(uri sip.Uri) ([]Binding, error) {
+	bindings, err := r.store.Bindings(AOR(uri))
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(bindings, func(a, b Binding) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return 0
+	})
+	return bindings, nil
+}
+
+// Sweep removes expired bindings on every interval until ctx is done
+func (r *Registrar) Sweep(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-t.C:
+			if err := r.store.RemoveExpired(now); err != nil {
+				r.log.Error("Failed to remove expired bindings", "error", err)
+			}
+		}
+	}
+}
+
+// ServeRegister is sipgo.RequestHandler for REGISTER requests.
+// Authentication should be done before, for example by wrapping with sipgo.DigestServerAuth Handler.
+func (r *Registrar) ServeRegister(req *sip.Request, tx sip.ServerTransaction) {
+	res := r.handleRegister(req)
+	if err := tx.Respond(res); err != nil {
+		r.log.Error("Failed to respond on REGISTER", "error", err)
+	}
+}
+
+func (r *Registrar) handleRegister(req *sip.Request) *sip.Response {
+	to := req.To()
+	callid := req.CallID()
+	cseq := req.CSeq()
+	if to == nil || callid == nil || cseq == nil {
+		return sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request", nil)
+	}
+
+	if to.Address.User == "" {
+		return sip.NewResponseFromRequest(req, sip.StatusNotFound, "Not Found", nil)
+	}
+	aor := AOR(to.Address)
+
+	// Expires header is default for all contacts without expires param
+	expires := r.defaultExpires
+	hasExpires := false
+	if h := req.GetHeader("Expires"); h != nil {
+		sec, err := strconv.ParseUint(strings.TrimSpace(h.Value()), 10, 32)
+		if err != nil {
+			return sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - Invalid Expires", nil)
+		}
+		expires = time.Duration(sec) * time.Second
+		hasExpires = true
+	}
+
+	contacts := req.GetHeaders("Contact")
+
+	lock := r.lock(aor)
+	lock.Lock()
+	defer lock.Unlock()
+
+	bindings, err := r.store.Bindings(aor)
+	if err != nil {
+		r.log.Error("Failed to get bindings", "error", err, "aor", aor)
+		return sip.NewResponseFromRequest(req, sip.StatusInternalServerError, "Server Internal Error", nil)
+	}
+
+	now := time.Now()
+	switch {
+	case len(contacts) == 0:
+		// Query for bindings
+	case isWildcard(contacts):
+		if len(contacts) > 1 || !hasExpires || expires != 0 {
+			return sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - Invalid Wildcard Contact", nil)
+		}
+		for _, b := range bindings {
+			if b.CallID == string(*callid) && cseq.SeqNo <= b.CSeq {
+				return r.responseOutOfOrder(req)
+			}
+		}
+		bindings = nil
+
+	default:
+		bindings, err = r.updateBindings(req, bindings, contacts, expires, now)
+		if err != nil {
+			var minErr errIntervalTooBrief
+			switch {
+			case errors.As(err, &minErr):
+				res := sip.NewResponseFromRequest(req, sip.StatusIntervalToBrief, "Interval Too Brief", nil)
+				res.AppendHeader(sip.NewHeader("Min-Expires", strconv.Itoa(int(r.minExpires.Seconds()))))
+				return res
+			case errors.Is(err, ErrOutOfOrder):
+				return r.responseOutOfOrder(req)
+			}
+			return sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - "+err.Error(), nil)
+		}
+	}
+
+	if len(contacts) > 0 {
+		if err := r.store.SetBindings(aor, bindings); err != nil {
+			r.log.Error("Failed to store bindings", "error", err, "aor", aor)
+			return sip.NewResponseFromRequest(req, sip.StatusInternalServerError, "Server Internal Error", nil)
+		}
+	}
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	for _, b := range bindings {
+		h := b.Contact.Clone()
+		h.Params.Add("expires", strconv.Itoa(int(b.Expires.Sub(now).Round(time.Second).Seconds())))
+		res.AppendHeader(h)
+	}
+	res.AppendHeader(sip.NewHeader("Date", now.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")))
+	return res
+}
+
+type errIntervalTooBrief time.Duration
+
+func (e errIntervalTooBrief) Error() string {
+	return fmt.Sprintf("interval too brief %s", time.Duration(e))
+}
+
+// updateBindings applies contacts on existing bindings as described in RFC 3261 10.3 step 7.
+// Nothing is applied if any contact fails
+func (r *Registrar) updateBindings(req *sip.Request, bindings []Binding, contacts []sip.Header, expires time.Duration, now time.Time) ([]Binding, error) {
+	callid := string(*req.CallID())
+	seqNo := req.CSeq().SeqNo
+	bindings = slices.Clone(bindings)
+
+	for _, h := range contacts {
+		c, ok := h.(*sip.ContactHeader)
+		if !ok {
+			return nil, fmt.Errorf("invalid Contact")
+		}
+
+		exp := expires
+		if v, ok := c.Params.Get("expires"); ok {
+			sec, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Contact expires")
+			}
+			exp = time.Duration(sec) * time.Second
+		}
+
+		if exp > 0 && exp < r.minExpires {
+			return nil, errIntervalTooBrief(exp)
+		}
+		if exp > r.maxExpires {
+			exp = r.maxExpires
+		}
+
+		q := 1.0
+		if v, ok := c.Params.Get("q"); ok {
+			var err error
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				return nil, fmt.Errorf("invalid Contact q")
+			}
+		}
+
+		ind := slices.IndexFunc(bindings, func(b Binding) bool {
+			return contactEqual(&b.Contact.Address, &c.Address)
+		})
+
+		if ind >= 0 {
+			b := bindings[ind]
+			if b.CallID == callid && seqNo <= b.CSeq {
+				return nil, ErrOutOfOrder
+			}
+			if exp == 0 {
+				bindings = slices.Delete(bindings, ind, ind+1)
+				continue
+			}
+		} else if exp == 0 {
+			continue
+		}
+
+		contact := c.Clone()
+		contact.Params.Remove("expires")
+		b := Binding{
+			Contact:   contact,
+			CallID:    callid,
+			CSeq:      seqNo,
+			Expires:   now.Add(exp),
+			Q:         q,
+			Source:    req.Source(),
+			Transport: req.Transport(),
+		}
+
+		if ind >= 0 {
+			bindings[ind] = b
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, nil
+}
+
+func (r *Registrar) responseOutOfOrder(req *sip.Request) *sip.Response {
+	return sip.NewResponseFromRequest(req, sip.StatusInternalServerError, "Server Internal Error - Request Out Of Order", nil)
+}
+
+func (r *Registrar) lock(aor string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(aor))
+	return &r.locks[h.Sum32()%uint32(len(r.locks))]
+}
+
+func isWildcard(contacts []sip.Header) bool {
+	for _, h := range contacts {
+		if c, ok := h.(*sip.ContactHeader); ok && c.Address.Wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// contactEqual is simplified URI comparison from RFC 3261 19.1.4
+func contactEqual(a *sip.Uri, b *sip.Uri) bool {
+	return a.User == b.User &&
+		strings.EqualFold(a.Host, b.Host) &&
+		a.Port == b.Port &&
+		strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.UriParams.GetOr("transport", ""), b.UriParams.GetOr("transport", ""))
+}
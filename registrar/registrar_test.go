@@ -0,0 +1,135 @@
+package registrar
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRegister(t *testing.T, callid string, cseq int, headers ...string) *sip.Request {
+	msg := []string{
+		"REGISTER sip:sipgo.com SIP/2.0",
+		"Via: SIP/2.0/UDP 10.1.1.1:5060;branch=z9hG4bK.regtest-" + callid + "-" + strconv.Itoa(cseq),
+		"From: <sip:alice@sipgo.com>;tag=1234",
+		"To: <sip:alice@sipgo.com>",
+		"Call-ID: " + callid,
+		"CSeq: " + strconv.Itoa(cseq) + " REGISTER",
+		"Max-Forwards: 70",
+	}
+	msg = append(msg, headers...)
+	msg = append(msg, "Content-Length: 0", "", "")
+
+	m, err := sip.ParseMessage([]byte(strings.Join(msg, "\r\n")))
+	require.NoError(t, err)
+	return m.(*sip.Request)
+}
+
+func register(t *testing.T, r *Registrar, req *sip.Request) *sip.Response {
+	rec := siptest.NewServerTxRecorder(req)
+	r.ServeRegister(req, rec)
+	res := rec.Result()
+	require.Len(t, res, 1)
+	return res[0]
+}
+
+func TestRegistrar(t *testing.T) {
+	r := NewRegistrar()
+	aor := sip.Uri{User: "alice", Host: "sipgo.com"}
+
+	t.Run("MultipleContacts", func(t *testing.T) {
+		res := register(t, r, newRegister(t, "call1", 1,
+			"Contact: <sip:alice@10.1.1.1:5060>;q=0.5, <sip:alice@10.1.1.2:5060>;q=0.9;expires=120",
+			"Expires: 300",
+		))
+		require.Equal(t, sip.StatusOK, res.StatusCode)
+		require.Len(t, res.GetHeaders("Contact"), 2)
+		require.NotNil(t, res.GetHeader("Date"))
+
+		bindings, err := r.Lookup(aor)
+		require.NoError(t, err)
+		require.Len(t, bindings, 2)
+		assert.Equal(t, "10.1.1.2", bindings[0].Contact.Address.Host)
+		assert.Equal(t, 0.9, bindings[0].Q)
+		assert.WithinDuration(t, time.Now().Add(120*time.Second), bindings[0].Expires, time.Second)
+		assert.WithinDuration(t, time.Now().Add(300*time.Second), bindings[1].Expires, time.Second)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		res := register(t, r, newRegister(t, "call2", 1))
+		require.Equal(t, sip.StatusOK, res.StatusCode)
+		contacts := res.GetHeaders("Contact")
+		require.Len(t, contacts, 2)
+		assert.True(t, contacts[0].(*sip.ContactHeader).Params.Has("expires"))
+	})
+
+	t.Run("OutOfOrder", func(t *testing.T) {
+		res := register(t, r, newRegister(t, "call1", 1,
+			"Contact: <sip:alice@10.1.1.1:5060>",
+		))
+		require.Equal(t, sip.StatusInternalServerError, res.StatusCode)
+	})
+
+	t.Run("IntervalTooBrief", func(t *testing.T) {
+		res := register(t, r, newRegister(t, "call1", 2,
+			"Contact: <sip:alice@10.1.1.1:5060>",
+			"Expires: 10",
+		))
+		require.Equal(t, sip.StatusIntervalToBrief, res.StatusCode)
+		require.Equal(t, "60", res.GetHeader("Min-Expires").Value())
+	})
+
+	t.Run("RemoveContact", func(t *testing.T) {
+		res := register(t, r, newRegister(t, "call1", 3,
+			"Contact: <sip:alice@10.1.1.1:5060>;expires=0",
+		))
+		require.Equal(t, sip.StatusOK, res.StatusCode)
+		require.Len(t, res.GetHeaders("Contact"), 1)
+	})
+
+	t.Run("WildcardRequiresExpiresZero", func(t *testing.T) {
+		res := register(t, r, newRegister(t, "call1", 4,
+			"Contact: *",
+		))
+		require.Equal(t, sip.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Wildcard", func(t *testing.T) {
+		res := register(t, r, newRegister(t, "call1", 5,
+			"Contact: *",
+			"Expires: 0",
+		))
+		require.Equal(t, sip.StatusOK, res.StatusCode)
+		require.Empty(t, res.GetHeaders("Contact"))
+
+		bindings, err := r.Lookup(aor)
+		require.NoError(t, err)
+		require.Empty(t, bindings)
+	})
+}
+
+func TestRegistrarSweep(t *testing.T) {
+	store := NewMemoryStore()
+	r := NewRegistrar(WithStore(store), WithExpires(time.Second, time.Second, time.Hour))
+
+	res := register(t, r, newRegister(t, "call1", 1,
+		"Contact: <sip:alice@10.1.1.1:5060>",
+	))
+	require.Equal(t, sip.StatusOK, res.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Sweep(ctx, 100*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		return len(store.bindings) == 0
+	}, 3*time.Second, 50*time.Millisecond)
+}
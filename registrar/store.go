@@ -0,0 +1,97 @@
+package registrar
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// Binding is single Contact bound to address of record (AOR)
+type Binding struct {
+	// Contact as received in REGISTER.
+	Contact *sip.ContactHeader
+	// CallID and CSeq of REGISTER that created or refreshed binding
+	CallID string
+	CSeq   uint32
+	// Expires is absolute expiry time of binding
+	Expires time.Time
+	// Q is contact preference 0.0 - 1.0. Missing q param is treated as 1.0
+	Q float64
+	// Source and Transport of REGISTER request.
+	Source    string
+	Transport string
+}
+
+// Expired checks is binding expired at given time
+func (b *Binding) Expired(now time.Time) bool {
+	return !now.Before(b.Expires)
+}
+
+// Store is storage for bindings.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Bindings returns all current bindings for AOR.
+	Bindings(aor string) ([]Binding, error)
+	// SetBindings replaces all bindings for AOR. Empty list removes AOR.
+	SetBindings(aor string, bindings []Binding) error
+	// RemoveExpired removes all bindings expired at given time
+	RemoveExpired(now time.Time) error
+}
+
+// MemoryStore is in memory Store implementation
+type MemoryStore struct {
+	mu       sync.RWMutex
+	bindings map[string][]Binding
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		bindings: make(map[string][]Binding),
+	}
+}
+
+func (s *MemoryStore) Bindings(aor string) ([]Binding, error) {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bindings := make([]Binding, 0, len(s.bindings[aor]))
+	for _, b := range s.bindings[aor] {
+		if b.Expired(now) {
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, nil
+}
+
+func (s *MemoryStore) SetBindings(aor string, bindings []Binding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(bindings) == 0 {
+		delete(s.bindings, aor)
+		return nil
+	}
+	s.bindings[aor] = slices.Clone(bindings)
+	return nil
+}
+
+func (s *MemoryStore) RemoveExpired(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for aor, bindings := range s.bindings {
+		bindings = slices.DeleteFunc(bindings, func(b Binding) bool {
+			return b.Expired(now)
+		})
+		if len(bindings) == 0 {
+			delete(s.bindings, aor)
+			continue
+		}
+		s.bindings[aor] = bindings
+	}
+	return nil
+}
@@ -0,0 +1,543 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRegistratorClosed = errors.New("registrator closed")
+)
+
+type RegistrationState int
+
+const (
+	// REGISTER is sent
+	RegistrationStateRegistering RegistrationState = 1
+	// REGISTER received 2xx
+	RegistrationStateRegistered RegistrationState = 2
+	// REGISTER failed on all targets
+	RegistrationStateFailed RegistrationState = 3
+	// Bindings are removed
+	RegistrationStateUnregistered RegistrationState = 4
+)
+
+func (s RegistrationState) String() string {
+	switch s {
+	case RegistrationStateRegistering:
+		return "Registering"
+	case RegistrationStateRegistered:
+		return "Registered"
+	case RegistrationStateFailed:
+		return "Failed"
+	case RegistrationStateUnregistered:
+		return "Unregistered"
+	default:
+		return "Unknown Registration State"
+	}
+}
+
+type RegistrationStateFn func(s RegistrationState)
+
+type RegistratorOptions struct {
+	// Targets are registrar URIs. On failure next target is used.
+	Targets []sip.Uri
+	// AOR is address of record used in To and From.
+	// Default is Username@target host
+	AOR sip.Uri
+	// Contact to bind. Default is built from client host and port
+	Contact *sip.ContactHeader
+
+	// For digest authentication
+	Username string
+	Password string
+
+	// Expiry requested from registrar. Default 3600s
+	Expiry time.Duration
+	// RetryMin and RetryMax are backoff bounds after failure. Default 5s and 5m
+	RetryMin time.Duration
+	RetryMax time.Duration
+
+	// InstanceID is +sip.instance Contact parameter. It must be URN persistent across UA restarts
+	// like urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6.
+	// Together with RegID it enables SIP Outbound https://datatracker.ietf.org/doc/html/rfc5626
+	InstanceID string
+	// RegID is reg-id Contact parameter identifying flow of this registration. Usually 1
+	RegID int
+}
+
+const (
+	// Keep alive intervals when registrar does not send Flow-Timer
+	// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4.1
+	outboundFlowTimerReliable   = 120 * time.Second
+	outboundFlowTimerUnreliable = 29 * time.Second
+	// outboundPongTimeout is time after flow is considered failed if pong is not received
+	outboundPongTimeout = 10 * time.Second
+)
+
+type outboundFlow struct {
+	flow  sip.Flow
+	timer time.Duration
+}
+
+// Registrator keeps registration alive on one of registrar targets.
+// It handles digest authentication, refreshing before expiry, 423 Interval Too Brief
+// and failover to next target.
+//
+// Experimental
+type Registrator struct {
+	client *Client
+	opts   RegistratorOptions
+	log    *slog.Logger
+
+	// mu serializes REGISTER requests
+	mu      sync.Mutex
+	callID  sip.CallIDHeader
+	fromTag string
+	cseq    uint32
+	expiry  time.Duration
+
+	target  atomic.Int32
+	granted atomic.Int64
+
+	state          atomic.Int32
+	onStatePointer atomic.Pointer[RegistrationStateFn]
+
+	// flow is set when SIP Outbound is negotiated with registrar
+	flow          atomic.Pointer[outboundFlow]
+	flowKeepAlive func(ctx context.Context, f sip.Flow) error
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewRegistrator(client *Client, opts RegistratorOptions) (*Registrator, error) {
+	if len(opts.Targets) == 0 {
+		return nil, fmt.Errorf("no registrar targets")
+	}
+
+	if opts.Expiry <= 0 {
+		opts.Expiry = 3600 * time.Second
+	}
+	if opts.RetryMin <= 0 {
+		opts.RetryMin = 5 * time.Second
+	}
+	if opts.RetryMax < opts.RetryMin {
+		opts.RetryMax = max(5*time.Minute, opts.RetryMin)
+	}
+
+	callid, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registrator{
+		client:  client,
+		opts:    opts,
+		log:     client.log.With("caller", "Registrator"),
+		callID:  sip.CallIDHeader(callid.String()),
+		fromTag: sip.GenerateTagN(16),
+		cseq:    randUniform32() & 0x7FFF,
+		expiry:  opts.Expiry,
+		closed:  make(chan struct{}),
+	}
+	r.flowKeepAlive = client.TransportLayer().FlowKeepAlive
+	return r, nil
+}
+
+// OnState registers callback for registration state changes
+func (r *Registrator) OnState(f RegistrationStateFn) {
+	for current := r.onStatePointer.Load(); current != nil; current = r.onStatePointer.Load() {
+		cb := *current
+		newCb := func(s RegistrationState) {
+			f(s)
+			cb(s)
+		}
+		newCBState := RegistrationStateFn(newCb)
+		if r.onStatePointer.CompareAndSwap(current, &newCBState) {
+			return
+		}
+	}
+	r.onStatePointer.Store(&f)
+}
+
+// StateRead returns channel of state changes.
+// States are dropped if channel is not read
+func (r *Registrator) StateRead() <-chan RegistrationState {
+	ch := make(chan RegistrationState, 5)
+	r.OnState(func(s RegistrationState) {
+		select {
+		case ch <- s:
+		default:
+		}
+	})
+	return ch
+}
+
+func (r *Registrator) LoadState() RegistrationState {
+	return RegistrationState(r.state.Load())
+}
+
+func (r *Registrator) setState(s RegistrationState) {
+	old := r.state.Swap(int32(s))
+	if old == int32(s) {
+		return
+	}
+
+	if f := r.onStatePointer.Load(); f != nil {
+		cb := *f
+		cb(s)
+	}
+}
+
+// Target returns current registrar target
+func (r *Registrator) Target() sip.Uri {
+	return r.opts.Targets[r.target.Load()]
+}
+
+// Expires returns expiry granted by registrar on last registration
+func (r *Registrator) Expires() time.Duration {
+	return time.Duration(r.granted.Load())
+}
+
+// Flow returns RFC 5626 flow of current registration.
+// It is available only when SIP Outbound is negotiated with registrar
+func (r *Registrator) Flow() (sip.Flow, bool) {
+	of := r.flow.Load()
+	if of == nil {
+		return sip.Flow{}, false
+	}
+	return of.flow, true
+}
+
+// Register sends REGISTER starting with current target and fails over to next targets.
+// On success current target is one that accepted registration.
+func (r *Registrator) Register(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.closed:
+		return ErrRegistratorClosed
+	default:
+	}
+
+	r.setState(RegistrationStateRegistering)
+	var errs []error
+	for i := 0; i < len(r.opts.Targets); i++ {
+		target := r.Target()
+		granted, err := r.register(ctx, target, r.expiry)
+		if err == nil {
+			r.granted.Store(int64(granted))
+			r.setState(RegistrationStateRegistered)
+			return nil
+		}
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+		r.log.Info("Registration failed, trying next target", "target", target.String(), "error", err)
+		r.target.Store((r.target.Load() + 1) % int32(len(r.opts.Targets)))
+	}
+
+	r.setState(RegistrationStateFailed)
+	return errors.Join(errs...)
+}
+
+// Unregister removes our binding from current target
+func (r *Registrator) Unregister(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.unregister(ctx)
+}
+
+func (r *Registrator) unregister(ctx context.Context) error {
+	_, err := r.register(ctx, r.Target(), 0)
+	if err != nil {
+		return err
+	}
+	r.granted.Store(0)
+	r.flow.Store(nil)
+	r.setState(RegistrationStateUnregistered)
+	return nil
+}
+
+// Run registers and keeps refreshing registration before it expires.
+// On failure it retries with exponential backoff.
+// With SIP Outbound it sends keep alives over flow and registers again once flow fails.
+// It blocks until ctx is done or Close is called.
+func (r *Registrator) Run(ctx context.Context) error {
+	retry := r.opts.RetryMin
+	for {
+		var wait time.Duration
+		var flowFailed <-chan error
+		kaCtx, kaCancel := context.WithCancel(ctx)
+		if err := r.Register(ctx); err != nil {
+			r.log.Error("Registration failed", "error", err, "retry", retry)
+			wait = retry
+			retry = min(2*retry, r.opts.RetryMax)
+		} else {
+			retry = r.opts.RetryMin
+			wait = registerRefreshInterval(r.Expires(), r.client.timers().TimerF)
+			flowFailed = r.keepAlive(kaCtx)
+		}
+
+		select {
+		case <-ctx.Done():
+			kaCancel()
+			return ctx.Err()
+		case <-r.closed:
+			kaCancel()
+			return ErrRegistratorClosed
+		case err := <-flowFailed:
+			r.log.Info("Outbound flow failed, registering again", "error", err)
+		case <-time.After(wait):
+		}
+		kaCancel()
+	}
+}
+
+// keepAlive sends keep alives over outbound flow until ctx is done.
+// Returned channel receives error once flow fails. It is nil if outbound is not negotiated
+// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4
+func (r *Registrator) keepAlive(ctx context.Context) <-chan error {
+	of := r.flow.Load()
+	if of == nil {
+		return nil
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(outboundKeepAliveInterval(of.timer)):
+			}
+
+			pctx, cancel := context.WithTimeout(ctx, outboundPongTimeout)
+			err := r.flowKeepAlive(pctx, of.flow)
+			cancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					failed <- err
+				}
+				return
+			}
+		}
+	}()
+	return failed
+}
+
+// Close stops Run and unregisters if registered
+func (r *Registrator) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+
+	// Waits registration in progress, so binding created by it is removed
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.LoadState() != RegistrationStateRegistered {
+		return nil
+	}
+	return r.unregister(context.Background())
+}
+
+// register does single registration on target with retry on 401/407 and 423.
+// It returns granted expiry
+func (r *Registrator) register(ctx context.Context, target sip.Uri, expiry time.Duration) (time.Duration, error) {
+	contact := r.contact()
+	authorized := false
+	for {
+		req := r.newRequest(target, contact, expiry)
+		res, err := r.client.Do(ctx, req)
+		if err != nil {
+			return 0, err
+		}
+
+		if !authorized && (res.StatusCode == sip.StatusUnauthorized || res.StatusCode == sip.StatusProxyAuthRequired) {
+			res, err = r.client.DoDigestAuth(ctx, req, res, DigestAuth{
+				Username: r.opts.Username,
+				Password: r.opts.Password,
+			})
+			if err != nil {
+				return 0, err
+			}
+			// Digest auth increases CSeq on request
+			r.cseq = req.CSeq().SeqNo
+			authorized = true
+		}
+
+		if res.StatusCode == sip.StatusIntervalToBrief && expiry > 0 {
+			h := res.GetHeader("Min-Expires")
+			if h == nil {
+				return 0, fmt.Errorf("423 response missing Min-Expires")
+			}
+			sec, err := strconv.ParseUint(strings.TrimSpace(h.Value()), 10, 32)
+			minExp := time.Duration(sec) * time.Second
+			if err != nil || minExp <= expiry {
+				return 0, fmt.Errorf("423 response with invalid Min-Expires %q", h.Value())
+			}
+			expiry = minExp
+			r.expiry = minExp
+			authorized = false
+			continue
+		}
+
+		if !res.IsSuccess() {
+			return 0, fmt.Errorf("register failed with response %d %s", res.StatusCode, res.Reason)
+		}
+		granted := registerGrantedExpiry(res, contact, expiry)
+		if expiry > 0 && granted <= 0 {
+			// Refreshing with zero expiry would loop without any wait
+			return 0, fmt.Errorf("register response %d %s granted zero expiry", res.StatusCode, res.Reason)
+		}
+		if expiry > 0 {
+			r.outboundFlow(res)
+		}
+		return granted, nil
+	}
+}
+
+func (r *Registrator) newRequest(target sip.Uri, contact *sip.ContactHeader, expiry time.Duration) *sip.Request {
+	aor := r.opts.AOR
+	if aor.Host == "" {
+		aor = sip.Uri{
+			Scheme: target.Scheme,
+			User:   r.opts.Username,
+			Host:   target.Host,
+		}
+	}
+
+	recipient := *target.Clone()
+	recipient.User = ""
+	req := sip.NewRequest(sip.REGISTER, recipient)
+
+	from := &sip.FromHeader{Address: aor, Params: sip.NewParams()}
+	from.Params.Add("tag", r.fromTag)
+	callid := r.callID
+	r.cseq++
+	expires := sip.ExpiresHeader(expiry.Seconds())
+	req.AppendHeader(&sip.ToHeader{Address: aor})
+	req.AppendHeader(from)
+	req.AppendHeader(&callid)
+	req.AppendHeader(&sip.CSeqHeader{SeqNo: r.cseq, MethodName: sip.REGISTER})
+	req.AppendHeader(contact.Clone())
+	req.AppendHeader(&expires)
+	if r.outbound() {
+		addOptionTag(req, "Supported", "path")
+		addOptionTag(req, "Supported", "outbound")
+	}
+	return req
+}
+
+func (r *Registrator) outbound() bool {
+	return r.opts.InstanceID != "" && r.opts.RegID > 0
+}
+
+// outboundFlow stores flow of registration if registrar supports outbound.
+// Registrar confirms it with Require: outbound and can set keep alive interval with Flow-Timer
+// https://datatracker.ietf.org/doc/html/rfc5626#section-4.2.1
+func (r *Registrator) outboundFlow(res *sip.Response) {
+	r.flow.Store(nil)
+	if !r.outbound() {
+		return
+	}
+
+	if !hasOptionTag(res, "Require", "outbound") {
+		r.log.Debug("Registrar does not support outbound")
+		return
+	}
+
+	of := &outboundFlow{
+		flow:  r.client.TransportLayer().MessageFlow(res),
+		timer: outboundFlowTimerUnreliable,
+	}
+	if sip.IsReliable(res.Transport()) {
+		of.timer = outboundFlowTimerReliable
+	}
+	if h := res.GetHeader("Flow-Timer"); h != nil {
+		if sec, err := strconv.ParseUint(strings.TrimSpace(h.Value()), 10, 32); err == nil && sec > 0 {
+			of.timer = time.Duration(sec) * time.Second
+		}
+	}
+	r.flow.Store(of)
+}
+
+func (r *Registrator) contact() *sip.ContactHeader {
+	var contact *sip.ContactHeader
+	if r.opts.Contact != nil {
+		contact = r.opts.Contact.Clone()
+	} else {
+		user := r.opts.Username
+		if user == "" {
+			user = r.client.name
+		}
+		contact = &sip.ContactHeader{
+			Address: sip.Uri{
+				User: user,
+				Host: r.client.host,
+				Port: r.client.port,
+			},
+		}
+	}
+
+	if r.outbound() {
+		// https://datatracker.ietf.org/doc/html/rfc5626#section-4.2
+		if contact.Params == nil {
+			contact.Params = sip.NewParams()
+		}
+		contact.Params.Add("+sip.instance", `"<`+r.opts.InstanceID+`>"`)
+		contact.Params.Add("reg-id", strconv.Itoa(r.opts.RegID))
+	}
+	return contact
+}
+
+// registerGrantedExpiry reads expiry from our Contact in response or Expires header
+func registerGrantedExpiry(res *sip.Response, contact *sip.ContactHeader, requested time.Duration) time.Duration {
+	for _, h := range res.GetHeaders("Contact") {
+		c, ok := h.(*sip.ContactHeader)
+		if !ok || c.Address.User != contact.Address.User || !strings.EqualFold(c.Address.Host, contact.Address.Host) || c.Address.Port != contact.Address.Port {
+			continue
+		}
+		if v, ok := c.Params.Get("expires"); ok {
+			if sec, err := strconv.ParseUint(v, 10, 32); err == nil {
+				return time.Duration(sec) * time.Second
+			}
+		}
+	}
+
+	if h := res.GetHeader("Expires"); h != nil {
+		if sec, err := strconv.ParseUint(strings.TrimSpace(h.Value()), 10, 32); err == nil {
+			return time.Duration(sec) * time.Second
+		}
+	}
+	return requested
+}
+
+// outboundKeepAliveInterval returns random interval between 80% and 100% of flow timer
+// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4.1
+func outboundKeepAliveInterval(flowTimer time.Duration) time.Duration {
+	return flowTimer - time.Duration(rand.Int64N(int64(flowTimer/5)+1))
+}
+
+// registerRefreshInterval leaves enough time for transaction to complete before expiry
+func registerRefreshInterval(expiry time.Duration, timerF time.Duration) time.Duration {
+	if expiry > 2*timerF {
+		return expiry - timerF
+	}
+	return expiry / 2
+}
@@ -0,0 +1,245 @@
+package sipgo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrator(t *testing.T) {
+	auth := NewDigestServerAuth("sipgo", DigestCredentialsMap{"alice": "alicepass"})
+
+	t.Run("DigestAuth", func(t *testing.T) {
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			if _, err := auth.Verify(req); err != nil {
+				return auth.Challenge(req, false)
+			}
+			res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+			cont := req.Contact().Clone()
+			cont.Params = sip.HeaderParams{{K: "expires", V: "120"}}
+			res.AppendHeader(cont)
+			return res
+		})
+
+		reg, err := NewRegistrator(client, RegistratorOptions{
+			Targets:  []sip.Uri{{Host: "sipgo.com"}},
+			Username: "alice",
+			Password: "alicepass",
+		})
+		require.NoError(t, err)
+
+		states := reg.StateRead()
+		require.NoError(t, reg.Register(context.TODO()))
+		assert.Equal(t, RegistrationStateRegistered, reg.LoadState())
+		assert.Equal(t, 120*time.Second, reg.Expires())
+		assert.Equal(t, RegistrationStateRegistering, <-states)
+		assert.Equal(t, RegistrationStateRegistered, <-states)
+
+		// Refresh must authenticate again
+		require.NoError(t, reg.Register(context.TODO()))
+	})
+
+	t.Run("IntervalTooBrief", func(t *testing.T) {
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			if req.GetHeader("Expires").Value() != "600" {
+				res := sip.NewResponseFromRequest(req, sip.StatusIntervalToBrief, "Interval Too Brief", nil)
+				res.AppendHeader(sip.NewHeader("Min-Expires", "600"))
+				return res
+			}
+			res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+			res.AppendHeader(sip.NewHeader("Expires", "600"))
+			return res
+		})
+
+		reg, err := NewRegistrator(client, RegistratorOptions{
+			Targets: []sip.Uri{{Host: "sipgo.com"}},
+			Expiry:  60 * time.Second,
+		})
+		require.NoError(t, err)
+		require.NoError(t, reg.Register(context.TODO()))
+		assert.Equal(t, 600*time.Second, reg.Expires())
+	})
+
+	t.Run("Outbound", func(t *testing.T) {
+		var mu sync.Mutex
+		var registers []*sip.Request
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			mu.Lock()
+			registers = append(registers, req)
+			mu.Unlock()
+			res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+			res.AppendHeader(sip.NewHeader("Require", "outbound"))
+			res.AppendHeader(sip.NewHeader("Flow-Timer", "1"))
+			return res
+		})
+
+		reg, err := NewRegistrator(client, RegistratorOptions{
+			Targets:    []sip.Uri{{Host: "sipgo.com"}},
+			Username:   "alice",
+			InstanceID: "urn:uuid:00000000-0000-1000-8000-000a95a0e128",
+			RegID:      1,
+		})
+		require.NoError(t, err)
+
+		var pings atomic.Int32
+		reg.flowKeepAlive = func(ctx context.Context, f sip.Flow) error {
+			if pings.Add(1) == 2 {
+				return sip.ErrTransportFlowFailed
+			}
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go reg.Run(ctx)
+
+		// Second ping fails and flow is registered again
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(registers) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+
+		_, ok := reg.Flow()
+		assert.True(t, ok)
+
+		mu.Lock()
+		req := registers[0]
+		mu.Unlock()
+		contact := req.Contact()
+		instance, _ := contact.Params.Get("+sip.instance")
+		assert.Equal(t, `"<urn:uuid:00000000-0000-1000-8000-000a95a0e128>"`, instance)
+		regID, _ := contact.Params.Get("reg-id")
+		assert.Equal(t, "1", regID)
+		assert.True(t, hasOptionTag(req, "Supported", "path"))
+		assert.True(t, hasOptionTag(req, "Supported", "outbound"))
+	})
+
+	t.Run("OutboundNotSupported", func(t *testing.T) {
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			return sip.NewResponseFromRequest(req, 200, "OK", nil)
+		})
+		reg, err := NewRegistrator(client, RegistratorOptions{
+			Targets:    []sip.Uri{{Host: "sipgo.com"}},
+			InstanceID: "urn:uuid:00000000-0000-1000-8000-000a95a0e128",
+			RegID:      1,
+		})
+		require.NoError(t, err)
+		require.NoError(t, reg.Register(context.TODO()))
+		_, ok := reg.Flow()
+		assert.False(t, ok)
+	})
+
+	t.Run("ZeroExpiry", func(t *testing.T) {
+		var registers atomic.Int32
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			registers.Add(1)
+			res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+			res.AppendHeader(sip.NewHeader("Expires", "0"))
+			return res
+		})
+
+		reg, err := NewRegistrator(client, RegistratorOptions{
+			Targets:  []sip.Uri{{Host: "sipgo.com"}},
+			RetryMin: time.Second,
+		})
+		require.NoError(t, err)
+		require.Error(t, reg.Register(context.TODO()))
+		assert.Equal(t, RegistrationStateFailed, reg.LoadState())
+
+		// Run backs off instead of refreshing in loop
+		registers.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, reg.Run(ctx), context.DeadlineExceeded)
+		assert.Equal(t, int32(1), registers.Load())
+	})
+
+	t.Run("CloseWhileRegistering", func(t *testing.T) {
+		var mu sync.Mutex
+		var expires []string
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			mu.Lock()
+			expires = append(expires, req.GetHeader("Expires").Value())
+			mu.Unlock()
+			if req.GetHeader("Expires").Value() != "0" {
+				close(entered)
+				<-release
+			}
+			return sip.NewResponseFromRequest(req, 200, "OK", nil)
+		})
+
+		reg, err := NewRegistrator(client, RegistratorOptions{
+			Targets: []sip.Uri{{Host: "sipgo.com"}},
+		})
+		require.NoError(t, err)
+
+		registered := make(chan error)
+		go func() { registered <- reg.Register(context.TODO()) }()
+		<-entered
+
+		closed := make(chan error)
+		go func() { closed <- reg.Close() }()
+		select {
+		case <-closed:
+			t.Fatal("close did not wait registration")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		require.NoError(t, <-registered)
+		require.NoError(t, <-closed)
+		assert.Equal(t, RegistrationStateUnregistered, reg.LoadState())
+		mu.Lock()
+		assert.Equal(t, []string{"3600", "0"}, expires)
+		mu.Unlock()
+
+		require.ErrorIs(t, reg.Register(context.TODO()), ErrRegistratorClosed)
+	})
+
+	t.Run("FailoverAndClose", func(t *testing.T) {
+		var mu sync.Mutex
+		var lastExpires string
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			if req.Recipient.Host == "primary.sipgo.com" {
+				return sip.NewResponseFromRequest(req, sip.StatusServiceUnavailable, "Service Unavailable", nil)
+			}
+			mu.Lock()
+			lastExpires = req.GetHeader("Expires").Value()
+			mu.Unlock()
+			return sip.NewResponseFromRequest(req, 200, "OK", nil)
+		})
+
+		reg, err := NewRegistrator(client, RegistratorOptions{
+			Targets: []sip.Uri{{Host: "primary.sipgo.com"}, {Host: "backup.sipgo.com"}},
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error)
+		go func() { done <- reg.Run(ctx) }()
+
+		require.Eventually(t, func() bool {
+			return reg.LoadState() == RegistrationStateRegistered
+		}, 3*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "backup.sipgo.com", reg.Target().Host)
+		assert.Equal(t, 3600*time.Second, reg.Expires())
+
+		require.NoError(t, reg.Close())
+		require.ErrorIs(t, <-done, ErrRegistratorClosed)
+		assert.Equal(t, RegistrationStateUnregistered, reg.LoadState())
+		mu.Lock()
+		assert.Equal(t, "0", lastExpires)
+		mu.Unlock()
+	})
+}
@@ -0,0 +1,275 @@
+package sipgo
+
+import (
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// RouteMatcher matches request for route
+type RouteMatcher func(req *sip.Request) bool
+
+// Route is router rule. Request is routed to Handler when method, event and all matchers match
+type Route struct {
+	// Method of request. Empty matches any method
+	Method sip.RequestMethod
+	// Event is event package for SUBSCRIBE, NOTIFY and PUBLISH requests.
+	// Requests for event package without route are rejected with 489 Bad Event
+	Event string
+	// Match are matchers that all must match
+	Match []RouteMatcher
+	// Priority of route. Routes with higher priority are matched first,
+	// and routes with same priority in order they are added
+	Priority int
+
+	Handler RequestHandler
+}
+
+// Router routes requests by method, Request-URI, headers and source.
+// It is used with WithServerRouter and routes are checked before handlers registered on server.
+// Request without matching route is answered with:
+//   - 489 Bad Event if event package is not routed for SUBSCRIBE, NOTIFY or PUBLISH
+//   - 404 Not Found if any route for method exists
+//   - 405 Method Not Allowed otherwise
+//
+// Routes must be added before serving
+type Router struct {
+	routes  []Route
+	noMatch RequestHandler
+}
+
+// NewRouter creates new router. Use it with WithServerRouter
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Add adds route
+func (r *Router) Add(route Route) {
+	r.routes = append(r.routes, route)
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].Priority > r.routes[j].Priority
+	})
+}
+
+// Handle adds route for method with matchers
+func (r *Router) Handle(method sip.RequestMethod, handler RequestHandler, match ...RouteMatcher) {
+	r.Add(Route{Method: method, Match: match, Handler: handler})
+}
+
+// OnNoMatch replaces default 404/405/489 responses when no route matches
+func (r *Router) OnNoMatch(handler RequestHandler) {
+	r.noMatch = handler
+}
+
+// Methods returns list of routed methods
+func (r *Router) Methods() []sip.RequestMethod {
+	methods := make([]sip.RequestMethod, 0, len(r.routes))
+	for _, route := range r.routes {
+		if route.Method != "" && !slices.Contains(methods, route.Method) {
+			methods = append(methods, route.Method)
+		}
+	}
+	return methods
+}
+
+// Match returns handler of first matching route
+func (r *Router) Match(req *sip.Request) (RequestHandler, bool) {
+	for i := range r.routes {
+		if r.routes[i].match(req) {
+			return r.routes[i].Handler, true
+		}
+	}
+	return nil, false
+}
+
+func (route *Route) match(req *sip.Request) bool {
+	if route.Method != "" && route.Method != req.Method {
+		return false
+	}
+	if route.Event != "" && routeEvent(req) != route.Event {
+		return false
+	}
+	for _, m := range route.Match {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// respondNoMatch responds on request without route. allow is list of all methods handled by server
+func (r *Router) respondNoMatch(req *sip.Request, tx sip.ServerTransaction, allow []string) error {
+	if r.noMatch != nil {
+		r.noMatch(req, tx)
+		return nil
+	}
+
+	var res *sip.Response
+	switch events := r.events(req.Method); {
+	case isEventMethod(req.Method) && len(events) > 0 && !events.Has(routeEvent(req)):
+		res = sip.NewResponseFromRequest(req, sip.StatusBadEvent, "Bad Event", nil)
+		res.AppendHeader(&events)
+	case r.routed(req.Method):
+		res = sip.NewResponseFromRequest(req, sip.StatusNotFound, "Not Found", nil)
+	default:
+		res = sip.NewResponseFromRequest(req, sip.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		if len(allow) > 0 {
+			res.AppendHeader(sip.NewHeader("Allow", strings.Join(allow, ", ")))
+		}
+	}
+	return tx.Respond(res)
+}
+
+// routed checks is any route for method
+func (r *Router) routed(method sip.RequestMethod) bool {
+	for _, route := range r.routes {
+		if route.Method == "" || route.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// events returns routed event packages for method
+func (r *Router) events(method sip.RequestMethod) sip.AllowEventsHeader {
+	var events sip.AllowEventsHeader
+	for _, route := range r.routes {
+		if route.Event == "" || (route.Method != "" && route.Method != method) {
+			continue
+		}
+		if !events.Has(route.Event) {
+			events = append(events, route.Event)
+		}
+	}
+	return events
+}
+
+func isEventMethod(method sip.RequestMethod) bool {
+	return method == sip.SUBSCRIBE || method == sip.NOTIFY || method == sip.PUBLISH
+}
+
+func routeEvent(req *sip.Request) string {
+	if ev := req.Event(); ev != nil {
+		return ev.Event
+	}
+	return ""
+}
+
+// MatchURIUser matches Request-URI user. Feature codes like *97 are matched as is
+func MatchURIUser(user string) RouteMatcher {
+	return func(req *sip.Request) bool {
+		return req.Recipient.User == user
+	}
+}
+
+// MatchURIUserPrefix matches Request-URI user starting with prefix
+func MatchURIUserPrefix(prefix string) RouteMatcher {
+	return func(req *sip.Request) bool {
+		return strings.HasPrefix(req.Recipient.User, prefix)
+	}
+}
+
+// MatchURIUserRegexp matches Request-URI user with regular expression
+func MatchURIUserRegexp(re *regexp.Regexp) RouteMatcher {
+	return func(req *sip.Request) bool {
+		return re.MatchString(req.Recipient.User)
+	}
+}
+
+// MatchURIHost matches Request-URI host case insensitive.
+// Domain pattern *.example.com matches any subdomain of example.com
+func MatchURIHost(host string) RouteMatcher {
+	return func(req *sip.Request) bool {
+		return matchDomain(req.Recipient.Host, host)
+	}
+}
+
+// MatchURIParam matches Request-URI parameter value. Empty value matches only existence of parameter
+func MatchURIParam(name string, value string) RouteMatcher {
+	return func(req *sip.Request) bool {
+		if req.Recipient.UriParams == nil {
+			return false
+		}
+		v, ok := req.Recipient.UriParams.Get(name)
+		return ok && (value == "" || v == value)
+	}
+}
+
+// MatchToHost matches To header host. See MatchURIHost for pattern
+func MatchToHost(host string) RouteMatcher {
+	return func(req *sip.Request) bool {
+		to := req.To()
+		return to != nil && matchDomain(to.Address.Host, host)
+	}
+}
+
+// MatchHeader matches header value without parameters, case insensitive.
+// Empty value matches only existence of header
+func MatchHeader(name string, value string) RouteMatcher {
+	return func(req *sip.Request) bool {
+		for _, h := range req.GetHeaders(name) {
+			if value == "" {
+				return true
+			}
+			v, _, _ := strings.Cut(h.Value(), ";")
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchTransport matches transport request is received on, like UDP or TLS
+func MatchTransport(transports ...string) RouteMatcher {
+	return func(req *sip.Request) bool {
+		tp := req.Transport()
+		for _, t := range transports {
+			if strings.EqualFold(tp, t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchSourcePort matches source port of request
+func MatchSourcePort(port int) RouteMatcher {
+	return func(req *sip.Request) bool {
+		_, p, err := net.SplitHostPort(req.Source())
+		if err != nil {
+			return false
+		}
+		return p == strconv.Itoa(port)
+	}
+}
+
+// MatchSource matches source IP of request within any of prefixes
+func MatchSource(prefixes ...netip.Prefix) RouteMatcher {
+	return func(req *sip.Request) bool {
+		addr, err := netip.ParseAddrPort(req.Source())
+		if err != nil {
+			return false
+		}
+		ip := addr.Addr().Unmap()
+		for _, p := range prefixes {
+			if p.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchDomain(host string, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return len(host) > len(suffix) && strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(suffix))
+	}
+	return strings.EqualFold(host, pattern)
+}
@@ -0,0 +1,151 @@
+package sipgo
+
+import (
+	"context"
+	"net/netip"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterMatch(t *testing.T) {
+	var matched string
+	route := func(name string) RequestHandler {
+		return func(req *sip.Request, tx sip.ServerTransaction) { matched = name }
+	}
+	newRequest := func(method sip.RequestMethod, user string, host string) *sip.Request {
+		req := sip.NewRequest(method, sip.Uri{User: user, Host: host})
+		req.SetSource("10.0.0.1:5080")
+		req.SetTransport("TCP")
+		return req
+	}
+	match := func(r *Router, req *sip.Request) string {
+		matched = ""
+		if h, ok := r.Match(req); ok {
+			h(req, nil)
+		}
+		return matched
+	}
+
+	r := NewRouter()
+	r.Handle(sip.INVITE, route("voicemail"), MatchURIUser("*97"))
+	r.Handle(sip.INVITE, route("features"), MatchURIUserPrefix("*"))
+	r.Handle(sip.INVITE, route("tenant"), MatchURIHost("*.tenant.com"))
+	r.Handle(sip.INVITE, route("extension"), MatchURIUserRegexp(regexp.MustCompile(`^\d{3}$`)))
+	r.Add(Route{Method: sip.INVITE, Match: []RouteMatcher{MatchSource(netip.MustParsePrefix("10.0.0.0/8")), MatchSourcePort(5080), MatchTransport("tcp")}, Priority: 10, Handler: route("trunk")})
+	r.Add(Route{Method: sip.SUBSCRIBE, Event: "presence", Handler: route("presence")})
+	r.Add(Route{Method: sip.SUBSCRIBE, Event: "dialog", Handler: route("dialog")})
+	r.Handle(sip.MESSAGE, route("im"), MatchHeader("Content-Type", "text/plain"))
+	r.Handle("", route("any"), MatchURIHost("any.com"))
+
+	// Priority is matched before order
+	assert.Equal(t, "trunk", match(r, newRequest(sip.INVITE, "*97", "example.com")))
+
+	req := newRequest(sip.INVITE, "*97", "example.com")
+	req.SetSource("192.168.0.1:5080")
+	assert.Equal(t, "voicemail", match(r, req))
+	req.Recipient.User = "*98"
+	assert.Equal(t, "features", match(r, req))
+	req.Recipient.User = "alice"
+	req.Recipient.Host = "Acme.Tenant.com"
+	assert.Equal(t, "tenant", match(r, req))
+	req.Recipient.Host = "tenant.com"
+	assert.Equal(t, "", match(r, req))
+	req.Recipient.User = "100"
+	assert.Equal(t, "extension", match(r, req))
+
+	sub := newRequest(sip.SUBSCRIBE, "alice", "example.com")
+	sub.AppendHeader(&sip.EventHeader{Event: "dialog", Params: sip.HeaderParams{{K: "id", V: "1"}}})
+	assert.Equal(t, "dialog", match(r, sub))
+	sub.ReplaceHeader(&sip.EventHeader{Event: "presence"})
+	assert.Equal(t, "presence", match(r, sub))
+
+	msg := newRequest(sip.MESSAGE, "alice", "example.com")
+	assert.Equal(t, "", match(r, msg))
+	msg.AppendHeader(sip.NewHeader("Content-Type", "Text/Plain;charset=utf-8"))
+	assert.Equal(t, "im", match(r, msg))
+
+	assert.Equal(t, "any", match(r, newRequest(sip.OPTIONS, "", "any.com")))
+
+	assert.ElementsMatch(t, []sip.RequestMethod{sip.INVITE, sip.SUBSCRIBE, sip.MESSAGE}, r.Methods())
+}
+
+func TestServerRouter(t *testing.T) {
+	mem := sip.NewMemoryNetwork()
+	newMemoryUA := func(t *testing.T) *UserAgent {
+		ua, err := NewUA()
+		require.NoError(t, err)
+		require.NoError(t, ua.TransportLayer().RegisterTransport("memory", sip.NewTransportMemory(mem, sip.NewParser())))
+		return ua
+	}
+	newRequest := func(method sip.RequestMethod, user string) *sip.Request {
+		return sip.NewRequest(method, sip.Uri{User: user, Host: "uas", Port: 5060, UriParams: sip.HeaderParams{{K: "transport", V: "memory"}}})
+	}
+	respond := func(code int) RequestHandler {
+		return func(req *sip.Request, tx sip.ServerTransaction) {
+			tx.Respond(sip.NewResponseFromRequest(req, code, "", nil))
+		}
+	}
+
+	router := NewRouter()
+	router.Handle(sip.INVITE, respond(sip.StatusOK), MatchURIUser("*97"))
+	router.Add(Route{Method: sip.SUBSCRIBE, Event: "presence", Handler: respond(sip.StatusAccepted)})
+
+	uas := newMemoryUA(t)
+	defer uas.Close()
+	srv, err := NewServer(uas, WithServerRouter(router))
+	require.NoError(t, err)
+	// Handlers registered on server are used when no route matches
+	srv.OnOptions(respond(sip.StatusOK))
+
+	l, err := mem.Listen("uas:5060")
+	require.NoError(t, err)
+	go srv.Serve("memory", l)
+
+	uac := newMemoryUA(t)
+	defer uac.Close()
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	do := func(req *sip.Request) *sip.Response {
+		res, err := client.Do(ctx, req)
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.Equal(t, sip.StatusOK, do(newRequest(sip.INVITE, "*97")).StatusCode)
+	assert.Equal(t, sip.StatusOK, do(newRequest(sip.OPTIONS, "")).StatusCode)
+	assert.Equal(t, sip.StatusNotFound, do(newRequest(sip.INVITE, "*98")).StatusCode)
+
+	res := do(newRequest(sip.MESSAGE, "alice"))
+	assert.Equal(t, sip.StatusMethodNotAllowed, res.StatusCode)
+	allow := res.GetHeader("Allow")
+	require.NotNil(t, allow)
+	for _, m := range []string{"INVITE", "SUBSCRIBE", "OPTIONS"} {
+		assert.Contains(t, allow.Value(), m)
+	}
+
+	sub := newRequest(sip.SUBSCRIBE, "alice")
+	sub.AppendHeader(&sip.EventHeader{Event: "presence"})
+	assert.Equal(t, sip.StatusAccepted, do(sub).StatusCode)
+
+	sub = newRequest(sip.SUBSCRIBE, "alice")
+	sub.AppendHeader(&sip.EventHeader{Event: "dialog"})
+	res = do(sub)
+	assert.Equal(t, sip.StatusBadEvent, res.StatusCode)
+	require.NotNil(t, res.GetHeader("Allow-Events"))
+	assert.Equal(t, "presence", res.GetHeader("Allow-Events").Value())
+
+	t.Run("OnNoMatch", func(t *testing.T) {
+		router.OnNoMatch(respond(sip.StatusForbidden))
+		defer router.OnNoMatch(nil)
+		assert.Equal(t, sip.StatusForbidden, do(newRequest(sip.INVITE, "*98")).StatusCode)
+	})
+}
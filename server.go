@@ -3,6 +3,7 @@ package sipgo
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -13,6 +14,9 @@ import (
 )
 
 var (
+	// ErrServerClosed is returned by serve functions after Shutdown
+	ErrServerClosed = errors.New("sipgo: Server closed")
+
 	// Used only for testing, better way is to pass listener with Serve{Transport}
 	ListenReadyCtxKey = "ListenReadyCtxKey"
 )
@@ -41,10 +45,19 @@ type Server struct {
 	// requestHandlers map of all registered request handlers
 	requestHandlers map[sip.RequestMethod]RequestHandler
 	noRouteHandler  RequestHandler
+	router          *Router
 
 	log *slog.Logger
 
 	requestMiddlewares []func(r *sip.Request)
+	// middlewares wrap request handlers. See Use
+	middlewares       []RequestMiddleware
+	methodMiddlewares map[sip.RequestMethod][]RequestMiddleware
+	// chainGlobal and chainMethods are handlers wrapped with middlewares
+	chainGlobal  RequestHandler
+	chainMethods map[sip.RequestMethod]RequestHandler
+
+	overload *overloadController
 }
 
 type ServerOption func(s *Server) error
@@ -57,6 +70,24 @@ func WithServerLogger(logger *slog.Logger) ServerOption {
 	}
 }
 
+// WithServerOverloadControl enables overload control. New requests are rejected with 503
+// when server is above thresholds and reduction is advertised to RFC 7339 clients. See OverloadConfig
+func WithServerOverloadControl(conf OverloadConfig) ServerOption {
+	return func(s *Server) error {
+		s.overload = newOverloadController(conf)
+		return nil
+	}
+}
+
+// WithServerRouter routes requests with router before handlers registered with OnRequest.
+// Requests not handled by either are answered by router. See Router
+func WithServerRouter(r *Router) ServerOption {
+	return func(s *Server) error {
+		s.router = r
+		return nil
+	}
+}
+
 // NewServer creates new instance of SIP server handle.
 // Allows creating server transaction handlers
 // It uses User Agent transport and transaction layer
@@ -93,8 +124,11 @@ func newBaseServer(ua *UserAgent, options ...ServerOption) (*Server, error) {
 }
 
 // Serve will fire all listeners
-// Network supported: udp, tcp, ws
+// Network supported: udp, tcp, ws, unix (registered with sip.NewTransportUnix)
 func (srv *Server) ListenAndServe(ctx context.Context, network string, addr string) error {
+	if srv.tx.Draining() {
+		return ErrServerClosed
+	}
 	network = strings.ToLower(network)
 
 	watchContext := func(connCloser io.Closer) {
@@ -121,7 +155,7 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 
 		go watchContext(udpConn)
 		listenReadyCtx(ctx, network, udpConn.LocalAddr().String())
-		return srv.tp.ServeUDP(udpConn)
+		return srv.serveErr(srv.tp.ServeUDP(udpConn))
 
 	case "tcp", "tcp4", "tcp6":
 		laddr, err := net.ResolveTCPAddr(network, addr)
@@ -137,7 +171,7 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 		go watchContext(conn)
 		listenReadyCtx(ctx, network, conn.Addr().String())
 
-		return srv.tp.ServeTCP(conn)
+		return srv.serveErr(srv.tp.ServeTCP(conn))
 	case "ws", "ws4", "ws6":
 		ipv := network[2:]
 		network = "tcp" + ipv
@@ -154,7 +188,17 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 		go watchContext(conn)
 		listenReadyCtx(ctx, network, conn.Addr().String())
 		// and uses listener to buffer
-		return srv.tp.ServeWS(conn)
+		return srv.serveErr(srv.tp.ServeWS(conn))
+	case "unix":
+		// Transport must be registered with sip.NewTransportUnix
+		conn, err := net.Listen("unix", addr)
+		if err != nil {
+			return fmt.Errorf("listen unix error. err=%w", err)
+		}
+
+		go watchContext(conn)
+		listenReadyCtx(ctx, network, conn.Addr().String())
+		return srv.serveErr(srv.tp.Serve(network, conn))
 	}
 	return sip.ErrTransportNotSuported
 }
@@ -162,6 +206,9 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 // Serve will fire all listeners that are secured.
 // Network supported: tls, wss, tcp, tcp4, tcp6, ws, ws4, ws6
 func (srv *Server) ListenAndServeTLS(ctx context.Context, network string, addr string, conf *tls.Config) error {
+	if srv.tx.Draining() {
+		return ErrServerClosed
+	}
 	network = strings.ToLower(network)
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -208,10 +255,10 @@ func (srv *Server) ListenAndServeTLS(ctx context.Context, network string, addr s
 		listenReadyCtx(ctx, network, listener.Addr().String())
 
 		if network == "wss" {
-			return srv.tp.ServeWSS(listener)
+			return srv.serveErr(srv.tp.ServeWSS(listener))
 		}
 
-		return srv.tp.ServeTLS(listener)
+		return srv.serveErr(srv.tp.ServeTLS(listener))
 	}
 
 	return sip.ErrTransportNotSuported
@@ -219,36 +266,54 @@ func (srv *Server) ListenAndServeTLS(ctx context.Context, network string, addr s
 
 // ServeUDP starts serving request on UDP type listener.
 func (srv *Server) ServeUDP(l net.PacketConn) error {
-	return srv.tp.ServeUDP(l)
+	return srv.serveErr(srv.tp.ServeUDP(l))
 }
 
 // ServeTCP starts serving request on TCP type listener.
 func (srv *Server) ServeTCP(l net.Listener) error {
-	return srv.tp.ServeTCP(l)
+	return srv.serveErr(srv.tp.ServeTCP(l))
 }
 
 // ServeTLS starts serving request on TLS type listener.
 func (srv *Server) ServeTLS(l net.Listener) error {
-	return srv.tp.ServeTLS(l)
+	return srv.serveErr(srv.tp.ServeTLS(l))
 }
 
 // ServeWS starts serving request on WS type listener.
 func (srv *Server) ServeWS(l net.Listener) error {
-	return srv.tp.ServeWS(l)
+	return srv.serveErr(srv.tp.ServeWS(l))
 }
 
 // ServeWS starts serving request on WS type listener.
 func (srv *Server) ServeWSS(l net.Listener) error {
-	return srv.tp.ServeWSS(l)
+	return srv.serveErr(srv.tp.ServeWSS(l))
+}
+
+// Serve starts serving request on listener with transport registered for network.
+func (srv *Server) Serve(network string, l net.Listener) error {
+	return srv.serveErr(srv.tp.Serve(network, l))
+}
+
+// serveErr returns ErrServerClosed if serving stopped due to Shutdown
+func (srv *Server) serveErr(err error) error {
+	if srv.tx.Draining() {
+		return ErrServerClosed
+	}
+	return err
 }
 
 // handleRequest is handling transaction layer
 func (srv *Server) handleRequest(req *sip.Request, tx *sip.ServerTx) {
+	if srv.overload != nil && tx != nil && !srv.overload.serve(req, tx) {
+		tx.TerminateGracefully()
+		return
+	}
+
 	for _, mid := range srv.requestMiddlewares {
 		mid(req)
 	}
 
-	handler := srv.getHandler(req.Method)
+	handler := srv.chainHandler(req.Method)
 	handler(req, tx)
 	if tx != nil {
 		// Must be called to prevent any transaction leaks
@@ -256,12 +321,22 @@ func (srv *Server) handleRequest(req *sip.Request, tx *sip.ServerTx) {
 	}
 }
 
+// OverloadStats returns overload control metrics.
+// It returns false if overload control is not enabled with WithServerOverloadControl
+func (srv *Server) OverloadStats() (OverloadStats, bool) {
+	if srv.overload == nil {
+		return OverloadStats{}, false
+	}
+	return srv.overload.stats(), true
+}
+
 // WriteResponse will proxy message to transport layer. Use it in stateless mode
 func (srv *Server) WriteResponse(r *sip.Response) error {
 	return srv.tp.WriteMsg(r)
 }
 
 // Close server handle. UserAgent must be closed for full transaction and transport layer closing.
+// For graceful stop use Shutdown.
 func (srv *Server) Close() error {
 	return nil
 }
@@ -355,17 +430,42 @@ func (srv *Server) RegisteredMethods() []string {
 	for k, _ := range srv.requestHandlers {
 		r = append(r, k.String())
 	}
+	if srv.router != nil {
+		for _, m := range srv.router.Methods() {
+			if _, ok := srv.requestHandlers[m]; !ok {
+				r = append(r, m.String())
+			}
+		}
+	}
 	return r
 }
 
-func (srv *Server) getHandler(method sip.RequestMethod) (handler RequestHandler) {
-	handler, ok := srv.requestHandlers[method]
+func (srv *Server) getHandler(req *sip.Request) (handler RequestHandler) {
+	if srv.router != nil {
+		if handler, ok := srv.router.Match(req); ok {
+			return handler
+		}
+	}
+	handler, ok := srv.requestHandlers[req.Method]
 	if !ok {
+		if srv.router != nil {
+			return srv.routerNoMatch
+		}
 		return srv.noRouteHandler
 	}
 	return handler
 }
 
+func (srv *Server) routerNoMatch(req *sip.Request, tx sip.ServerTransaction) {
+	srv.log.Debug("SIP request route not found", "method", req.Method, "uri", req.Recipient.String())
+	if req.IsAck() {
+		return
+	}
+	if err := srv.router.respondNoMatch(req, tx, srv.RegisteredMethods()); err != nil {
+		srv.log.Error("respond on no route failed", "error", err)
+	}
+}
+
 func (srv *Server) defaultUnhandledHandler(req *sip.Request, tx sip.ServerTransaction) {
 	srv.log.Warn("SIP request handler not found", "method", req.Method)
 	res := sip.NewResponseFromRequest(req, 405, "Method Not Allowed", nil)
@@ -0,0 +1,441 @@
+package sipgo
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/icholy/digest"
+)
+
+var (
+	ErrDigestCredentialsNotFound = errors.New("digest credentials not found")
+	ErrDigestUnauthorized        = errors.New("digest unauthorized")
+	ErrDigestStaleNonce          = errors.New("digest stale nonce")
+)
+
+// DigestCredentials are credentials returned by DigestCredentialStore.
+// Either Password or HA1 must be provided.
+type DigestCredentials struct {
+	// Password is plain text password
+	Password string
+	// HA1 is precomputed H(username:realm:password) keyed by algorithm (MD5, SHA-256, SHA-512-256).
+	// It is used when Password is empty.
+	HA1 map[string]string
+}
+
+// DigestCredentialStore is used by DigestServerAuth to lookup user credentials.
+type DigestCredentialStore interface {
+	// DigestCredentials returns credentials for username within realm.
+	// It must return ErrDigestCredentialsNotFound in case user does not exist.
+	DigestCredentials(username string, realm string) (DigestCredentials, error)
+}
+
+// DigestCredentialsMap is simple in memory credential store with username -> plain password mapping
+type DigestCredentialsMap map[string]string
+
+func (m DigestCredentialsMap) DigestCredentials(username string, realm string) (DigestCredentials, error) {
+	passwd, exists := m[username]
+	if !exists {
+		return DigestCredentials{}, ErrDigestCredentialsNotFound
+	}
+	return DigestCredentials{Password: passwd}, nil
+}
+
+type DigestServerAuthOption func(a *DigestServerAuth)
+
+// WithDigestServerAuthAlgorithms sets algorithms offered in challenge. Order matters as clients
+// mostly pick first. Supported: MD5, SHA-256, SHA-512-256
+// Default: MD5
+func WithDigestServerAuthAlgorithms(algs ...string) DigestServerAuthOption {
+	return func(a *DigestServerAuth) {
+		a.algorithms = algs
+	}
+}
+
+// WithDigestServerAuthQOP sets qop options offered in challenge. Supported: auth, auth-int
+// Passing nothing disables qop (RFC 2069 compatibility).
+// Default: auth
+func WithDigestServerAuthQOP(qop ...string) DigestServerAuthOption {
+	return func(a *DigestServerAuth) {
+		a.qop = qop
+	}
+}
+
+// WithDigestServerAuthNonceExpire sets how long issued nonce is valid.
+// After expire client is rechallenged with stale=true
+// Default: 5 min
+func WithDigestServerAuthNonceExpire(d time.Duration) DigestServerAuthOption {
+	return func(a *DigestServerAuth) {
+		a.nonceExpire = d
+	}
+}
+
+// WithDigestServerAuthProxy makes authenticator act as proxy by responding
+// 407 Proxy Authentication Required and reading Proxy-Authorization header
+func WithDigestServerAuthProxy() DigestServerAuthOption {
+	return func(a *DigestServerAuth) {
+		a.proxy = true
+	}
+}
+
+// WithDigestServerAuthLogger allows customizing authenticator logger
+func WithDigestServerAuthLogger(l *slog.Logger) DigestServerAuthOption {
+	return func(a *DigestServerAuth) {
+		a.log = l
+	}
+}
+
+// digestNonce is state of nonce used in authorized request
+type digestNonce struct {
+	created time.Time
+	// nc is last nonce count used with this nonce. Any request with lower or same nc is replay
+	nc int
+}
+
+// digestNonceSize is size of nonce before hex encoding: timestamp, random and HMAC
+const digestNonceSize = 8 + 8 + 16
+
+// digestOpaque is opaque sent in challenge, which client must return unchanged
+const digestOpaque = "sipgo"
+
+// DigestServerAuth is server side digest authentication based on
+// https://datatracker.ietf.org/doc/html/rfc3261#section-22.4 and
+// https://datatracker.ietf.org/doc/html/rfc8760
+//
+// It issues challenges and verifies credentials against DigestCredentialStore.
+// Nonces are stateless, signed with HMAC of timestamp, so challenging does not keep any state.
+// Only nonces of authorized requests are tracked to detect replay.
+// Use Handler to wrap your request handlers
+type DigestServerAuth struct {
+	realm       string
+	store       DigestCredentialStore
+	algorithms  []string
+	qop         []string
+	nonceExpire time.Duration
+	proxy       bool
+	log         *slog.Logger
+
+	// secret signs nonces
+	secret []byte
+
+	mu        sync.Mutex
+	nonces    map[string]*digestNonce
+	lastSweep time.Time
+}
+
+// NewDigestServerAuth creates server digest authenticator for realm
+func NewDigestServerAuth(realm string, store DigestCredentialStore, options ...DigestServerAuthOption) *DigestServerAuth {
+	a := &DigestServerAuth{
+		realm:       realm,
+		store:       store,
+		algorithms:  []string{"MD5"},
+		qop:         []string{"auth"},
+		nonceExpire: 5 * time.Minute,
+		log:         sip.DefaultLogger().With("caller", "DigestServerAuth"),
+		nonces:      make(map[string]*digestNonce),
+		secret:      make([]byte, 32),
+	}
+	rand.Read(a.secret)
+
+	for _, o := range options {
+		o(a)
+	}
+	return a
+}
+
+// Handler wraps request handler and calls it only if request is authorized.
+// Otherwise request is challenged with 401 or 407.
+// ACK and CANCEL requests can not be challenged and are passed directly.
+func (a *DigestServerAuth) Handler(next RequestHandler) RequestHandler {
+	return func(req *sip.Request, tx sip.ServerTransaction) {
+		if req.IsAck() || req.IsCancel() {
+			next(req, tx)
+			return
+		}
+
+		if _, err := a.Authenticate(req, tx); err != nil {
+			a.log.Debug("Request not authorized", "error", err, "req", req.StartLine())
+			return
+		}
+		next(req, tx)
+	}
+}
+
+// Authenticate verifies request credentials and returns authenticated username.
+// In case request is not authorized it responds with challenge on tx and returns error.
+func (a *DigestServerAuth) Authenticate(req *sip.Request, tx sip.ServerTransaction) (string, error) {
+	username, err := a.Verify(req)
+	if err == nil {
+		return username, nil
+	}
+
+	res := a.Challenge(req, errors.Is(err, ErrDigestStaleNonce))
+	if rerr := tx.Respond(res); rerr != nil {
+		return "", errors.Join(err, rerr)
+	}
+	return "", err
+}
+
+// Challenge builds 401 or 407 response with challenge for each configured algorithm.
+// stale should be set when client used expired nonce
+func (a *DigestServerAuth) Challenge(req *sip.Request, stale bool) *sip.Response {
+	statusCode, reason, hdrName := sip.StatusUnauthorized, "Unauthorized", "WWW-Authenticate"
+	if a.proxy {
+		statusCode, reason, hdrName = sip.StatusProxyAuthRequired, "Proxy Authentication Required", "Proxy-Authenticate"
+	}
+
+	res := sip.NewResponseFromRequest(req, statusCode, reason, nil)
+	nonce := a.newNonce()
+	for _, alg := range a.algorithms {
+		chal := digest.Challenge{
+			Realm:     a.realm,
+			Nonce:     nonce,
+			Opaque:    digestOpaque,
+			Algorithm: alg,
+			QOP:       a.qop,
+			Stale:     stale,
+		}
+		res.AppendHeader(sip.NewHeader(hdrName, chal.String()))
+	}
+	return res
+}
+
+// Verify verifies request credentials without responding. It returns authenticated username.
+// Returned error is ErrDigestUnauthorized or ErrDigestStaleNonce in case nonce expired
+func (a *DigestServerAuth) Verify(req *sip.Request) (string, error) {
+	hdrName := "Authorization"
+	if a.proxy {
+		hdrName = "Proxy-Authorization"
+	}
+
+	var cred *digest.Credentials
+	for _, h := range req.GetHeaders(hdrName) {
+		c, err := digest.ParseCredentials(h.Value())
+		if err != nil {
+			return "", errors.Join(ErrDigestUnauthorized, fmt.Errorf("fail to parse credentials: %w", err))
+		}
+		// There could be more credentials for different realms
+		if c.Realm == a.realm {
+			cred = c
+			break
+		}
+	}
+
+	if cred == nil {
+		return "", fmt.Errorf("no credentials for realm %q: %w", a.realm, ErrDigestUnauthorized)
+	}
+
+	alg := sip.ASCIIToUpper(cred.Algorithm)
+	if alg == "" {
+		alg = "MD5"
+	}
+	if !a.supportsAlgorithm(alg) {
+		return "", fmt.Errorf("algorithm %q not offered: %w", cred.Algorithm, ErrDigestUnauthorized)
+	}
+
+	if len(a.qop) > 0 && !a.supportsQOP(cred.QOP) {
+		return "", fmt.Errorf("qop %q not offered: %w", cred.QOP, ErrDigestUnauthorized)
+	}
+
+	// Response is computed over URI sent by client, so it must be Request-URI
+	// https://datatracker.ietf.org/doc/html/rfc2617#section-3.2.2.5
+	if !digestURIMatch(cred.URI, req.Recipient) {
+		return "", fmt.Errorf("uri %q does not match request uri: %w", cred.URI, ErrDigestUnauthorized)
+	}
+
+	if cred.Opaque != digestOpaque {
+		return "", fmt.Errorf("opaque %q does not match: %w", cred.Opaque, ErrDigestUnauthorized)
+	}
+
+	if _, err := a.checkNonce(cred.Nonce); err != nil {
+		return "", err
+	}
+
+	creds, err := a.store.DigestCredentials(cred.Username, a.realm)
+	if err != nil {
+		return "", errors.Join(ErrDigestUnauthorized, err)
+	}
+
+	opts := digest.Options{
+		Method:   req.Method.String(),
+		URI:      cred.URI,
+		Username: cred.Username,
+		Password: creds.Password,
+		Cnonce:   cred.Cnonce,
+		Count:    cred.Nc,
+	}
+	if creds.Password == "" {
+		opts.A1 = creds.HA1[alg]
+		if opts.A1 == "" {
+			return "", fmt.Errorf("no HA1 for algorithm %q: %w", alg, ErrDigestUnauthorized)
+		}
+	}
+
+	if cred.QOP == "auth-int" {
+		body := req.Body()
+		opts.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	chal := &digest.Challenge{
+		Realm:     a.realm,
+		Nonce:     cred.Nonce,
+		Opaque:    cred.Opaque,
+		Algorithm: alg,
+	}
+	if cred.QOP != "" {
+		chal.QOP = []string{cred.QOP}
+	}
+
+	expected, err := digest.Digest(chal, opts)
+	if err != nil {
+		return "", errors.Join(ErrDigestUnauthorized, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected.Response), []byte(cred.Response)) != 1 {
+		return "", fmt.Errorf("response does not match for user %q: %w", cred.Username, ErrDigestUnauthorized)
+	}
+
+	// Nonce count is consumed only after response is verified, otherwise anyone could burn client nonce
+	if err := a.useNonce(cred.Nonce, cred.Nc, cred.QOP != ""); err != nil {
+		return "", err
+	}
+	return cred.Username, nil
+}
+
+func (a *DigestServerAuth) supportsAlgorithm(alg string) bool {
+	for _, v := range a.algorithms {
+		if sip.ASCIIToUpper(v) == alg {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *DigestServerAuth) supportsQOP(qop string) bool {
+	for _, v := range a.qop {
+		if v == qop {
+			return true
+		}
+	}
+	return false
+}
+
+// newNonce creates nonce as hex of timestamp, random and HMAC of both
+func (a *DigestServerAuth) newNonce() string {
+	buf := make([]byte, digestNonceSize)
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().UnixNano()))
+	rand.Read(buf[8:16])
+	copy(buf[16:], a.nonceMAC(buf[:16]))
+	return hex.EncodeToString(buf)
+}
+
+func (a *DigestServerAuth) nonceMAC(data []byte) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(data)
+	return mac.Sum(nil)[:digestNonceSize-16]
+}
+
+// checkNonce validates that nonce is issued by us and not expired. It returns nonce creation time
+func (a *DigestServerAuth) checkNonce(nonce string) (time.Time, error) {
+	buf, err := hex.DecodeString(nonce)
+	if err != nil || len(buf) != digestNonceSize || !hmac.Equal(buf[16:], a.nonceMAC(buf[:16])) {
+		// Nonce could be issued before restart. Make client to retry with new one
+		return time.Time{}, fmt.Errorf("nonce %q unknown: %w", nonce, ErrDigestStaleNonce)
+	}
+
+	created := time.Unix(0, int64(binary.BigEndian.Uint64(buf)))
+	if age := time.Since(created); age > a.nonceExpire || age < 0 {
+		return time.Time{}, fmt.Errorf("nonce %q expired: %w", nonce, ErrDigestStaleNonce)
+	}
+	return created, nil
+}
+
+// useNonce validates nonce count and marks it as used.
+// https://datatracker.ietf.org/doc/html/rfc7616#section-3.4
+// nonce count must be increased by client for every request with same nonce, which prevents replay
+func (a *DigestServerAuth) useNonce(nonce string, nc int, hasQOP bool) error {
+	created, err := a.checkNonce(nonce)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Cleanup expired nonces. No need to have this done on every request
+	if now.Sub(a.lastSweep) > a.nonceExpire {
+		for k, n := range a.nonces {
+			if now.Sub(n.created) > a.nonceExpire {
+				delete(a.nonces, k)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	n, exists := a.nonces[nonce]
+	if !exists {
+		a.nonces[nonce] = &digestNonce{created: created, nc: nc}
+		return nil
+	}
+
+	// Without qop there is no nonce count, so nonce is allowed only once
+	if !hasQOP || nc <= n.nc {
+		return fmt.Errorf("nonce count %d replayed: %w", nc, ErrDigestUnauthorized)
+	}
+	n.nc = nc
+	return nil
+}
+
+// DigestHA1 computes HA1 = H(username:realm:password) for algorithm.
+// It can be used to prebuild DigestCredentials.HA1 and avoid storing plain passwords
+func DigestHA1(algorithm string, username string, realm string, password string) (string, error) {
+	h, err := digestHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	h.Write([]byte(strings.Join([]string{username, realm, password}, ":")))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func digestHash(algorithm string) (hash.Hash, error) {
+	switch sip.ASCIIToUpper(algorithm) {
+	case "", "MD5":
+		return md5.New(), nil
+	case "SHA-256":
+		return sha256.New(), nil
+	case "SHA-512-256":
+		return sha512.New512_256(), nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %q", algorithm)
+}
+
+// digestURIMatch checks is credentials digest-uri same as Request-URI. Uri params and headers are ignored
+func digestURIMatch(credURI string, uri sip.Uri) bool {
+	var u sip.Uri
+	if err := sip.ParseUri(credURI, &u); err != nil {
+		return false
+	}
+	return u.IsEncrypted() == uri.IsEncrypted() &&
+		u.User == uri.User &&
+		strings.EqualFold(u.Host, uri.Host) &&
+		u.Port == uri.Port
+}
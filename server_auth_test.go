@@ -0,0 +1,215 @@
+package sipgo
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/icholy/digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestServerAuth(t *testing.T) {
+	store := DigestCredentialsMap{"alice": "alicepass"}
+
+	register := func() *sip.Request {
+		return createSimpleRequest(sip.REGISTER,
+			sip.Uri{User: "alice", Host: "10.1.1.1", Port: 5060},
+			sip.Uri{Host: "sipgo.com"}, "UDP",
+		)
+	}
+
+	challenge := func(t *testing.T, auth *DigestServerAuth, req *sip.Request) *sip.Response {
+		rec := siptest.NewServerTxRecorder(req)
+		_, err := auth.Authenticate(req, rec)
+		require.ErrorIs(t, err, ErrDigestUnauthorized)
+		res := rec.Result()
+		require.Len(t, res, 1)
+		return res[0]
+	}
+
+	authOpts := func(req *sip.Request, password string) digest.Options {
+		return digest.Options{
+			Method:   req.Method.String(),
+			URI:      req.Recipient.Addr(),
+			Username: "alice",
+			Password: password,
+		}
+	}
+
+	t.Run("Authorized", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store)
+		req := register()
+		res := challenge(t, auth, req)
+		require.Equal(t, sip.StatusUnauthorized, res.StatusCode)
+
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "alicepass")))
+		username, err := auth.Verify(req)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", username)
+
+		// Same nonce count is replay
+		_, err = auth.Verify(req)
+		require.ErrorIs(t, err, ErrDigestUnauthorized)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store)
+		req := register()
+		res := challenge(t, auth, req)
+
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "wrong")))
+		_, err := auth.Verify(req)
+		require.ErrorIs(t, err, ErrDigestUnauthorized)
+	})
+
+	t.Run("URIMismatch", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store)
+		req := register()
+		res := challenge(t, auth, req)
+
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "alicepass")))
+		// Captured credentials are used for other Request-URI
+		other := req.Clone()
+		other.Recipient = sip.Uri{Host: "other.sipgo.com"}
+		_, err := auth.Verify(other)
+		require.ErrorIs(t, err, ErrDigestUnauthorized)
+
+		// Uri params are not part of comparison
+		req.Recipient.UriParams = sip.HeaderParams{{K: "transport", V: "udp"}}
+		_, err = auth.Verify(req)
+		require.NoError(t, err)
+	})
+
+	t.Run("OpaqueMismatch", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store)
+		req := register()
+		res := challenge(t, auth, req)
+
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "alicepass")))
+		h := req.GetHeader("Authorization")
+		require.Contains(t, h.Value(), `opaque="sipgo"`)
+		req.ReplaceHeader(sip.NewHeader("Authorization", strings.Replace(h.Value(), `opaque="sipgo"`, `opaque="other"`, 1)))
+		_, err := auth.Verify(req)
+		require.ErrorIs(t, err, ErrDigestUnauthorized)
+	})
+
+	t.Run("SHA256WithHA1", func(t *testing.T) {
+		ha1, err := DigestHA1("SHA-256", "alice", "sipgo", "alicepass")
+		require.NoError(t, err)
+		hstore := digestCredentialsFunc(func(username, realm string) (DigestCredentials, error) {
+			return DigestCredentials{HA1: map[string]string{"SHA-256": ha1}}, nil
+		})
+		auth := NewDigestServerAuth("sipgo", hstore, WithDigestServerAuthAlgorithms("SHA-256", "MD5"))
+		req := register()
+		res := challenge(t, auth, req)
+		require.Len(t, res.GetHeaders("WWW-Authenticate"), 2)
+
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "alicepass")))
+		_, err = auth.Verify(req)
+		require.NoError(t, err)
+	})
+
+	t.Run("AuthInt", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store, WithDigestServerAuthQOP("auth-int"))
+		req := register()
+		req.SetBody([]byte("body"))
+		res := challenge(t, auth, req)
+
+		opts := authOpts(req, "alicepass")
+		opts.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(req.Body())), nil
+		}
+		require.NoError(t, digestAuthApply(req, res, opts))
+		_, err := auth.Verify(req)
+		require.NoError(t, err)
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store, WithDigestServerAuthProxy())
+		req := register()
+		res := challenge(t, auth, req)
+		require.Equal(t, sip.StatusProxyAuthRequired, res.StatusCode)
+
+		require.NoError(t, digestProxyAuthApply(req, res, authOpts(req, "alicepass")))
+		_, err := auth.Verify(req)
+		require.NoError(t, err)
+	})
+
+	t.Run("StaleNonce", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store, WithDigestServerAuthNonceExpire(time.Millisecond))
+		req := register()
+		res := challenge(t, auth, req)
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "alicepass")))
+
+		time.Sleep(5 * time.Millisecond)
+		rec := siptest.NewServerTxRecorder(req)
+		_, err := auth.Authenticate(req, rec)
+		require.ErrorIs(t, err, ErrDigestStaleNonce)
+
+		chal, err := digest.ParseChallenge(rec.Result()[0].GetHeader("WWW-Authenticate").Value())
+		require.NoError(t, err)
+		assert.True(t, chal.Stale)
+	})
+
+	t.Run("ChallengeStateless", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store)
+		for i := 0; i < 100; i++ {
+			challenge(t, auth, register())
+		}
+		assert.Empty(t, auth.nonces)
+
+		// Nonce not signed by us is rejected
+		req := register()
+		res := challenge(t, auth, req)
+		chal, err := digest.ParseChallenge(res.GetHeader("WWW-Authenticate").Value())
+		require.NoError(t, err)
+		forged := []byte(chal.Nonce)
+		forged[0] ^= 1
+		res.ReplaceHeader(sip.NewHeader("WWW-Authenticate", strings.Replace(res.GetHeader("WWW-Authenticate").Value(), chal.Nonce, string(forged), 1)))
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "alicepass")))
+		_, err = auth.Verify(req)
+		require.ErrorIs(t, err, ErrDigestStaleNonce)
+		assert.Empty(t, auth.nonces)
+	})
+
+	t.Run("NoQOPReplay", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store, WithDigestServerAuthQOP())
+		req := register()
+		res := challenge(t, auth, req)
+		require.NoError(t, digestAuthApply(req, res, authOpts(req, "alicepass")))
+		_, err := auth.Verify(req)
+		require.NoError(t, err)
+		_, err = auth.Verify(req)
+		require.ErrorIs(t, err, ErrDigestUnauthorized)
+	})
+
+	t.Run("Handler", func(t *testing.T) {
+		auth := NewDigestServerAuth("sipgo", store)
+		called := 0
+		h := auth.Handler(func(req *sip.Request, tx sip.ServerTransaction) {
+			called++
+		})
+
+		req := register()
+		rec := siptest.NewServerTxRecorder(req)
+		h(req, rec)
+		require.Equal(t, 0, called)
+
+		req = req.Clone()
+		require.NoError(t, digestAuthApply(req, rec.Result()[0], authOpts(req, "alicepass")))
+		h(req, siptest.NewServerTxRecorder(req))
+		require.Equal(t, 1, called)
+	})
+}
+
+type digestCredentialsFunc func(username, realm string) (DigestCredentials, error)
+
+func (f digestCredentialsFunc) DigestCredentials(username, realm string) (DigestCredentials, error) {
+	return f(username, realm)
+}
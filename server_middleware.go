@@ -0,0 +1,93 @@
+package sipgo
+
+import (
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// RequestMiddleware wraps request handler. It can respond and not call next handler to stop processing
+type RequestMiddleware func(next RequestHandler) RequestHandler
+
+// Use adds middlewares applied on every request, including requests without registered handler.
+// Middlewares are called in order they are added, and before per method middlewares added with UseMethod.
+// They must be added before serving
+func (srv *Server) Use(mw ...RequestMiddleware) {
+	srv.middlewares = append(srv.middlewares, mw...)
+	srv.buildChains()
+}
+
+// UseMethod adds middlewares applied only on requests with method.
+// They must be added before serving
+func (srv *Server) UseMethod(method sip.RequestMethod, mw ...RequestMiddleware) {
+	if srv.methodMiddlewares == nil {
+		srv.methodMiddlewares = make(map[sip.RequestMethod][]RequestMiddleware)
+	}
+	srv.methodMiddlewares[method] = append(srv.methodMiddlewares[method], mw...)
+	srv.buildChains()
+}
+
+// buildChains wraps handler dispatch with middlewares once, so they are not rebuilt for every request
+func (srv *Server) buildChains() {
+	srv.chainGlobal = srv.chain("", srv.dispatch)
+	srv.chainMethods = make(map[sip.RequestMethod]RequestHandler, len(srv.methodMiddlewares))
+	for method := range srv.methodMiddlewares {
+		srv.chainMethods[method] = srv.chain(method, srv.dispatch)
+	}
+}
+
+// chainHandler returns handler wrapped with middlewares for method
+func (srv *Server) chainHandler(method sip.RequestMethod) RequestHandler {
+	if h, ok := srv.chainMethods[method]; ok {
+		return h
+	}
+	if srv.chainGlobal != nil {
+		return srv.chainGlobal
+	}
+	return srv.dispatch
+}
+
+// dispatch calls handler matching request
+func (srv *Server) dispatch(req *sip.Request, tx sip.ServerTransaction) {
+	srv.getHandler(req)(req, tx)
+}
+
+// chain wraps handler with method and global middlewares, where first added is outermost
+func (srv *Server) chain(method sip.RequestMethod, handler RequestHandler) RequestHandler {
+	mws := srv.methodMiddlewares[method]
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	for i := len(srv.middlewares) - 1; i >= 0; i-- {
+		handler = srv.middlewares[i](handler)
+	}
+	return handler
+}
+
+// RecoverMiddleware recovers from handler panic and responds with 500 Server Internal Error
+// instead of crashing the server. Panic and stack are logged with logger, or default logger if nil
+func RecoverMiddleware(logger *slog.Logger) RequestMiddleware {
+	if logger == nil {
+		logger = sip.DefaultLogger()
+	}
+	return func(next RequestHandler) RequestHandler {
+		return func(req *sip.Request, tx sip.ServerTransaction) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				logger.Error("Request handler panic", "panic", r, "req", req.StartLine(), "stack", string(debug.Stack()))
+				if req.IsAck() || tx == nil {
+					return
+				}
+				res := sip.NewResponseFromRequest(req, sip.StatusInternalServerError, "Server Internal Error", nil)
+				if err := tx.Respond(res); err != nil {
+					logger.Error("respond '500 Server Internal Error' failed", "error", err)
+				}
+			}()
+			next(req, tx)
+		}
+	}
+}
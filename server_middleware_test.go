@@ -0,0 +1,127 @@
+package sipgo
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMiddleware(t *testing.T) {
+	mem := sip.NewMemoryNetwork()
+	newMemoryUA := func(t *testing.T) *UserAgent {
+		ua, err := NewUA()
+		require.NoError(t, err)
+		require.NoError(t, ua.TransportLayer().RegisterTransport("memory", sip.NewTransportMemory(mem, sip.NewParser())))
+		return ua
+	}
+	newRequest := func(method sip.RequestMethod) *sip.Request {
+		return sip.NewRequest(method, sip.Uri{Host: "uas", Port: 5060, UriParams: sip.HeaderParams{{K: "transport", V: "memory"}}})
+	}
+
+	uas := newMemoryUA(t)
+	defer uas.Close()
+	srv, err := NewServer(uas)
+	require.NoError(t, err)
+
+	var calls []string
+	trace := func(name string) RequestMiddleware {
+		return func(next RequestHandler) RequestHandler {
+			return func(req *sip.Request, tx sip.ServerTransaction) {
+				calls = append(calls, name)
+				next(req, tx)
+			}
+		}
+	}
+
+	// Middlewares are not wrapped again for every request
+	var wraps atomic.Int32
+	srv.Use(func(next RequestHandler) RequestHandler {
+		wraps.Add(1)
+		return next
+	})
+	srv.Use(RecoverMiddleware(nil), trace("global1"), trace("global2"))
+	srv.UseMethod(sip.OPTIONS, trace("options"))
+	srv.UseMethod(sip.MESSAGE, func(next RequestHandler) RequestHandler {
+		return func(req *sip.Request, tx sip.ServerTransaction) {
+			if req.GetHeader("X-Token") == nil {
+				tx.Respond(sip.NewResponseFromRequest(req, sip.StatusForbidden, "Forbidden", nil))
+				return
+			}
+			next(req, tx)
+		}
+	})
+
+	srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		calls = append(calls, "handler")
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+	})
+	srv.OnMessage(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+	})
+	srv.OnInfo(func(req *sip.Request, tx sip.ServerTransaction) {
+		panic("handler failed")
+	})
+
+	l, err := mem.Listen("uas:5060")
+	require.NoError(t, err)
+	go srv.Serve("memory", l)
+
+	uac := newMemoryUA(t)
+	defer uac.Close()
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.Do(ctx, newRequest(sip.OPTIONS))
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"global1", "global2", "options", "handler"}, calls)
+
+	t.Run("NoRoute", func(t *testing.T) {
+		calls = nil
+		res, err := client.Do(ctx, newRequest(sip.PUBLISH))
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusMethodNotAllowed, res.StatusCode)
+		assert.Equal(t, []string{"global1", "global2"}, calls)
+	})
+
+	t.Run("ShortCircuit", func(t *testing.T) {
+		res, err := client.Do(ctx, newRequest(sip.MESSAGE))
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusForbidden, res.StatusCode)
+
+		req := newRequest(sip.MESSAGE)
+		req.AppendHeader(sip.NewHeader("X-Token", "secret"))
+		res, err = client.Do(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusOK, res.StatusCode)
+	})
+
+	t.Run("Recover", func(t *testing.T) {
+		res, err := client.Do(ctx, newRequest(sip.INFO))
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusInternalServerError, res.StatusCode)
+
+		// Server still serves
+		res, err = client.Do(ctx, newRequest(sip.OPTIONS))
+		require.NoError(t, err)
+		assert.Equal(t, sip.StatusOK, res.StatusCode)
+	})
+
+	t.Run("ChainsBuiltOnce", func(t *testing.T) {
+		before := wraps.Load()
+		for range 3 {
+			res, err := client.Do(ctx, newRequest(sip.OPTIONS))
+			require.NoError(t, err)
+			assert.Equal(t, sip.StatusOK, res.StatusCode)
+		}
+		assert.Equal(t, before, wraps.Load())
+	})
+}
@@ -1,6 +1,7 @@
 package sipgo
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -313,6 +314,212 @@ func TestTCPUAS(t *testing.T) {
 	}
 }
 
+func TestMemoryUAS(t *testing.T) {
+	mem := sip.NewMemoryNetwork()
+
+	uas, err := NewUA()
+	require.NoError(t, err)
+	defer uas.Close()
+	require.NoError(t, uas.TransportLayer().RegisterTransport("memory", sip.NewTransportMemory(mem, sip.NewParser())))
+
+	srv, err := NewServer(uas)
+	require.NoError(t, err)
+	srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, 200, "OK", nil))
+	})
+
+	l, err := mem.Listen("uas:5060")
+	require.NoError(t, err)
+	go srv.Serve("memory", l)
+
+	uac, err := NewUA()
+	require.NoError(t, err)
+	defer uac.Close()
+	require.NoError(t, uac.TransportLayer().RegisterTransport("memory", sip.NewTransportMemory(mem, sip.NewParser())))
+
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+
+	req := sip.NewRequest(sip.OPTIONS, sip.Uri{Host: "uas", Port: 5060, UriParams: sip.HeaderParams{{K: "transport", V: "memory"}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := client.Do(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "MEMORY", res.Via().Transport)
+}
+
+func TestServerShutdown(t *testing.T) {
+	mem := sip.NewMemoryNetwork()
+	newMemoryUA := func(t *testing.T) *UserAgent {
+		ua, err := NewUA()
+		require.NoError(t, err)
+		require.NoError(t, ua.TransportLayer().RegisterTransport("memory", sip.NewTransportMemory(mem, sip.NewParser())))
+		return ua
+	}
+	newOptions := func() *sip.Request {
+		return sip.NewRequest(sip.OPTIONS, sip.Uri{Host: "uas", Port: 5060, UriParams: sip.HeaderParams{{K: "transport", V: "memory"}}})
+	}
+
+	uas := newMemoryUA(t)
+	srv, err := NewServer(uas)
+	require.NoError(t, err)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		if !req.To().Params.Has("tag") {
+			// In progress transaction
+			entered <- struct{}{}
+			<-release
+		}
+		tx.Respond(sip.NewResponseFromRequest(req, 200, "OK", nil))
+	})
+
+	l, err := mem.Listen("uas:5060")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve("memory", l) }()
+
+	uac := newMemoryUA(t)
+	defer uac.Close()
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inProgress := make(chan *sip.Response, 1)
+	go func() {
+		res, err := client.Do(ctx, newOptions())
+		assert.NoError(t, err)
+		inProgress <- res
+	}()
+	<-entered
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(ctx) }()
+	require.Eventually(t, uas.TransactionLayer().Draining, time.Second, time.Millisecond)
+
+	// New request is rejected
+	res, err := client.Do(ctx, newOptions())
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, "30", res.GetHeader("Retry-After").Value())
+
+	// Request within dialog is served
+	req := newOptions()
+	to := &sip.ToHeader{Address: req.Recipient, Params: sip.NewParams()}
+	to.Params.Add("tag", "in-dialog")
+	req.AppendHeader(to)
+	res, err = client.Do(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusOK, res.StatusCode)
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown finished before transaction err=%v", err)
+	default:
+	}
+
+	close(release)
+	res = <-inProgress
+	assert.Equal(t, sip.StatusOK, res.StatusCode)
+	require.NoError(t, <-shutdownErr)
+	require.ErrorIs(t, <-serveErr, ErrServerClosed)
+	require.ErrorIs(t, srv.ListenAndServe(ctx, "udp", "127.0.0.1:0"), ErrServerClosed)
+
+	t.Run("Deadline", func(t *testing.T) {
+		uas := newMemoryUA(t)
+		srv, err := NewServer(uas)
+		require.NoError(t, err)
+		srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+			entered <- struct{}{}
+			<-tx.Done()
+		})
+		l, err := mem.Listen("uas:5060")
+		require.NoError(t, err)
+		go srv.Serve("memory", l)
+
+		uac := newMemoryUA(t)
+		defer uac.Close()
+		client, err := NewClient(uac)
+		require.NoError(t, err)
+		go client.Do(ctx, newOptions())
+		<-entered
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer shutdownCancel()
+		require.ErrorIs(t, srv.Shutdown(shutdownCtx), context.DeadlineExceeded)
+	})
+}
+
+func TestServerShutdownCancel(t *testing.T) {
+	mem := sip.NewMemoryNetwork()
+	newMemoryUA := func(t *testing.T) *UserAgent {
+		ua, err := NewUA()
+		require.NoError(t, err)
+		require.NoError(t, ua.TransportLayer().RegisterTransport("memory", sip.NewTransportMemory(mem, sip.NewParser())))
+		return ua
+	}
+	newInvite := func() *sip.Request {
+		return sip.NewRequest(sip.INVITE, sip.Uri{User: "bob", Host: "uas", Port: 5060, UriParams: sip.HeaderParams{{K: "transport", V: "memory"}}})
+	}
+
+	uas := newMemoryUA(t)
+	defer uas.Close()
+	srv, err := NewServer(uas)
+	require.NoError(t, err)
+	srv.OnInvite(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusRinging, "Ringing", nil))
+		<-tx.Done()
+	})
+	srv.OnCancel(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil))
+	})
+
+	l, err := mem.Listen("uas:5060")
+	require.NoError(t, err)
+	go srv.Serve("memory", l)
+
+	uac := newMemoryUA(t)
+	defer uac.Close()
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	invite := newInvite()
+	tx, err := client.TransactionRequest(ctx, invite)
+	require.NoError(t, err)
+	defer tx.Terminate()
+	res := <-tx.Responses()
+	require.Equal(t, sip.StatusRinging, res.StatusCode)
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(ctx) }()
+	require.Eventually(t, uas.TransactionLayer().Draining, time.Second, time.Millisecond)
+
+	// CANCEL of call in progress is not rejected
+	res, err = client.Do(ctx, newCancelRequest(invite))
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusOK, res.StatusCode)
+	res = <-tx.Responses()
+	assert.Equal(t, sip.StatusRequestTerminated, res.StatusCode)
+
+	// CANCEL without transaction is passed to handler
+	unknown := invite.Clone()
+	unknown.Via().Params.Add("branch", sip.GenerateBranch())
+	callID := sip.CallIDHeader("unknown")
+	unknown.ReplaceHeader(&callID)
+	res, err = client.Do(ctx, newCancelRequest(unknown))
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusCallTransactionDoesNotExists, res.StatusCode)
+
+	require.NoError(t, <-shutdownErr)
+}
+
 func BenchmarkSwitchVsMap(b *testing.B) {
 
 	b.Run("map", func(b *testing.B) {
@@ -55,6 +55,7 @@ func (hp HeaderParams) index(key string) int {
 }
 
 // Get returns a value for a given key, if it exists.
+// Quoted string value is returned with quotes as it is received, use GetUnquoted to strip them.
 func (hp HeaderParams) Get(key string) (string, bool) {
 	for _, kv := range hp {
 		if kv.K == key {
@@ -64,6 +65,15 @@ func (hp HeaderParams) Get(key string) (string, bool) {
 	return "", false
 }
 
+// GetUnquoted is same as Get, but quotes of quoted string value are removed
+func (hp HeaderParams) GetUnquoted(key string) (string, bool) {
+	v, exists := hp.Get(key)
+	if paramValueQuoted(v) {
+		v = v[1 : len(v)-1]
+	}
+	return v, exists
+}
+
 // GetOr returns a value for a given key, oe a default, if it doesn't exist.
 func (hp HeaderParams) GetOr(key, def string) string {
 	for _, kv := range hp {
@@ -121,7 +131,7 @@ func (hp HeaderParams) ToString(sep byte) string {
 		buffer.WriteByte(sep)
 		buffer.WriteString(kv.K)
 		// This could be removed
-		if strings.ContainsAny(kv.V, abnf) {
+		if strings.ContainsAny(kv.V, abnf) && !paramValueQuoted(kv.V) {
 			buffer.WriteString("=\"")
 			buffer.WriteString(kv.V)
 			buffer.WriteByte('"')
@@ -154,7 +164,7 @@ func (hp HeaderParams) ToStringWrite(sep byte, buffer io.StringWriter) {
 			continue
 		}
 		// This could be removed
-		if strings.ContainsAny(kv.V, abnf) {
+		if strings.ContainsAny(kv.V, abnf) && !paramValueQuoted(kv.V) {
 			buffer.WriteString("=\"")
 			buffer.WriteString(kv.V)
 			buffer.WriteString("\"")
@@ -165,6 +175,11 @@ func (hp HeaderParams) ToStringWrite(sep byte, buffer io.StringWriter) {
 	}
 }
 
+// paramValueQuoted checks is value already quoted string
+func paramValueQuoted(v string) bool {
+	return len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"'
+}
+
 // String returns params joined with '&' char.
 func (hp HeaderParams) String() string {
 	return hp.ToString('&')
@@ -443,6 +443,78 @@ func (hs *headers) ReferredBy() *ReferredByHeader {
 	return nil
 }
 
+// SessionExpires parses underlying Session-Expires header or nil if not exists
+func (hs *headers) SessionExpires() *SessionExpiresHeader {
+	h := &SessionExpiresHeader{}
+	if parseHeaderLazy(hs, parseSessionExpiresHeader, []string{"session-expires", "x"}, h) {
+		return h
+	}
+	return nil
+}
+
+// MinSE parses underlying Min-SE header or nil if not exists
+func (hs *headers) MinSE() *MinSEHeader {
+	var h MinSEHeader
+	if parseHeaderLazy(hs, parseMinSEHeader, []string{"min-se"}, &h) {
+		return &h
+	}
+	return nil
+}
+
+// Event parses underlying Event header or nil if not exists
+func (hs *headers) Event() *EventHeader {
+	h := &EventHeader{}
+	if parseHeaderLazy(hs, parseEventHeader, []string{"event", "o"}, h) {
+		return h
+	}
+	return nil
+}
+
+// SubscriptionState parses underlying Subscription-State header or nil if not exists
+func (hs *headers) SubscriptionState() *SubscriptionStateHeader {
+	h := &SubscriptionStateHeader{}
+	if parseHeaderLazy(hs, parseSubscriptionStateHeader, []string{"subscription-state"}, h) {
+		return h
+	}
+	return nil
+}
+
+// AllowEvents parses underlying Allow-Events header or nil if not exists
+func (hs *headers) AllowEvents() *AllowEventsHeader {
+	h := &AllowEventsHeader{}
+	if parseHeaderLazy(hs, parseAllowEventsHeader, []string{"allow-events", "u"}, h) {
+		return h
+	}
+	return nil
+}
+
+// RSeq parses underlying RSeq header or nil if not exists
+func (hs *headers) RSeq() *RSeqHeader {
+	var h RSeqHeader
+	if parseHeaderLazy(hs, parseRSeqHeader, []string{"rseq"}, &h) {
+		return &h
+	}
+	return nil
+}
+
+// RAck parses underlying RAck header or nil if not exists
+func (hs *headers) RAck() *RAckHeader {
+	h := &RAckHeader{}
+	if parseHeaderLazy(hs, parseRAckHeader, []string{"rack"}, h) {
+		return h
+	}
+	return nil
+}
+
+// Replaces parses underlying Replaces header or nil if not exists
+func (hs *headers) Replaces() *ReplacesHeader {
+	h := &ReplacesHeader{}
+	if parseHeaderLazy(hs, parseReplacesHeader, []string{"replaces"}, h) {
+		return h
+	}
+	return nil
+}
+
 // NewHeader creates generic type of header
 func NewHeader(name, value string) Header {
 	return &genericHeader{
@@ -853,6 +925,443 @@ func (h ExpiresHeader) Value() string { return strconv.Itoa(int(h)) }
 
 func (h *ExpiresHeader) headerClone() Header { return h }
 
+// SessionExpiresHeader is Session-Expires header representation
+// https://datatracker.ietf.org/doc/html/rfc4028#section-4
+type SessionExpiresHeader struct {
+	// Delta is session interval in seconds
+	Delta  uint32
+	Params HeaderParams
+}
+
+func (h *SessionExpiresHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *SessionExpiresHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	h.valueStringWrite(buffer)
+}
+
+func (h *SessionExpiresHeader) valueStringWrite(buffer io.StringWriter) {
+	buffer.WriteString(strconv.Itoa(int(h.Delta)))
+	if h.Params != nil && h.Params.Length() > 0 {
+		buffer.WriteString(";")
+		h.Params.ToStringWrite(';', buffer)
+	}
+}
+
+func (h *SessionExpiresHeader) Name() string { return "Session-Expires" }
+
+func (h *SessionExpiresHeader) Value() string {
+	var buffer strings.Builder
+	h.valueStringWrite(&buffer)
+	return buffer.String()
+}
+
+// Refresher returns refresher param value, uac or uas. Empty if not set
+func (h *SessionExpiresHeader) Refresher() string {
+	return h.Params.GetOr("refresher", "")
+}
+
+func (h *SessionExpiresHeader) headerClone() Header {
+	return h.Clone()
+}
+
+func (h *SessionExpiresHeader) Clone() *SessionExpiresHeader {
+	newHdr := &SessionExpiresHeader{
+		Delta: h.Delta,
+	}
+	if h.Params != nil {
+		newHdr.Params = h.Params.Clone()
+	}
+	return newHdr
+}
+
+// EventHeader is Event header representation
+// https://datatracker.ietf.org/doc/html/rfc6665#section-8.2.1
+type EventHeader struct {
+	// Event is event package name with optional template like presence or presence.winfo
+	Event  string
+	Params HeaderParams
+}
+
+func (h *EventHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *EventHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	h.valueStringWrite(buffer)
+}
+
+func (h *EventHeader) valueStringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Event)
+	if h.Params != nil && h.Params.Length() > 0 {
+		buffer.WriteString(";")
+		h.Params.ToStringWrite(';', buffer)
+	}
+}
+
+func (h *EventHeader) Name() string { return "Event" }
+
+func (h *EventHeader) Value() string {
+	var buffer strings.Builder
+	h.valueStringWrite(&buffer)
+	return buffer.String()
+}
+
+// ID returns id param value. Empty if not set
+func (h *EventHeader) ID() string {
+	return h.Params.GetOr("id", "")
+}
+
+// Match compares event package and id param. Event package is case sensitive
+// https://datatracker.ietf.org/doc/html/rfc6665#section-8.2.1
+func (h *EventHeader) Match(other *EventHeader) bool {
+	return h.Event == other.Event && h.ID() == other.ID()
+}
+
+func (h *EventHeader) headerClone() Header {
+	return h.Clone()
+}
+
+func (h *EventHeader) Clone() *EventHeader {
+	newHdr := &EventHeader{
+		Event: h.Event,
+	}
+	if h.Params != nil {
+		newHdr.Params = h.Params.Clone()
+	}
+	return newHdr
+}
+
+// Subscription states used in Subscription-State header
+const (
+	SubscriptionStateActive     = "active"
+	SubscriptionStatePending    = "pending"
+	SubscriptionStateTerminated = "terminated"
+)
+
+// Subscription-State reason values
+// https://datatracker.ietf.org/doc/html/rfc6665#section-4.1.3
+const (
+	SubscriptionReasonDeactivated = "deactivated"
+	SubscriptionReasonProbation   = "probation"
+	SubscriptionReasonRejected    = "rejected"
+	SubscriptionReasonTimeout     = "timeout"
+	SubscriptionReasonGiveup      = "giveup"
+	SubscriptionReasonNoresource  = "noresource"
+	SubscriptionReasonInvariant   = "invariant"
+)
+
+// SubscriptionStateHeader is Subscription-State header representation
+// https://datatracker.ietf.org/doc/html/rfc6665#section-8.2.3
+type SubscriptionStateHeader struct {
+	// State is active, pending or terminated
+	State  string
+	Params HeaderParams
+}
+
+func (h *SubscriptionStateHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *SubscriptionStateHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	h.valueStringWrite(buffer)
+}
+
+func (h *SubscriptionStateHeader) valueStringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.State)
+	if h.Params != nil && h.Params.Length() > 0 {
+		buffer.WriteString(";")
+		h.Params.ToStringWrite(';', buffer)
+	}
+}
+
+func (h *SubscriptionStateHeader) Name() string { return "Subscription-State" }
+
+func (h *SubscriptionStateHeader) Value() string {
+	var buffer strings.Builder
+	h.valueStringWrite(&buffer)
+	return buffer.String()
+}
+
+// Reason returns reason param value used with terminated state. Empty if not set
+func (h *SubscriptionStateHeader) Reason() string {
+	return h.Params.GetOr("reason", "")
+}
+
+// Expires returns expires param value in seconds
+func (h *SubscriptionStateHeader) Expires() (uint32, bool) {
+	return h.uintParam("expires")
+}
+
+// RetryAfter returns retry-after param value in seconds
+func (h *SubscriptionStateHeader) RetryAfter() (uint32, bool) {
+	return h.uintParam("retry-after")
+}
+
+func (h *SubscriptionStateHeader) uintParam(name string) (uint32, bool) {
+	v, ok := h.Params.Get(name)
+	if !ok {
+		return 0, false
+	}
+	val, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(val), true
+}
+
+func (h *SubscriptionStateHeader) headerClone() Header {
+	return h.Clone()
+}
+
+func (h *SubscriptionStateHeader) Clone() *SubscriptionStateHeader {
+	newHdr := &SubscriptionStateHeader{
+		State: h.State,
+	}
+	if h.Params != nil {
+		newHdr.Params = h.Params.Clone()
+	}
+	return newHdr
+}
+
+// AllowEventsHeader is Allow-Events header representation
+// https://datatracker.ietf.org/doc/html/rfc6665#section-8.2.2
+type AllowEventsHeader []string
+
+func (h *AllowEventsHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *AllowEventsHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	h.valueStringWrite(buffer)
+}
+
+func (h *AllowEventsHeader) valueStringWrite(buffer io.StringWriter) {
+	for i, e := range *h {
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(e)
+	}
+}
+
+func (h *AllowEventsHeader) Name() string { return "Allow-Events" }
+
+func (h *AllowEventsHeader) Value() string {
+	var buffer strings.Builder
+	h.valueStringWrite(&buffer)
+	return buffer.String()
+}
+
+// Has checks is event package allowed
+func (h *AllowEventsHeader) Has(event string) bool {
+	for _, e := range *h {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *AllowEventsHeader) headerClone() Header {
+	newHdr := make(AllowEventsHeader, len(*h))
+	copy(newHdr, *h)
+	return &newHdr
+}
+
+// RSeqHeader is RSeq header representation
+// https://datatracker.ietf.org/doc/html/rfc3262#section-7.1
+type RSeqHeader uint32
+
+func (h *RSeqHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *RSeqHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	buffer.WriteString(h.Value())
+}
+
+func (h *RSeqHeader) valueStringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Value())
+}
+
+func (h *RSeqHeader) Name() string { return "RSeq" }
+
+func (h RSeqHeader) Value() string { return strconv.Itoa(int(h)) }
+
+func (h *RSeqHeader) headerClone() Header { return h }
+
+func (h RSeqHeader) Val() uint32 {
+	return uint32(h)
+}
+
+// RAckHeader is RAck header representation
+// https://datatracker.ietf.org/doc/html/rfc3262#section-7.2
+type RAckHeader struct {
+	RSeq       uint32
+	CSeq       uint32
+	MethodName RequestMethod
+}
+
+func (h *RAckHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *RAckHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	h.valueStringWrite(buffer)
+}
+
+func (h *RAckHeader) Name() string { return "RAck" }
+
+func (h *RAckHeader) Value() string {
+	var buffer strings.Builder
+	h.valueStringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *RAckHeader) valueStringWrite(buffer io.StringWriter) {
+	buffer.WriteString(strconv.Itoa(int(h.RSeq)))
+	buffer.WriteString(" ")
+	buffer.WriteString(strconv.Itoa(int(h.CSeq)))
+	buffer.WriteString(" ")
+	buffer.WriteString(string(h.MethodName))
+}
+
+func (h *RAckHeader) headerClone() Header {
+	if h == nil {
+		var newRAck *RAckHeader
+		return newRAck
+	}
+
+	return &RAckHeader{
+		RSeq:       h.RSeq,
+		CSeq:       h.CSeq,
+		MethodName: h.MethodName,
+	}
+}
+
+// ReplacesHeader is Replaces header representation. ToTag and FromTag are from perspective
+// of UA receiving INVITE with Replaces, so ToTag is local and FromTag is remote tag of dialog
+// https://datatracker.ietf.org/doc/html/rfc3891#section-6.1
+type ReplacesHeader struct {
+	CallID    string
+	ToTag     string
+	FromTag   string
+	EarlyOnly bool
+	// Params are any extension params
+	Params HeaderParams
+}
+
+func (h *ReplacesHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *ReplacesHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	h.valueStringWrite(buffer)
+}
+
+func (h *ReplacesHeader) Name() string { return "Replaces" }
+
+func (h *ReplacesHeader) Value() string {
+	var buffer strings.Builder
+	h.valueStringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *ReplacesHeader) valueStringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.CallID)
+	buffer.WriteString(";to-tag=")
+	buffer.WriteString(h.ToTag)
+	buffer.WriteString(";from-tag=")
+	buffer.WriteString(h.FromTag)
+	if h.EarlyOnly {
+		buffer.WriteString(";early-only")
+	}
+	if h.Params != nil && h.Params.Length() > 0 {
+		buffer.WriteString(";")
+		h.Params.ToStringWrite(';', buffer)
+	}
+}
+
+func (h *ReplacesHeader) headerClone() Header {
+	return h.Clone()
+}
+
+func (h *ReplacesHeader) Clone() *ReplacesHeader {
+	if h == nil {
+		return nil
+	}
+	newReplaces := &ReplacesHeader{
+		CallID:    h.CallID,
+		ToTag:     h.ToTag,
+		FromTag:   h.FromTag,
+		EarlyOnly: h.EarlyOnly,
+	}
+	if h.Params != nil {
+		newReplaces.Params = h.Params.Clone()
+	}
+	return newReplaces
+}
+
+// MinSEHeader is Min-SE header representation
+// https://datatracker.ietf.org/doc/html/rfc4028#section-5
+type MinSEHeader uint32
+
+func (h *MinSEHeader) String() string {
+	var buffer strings.Builder
+	h.StringWrite(&buffer)
+	return buffer.String()
+}
+
+func (h *MinSEHeader) StringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Name())
+	buffer.WriteString(": ")
+	buffer.WriteString(h.Value())
+}
+
+func (h *MinSEHeader) valueStringWrite(buffer io.StringWriter) {
+	buffer.WriteString(h.Value())
+}
+
+func (h *MinSEHeader) Name() string { return "Min-SE" }
+
+func (h MinSEHeader) Value() string { return strconv.Itoa(int(h)) }
+
+func (h *MinSEHeader) headerClone() Header { return h }
+
+func (h MinSEHeader) Val() uint32 {
+	return uint32(h)
+}
+
 // ContentLengthHeader is Content-Length header representation
 type ContentLengthHeader uint32
 
@@ -1233,6 +1742,8 @@ func compactHeaderName(full string) string {
 		return "s"
 	case "Allow-Events":
 		return "u"
+	case "Session-Expires":
+		return "x"
 
 	default:
 		return full
@@ -42,7 +42,9 @@ const (
 	StatusRequestedRangeNotSatisfiable = 416
 	StatusBadExtension                 = 420
 	StatusExtensionRequired            = 421
+	StatusSessionIntervalTooSmall      = 422
 	StatusIntervalToBrief              = 423
+	StatusFlowFailed                   = 430
 	StatusTemporarilyUnavailable       = 480
 	StatusCallTransactionDoesNotExists = 481
 	StatusLoopDetected                 = 482
@@ -52,6 +54,7 @@ const (
 	StatusBusyHere                     = 486
 	StatusRequestTerminated            = 487
 	StatusNotAcceptableHere            = 488
+	StatusBadEvent                     = 489
 	StatusRequestPending               = 491
 
 	StatusInternalServerError = 500
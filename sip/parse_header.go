@@ -34,6 +34,7 @@ func (e errComaDetected) Error() string {
 // m	Contact	RFC 3261	"moved"
 // o	Event	-event-	"occurance"
 // r	Refer-To	-refer-
+// x	Session-Expires	RFC 4028
 // s	Subject	RFC 3261
 // t	To	RFC 3261
 // u	Allow-Events	-events-	"understand"
@@ -138,6 +139,139 @@ func parseMaxForwardsHeader(headerText string, maxfwd *MaxForwardsHeader) error
 	return err
 }
 
+// parseSessionExpiresHeader parses Session-Expires header
+func parseSessionExpiresHeader(headerText string, h *SessionExpiresHeader) error {
+	delta, params, _ := strings.Cut(headerText, ";")
+	val, err := strconv.ParseUint(strings.TrimSpace(delta), 10, 32)
+	if err != nil {
+		return err
+	}
+	h.Delta = uint32(val)
+	h.Params = nil
+	if params != "" {
+		h.Params = NewParams()
+		if _, err := UnmarshalHeaderParams(params, ';', 0, &h.Params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMinSEHeader parses Min-SE header. Generic params are ignored
+func parseMinSEHeader(headerText string, minse *MinSEHeader) error {
+	delta, _, _ := strings.Cut(headerText, ";")
+	val, err := strconv.ParseUint(strings.TrimSpace(delta), 10, 32)
+	*minse = MinSEHeader(val)
+	return err
+}
+
+// parseEventHeader parses Event header
+func parseEventHeader(headerText string, h *EventHeader) error {
+	event, params, _ := strings.Cut(headerText, ";")
+	h.Event = strings.TrimSpace(event)
+	if h.Event == "" {
+		return fmt.Errorf("empty Event header")
+	}
+	h.Params = nil
+	if params != "" {
+		h.Params = NewParams()
+		if _, err := UnmarshalHeaderParams(params, ';', 0, &h.Params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSubscriptionStateHeader parses Subscription-State header
+func parseSubscriptionStateHeader(headerText string, h *SubscriptionStateHeader) error {
+	state, params, _ := strings.Cut(headerText, ";")
+	h.State = strings.ToLower(strings.TrimSpace(state))
+	if h.State == "" {
+		return fmt.Errorf("empty Subscription-State header")
+	}
+	h.Params = nil
+	if params != "" {
+		h.Params = NewParams()
+		if _, err := UnmarshalHeaderParams(params, ';', 0, &h.Params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseAllowEventsHeader parses Allow-Events header. All comma separated values are kept in single header
+func parseAllowEventsHeader(headerText string, h *AllowEventsHeader) error {
+	*h = (*h)[:0]
+	for _, e := range strings.Split(headerText, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			*h = append(*h, e)
+		}
+	}
+	return nil
+}
+
+// parseRSeqHeader parses RSeq header
+func parseRSeqHeader(headerText string, rseq *RSeqHeader) error {
+	val, err := strconv.ParseUint(strings.TrimSpace(headerText), 10, 32)
+	*rseq = RSeqHeader(val)
+	return err
+}
+
+// parseRAckHeader parses RAck header
+func parseRAckHeader(headerText string, rack *RAckHeader) error {
+	fields := strings.Fields(headerText)
+	if len(fields) != 3 {
+		return fmt.Errorf("RAck field should have response-num CSeq-num Method: '%s'", headerText)
+	}
+
+	rseq, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return err
+	}
+	cseq, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return err
+	}
+
+	rack.RSeq = uint32(rseq)
+	rack.CSeq = uint32(cseq)
+	rack.MethodName = RequestMethod(fields[2])
+	return nil
+}
+
+// parseReplacesHeader parses Replaces header
+func parseReplacesHeader(headerText string, h *ReplacesHeader) error {
+	callID, params, _ := strings.Cut(headerText, ";")
+	h.CallID = strings.TrimSpace(callID)
+	if h.CallID == "" {
+		return fmt.Errorf("empty Call-ID in Replaces header")
+	}
+
+	h.ToTag, h.FromTag, h.EarlyOnly = "", "", false
+	h.Params = nil
+	hp := NewParams()
+	if _, err := UnmarshalHeaderParams(params, ';', 0, &hp); err != nil {
+		return err
+	}
+	for _, kv := range hp {
+		switch strings.ToLower(kv.K) {
+		case "to-tag":
+			h.ToTag = kv.V
+		case "from-tag":
+			h.FromTag = kv.V
+		case "early-only":
+			h.EarlyOnly = true
+		default:
+			h.Params.Add(kv.K, kv.V)
+		}
+	}
+
+	if h.ToTag == "" || h.FromTag == "" {
+		return fmt.Errorf("Replaces header must have to-tag and from-tag: '%s'", headerText)
+	}
+	return nil
+}
+
 func headerParserCSeq(headerName []byte, headerText string) (headers Header, err error) {
 	var cseq CSeqHeader
 	return &cseq, parseCSeqHeader(headerText, &cseq)
@@ -11,6 +11,7 @@ const (
 	paramsStateEqual
 	paramsStateValue
 	paramsStateQuote
+	paramsStateQuoteEnd
 )
 
 func UnmarshalHeaderParams(s string, seperator rune, ending rune, p *HeaderParams) (n int, err error) {
@@ -61,18 +62,26 @@ func UnmarshalHeaderParams(s string, seperator rune, ending rune, p *HeaderParam
 				//End quoute
 				continue
 			}
-			p.Add(s[start:], s[quote+1:i])
-			state = paramsStateKey
+			// Quoted value is kept with quotes for every header, so it is written back as is.
+			// Use HeaderParams.GetUnquoted to read it without quotes
+			p.Add(s[start:sep], s[quote:i+1])
+			state = paramsStateQuoteEnd
+
+		case paramsStateQuoteEnd:
+			// Skip until next param
+			if c == seperator {
+				state = paramsStateKey
+			}
 		}
 	}
 
 	// Do the last one
-	if sep > 0 && n >= 0 && (start < sep) {
+	switch state {
+	case paramsStateValue, paramsStateQuote:
 		p.Add(s[start:sep], s[sep+1:n])
-	}
-	// No seperator
-	if sep == 0 && start < n && n >= 0 {
-		p.Add(s[start:], "")
+	case paramsStateEqual:
+		// No seperator
+		p.Add(s[start:n], "")
 	}
 
 	return n, nil
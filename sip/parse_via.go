@@ -152,9 +152,9 @@ loop:
 
 func viaStateParams(h *ViaHeader, s string) (viaFSM, int, error) {
 	var err error
-	coma := strings.IndexRune(s, ',')
+	coma := indexComaUnquoted(s)
 	if coma > 0 {
-		_, err = UnmarshalHeaderParams(s[:coma], ';', ',', &h.Params)
+		_, err = UnmarshalHeaderParams(s[:coma], ';', 0, &h.Params)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -164,3 +164,19 @@ func viaStateParams(h *ViaHeader, s string) (viaFSM, int, error) {
 	_, err = UnmarshalHeaderParams(s, ';', '\r', &h.Params)
 	return nil, 0, err
 }
+
+// indexComaUnquoted returns index of coma which is not within quoted param value
+func indexComaUnquoted(s string) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -28,6 +28,11 @@ var streamBufReader = sync.Pool{
 type ParserStream struct {
 	p *Parser
 
+	// OnKeepAlive is called with number of CRLF read between messages.
+	// Double CRLF is keep alive ping and single CRLF is pong
+	// https://datatracker.ietf.org/doc/html/rfc5626#section-3.5.1
+	OnKeepAlive func(crlf int)
+
 	// runtime values
 	buf           *bytes.Buffer
 	state         parserState
@@ -143,6 +148,20 @@ func (p *ParserStream) advance(n int) {
 	_ = p.buf.Next(n)
 }
 
+// skipCRLF skips CRLF before start line and returns number of skipped CRLF
+// RFC 3261 - 7.5.
+// Implementations processing SIP messages over stream-oriented
+// transports MUST ignore any CRLF appearing before the start-line.
+func (p *ParserStream) skipCRLF() int {
+	data := p.buf.Bytes()
+	n := 0
+	for len(data) >= 2*n+2 && data[2*n] == '\r' && data[2*n+1] == '\n' {
+		n++
+	}
+	_ = p.buf.Next(2 * n)
+	return n
+}
+
 func (p *ParserStream) parseSingle() error {
 	if p.buf == nil {
 		return io.ErrUnexpectedEOF
@@ -153,6 +172,15 @@ func (p *ParserStream) parseSingle() error {
 	)
 	switch p.state {
 	case stateStartLine:
+		if crlf := p.skipCRLF(); crlf > 0 {
+			if p.OnKeepAlive != nil {
+				p.OnKeepAlive(crlf)
+			}
+			if p.buf.Len() < 2 {
+				return io.ErrUnexpectedEOF
+			}
+		}
+
 		var msg Message
 		msg, n, err = p.p.parseStartLine(p.buf.Bytes(), true)
 		p.advance(n)
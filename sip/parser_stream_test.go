@@ -629,3 +629,26 @@ func BenchmarkParserStream(b *testing.B) {
 	})
 
 }
+
+func TestParserStreamKeepAlive(t *testing.T) {
+	parser := NewParser().NewSIPStream()
+	var crlfs []int
+	parser.OnKeepAlive = func(crlf int) {
+		crlfs = append(crlfs, crlf)
+	}
+
+	_, err := parser.parseSIPStreamFull([]byte("\r\n\r\n"))
+	require.ErrorIs(t, err, ErrParseSipPartial)
+	_, err = parser.parseSIPStreamFull([]byte("\r\n"))
+	require.ErrorIs(t, err, ErrParseSipPartial)
+	require.Equal(t, []int{2, 1}, crlfs)
+
+	// Ping glued with messages
+	crlfs = nil
+	data := append([]byte("\r\n\r\n"), testRawOptions("keepalive")...)
+	data = append(data, "\r\n\r\n"...)
+	msgs, err := parser.parseSIPStreamFull(data)
+	require.ErrorIs(t, err, ErrParseSipPartial)
+	require.Len(t, msgs, 1)
+	require.Equal(t, []int{2, 2}, crlfs)
+}
@@ -23,6 +23,44 @@ func TestUnmarshalParams(t *testing.T) {
 	assert.Equal(t, "", params.GetOr("lr", "<missing>"))
 }
 
+func TestParseQuotedParams(t *testing.T) {
+	parser := NewParser()
+	// Quoted values are kept with quotes for every header, not only Via
+	for _, c := range []struct {
+		header string
+		params func(req *Request) HeaderParams
+		key    string
+		value  string
+	}{
+		{
+			`Contact: <sip:alice@10.0.0.1>;+sip.instance="<urn:uuid:f81d4fae-7dec>";reg-id=1`,
+			func(req *Request) HeaderParams { return req.Contact().Params },
+			"+sip.instance", "<urn:uuid:f81d4fae-7dec>",
+		},
+		{
+			`Event: presence;id="a;b"`,
+			func(req *Request) HeaderParams { return req.Event().Params },
+			"id", "a;b",
+		},
+		{
+			`Subscription-State: terminated;reason="giveup"`,
+			func(req *Request) HeaderParams { return req.SubscriptionState().Params },
+			"reason", "giveup",
+		},
+	} {
+		req, _ := testParseHeaderOnRequest(t, parser, c.header)
+		params := c.params(req)
+		v, _ := params.Get(c.key)
+		assert.Equal(t, `"`+c.value+`"`, v)
+		v, _ = params.GetUnquoted(c.key)
+		assert.Equal(t, c.value, v)
+
+		// Round trip
+		name, _, _ := strings.Cut(c.header, ":")
+		assert.Equal(t, c.header, req.GetHeader(name).String())
+	}
+}
+
 func testParseHeader(t *testing.T, parser *Parser, header string) Header {
 	// This is fake way to get parsing done. We use fake message and read first header
 	_, h := testParseHeaderOnRequest(t, parser, header)
@@ -66,6 +104,27 @@ func TestParseHeaders(t *testing.T) {
 			assert.Equal(t, "UDP", via.Transport)
 		})
 
+		t.Run("QuotedParams", func(t *testing.T) {
+			header := `Via: SIP/2.0/UDP 192.0.2.2:5060;branch=z9hG4bK776;oc;oc-algo="loss,A";received=192.0.2.3, SIP/2.0/UDP 192.0.2.4;branch=z9hG4bK777`
+			out, err := parser.headersParsers.ParseHeader(nil, []byte(header))
+			require.NoError(t, err)
+			require.Len(t, out, 2)
+
+			via := out[0].(*ViaHeader)
+			assert.Equal(t, HeaderParams{{"branch", "z9hG4bK776"}, {"oc", ""}, {"oc-algo", `"loss,A"`}, {"received", "192.0.2.3"}}, via.Params)
+			via = out[1].(*ViaHeader)
+			assert.Equal(t, "192.0.2.4", via.Host)
+			assert.Equal(t, HeaderParams{{"branch", "z9hG4bK777"}}, via.Params)
+
+			// Round trip keeps quoted value
+			hstr := out[0].String()
+			assert.Equal(t, `Via: SIP/2.0/UDP 192.0.2.2:5060;branch=z9hG4bK776;oc;oc-algo="loss,A";received=192.0.2.3`, hstr)
+			out, err = parser.headersParsers.ParseHeader(nil, []byte(hstr))
+			require.NoError(t, err)
+			require.Len(t, out, 1)
+			assert.Equal(t, hstr, out[0].String())
+		})
+
 		t.Run("IPv6", func(t *testing.T) {
 			// Issue surfaced as livekit/sip#640: viaStateHost previously
 			// walked colons greedily and confused IPv6 separators with the
@@ -232,6 +291,164 @@ func TestParseHeaders(t *testing.T) {
 		assert.Equal(t, "70", h.Value())
 		assert.Equal(t, header, h.String())
 	})
+
+	t.Run("SessionExpires", func(t *testing.T) {
+		header := "Session-Expires: 1800;refresher=uac"
+		req, h := testParseHeaderOnRequest(t, parser, header)
+
+		se := req.SessionExpires()
+		require.NotNil(t, se)
+		assert.Equal(t, uint32(1800), se.Delta)
+		assert.Equal(t, "uac", se.Refresher())
+		assert.Equal(t, header, se.String())
+		assert.Equal(t, header, h.String())
+
+		req, _ = testParseHeaderOnRequest(t, parser, "x: 90")
+		require.NotNil(t, req.SessionExpires())
+		assert.Equal(t, uint32(90), req.SessionExpires().Delta)
+		assert.Empty(t, req.SessionExpires().Refresher())
+	})
+
+	t.Run("MinSE", func(t *testing.T) {
+		header := "Min-SE: 120"
+		req, _ := testParseHeaderOnRequest(t, parser, header)
+
+		exp := MinSEHeader(120)
+		assert.Equal(t, &exp, req.MinSE())
+		assert.Equal(t, header, req.MinSE().String())
+	})
+
+	t.Run("Event", func(t *testing.T) {
+		header := "Event: presence;id=1234"
+		req, _ := testParseHeaderOnRequest(t, parser, header)
+
+		ev := req.Event()
+		require.NotNil(t, ev)
+		assert.Equal(t, "presence", ev.Event)
+		assert.Equal(t, "1234", ev.ID())
+		assert.Equal(t, header, ev.String())
+
+		req, _ = testParseHeaderOnRequest(t, parser, "o: dialog")
+		require.NotNil(t, req.Event())
+		assert.True(t, req.Event().Match(&EventHeader{Event: "dialog"}))
+		assert.False(t, req.Event().Match(ev))
+	})
+
+	t.Run("SubscriptionState", func(t *testing.T) {
+		header := "Subscription-State: terminated;reason=probation;retry-after=30"
+		req, _ := testParseHeaderOnRequest(t, parser, header)
+
+		ss := req.SubscriptionState()
+		require.NotNil(t, ss)
+		assert.Equal(t, SubscriptionStateTerminated, ss.State)
+		assert.Equal(t, "probation", ss.Reason())
+		retry, ok := ss.RetryAfter()
+		assert.True(t, ok)
+		assert.Equal(t, uint32(30), retry)
+		_, ok = ss.Expires()
+		assert.False(t, ok)
+		assert.Equal(t, header, ss.String())
+
+		req, _ = testParseHeaderOnRequest(t, parser, "Subscription-State: active;expires=600")
+		require.NotNil(t, req.SubscriptionState())
+		expires, _ := req.SubscriptionState().Expires()
+		assert.Equal(t, uint32(600), expires)
+	})
+
+	t.Run("AllowEvents", func(t *testing.T) {
+		header := "Allow-Events: presence, dialog, message-summary"
+		req, _ := testParseHeaderOnRequest(t, parser, header)
+
+		exp := &AllowEventsHeader{"presence", "dialog", "message-summary"}
+		assert.Equal(t, exp, req.AllowEvents())
+		assert.Equal(t, header, req.AllowEvents().String())
+
+		req, _ = testParseHeaderOnRequest(t, parser, "u: refer")
+		require.NotNil(t, req.AllowEvents())
+		assert.True(t, req.AllowEvents().Has("refer"))
+	})
+
+	t.Run("RSeq", func(t *testing.T) {
+		header := "RSeq: 988789"
+		req, _ := testParseHeaderOnRequest(t, parser, header)
+
+		exp := RSeqHeader(988789)
+		assert.Equal(t, &exp, req.RSeq())
+		assert.Equal(t, header, req.RSeq().String())
+		assert.Equal(t, uint32(988789), req.RSeq().Val())
+	})
+
+	t.Run("RAck", func(t *testing.T) {
+		header := "RAck: 776656 1 INVITE"
+		req, _ := testParseHeaderOnRequest(t, parser, header)
+
+		exp := &RAckHeader{RSeq: 776656, CSeq: 1, MethodName: INVITE}
+		assert.Equal(t, exp, req.RAck())
+		assert.Equal(t, header, req.RAck().String())
+
+		req, _ = testParseHeaderOnRequest(t, parser, "RAck: 776656 INVITE")
+		assert.Nil(t, req.RAck())
+	})
+
+	t.Run("Replaces", func(t *testing.T) {
+		header := "Replaces: 98732@sip.example.com;to-tag=r33th4x0r;from-tag=ff87ff;early-only"
+		req, _ := testParseHeaderOnRequest(t, parser, header)
+
+		exp := &ReplacesHeader{CallID: "98732@sip.example.com", ToTag: "r33th4x0r", FromTag: "ff87ff", EarlyOnly: true}
+		assert.Equal(t, exp, req.Replaces())
+		assert.Equal(t, header, req.Replaces().String())
+
+		req, _ = testParseHeaderOnRequest(t, parser, "Replaces: 425928@bobster.example.org ;from-tag=7743;to-tag=6472")
+		assert.Equal(t, "425928@bobster.example.org;to-tag=6472;from-tag=7743", req.Replaces().Value())
+
+		req, _ = testParseHeaderOnRequest(t, parser, "Replaces: 425928@bobster.example.org;to-tag=6472")
+		assert.Nil(t, req.Replaces())
+	})
+}
+
+func TestParseMalformedLazyHeaders(t *testing.T) {
+	// Malformed headers parsed only on access must not fail parsing of message
+	parser := NewParser()
+	for _, header := range []string{
+		"Session-Expires: abc",
+		"x: 90;refresher",
+		"Min-SE: -1",
+		"RSeq: abc",
+		"RAck: 776656 INVITE",
+		"Event: ;id=1",
+		"Subscription-State: ;expires=600",
+		"Replaces: 425928@bobster.example.org;to-tag=6472",
+	} {
+		t.Run(header, func(t *testing.T) {
+			msg, err := parser.ParseSIP([]byte(strings.Join([]string{
+				"INVITE sip:bob@example.com SIP/2.0",
+				"Via: SIP/2.0/UDP 127.0.0.1:5060;branch=" + GenerateBranch(),
+				"From: <sip:alice@example.com>;tag=1234",
+				"To: <sip:bob@example.com>",
+				"Call-ID: " + GenerateTagN(16),
+				"CSeq: 1 INVITE",
+				header,
+				"Content-Length: 0",
+				"",
+				"",
+			}, "\r\n")))
+			require.NoError(t, err)
+			name, _, _ := strings.Cut(header, ":")
+			assert.Equal(t, header, msg.(*Request).GetHeader(name).String())
+		})
+	}
+
+	req := NewRequest(INVITE, Uri{})
+	req.AppendHeader(NewHeader("Session-Expires", "abc"))
+	req.AppendHeader(NewHeader("Min-SE", "-1"))
+	assert.Nil(t, req.SessionExpires())
+	assert.Nil(t, req.MinSE())
+
+	req.AppendHeader(NewHeader("RSeq", "abc"))
+	assert.Nil(t, req.RSeq())
+
+	req.AppendHeader(NewHeader("Event", ";id=1"))
+	assert.Nil(t, req.Event())
 }
 
 func BenchmarkParserHeaders(b *testing.B) {
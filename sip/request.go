@@ -18,6 +18,12 @@ type Request struct {
 	Laddr Addr
 	// raddr is address set after resolving Via
 	raddr Addr
+	// flow forces request to be sent over existing connection
+	flow *Flow
+	// udpLarge allows request above MTU over UDP, after TCP failed as per RFC 3261 18.1.1
+	udpLarge bool
+	// timers overrides transaction layer timers for client transaction
+	timers *Timers
 }
 
 // NewRequest creates base for building sip Request
@@ -147,11 +153,6 @@ func (req *Request) Transport() string {
 		}
 	}
 
-	//TODO string is expensive
-	// if tp == "UDP" && len(req.String()) > int(MTU)-200 {
-	// 	tp = "TCP"
-	// }
-
 	return tp
 }
 
@@ -231,6 +232,25 @@ func (req *Request) Destination() string {
 	return fmt.Sprintf("%v:%v", host, port)
 }
 
+// SetFlow forces request to be sent over RFC 5626 flow. Transport and destination are set from flow.
+// If flow connection no longer exists sending fails with ErrTransportFlowFailed
+// and no new connection is created.
+func (req *Request) SetFlow(f Flow) {
+	req.flow = &f
+	req.SetTransport(NetworkToUpper(f.Transport))
+	req.SetDestination(f.RemoteAddr)
+}
+
+// SetTimers overrides transaction layer timers for client transaction of this request,
+// for example shorter Timer B for OPTIONS ping
+//
+//	t := ua.TransactionLayer().Timers()
+//	t.TimerB = 2 * time.Second
+//	req.SetTimers(t)
+func (req *Request) SetTimers(t Timers) {
+	req.timers = &t
+}
+
 // newAckRequestNon2xx follows rules as here. This is not dialog ACK instead it is transaction ACK.
 // https://datatracker.ietf.org/doc/html/rfc3261#section-17.1.1.3
 func newAckRequestNon2xx(inviteRequest *Request, inviteResponse *Response, body []byte) *Request {
@@ -348,6 +368,8 @@ func cloneRequest(req *Request) *Request {
 	newReq.SetDestination(req.Destination())
 	newReq.raddr = req.raddr
 	newReq.Laddr = req.Laddr
+	newReq.flow = req.flow
+	newReq.timers = req.timers
 
 	return newReq
 }
@@ -42,6 +42,9 @@ var (
 
 	TxSeperator = "__"
 
+	// DefaultDrainRetryAfter is Retry-After of 503 response to new requests during Shutdown
+	DefaultDrainRetryAfter = 30 * time.Second
+
 	TransactionFSMDebug bool
 )
 
@@ -52,6 +55,8 @@ func init() {
 	SetTimers(t1, t2, t4)
 }
 
+// SetTimers sets package timers, which are used by transactions when timers profile is not set.
+// For per user agent timers use WithTransactionLayerTimers
 func SetTimers(t1, t2, t4 time.Duration) {
 	T1 = t1
 	T2 = t2
@@ -70,6 +75,73 @@ func SetTimers(t1, t2, t4 time.Duration) {
 	Timer_M = 64 * T1
 }
 
+// Timers is SIP timers profile used by transactions. It allows user agents in same process
+// to have different timers, for example trunk side with high RTT.
+// Use NewTimers to populate all timers based on T1, T2 and T4
+type Timers struct {
+	// T1: Round-trip time (RTT) estimate
+	T1 time.Duration
+	// T2: Maximum retransmission interval for non-INVITE requests and INVITE responses
+	T2 time.Duration
+	// T4: Maximum duration that a message can remain in the network
+	T4 time.Duration
+
+	TimerA time.Duration
+	TimerB time.Duration
+	TimerD time.Duration
+	TimerE time.Duration
+	TimerF time.Duration
+	TimerG time.Duration
+	TimerH time.Duration
+	TimerI time.Duration
+	TimerJ time.Duration
+	TimerK time.Duration
+	TimerL time.Duration
+	TimerM time.Duration
+}
+
+// NewTimers creates timers profile where all timers get populated based on T1, T2 and T4 as SetTimers does
+func NewTimers(t1, t2, t4 time.Duration) Timers {
+	return Timers{
+		T1:     t1,
+		T2:     t2,
+		T4:     t4,
+		TimerA: t1,
+		TimerB: 64 * t1,
+		TimerD: 32 * time.Second,
+		TimerE: t1,
+		TimerF: 64 * t1,
+		TimerG: t1,
+		TimerH: 64 * t1,
+		TimerI: t4,
+		TimerJ: 64 * t1,
+		TimerK: t4,
+		TimerL: 64 * t1,
+		TimerM: 64 * t1,
+	}
+}
+
+// DefaultTimers returns timers profile of package timers, which are set by SetTimers
+func DefaultTimers() Timers {
+	return Timers{
+		T1:     T1,
+		T2:     T2,
+		T4:     T4,
+		TimerA: Timer_A,
+		TimerB: Timer_B,
+		TimerD: Timer_D,
+		TimerE: Timer_E,
+		TimerF: Timer_F,
+		TimerG: Timer_G,
+		TimerH: Timer_H,
+		TimerI: Timer_I,
+		TimerJ: Timer_J,
+		TimerK: Timer_K,
+		TimerL: Timer_L,
+		TimerM: Timer_M,
+	}
+}
+
 var (
 	// Transaction Layer Errors can be detected and handled with different response on caller side
 	// https://www.rfc-editor.org/rfc/rfc3261#section-8.1.3.1
@@ -171,6 +243,8 @@ type baseTx struct {
 
 	log         *slog.Logger
 	onTerminate FnTxTerminate
+	// timers is profile read by FSM
+	timers Timers
 }
 
 func (tx *baseTx) String() string {
@@ -462,6 +536,12 @@ func (store *transactionStore[T]) drop(key string) bool {
 	return exists
 }
 
+func (store *transactionStore[T]) len() int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return len(store.items)
+}
+
 func (store *transactionStore[T]) terminateAll() {
 	store.mu.RLock()
 	defer store.mu.RUnlock()
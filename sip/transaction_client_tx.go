@@ -3,9 +3,14 @@ package sip
 import (
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 )
 
+// clientTxReceiveQueueSize is number of responses waiting to be passed to client transaction
+// with receiveQueued. It covers retransmissions of final response
+const clientTxReceiveQueueSize = 16
+
 type ClientTx struct {
 	baseTx
 	responses    chan *Response
@@ -17,6 +22,17 @@ type ClientTx struct {
 	timer_m      *time.Timer
 
 	onRetransmission FnTxResponse
+
+	// sentAt is time of first request send, used for RTT measurement
+	sentAt        time.Time
+	retransmitted bool
+	rttMeasured   bool
+	onRTT         func(rtt time.Duration)
+	onResponse    func(res *Response)
+
+	// receiveQueue is drained by own goroutine. See receiveQueued
+	receiveQueue     chan *Response
+	receiveQueueOnce sync.Once
 }
 
 func NewClientTx(key string, origin *Request, conn Connection, logger *slog.Logger) *ClientTx {
@@ -34,8 +50,15 @@ func NewClientTx(key string, origin *Request, conn Connection, logger *slog.Logg
 }
 
 func (tx *ClientTx) Init() error {
+	if tx.timers == (Timers{}) {
+		// Timers profile is not set by transaction layer
+		tx.timers = DefaultTimers()
+	}
 	tx.initFSM()
 
+	tx.mu.Lock()
+	tx.sentAt = time.Now()
+	tx.mu.Unlock()
 	if err := tx.conn.WriteMsg(tx.origin); err != nil {
 		e := fmt.Errorf("fail to write request on init req=%q: %w", tx.origin.StartLine(), err)
 		return wrapTransportError(e)
@@ -54,19 +77,19 @@ func (tx *ClientTx) Init() error {
 		// Timer A - retransmission
 
 		tx.mu.Lock()
-		tx.timer_a_time = Timer_A
+		tx.timer_a_time = tx.timers.TimerA
 
 		tx.timer_a = time.AfterFunc(tx.timer_a_time, func() {
 			tx.spinFsm(client_input_timer_a)
 		})
 		// Timer D is set to 32 seconds for unreliable transports
-		tx.timer_d_time = Timer_D
+		tx.timer_d_time = tx.timers.TimerD
 		tx.mu.Unlock()
 	}
 
 	// Timer B - timeout
 	tx.mu.Lock()
-	tx.timer_b = time.AfterFunc(Timer_B, func() {
+	tx.timer_b = time.AfterFunc(tx.timers.TimerB, func() {
 		tx.spinFsmWithError(client_input_timer_b, fmt.Errorf("Timer_B timed out. %w", ErrTransactionTimeout))
 	})
 	tx.mu.Unlock()
@@ -151,9 +174,87 @@ func (tx *ClientTx) Receive(res *Response) {
 	}
 	// }
 
+	tx.measureRTT()
+
+	tx.mu.Lock()
+	onResponse := tx.onResponse
+	tx.mu.Unlock()
+	if onResponse != nil {
+		onResponse(res)
+	}
 	tx.spinFsmWithResponse(input, res)
 }
 
+// receiveQueued passes response to Receive without blocking caller, as Receive blocks until response is consumed.
+// Responses are received in order. It returns false if queue is full and response is dropped
+func (tx *ClientTx) receiveQueued(res *Response) bool {
+	tx.receiveQueueOnce.Do(func() {
+		tx.receiveQueue = make(chan *Response, clientTxReceiveQueueSize)
+		go tx.receiveLoop()
+	})
+
+	select {
+	case tx.receiveQueue <- res:
+		return true
+	default:
+		return false
+	}
+}
+
+func (tx *ClientTx) receiveLoop() {
+	for {
+		select {
+		case <-tx.done:
+			return
+		case res := <-tx.receiveQueue:
+			tx.Receive(res)
+		}
+	}
+}
+
+// OnResponse registers callback called with every received response before it is passed to Responses.
+// It returns false in case transaction already terminated
+// NOTE: You must not block here.
+//
+// Experimental
+func (tx *ClientTx) OnResponse(f func(res *Response)) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return false
+	}
+	if tx.onResponse != nil {
+		prev := tx.onResponse
+		tx.onResponse = func(res *Response) {
+			prev(res)
+			f(res)
+		}
+		return true
+	}
+	tx.onResponse = f
+	return true
+}
+
+// measureRTT reports RTT on first response
+func (tx *ClientTx) measureRTT() {
+	tx.mu.Lock()
+	if tx.rttMeasured || tx.onRTT == nil || tx.sentAt.IsZero() {
+		tx.mu.Unlock()
+		return
+	}
+	tx.rttMeasured = true
+	rtt := time.Since(tx.sentAt)
+	retransmitted := tx.retransmitted
+	onRTT := tx.onRTT
+	tx.mu.Unlock()
+
+	// Karn's algorithm. Response to retransmitted request can not be matched to send time
+	if retransmitted {
+		return
+	}
+	onRTT(rtt)
+}
+
 func (tx *ClientTx) Connection() Connection {
 	return tx.conn
 }
@@ -211,6 +312,9 @@ func (tx *ClientTx) resend() {
 	}
 
 	// tx.log.Debug("resend origin request")
+	tx.mu.Lock()
+	tx.retransmitted = true
+	tx.mu.Unlock()
 
 	err := tx.conn.WriteMsg(tx.origin)
 	if err != nil {
@@ -223,8 +223,8 @@ func (tx *ClientTx) actResend() fsmInput {
 
 	tx.timer_a_time *= 2
 	// For non-INVITE, cap timer A at T2 seconds.
-	if tx.timer_a_time > T2 {
-		tx.timer_a_time = T2
+	if tx.timer_a_time > tx.timers.T2 {
+		tx.timer_a_time = tx.timers.T2
 	}
 
 	if tx.timer_a != nil {
@@ -349,7 +349,7 @@ func (tx *ClientTx) actAckResend() fsmInput {
 		select {
 		case <-tx.done:
 			return FsmInputNone
-		case <-time.After(T2):
+		case <-time.After(tx.timers.T2):
 		}
 	}
 	tx.ack()
@@ -402,7 +402,7 @@ func (tx *ClientTx) actPassupAccept() fsmInput {
 		tx.timer_b = nil
 	}
 
-	tx.timer_m = time.AfterFunc(Timer_M, func() {
+	tx.timer_m = time.AfterFunc(tx.timers.TimerM, func() {
 		tx.spinFsm(client_input_timer_m)
 	})
 	tx.mu.Unlock()
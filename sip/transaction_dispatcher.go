@@ -0,0 +1,240 @@
+package sip
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DispatcherOverflow is policy applied when dispatcher queue is full
+type DispatcherOverflow int
+
+const (
+	// DispatcherOverflowDrop drops message. Sender will retransmit over UDP
+	DispatcherOverflowDrop DispatcherOverflow = iota
+	// DispatcherOverflowReject responds to request with stateless 503 and Retry-After.
+	// ACK and responses are dropped
+	DispatcherOverflowReject
+	// DispatcherOverflowBlock blocks transport reader until queue has space
+	DispatcherOverflowBlock
+)
+
+var (
+	// DefaultDispatcherQueueSize is queue size per dispatcher worker
+	DefaultDispatcherQueueSize = 1024
+	// DefaultDispatcherRetryAfter is Retry-After of 503 response on queue overflow
+	DefaultDispatcherRetryAfter = 5 * time.Second
+)
+
+// DispatcherConfig configures bounded worker pool for handling messages in transaction layer
+type DispatcherConfig struct {
+	// Workers is number of workers. Default runtime.NumCPU()
+	Workers int
+	// QueueSize is queue size per worker. Default DefaultDispatcherQueueSize
+	QueueSize int
+	// Handlers is max number of request handlers of new server transactions running concurrently.
+	// Default Workers * QueueSize
+	Handlers int
+	// Overflow is policy when worker queue is full or all request handlers are busy. Default DispatcherOverflowDrop
+	Overflow DispatcherOverflow
+	// RetryAfter is used with DispatcherOverflowReject. Default DefaultDispatcherRetryAfter
+	RetryAfter time.Duration
+}
+
+// DispatcherStats are dispatcher metrics
+type DispatcherStats struct {
+	// Queued is number of messages waiting in queues
+	Queued int
+	// QueueDepths is number of messages waiting per worker
+	QueueDepths []int
+	// Capacity is total size of queues
+	Capacity int
+	// Handlers is number of running request handlers
+	Handlers int
+	// HandlersCapacity is max number of running request handlers
+	HandlersCapacity int
+	// Processed is number of handled messages
+	Processed uint64
+	// Dropped is number of messages dropped on overflow, including requests dropped when all handlers are busy
+	Dropped uint64
+	// Rejected is number of requests rejected with 503 on overflow
+	Rejected uint64
+}
+
+// dispatcher distributes messages to workers by transaction branch,
+// so messages of same transaction are handled in order
+type dispatcher struct {
+	queues   []chan Message
+	handlers chan struct{}
+	overflow DispatcherOverflow
+	handle   func(msg Message)
+	reject   func(req *Request)
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+func newDispatcher(conf DispatcherConfig, handle func(msg Message), reject func(req *Request)) *dispatcher {
+	workers := conf.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultDispatcherQueueSize
+	}
+	handlers := conf.Handlers
+	if handlers <= 0 {
+		handlers = workers * queueSize
+	}
+
+	d := &dispatcher{
+		queues:   make([]chan Message, workers),
+		handlers: make(chan struct{}, handlers),
+		overflow: conf.Overflow,
+		handle:   handle,
+		reject:   reject,
+		done:     make(chan struct{}),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan Message, queueSize)
+	}
+
+	d.wg.Add(workers)
+	for _, q := range d.queues {
+		go d.worker(q)
+	}
+	return d
+}
+
+func (d *dispatcher) worker(q chan Message) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case msg := <-q:
+			d.handle(msg)
+			d.processed.Add(1)
+		}
+	}
+}
+
+// dispatch queues message. Overflow policy is applied when worker queue is full
+func (d *dispatcher) dispatch(msg Message) {
+	q := d.queues[d.shard(msg)]
+	select {
+	case q <- msg:
+		return
+	case <-d.done:
+		d.dropped.Add(1)
+		return
+	default:
+	}
+
+	switch d.overflow {
+	case DispatcherOverflowBlock:
+		select {
+		case q <- msg:
+		case <-d.done:
+			d.dropped.Add(1)
+		}
+	case DispatcherOverflowReject:
+		if req, ok := msg.(*Request); ok && !req.IsAck() {
+			d.rejected.Add(1)
+			d.reject(req)
+			return
+		}
+		d.dropped.Add(1)
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// acquireHandler reserves slot for request handler, which must be released with releaseHandler.
+// Overflow policy is applied when all handlers are busy
+func (d *dispatcher) acquireHandler(req *Request) bool {
+	select {
+	case d.handlers <- struct{}{}:
+		return true
+	default:
+	}
+
+	switch d.overflow {
+	case DispatcherOverflowBlock:
+		select {
+		case d.handlers <- struct{}{}:
+			return true
+		case <-d.done:
+		}
+	case DispatcherOverflowReject:
+		if !req.IsAck() {
+			d.rejected.Add(1)
+			d.reject(req)
+			return false
+		}
+	}
+	d.dropped.Add(1)
+	return false
+}
+
+func (d *dispatcher) releaseHandler() {
+	<-d.handlers
+}
+
+// shard returns worker index based on top Via branch, which is same for request,
+// its retransmissions, CANCEL, ACK of non 2xx and responses. Call-ID is used in case of no branch
+func (d *dispatcher) shard(msg Message) int {
+	if len(d.queues) == 1 {
+		return 0
+	}
+
+	key := ""
+	if via := msg.Via(); via != nil {
+		key, _ = via.Params.Get("branch")
+	}
+	if key == "" {
+		if callid := msg.CallID(); callid != nil {
+			key = callid.Value()
+		}
+	}
+
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(d.queues)))
+}
+
+func (d *dispatcher) stats() DispatcherStats {
+	s := DispatcherStats{
+		QueueDepths:      make([]int, len(d.queues)),
+		Handlers:         len(d.handlers),
+		HandlersCapacity: cap(d.handlers),
+		Processed:        d.processed.Load(),
+		Dropped:          d.dropped.Load(),
+		Rejected:         d.rejected.Load(),
+	}
+	for i, q := range d.queues {
+		s.QueueDepths[i] = len(q)
+		s.Queued += len(q)
+		s.Capacity += cap(q)
+	}
+	return s
+}
+
+// stop stops workers. Queued messages are not handled
+func (d *dispatcher) stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+	})
+	d.wg.Wait()
+}
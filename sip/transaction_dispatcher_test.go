@@ -0,0 +1,292 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcherOrdering(t *testing.T) {
+	var mu sync.Mutex
+	handled := map[string][]uint32{}
+	var wg sync.WaitGroup
+
+	d := newDispatcher(DispatcherConfig{Workers: 4, QueueSize: 100, Overflow: DispatcherOverflowBlock}, func(msg Message) {
+		defer wg.Done()
+		req := msg.(*Request)
+		branch, _ := req.Via().Params.Get("branch")
+		mu.Lock()
+		handled[branch] = append(handled[branch], req.CSeq().SeqNo)
+		mu.Unlock()
+	}, nil)
+	defer d.stop()
+
+	reqs := make([]*Request, 10)
+	for i := range reqs {
+		reqs[i] = testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1")
+	}
+	for seq := uint32(1); seq <= 50; seq++ {
+		for _, req := range reqs {
+			r := req.Clone()
+			r.CSeq().SeqNo = seq
+			wg.Add(1)
+			d.dispatch(r)
+		}
+	}
+	wg.Wait()
+
+	require.Len(t, handled, len(reqs))
+	for _, seqs := range handled {
+		require.Len(t, seqs, 50)
+		for i, seq := range seqs {
+			assert.Equal(t, uint32(i+1), seq)
+		}
+	}
+	stats := d.stats()
+	assert.Equal(t, uint64(500), stats.Processed)
+	assert.Equal(t, 400, stats.Capacity)
+	assert.Len(t, stats.QueueDepths, 4)
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+	// Worker blocks on first message, second fills queue
+	newBlocked := func(t *testing.T, overflow DispatcherOverflow, reject func(req *Request)) (*dispatcher, chan struct{}) {
+		unblock := make(chan struct{})
+		started := make(chan struct{}, 1)
+		d := newDispatcher(DispatcherConfig{Workers: 1, QueueSize: 1, Overflow: overflow}, func(msg Message) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-unblock
+		}, reject)
+
+		d.dispatch(testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1"))
+		<-started
+		d.dispatch(testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1"))
+		stats := d.stats()
+		require.Equal(t, 1, stats.Queued)
+		return d, unblock
+	}
+
+	t.Run("Drop", func(t *testing.T) {
+		d, unblock := newBlocked(t, DispatcherOverflowDrop, nil)
+		d.dispatch(testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1"))
+		assert.Equal(t, uint64(1), d.stats().Dropped)
+		close(unblock)
+		d.stop()
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		var rejected []*Request
+		d, unblock := newBlocked(t, DispatcherOverflowReject, func(req *Request) {
+			rejected = append(rejected, req)
+		})
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1")
+		d.dispatch(req)
+		ack := testCreateRequest(t, "ACK", "sip:bob@127.0.0.1", "UDP", "127.0.0.1")
+		d.dispatch(ack)
+
+		require.Len(t, rejected, 1)
+		assert.Equal(t, req, rejected[0])
+		stats := d.stats()
+		assert.Equal(t, uint64(1), stats.Rejected)
+		assert.Equal(t, uint64(1), stats.Dropped)
+		close(unblock)
+		d.stop()
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		d, unblock := newBlocked(t, DispatcherOverflowBlock, nil)
+		dispatched := make(chan struct{})
+		go func() {
+			d.dispatch(testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1"))
+			close(dispatched)
+		}()
+
+		select {
+		case <-dispatched:
+			t.Fatal("dispatch should block on full queue")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(unblock)
+		<-dispatched
+		d.stop()
+		assert.Equal(t, uint64(0), d.stats().Dropped)
+	})
+}
+
+func TestTransactionLayerDispatcher(t *testing.T) {
+	// NOTE it creates real network connection
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dst := l.LocalAddr().String()
+
+	serverTp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer serverTp.Close()
+	serverTxl := NewTransactionLayer(serverTp, WithTransactionLayerDispatcher(DispatcherConfig{Workers: 2}))
+	defer serverTxl.Close()
+	serverTxl.OnRequest(func(req *Request, tx *ServerTx) {
+		tx.Respond(NewResponseFromRequest(req, StatusOK, "OK", nil))
+	})
+	go serverTp.ServeUDP(l)
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+	txl := NewTransactionLayer(tp, WithTransactionLayerDispatcher(DispatcherConfig{Workers: 2}))
+	defer txl.Close()
+
+	for i := 0; i < 5; i++ {
+		req := testCreateRequest(t, "OPTIONS", "sip:"+dst, "UDP", "127.0.0.1")
+		tx, err := txl.Request(context.TODO(), req)
+		require.NoError(t, err)
+
+		select {
+		case res := <-tx.Responses():
+			require.Equal(t, StatusOK, res.StatusCode)
+		case <-time.After(2 * time.Second):
+			t.Fatal("response not received")
+		}
+		tx.Terminate()
+	}
+
+	// Counter is increased after message is handled
+	processed := func(txl *TransactionLayer) func() bool {
+		return func() bool {
+			stats, ok := txl.DispatcherStats()
+			return ok && stats.Processed == 5
+		}
+	}
+	require.Eventually(t, processed(serverTxl), time.Second, 10*time.Millisecond)
+	require.Eventually(t, processed(txl), time.Second, 10*time.Millisecond)
+
+	stats, _ := serverTxl.DispatcherStats()
+	assert.Equal(t, 2*DefaultDispatcherQueueSize, stats.Capacity)
+
+	_, ok := NewTransactionLayer(NewTransportLayer(net.DefaultResolver, NewParser(), nil)).DispatcherStats()
+	assert.False(t, ok)
+}
+
+func TestTransactionLayerDispatcherHandlers(t *testing.T) {
+	// NOTE it creates real network connection
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dst := l.LocalAddr().String()
+
+	serverTp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer serverTp.Close()
+	serverTxl := NewTransactionLayer(serverTp, WithTransactionLayerDispatcher(DispatcherConfig{Workers: 2, Handlers: 1, Overflow: DispatcherOverflowReject}))
+	defer serverTxl.Close()
+
+	unblock := make(chan struct{})
+	serverTxl.OnRequest(func(req *Request, tx *ServerTx) {
+		if req.GetHeader("X-Block") != nil {
+			<-unblock
+		}
+		tx.Respond(NewResponseFromRequest(req, StatusOK, "OK", nil))
+	})
+	go serverTp.ServeUDP(l)
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+	txl := NewTransactionLayer(tp)
+	defer txl.Close()
+
+	request := func(block bool) *ClientTx {
+		req := testCreateRequest(t, "OPTIONS", "sip:"+dst, "UDP", "127.0.0.1")
+		if block {
+			req.AppendHeader(NewHeader("X-Block", "1"))
+		}
+		tx, err := txl.Request(context.TODO(), req)
+		require.NoError(t, err)
+		t.Cleanup(tx.Terminate)
+		return tx
+	}
+	response := func(tx *ClientTx) *Response {
+		select {
+		case res := <-tx.Responses():
+			return res
+		case <-time.After(2 * time.Second):
+			t.Fatal("response not received")
+		}
+		return nil
+	}
+
+	blocked := request(true)
+	require.Eventually(t, func() bool {
+		stats, _ := serverTxl.DispatcherStats()
+		return stats.Handlers == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// All handlers are busy
+	res := response(request(false))
+	assert.Equal(t, StatusServiceUnavailable, res.StatusCode)
+	stats, _ := serverTxl.DispatcherStats()
+	assert.Equal(t, uint64(1), stats.Rejected)
+	assert.Equal(t, 1, stats.HandlersCapacity)
+
+	close(unblock)
+	assert.Equal(t, StatusOK, response(blocked).StatusCode)
+	require.Eventually(t, func() bool {
+		stats, _ := serverTxl.DispatcherStats()
+		return stats.Handlers == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, StatusOK, response(request(false)).StatusCode)
+}
+
+func TestTransactionLayerDispatcherUnreadResponses(t *testing.T) {
+	// NOTE it creates real network connection
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dst := l.LocalAddr().String()
+
+	serverTp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer serverTp.Close()
+	serverTxl := NewTransactionLayer(serverTp)
+	defer serverTxl.Close()
+	serverTxl.OnRequest(func(req *Request, tx *ServerTx) {
+		tx.Respond(NewResponseFromRequest(req, StatusOK, "OK", nil))
+	})
+	go serverTp.ServeUDP(l)
+
+	// Single worker handles all responses
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+	txl := NewTransactionLayer(tp, WithTransactionLayerDispatcher(DispatcherConfig{Workers: 1}))
+	defer txl.Close()
+
+	// Responses of this transaction are never read
+	unread, err := txl.NewClientTransaction(context.TODO(), testCreateRequest(t, "OPTIONS", "sip:"+dst, "UDP", "127.0.0.1"))
+	require.NoError(t, err)
+	defer unread.Terminate()
+	received := make(chan struct{}, 1)
+	unread.OnResponse(func(res *Response) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	})
+	require.NoError(t, unread.Init())
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("response not received")
+	}
+
+	for i := 0; i < 3; i++ {
+		tx, err := txl.Request(context.TODO(), testCreateRequest(t, "OPTIONS", "sip:"+dst, "UDP", "127.0.0.1"))
+		require.NoError(t, err)
+		select {
+		case res := <-tx.Responses():
+			assert.Equal(t, StatusOK, res.StatusCode)
+		case <-time.After(2 * time.Second):
+			t.Fatal("response blocked by unread client transaction")
+		}
+		tx.Terminate()
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,6 +30,21 @@ type TransactionLayer struct {
 	serverTransactions *transactionStore[*ServerTx]
 
 	terminateOnConnClose bool
+	// timers is timers profile. If nil package timers are used
+	timers *Timers
+	// rtt keeps RTT estimates per remote address
+	rtt *rttEstimator
+	// adaptiveT1 enables T1 derived from RTT estimate within bounds
+	adaptiveT1   bool
+	minT1, maxT1 time.Duration
+
+	// draining is set by Shutdown. New requests outside dialog are rejected
+	draining        atomic.Bool
+	drainRetryAfter time.Duration
+
+	// dispatcherConf enables handling messages on bounded worker pool
+	dispatcherConf *DispatcherConfig
+	dispatcher     *dispatcher
 
 	log *slog.Logger
 }
@@ -59,11 +76,56 @@ func WithTransactionLayerTerminateOnConnClose() TransactionLayerOption {
 	}
 }
 
+// WithTransactionLayerTimers sets timers profile for all transactions created by this layer,
+// instead of package timers set with SetTimers. Use NewTimers to build profile.
+func WithTransactionLayerTimers(t Timers) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.timers = &t
+	}
+}
+
+// WithTransactionLayerAdaptiveT1 enables T1 per remote address derived from measured RTT.
+// T1 is RTO (SRTT + 4*RTTVar) of remote address bounded by minT1 and maxT1,
+// and timers based on T1 like Timer B are scaled with it. Until RTT is measured, layer timers are used.
+// Timers set on request with SetTimers are not changed.
+func WithTransactionLayerAdaptiveT1(minT1, maxT1 time.Duration) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.adaptiveT1 = true
+		txl.minT1 = minT1
+		txl.maxT1 = maxT1
+	}
+}
+
+// WithTransactionLayerDrainRetryAfter sets Retry-After of 503 response sent to new requests during Shutdown
+// Default: DefaultDrainRetryAfter
+func WithTransactionLayerDrainRetryAfter(d time.Duration) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.drainRetryAfter = d
+	}
+}
+
+// WithTransactionLayerDispatcher enables handling of incoming messages on bounded worker pool
+// instead of goroutine per message. Messages are sharded by top Via branch (or Call-ID) to workers,
+// so messages of same transaction are processed in order. When worker queue is full,
+// conf.Overflow policy is applied. Request handler for new server transaction runs in own goroutine,
+// limited by conf.Handlers. When all handlers are busy, conf.Overflow policy is applied as well.
+// Responses are passed to client transaction without blocking worker, and they are dropped
+// if client transaction does not consume them.
+//
+// Experimental
+func WithTransactionLayerDispatcher(conf DispatcherConfig) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.dispatcherConf = &conf
+	}
+}
+
 func NewTransactionLayer(tpl *TransportLayer, options ...TransactionLayerOption) *TransactionLayer {
 	txl := &TransactionLayer{
 		tpl:                tpl,
 		clientTransactions: newTransactionStore[*ClientTx](),
 		serverTransactions: newTransactionStore[*ServerTx](),
+		rtt:                newRTTEstimator(),
+		drainRetryAfter:    DefaultDrainRetryAfter,
 
 		reqHandler:    defaultRequestHandler,
 		unRespHandler: defaultUnhandledRespHandler,
@@ -74,22 +136,23 @@ func NewTransactionLayer(tpl *TransportLayer, options ...TransactionLayerOption)
 		o(txl)
 	}
 
+	if conf := txl.dispatcherConf; conf != nil {
+		retryAfter := conf.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = DefaultDispatcherRetryAfter
+		}
+		txl.dispatcher = newDispatcher(*conf, txl.handleMessageDispatched, func(req *Request) {
+			txl.respondServiceUnavailable(req, retryAfter)
+		})
+	}
+
+	// Transport uses same timers profile as transactions
+	tpl.timersProfile = txl.Timers
+
 	//Send all transport messages to our transaction layer
 	tpl.OnMessage(txl.handleMessage)
 
-	notify := func(conn Connection) { txl.OnConnectionClose(conn) }
-	if tpl.tcp != nil {
-		tpl.tcp.onConnClose = notify
-	}
-	if tpl.tls != nil {
-		tpl.tls.onConnClose = notify
-	}
-	if tpl.ws != nil {
-		tpl.ws.onConnClose = notify
-	}
-	if tpl.wss != nil {
-		tpl.wss.onConnClose = notify
-	}
+	tpl.OnConnectionClose(txl.OnConnectionClose)
 
 	return txl
 }
@@ -99,7 +162,7 @@ func (txl *TransactionLayer) OnRequest(h TransactionRequestHandler) {
 }
 
 // OnConnectionClose is called when a reliable transport connection (TCP, TLS,
-// WS, WSS) is closed by the remote side or due to a read error.
+// WS, WSS or custom) is closed by the remote side or due to a read error.
 func (txl *TransactionLayer) OnConnectionClose(conn Connection) {
 	if txl.terminateOnConnClose {
 		txl.terminateClientTransactions(conn)
@@ -134,6 +197,10 @@ func (txl *TransactionLayer) handleMessage(msg Message) {
 	// Having concurency here we increased throghput but also solving deadlock
 	// Current client transactions are blocking on passUp and this may block when calling tx.Receive
 	// forking here can remove this
+	if txl.dispatcher != nil {
+		txl.dispatcher.dispatch(msg)
+		return
+	}
 
 	switch msg := msg.(type) {
 	case *Request:
@@ -145,6 +212,38 @@ func (txl *TransactionLayer) handleMessage(msg Message) {
 	}
 }
 
+// handleMessageDispatched is called by dispatcher worker
+func (txl *TransactionLayer) handleMessageDispatched(msg Message) {
+	switch msg := msg.(type) {
+	case *Request:
+		txl.handleRequestBackground(msg)
+	case *Response:
+		txl.handleResponseDispatched(msg)
+	default:
+		txl.log.Error("unsupported message, skip it")
+	}
+}
+
+// handleResponseDispatched passes response to client transaction without blocking worker,
+// so client transaction which responses are not consumed does not block other transactions
+func (txl *TransactionLayer) handleResponseDispatched(res *Response) {
+	key, err := ClientTxKeyMake(res)
+	if err != nil {
+		txl.log.Error("Client tx failed to handle response", "error", fmt.Errorf("make key failed: %w", err))
+		return
+	}
+
+	tx, exists := txl.getClientTx(key)
+	if !exists {
+		txl.unRespHandler(res)
+		return
+	}
+
+	if !tx.receiveQueued(res) {
+		txl.log.Debug("Client tx response queue is full, dropping response", "tx", key, "res", res.StartLine())
+	}
+}
+
 func (txl *TransactionLayer) handleRequestBackground(req *Request) {
 	if err := txl.handleRequest(req); err != nil {
 		txl.log.Error("Server tx failed to handle request", "error", err, "req", req.StartLine())
@@ -191,9 +290,42 @@ func (txl *TransactionLayer) handleRequest(req *Request) error {
 		return fmt.Errorf("make key failed: %w", err)
 	}
 
+	if txl.draining.Load() && txl.rejectDraining(req, key) {
+		return nil
+	}
+
 	return txl.serverTxRequest(req, key)
 }
 
+// rejectDraining sends stateless 503 for new request outside dialog during Shutdown.
+// Retransmissions of existing transactions, CANCEL and requests within dialog are processed.
+func (txl *TransactionLayer) rejectDraining(req *Request, key string) bool {
+	if req.IsAck() || req.IsCancel() {
+		// CANCEL has no To tag, but it only ends existing call
+		return false
+	}
+	if to := req.To(); to != nil && to.Params.Has("tag") {
+		return false
+	}
+	if _, exists := txl.getServerTx(key); exists {
+		return false
+	}
+
+	txl.respondServiceUnavailable(req, txl.drainRetryAfter)
+	return true
+}
+
+// respondServiceUnavailable sends stateless 503 response with Retry-After
+func (txl *TransactionLayer) respondServiceUnavailable(req *Request, retryAfter time.Duration) {
+	res := NewResponseFromRequest(req, StatusServiceUnavailable, "Service Unavailable", nil)
+	if retryAfter > 0 {
+		res.AppendHeader(NewHeader("Retry-After", strconv.Itoa(int(retryAfter.Seconds()))))
+	}
+	if err := txl.tpl.WriteMsg(res); err != nil {
+		txl.log.Error("Failed to send 503", "error", err, "req", req.StartLine())
+	}
+}
+
 // rejectMalformedRequest sends a stateless 400 Bad Request response when a
 // request is too malformed to create a transaction (e.g. missing CSeq or Via).
 //
@@ -248,6 +380,19 @@ func (txl *TransactionLayer) serverTxRequest(req *Request, key string) error {
 	txl.serverTransactions.unlock()
 
 	// pass request and transaction to handler
+	if d := txl.dispatcher; d != nil {
+		// Handlers are bounded, so flood of new transactions does not grow goroutines
+		if !d.acquireHandler(req) {
+			tx.Terminate()
+			return nil
+		}
+		// Handler can block until ACK or CANCEL is received, which is handled by same worker
+		go func() {
+			defer d.releaseHandler()
+			txl.reqHandler(req, tx)
+		}()
+		return nil
+	}
 	txl.reqHandler(req, tx)
 	return nil
 }
@@ -263,6 +408,7 @@ func (txl *TransactionLayer) serverTxCreate(req *Request, key string) (*ServerTx
 	}
 
 	tx := NewServerTx(key, req, conn, txl.log)
+	tx.timers = txl.addrTimers(req.Source())
 	if err := tx.Init(); err != nil {
 		// Init failed: this tx never reaches delete(), so release the connection
 		// reference serverRequestConnection took here (mirrors the conn.TryClose
@@ -343,6 +489,11 @@ func (txl *TransactionLayer) clientTxRequest(ctx context.Context, req *Request,
 		return nil, fmt.Errorf("client transaction %q already exists", key)
 	}
 	tx = NewClientTx(key, req, conn, txl.log)
+	addr := requestRTTAddr(req)
+	tx.timers = txl.requestTimers(req, addr)
+	tx.onRTT = func(rtt time.Duration) {
+		txl.rtt.update(addr, rtt)
+	}
 
 	txl.clientTransactions.items[key] = tx
 	tx.OnTerminate(txl.clientTxTerminate)
@@ -350,6 +501,55 @@ func (txl *TransactionLayer) clientTxRequest(ctx context.Context, req *Request,
 	return tx, nil
 }
 
+// Timers returns timers profile used for transactions
+func (txl *TransactionLayer) Timers() Timers {
+	if txl.timers != nil {
+		return *txl.timers
+	}
+	return DefaultTimers()
+}
+
+// requestTimers returns timers set on request with SetTimers or layer timers
+func (txl *TransactionLayer) requestTimers(req *Request, addr string) Timers {
+	if req.timers != nil {
+		return *req.timers
+	}
+	return txl.addrTimers(addr)
+}
+
+// addrTimers returns layer timers with T1 of remote address in case of adaptive T1
+func (txl *TransactionLayer) addrTimers(addr string) Timers {
+	timers := txl.Timers()
+	if !txl.adaptiveT1 {
+		return timers
+	}
+
+	e, exists := txl.rtt.get(addr)
+	if !exists {
+		return timers
+	}
+	t1 := min(max(e.RTO(), txl.minT1), txl.maxT1)
+	return timers.withT1(t1)
+}
+
+// RTTEstimate returns RTT estimate for remote address in host:port format
+func (txl *TransactionLayer) RTTEstimate(addr string) (RTTEstimate, bool) {
+	return txl.rtt.get(addr)
+}
+
+// RTTEstimates returns RTT estimates of all remote addresses. Useful for monitoring
+func (txl *TransactionLayer) RTTEstimates() map[string]RTTEstimate {
+	return txl.rtt.all()
+}
+
+// requestRTTAddr returns remote address of request, which is resolved by transport layer
+func requestRTTAddr(req *Request) string {
+	if req.raddr.IP != nil || req.raddr.Hostname != "" {
+		return req.raddr.String()
+	}
+	return req.Destination()
+}
+
 func (txl *TransactionLayer) Respond(res *Response) (*ServerTx, error) {
 	key, err := ServerTxKeyMake(res)
 	if err != nil {
@@ -401,9 +601,54 @@ func (txl *TransactionLayer) getServerTx(key string) (*ServerTx, bool) {
 	// return tx.(*ServerTx), true
 }
 
+// shutdownPollInterval is interval of checking transactions during Shutdown
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown gracefully stops transaction layer. New requests outside dialog are rejected with 503 and Retry-After,
+// while existing transactions and requests within dialog are still processed.
+// Shutdown waits until all transactions terminate. If ctx is done before, all transactions are terminated
+// and ctx error is returned.
+func (txl *TransactionLayer) Shutdown(ctx context.Context) error {
+	txl.draining.Store(true)
+	txl.log.Debug("transaction layer draining")
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if txl.clientTransactions.len() == 0 && txl.serverTransactions.len() == 0 {
+			txl.log.Debug("transaction layer drained")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			txl.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draining returns true once Shutdown is called
+func (txl *TransactionLayer) Draining() bool {
+	return txl.draining.Load()
+}
+
+// DispatcherStats returns dispatcher metrics like queue depth.
+// It returns false if dispatcher is not enabled with WithTransactionLayerDispatcher
+func (txl *TransactionLayer) DispatcherStats() (DispatcherStats, bool) {
+	if txl.dispatcher == nil {
+		return DispatcherStats{}, false
+	}
+	return txl.dispatcher.stats(), true
+}
+
 func (txl *TransactionLayer) Close() {
 	txl.clientTransactions.terminateAll()
 	txl.serverTransactions.terminateAll()
+	if txl.dispatcher != nil {
+		txl.dispatcher.stop()
+	}
 	txl.log.Debug("transaction layer closed")
 }
 
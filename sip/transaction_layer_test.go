@@ -179,3 +179,57 @@ func TestTransactionLayerClientTx(t *testing.T) {
 	require.Equal(t, 2, tp.udp.pool.Size())
 	assert.True(t, tp.udp.pool.Get("127.0.0.1:9876") != nil)
 }
+
+func TestTransactionLayerTimers(t *testing.T) {
+	// NOTE it creates real network connection
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	dst := l.LocalAddr().String()
+
+	timers := NewTimers(10*time.Millisecond, 40*time.Millisecond, 50*time.Millisecond)
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+	txl := NewTransactionLayer(tp, WithTransactionLayerTimers(timers))
+	defer txl.Close()
+	require.Equal(t, timers, txl.Timers())
+	require.Equal(t, 64*10*time.Millisecond, timers.TimerB)
+
+	waitTimeout := func(t *testing.T, tx *ClientTx) {
+		select {
+		case <-tx.Done():
+			require.ErrorIs(t, tx.Err(), ErrTransactionTimeout)
+		case <-time.After(5 * time.Second):
+			t.Fatal("transaction did not timeout")
+		}
+	}
+
+	t.Run("Layer", func(t *testing.T) {
+		req := testCreateRequest(t, "OPTIONS", "sip:"+dst, "UDP", "127.0.0.1:5060")
+		tx, err := txl.Request(context.TODO(), req)
+		require.NoError(t, err)
+		assert.Equal(t, timers, tx.timers)
+		waitTimeout(t, tx)
+	})
+
+	t.Run("Request", func(t *testing.T) {
+		req := testCreateRequest(t, "OPTIONS", "sip:"+dst, "UDP", "127.0.0.1:5060")
+		reqTimers := txl.Timers()
+		reqTimers.TimerB = 20 * time.Millisecond
+		req.SetTimers(reqTimers)
+
+		tx, err := txl.Request(context.TODO(), req)
+		require.NoError(t, err)
+		assert.Equal(t, 20*time.Millisecond, tx.timers.TimerB)
+		assert.Equal(t, timers.TimerA, tx.timers.TimerA)
+		waitTimeout(t, tx)
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+		defer tp.Close()
+		txl := NewTransactionLayer(tp)
+		defer txl.Close()
+		assert.Equal(t, DefaultTimers(), txl.Timers())
+	})
+}
@@ -0,0 +1,129 @@
+package sip
+
+import (
+	"sync"
+	"time"
+)
+
+// RTTEstimateExpiry is for how long estimate of remote address is kept without new samples
+var RTTEstimateExpiry = 10 * time.Minute
+
+// RTTEstimate is smoothed round trip time estimate of remote address.
+// It is calculated as in RFC 6298 from time between sending request and receiving first response
+type RTTEstimate struct {
+	// SRTT is smoothed round trip time
+	SRTT time.Duration
+	// RTTVar is round trip time variation
+	RTTVar time.Duration
+	// Samples is number of measured round trips
+	Samples uint64
+	// Updated is time of last sample
+	Updated time.Time
+}
+
+// RTO returns retransmission timeout SRTT + 4*RTTVar, which is used as T1 with adaptive T1
+func (e RTTEstimate) RTO() time.Duration {
+	return e.SRTT + 4*e.RTTVar
+}
+
+func (e *RTTEstimate) update(rtt time.Duration, now time.Time) {
+	if e.Samples == 0 {
+		e.SRTT = rtt
+		e.RTTVar = rtt / 2
+	} else {
+		// RTTVAR <- (1 - beta) * RTTVAR + beta * |SRTT - R'|, beta 1/4
+		// SRTT <- (1 - alpha) * SRTT + alpha * R', alpha 1/8
+		diff := e.SRTT - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		e.RTTVar = (3*e.RTTVar + diff) / 4
+		e.SRTT = (7*e.SRTT + rtt) / 8
+	}
+	e.Samples++
+	e.Updated = now
+}
+
+// rttEstimator keeps RTT estimates per remote address
+type rttEstimator struct {
+	mu        sync.Mutex
+	entries   map[string]*RTTEstimate
+	nextPurge time.Time
+}
+
+func newRTTEstimator() *rttEstimator {
+	return &rttEstimator{
+		entries: make(map[string]*RTTEstimate),
+	}
+}
+
+func (r *rttEstimator) update(addr string, rtt time.Duration) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, exists := r.entries[addr]
+	if !exists {
+		e = &RTTEstimate{}
+		r.entries[addr] = e
+	}
+	e.update(rtt, now)
+
+	// Remove estimates of addresses not used anymore
+	if now.After(r.nextPurge) {
+		for k, v := range r.entries {
+			if now.Sub(v.Updated) > RTTEstimateExpiry {
+				delete(r.entries, k)
+			}
+		}
+		r.nextPurge = now.Add(time.Minute)
+	}
+}
+
+func (r *rttEstimator) get(addr string) (RTTEstimate, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, exists := r.entries[addr]
+	if !exists || time.Since(e.Updated) > RTTEstimateExpiry {
+		return RTTEstimate{}, false
+	}
+	return *e, true
+}
+
+func (r *rttEstimator) all() map[string]RTTEstimate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make(map[string]RTTEstimate, len(r.entries))
+	for k, v := range r.entries {
+		if time.Since(v.Updated) > RTTEstimateExpiry {
+			continue
+		}
+		res[k] = *v
+	}
+	return res
+}
+
+// withT1 returns timers with T1 changed. Timers based on T1 are scaled by same ratio,
+// so custom timers keep their relation to T1
+func (t Timers) withT1(t1 time.Duration) Timers {
+	if t.T1 <= 0 || t1 == t.T1 {
+		return t
+	}
+
+	scale := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * float64(t1) / float64(t.T1))
+	}
+	t.TimerA = scale(t.TimerA)
+	t.TimerB = scale(t.TimerB)
+	t.TimerE = scale(t.TimerE)
+	t.TimerF = scale(t.TimerF)
+	t.TimerG = scale(t.TimerG)
+	t.TimerH = scale(t.TimerH)
+	t.TimerJ = scale(t.TimerJ)
+	t.TimerL = scale(t.TimerL)
+	t.TimerM = scale(t.TimerM)
+	t.T1 = t1
+	// Retransmission interval is capped with T2
+	t.T2 = max(t.T2, t1)
+	return t
+}
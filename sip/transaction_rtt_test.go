@@ -0,0 +1,120 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTTEstimate(t *testing.T) {
+	e := RTTEstimate{}
+	now := time.Now()
+	e.update(100*time.Millisecond, now)
+	assert.Equal(t, 100*time.Millisecond, e.SRTT)
+	assert.Equal(t, 50*time.Millisecond, e.RTTVar)
+	assert.Equal(t, 300*time.Millisecond, e.RTO())
+
+	e.update(200*time.Millisecond, now)
+	assert.Equal(t, 112500*time.Microsecond, e.SRTT)
+	assert.Equal(t, 62500*time.Microsecond, e.RTTVar)
+	assert.Equal(t, uint64(2), e.Samples)
+
+	t.Run("Expiry", func(t *testing.T) {
+		r := newRTTEstimator()
+		r.update("10.0.0.1:5060", 100*time.Millisecond)
+		_, exists := r.get("10.0.0.1:5060")
+		require.True(t, exists)
+
+		r.entries["10.0.0.1:5060"].Updated = time.Now().Add(-RTTEstimateExpiry - time.Second)
+		_, exists = r.get("10.0.0.1:5060")
+		require.False(t, exists)
+		require.Empty(t, r.all())
+	})
+}
+
+func TestTimersWithT1(t *testing.T) {
+	timers := NewTimers(500*time.Millisecond, 4*time.Second, 5*time.Second)
+	timers.TimerB = 10 * time.Second // custom
+
+	t1 := timers.withT1(50 * time.Millisecond)
+	assert.Equal(t, 50*time.Millisecond, t1.T1)
+	assert.Equal(t, 50*time.Millisecond, t1.TimerA)
+	assert.Equal(t, time.Second, t1.TimerB)
+	assert.Equal(t, 64*50*time.Millisecond, t1.TimerF)
+	assert.Equal(t, timers.T2, t1.T2)
+	assert.Equal(t, timers.TimerD, t1.TimerD)
+	assert.Equal(t, timers.TimerI, t1.TimerI)
+
+	// T2 can not be lower than T1
+	t1 = timers.withT1(5 * time.Second)
+	assert.Equal(t, 5*time.Second, t1.T2)
+}
+
+func TestTransactionLayerAdaptiveT1(t *testing.T) {
+	// NOTE it creates real network connection
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	dst := l.LocalAddr().String()
+
+	// Layers have own timers, so package timers changed by other tests are not read
+	timers := NewTimers(500*time.Millisecond, 4*time.Second, 5*time.Second)
+
+	serverTp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	t.Cleanup(func() { serverTp.Close() })
+	serverTxl := NewTransactionLayer(serverTp, WithTransactionLayerTimers(timers))
+	t.Cleanup(serverTxl.Close)
+	serverTxl.OnRequest(func(req *Request, tx *ServerTx) {
+		tx.Respond(NewResponseFromRequest(req, StatusOK, "OK", nil))
+	})
+	go serverTp.ServeUDP(l)
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	t.Cleanup(func() { tp.Close() })
+	txl := NewTransactionLayer(tp,
+		WithTransactionLayerTimers(timers),
+		WithTransactionLayerAdaptiveT1(100*time.Millisecond, 2*time.Second),
+	)
+	t.Cleanup(txl.Close)
+
+	request := func(req *Request) *ClientTx {
+		tx, err := txl.Request(context.TODO(), req)
+		require.NoError(t, err)
+		t.Cleanup(tx.Terminate)
+
+		select {
+		case res := <-tx.Responses():
+			require.Equal(t, StatusOK, res.StatusCode)
+		case <-time.After(2 * time.Second):
+			t.Fatal("response not received")
+		}
+		return tx
+	}
+	newRequest := func() *Request {
+		return testCreateRequest(t, "OPTIONS", "sip:"+dst, "UDP", "127.0.0.1")
+	}
+
+	// No estimate yet
+	tx := request(newRequest())
+	assert.Equal(t, 500*time.Millisecond, tx.timers.T1)
+
+	e, exists := txl.RTTEstimate(dst)
+	require.True(t, exists)
+	assert.Equal(t, uint64(1), e.Samples)
+	assert.Contains(t, txl.RTTEstimates(), dst)
+
+	// Local RTT is bellow lower bound
+	tx = request(newRequest())
+	assert.Equal(t, 100*time.Millisecond, tx.timers.T1)
+	assert.Equal(t, 64*100*time.Millisecond, tx.timers.TimerB)
+
+	// Per request timers are not adapted
+	req := newRequest()
+	req.SetTimers(NewTimers(time.Second, 4*time.Second, 5*time.Second))
+	tx = request(req)
+	assert.Equal(t, time.Second, tx.timers.T1)
+}
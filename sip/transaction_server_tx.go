@@ -11,6 +11,7 @@ type ServerTx struct {
 	acks chan *Request
 	// cancels chan *Request
 	onCancel     func(r *Request)
+	onResponse   func(res *Response)
 	timer_g      *time.Timer
 	timer_g_time time.Duration
 	timer_h      *time.Timer
@@ -39,13 +40,17 @@ func NewServerTx(key string, origin *Request, conn Connection, logger *slog.Logg
 }
 
 func (tx *ServerTx) Init() error {
+	if tx.timers == (Timers{}) {
+		// Timers profile is not set by transaction layer
+		tx.timers = DefaultTimers()
+	}
 	tx.initFSM()
 
 	tx.mu.Lock()
 	if !tx.reliable {
-		tx.timer_g_time = Timer_G
-		tx.timer_i_time = Timer_I
-		tx.timer_j_time = Timer_J
+		tx.timer_g_time = tx.timers.TimerG
+		tx.timer_i_time = tx.timers.TimerI
+		tx.timer_j_time = tx.timers.TimerJ
 	}
 	tx.mu.Unlock()
 
@@ -111,8 +116,13 @@ func (tx *ServerTx) Respond(res *Response) error {
 		tx.timer_1xx.Stop()
 		tx.timer_1xx = nil
 	}
+	onResponse := tx.onResponse
 	tx.mu.Unlock()
 
+	if onResponse != nil {
+		onResponse(res)
+	}
+
 	var input fsmInput
 	switch {
 	case res.IsProvisional():
@@ -202,6 +212,29 @@ func (tx *ServerTx) OnCancel(f FnTxCancel) bool {
 	return true
 }
 
+// OnResponse registers callback called with every response passed to Respond before it is sent.
+// Callback can modify response. It returns false in case transaction already terminated
+// NOTE: You must not block here.
+//
+// Experimental
+func (tx *ServerTx) OnResponse(f func(res *Response)) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return false
+	}
+	if tx.onResponse != nil {
+		prev := tx.onResponse
+		tx.onResponse = func(res *Response) {
+			prev(res)
+			f(res)
+		}
+		return true
+	}
+	tx.onResponse = f
+	return true
+}
+
 func (tx *ServerTx) registerOnCancel(f FnTxCancel) {
 	if tx.onCancel != nil {
 		prev := tx.onCancel
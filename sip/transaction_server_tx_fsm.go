@@ -190,8 +190,8 @@ func (tx *ServerTx) actRespondComplete() fsmInput {
 			})
 		} else {
 			tx.timer_g_time *= 2
-			if tx.timer_g_time > T2 {
-				tx.timer_g_time = T2
+			if tx.timer_g_time > tx.timers.T2 {
+				tx.timer_g_time = tx.timers.T2
 			}
 
 			tx.timer_g.Reset(tx.timer_g_time)
@@ -201,7 +201,7 @@ func (tx *ServerTx) actRespondComplete() fsmInput {
 
 	tx.mu.Lock()
 	if tx.timer_h == nil {
-		tx.timer_h = time.AfterFunc(Timer_H, func() {
+		tx.timer_h = time.AfterFunc(tx.timers.TimerH, func() {
 			tx.spinFsm(server_input_timer_h)
 		})
 	}
@@ -216,7 +216,7 @@ func (tx *ServerTx) actRespondAccept() fsmInput {
 	}
 
 	tx.mu.Lock()
-	tx.timer_l = time.AfterFunc(Timer_L, func() {
+	tx.timer_l = time.AfterFunc(tx.timers.TimerL, func() {
 		tx.spinFsm(server_input_timer_l)
 	})
 	tx.mu.Unlock()
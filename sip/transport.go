@@ -28,15 +28,31 @@ const (
 	DefaultWssPort int = 443
 )
 
-// Protocol implements network specific features.
-type transport interface {
+// Transport implements network specific features.
+// Custom transport can be added with TransportLayer.RegisterTransport.
+type Transport interface {
+	// Network returns network name like udp or tcp. It is used in Via and transport uri param
+	Network() string
 	// GetConnection returns connection from transport
 	// addr must be resolved to IP:port
 	GetConnection(addr string) Connection
+	// CreateConnection creates connection to raddr. Messages read on connection must be passed to handler
 	CreateConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error)
 	Close() error
 }
 
+// TransportServer is implemented by transport which accepts connections on listener.
+// It is used by TransportLayer.Serve
+type TransportServer interface {
+	Serve(l net.Listener, handler MessageHandler) error
+}
+
+// TransportConnectionNotifier is implemented by custom transport which notifies when connection
+// is closed by remote side or due to read error. See TransportLayer.OnConnectionClose
+type TransportConnectionNotifier interface {
+	OnConnectionClose(h func(conn Connection))
+}
+
 // TransportReadProps describes the transport read connection properties
 type TransportReadProps struct {
 	Transport  string
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/sync/singleflight"
 )
@@ -38,6 +39,10 @@ type connectionPool struct {
 	sync.RWMutex
 	m  map[string]Connection
 	sf singleflight.Group
+
+	// Metrics of connections closed by keep alive monitor
+	idleClosed atomic.Uint64
+	deadClosed atomic.Uint64
 }
 
 func newConnectionPool() *connectionPool {
@@ -190,6 +195,35 @@ func (p *connectionPool) Clear() error {
 	return werr
 }
 
+// flows returns flows from pool. Connection is stored under remote and local address,
+// so only entries not keyed by connection local address are flows
+func (p *connectionPool) flows() []Flow {
+	p.RLock()
+	defer p.RUnlock()
+
+	flows := make([]Flow, 0, len(p.m)/2)
+	for a, c := range p.m {
+		laddr := c.LocalAddr().String()
+		if a == laddr {
+			continue
+		}
+		flows = append(flows, Flow{LocalAddr: laddr, RemoteAddr: a})
+	}
+	return flows
+}
+
+// connections returns number of unique connections in pool
+func (p *connectionPool) connections() int {
+	p.RLock()
+	defer p.RUnlock()
+
+	conns := make(map[Connection]struct{}, len(p.m)/2)
+	for _, c := range p.m {
+		conns[c] = struct{}{}
+	}
+	return len(conns)
+}
+
 func (p *connectionPool) Size() int {
 	p.RLock()
 	l := len(p.m)
@@ -0,0 +1,350 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// DefaultDNSCacheTTL is TTL used when DNS backend does not return record TTL
+	DefaultDNSCacheTTL = 60 * time.Second
+	// DefaultDNSCacheNegativeTTL is TTL of not found results
+	DefaultDNSCacheNegativeTTL = 10 * time.Second
+	// DefaultDNSCacheMaxTTL caps record TTL
+	DefaultDNSCacheMaxTTL = time.Hour
+)
+
+// DNSTTLResolver is DNS backend which returns TTL of records.
+// DNSCache honors TTL of backend implementing this interface, otherwise DNSCache TTL is used.
+type DNSTTLResolver interface {
+	LookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error)
+	// LookupSRVTTL looks up SRV records of full name like _sip._udp.example.com
+	LookupSRVTTL(ctx context.Context, name string) ([]*net.SRV, time.Duration, error)
+}
+
+// DNSCacheStats are DNS cache metrics
+type DNSCacheStats struct {
+	// Hits is number of lookups answered from cache
+	Hits uint64
+	// NegativeHits is number of lookups answered with cached not found error
+	NegativeHits uint64
+	// StaticHits is number of lookups answered from static hosts
+	StaticHits uint64
+	// Misses is number of lookups passed to backend
+	Misses uint64
+	// Entries is number of cached results including negative
+	Entries int
+}
+
+type dnsCacheEntry struct {
+	ips     []net.IPAddr
+	srv     []*net.SRV
+	naptr   []*NAPTR
+	err     error
+	expires time.Time
+}
+
+// DNSCache is caching DNSResolver. Results are cached for record TTL and
+// not found results are cached for negative TTL. Concurrent lookups of same name are
+// done only once. Static hosts override DNS for domain, in which case NAPTR and SRV lookups are not done.
+//
+// It can be passed to transport layer as DNS resolver:
+//
+//	sipgo.NewUA(sipgo.WithUserAgentDNSResolver(sip.NewDNSCache(net.DefaultResolver)))
+type DNSCache struct {
+	backend     DNSResolver
+	ttl         time.Duration
+	maxTTL      time.Duration
+	negativeTTL time.Duration
+
+	mu        sync.RWMutex
+	hosts     map[string][]net.IPAddr
+	entries   map[string]dnsCacheEntry
+	nextPurge time.Time
+	group     singleflight.Group
+
+	hits         atomic.Uint64
+	negativeHits atomic.Uint64
+	staticHits   atomic.Uint64
+	misses       atomic.Uint64
+
+	// now can be changed for testing
+	now func() time.Time
+}
+
+type DNSCacheOption func(c *DNSCache)
+
+// WithDNSCacheTTL sets TTL for results of backend which does not return TTL
+// Default: DefaultDNSCacheTTL
+func WithDNSCacheTTL(ttl time.Duration) DNSCacheOption {
+	return func(c *DNSCache) {
+		c.ttl = ttl
+	}
+}
+
+// WithDNSCacheMaxTTL caps TTL returned by backend
+// Default: DefaultDNSCacheMaxTTL
+func WithDNSCacheMaxTTL(ttl time.Duration) DNSCacheOption {
+	return func(c *DNSCache) {
+		c.maxTTL = ttl
+	}
+}
+
+// WithDNSCacheNegativeTTL sets for how long not found result is cached. 0 disables negative caching
+// Default: DefaultDNSCacheNegativeTTL
+func WithDNSCacheNegativeTTL(ttl time.Duration) DNSCacheOption {
+	return func(c *DNSCache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithDNSCacheHosts sets static hosts, similar to /etc/hosts
+func WithDNSCacheHosts(hosts map[string][]net.IP) DNSCacheOption {
+	return func(c *DNSCache) {
+		for host, ips := range hosts {
+			c.setHost(host, ips)
+		}
+	}
+}
+
+// NewDNSCache creates caching resolver in front of backend
+func NewDNSCache(backend DNSResolver, opts ...DNSCacheOption) *DNSCache {
+	c := &DNSCache{
+		backend:     backend,
+		ttl:         DefaultDNSCacheTTL,
+		maxTTL:      DefaultDNSCacheMaxTTL,
+		negativeTTL: DefaultDNSCacheNegativeTTL,
+		hosts:       make(map[string][]net.IPAddr),
+		entries:     make(map[string]dnsCacheEntry),
+		now:         time.Now,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// SetHost adds static host override. Passing no ips removes override
+func (c *DNSCache) SetHost(host string, ips ...net.IP) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setHost(host, ips)
+}
+
+func (c *DNSCache) setHost(host string, ips []net.IP) {
+	host = dnsCacheName(host)
+	if len(ips) == 0 {
+		delete(c.hosts, host)
+		return
+	}
+
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	}
+	c.hosts[host] = addrs
+}
+
+// Flush removes all cached results. Static hosts are kept
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// Stats returns cache metrics
+func (c *DNSCache) Stats() DNSCacheStats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+
+	return DNSCacheStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		StaticHits:   c.staticHits.Load(),
+		Misses:       c.misses.Load(),
+		Entries:      entries,
+	}
+}
+
+func (c *DNSCache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	host = dnsCacheName(host)
+	if ips, exists := c.staticHost(host); exists {
+		c.staticHits.Add(1)
+		return ips, nil
+	}
+
+	e, err := c.lookup(ctx, "ip:"+host, func(ctx context.Context) (dnsCacheEntry, time.Duration, error) {
+		if r, ok := c.backend.(DNSTTLResolver); ok {
+			ips, ttl, err := r.LookupIPAddrTTL(ctx, host)
+			return dnsCacheEntry{ips: ips}, ttl, err
+		}
+		ips, err := c.backend.LookupIPAddr(ctx, host)
+		return dnsCacheEntry{ips: ips}, c.ttl, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]net.IPAddr(nil), e.ips...), nil
+}
+
+// LookupIP is same as LookupIPAddr with filtering IP version by network ip, ip4 or ip6
+func (c *DNSCache) LookupIP(ctx context.Context, network string, host string) ([]net.IP, error) {
+	addrs, err := c.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		switch {
+		case network == "ip4" && addr.IP.To4() == nil:
+		case network == "ip6" && addr.IP.To4() != nil:
+		default:
+			ips = append(ips, addr.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+func (c *DNSCache) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+	target = dnsCacheName(target)
+
+	if _, exists := c.staticHost(dnsCacheDomain(target)); exists {
+		return "", nil, &net.DNSError{Err: "no such host", Name: target, IsNotFound: true}
+	}
+
+	e, err := c.lookup(ctx, "srv:"+target, func(ctx context.Context) (dnsCacheEntry, time.Duration, error) {
+		if r, ok := c.backend.(DNSTTLResolver); ok {
+			srv, ttl, err := r.LookupSRVTTL(ctx, target)
+			return dnsCacheEntry{srv: srv}, ttl, err
+		}
+		_, srv, err := c.backend.LookupSRV(ctx, "", "", target)
+		return dnsCacheEntry{srv: srv}, c.ttl, err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return target, append([]*net.SRV(nil), e.srv...), nil
+}
+
+// LookupNAPTR looks up NAPTR if backend implements DNSNAPTRResolver.
+// As NAPTR TTL is not returned by backend, cache TTL is used
+func (c *DNSCache) LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	name = dnsCacheName(name)
+	r, ok := c.backend.(DNSNAPTRResolver)
+	if !ok {
+		return nil, &net.DNSError{Err: "NAPTR lookup not supported", Name: name, IsNotFound: true}
+	}
+	if _, exists := c.staticHost(name); exists {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	e, err := c.lookup(ctx, "naptr:"+name, func(ctx context.Context) (dnsCacheEntry, time.Duration, error) {
+		naptr, err := r.LookupNAPTR(ctx, name)
+		return dnsCacheEntry{naptr: naptr}, c.ttl, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]*NAPTR(nil), e.naptr...), nil
+}
+
+func (c *DNSCache) staticHost(host string) ([]net.IPAddr, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ips, exists := c.hosts[host]
+	if !exists {
+		return nil, false
+	}
+	return append([]net.IPAddr(nil), ips...), true
+}
+
+func (c *DNSCache) lookup(ctx context.Context, key string, fetch func(ctx context.Context) (dnsCacheEntry, time.Duration, error)) (dnsCacheEntry, error) {
+	c.mu.RLock()
+	e, exists := c.entries[key]
+	c.mu.RUnlock()
+	if exists && c.now().Before(e.expires) {
+		if e.err != nil {
+			c.negativeHits.Add(1)
+			return e, e.err
+		}
+		c.hits.Add(1)
+		return e, nil
+	}
+
+	c.misses.Add(1)
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		e, ttl, err := fetch(ctx)
+		if err != nil {
+			if c.negativeTTL <= 0 || !isDNSNotFound(err) {
+				// Temporary failures are not cached
+				return e, err
+			}
+			e.err = err
+			ttl = c.negativeTTL
+		}
+
+		// TTL 0 means record should not be cached
+		ttl = min(ttl, c.maxTTL)
+		if ttl > 0 {
+			c.store(key, e, ttl)
+		}
+		return e, err
+	})
+	return v.(dnsCacheEntry), err
+}
+
+func (c *DNSCache) store(key string, e dnsCacheEntry, ttl time.Duration) {
+	now := c.now()
+	e.expires = now.Add(ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = e
+
+	// Remove expired entries of names not looked up anymore
+	if now.After(c.nextPurge) {
+		for k, v := range c.entries {
+			if now.After(v.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextPurge = now.Add(time.Minute)
+	}
+}
+
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+func dnsCacheName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// dnsCacheDomain strips service labels like _sip._udp from SRV name
+func dnsCacheDomain(name string) string {
+	for strings.HasPrefix(name, "_") {
+		_, rest, found := strings.Cut(name, ".")
+		if !found {
+			break
+		}
+		name = rest
+	}
+	return name
+}
@@ -0,0 +1,124 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSCache(t *testing.T) {
+	ctx := context.Background()
+	newBackend := func() *fakeDNSResolver {
+		return &fakeDNSResolver{
+			hosts: map[string][]net.IP{
+				"sip.example.com": {net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")},
+			},
+			srv: map[string][]*net.SRV{
+				"_sip._udp.example.com": {{Target: "sip.example.com.", Port: 5060}},
+			},
+			ttl: 30 * time.Second,
+		}
+	}
+
+	t.Run("TTL", func(t *testing.T) {
+		backend := newBackend()
+		cache := NewDNSCache(backend)
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		for range 3 {
+			ips, err := cache.LookupIPAddr(ctx, "SIP.example.com.")
+			require.NoError(t, err)
+			require.Len(t, ips, 2)
+			_, srv, err := cache.LookupSRV(ctx, "sip", "udp", "example.com")
+			require.NoError(t, err)
+			require.Len(t, srv, 1)
+		}
+		assert.Equal(t, int32(2), backend.lookups.Load())
+		assert.Equal(t, DNSCacheStats{Hits: 4, Misses: 2, Entries: 2}, cache.Stats())
+
+		// Record TTL expired
+		now = now.Add(31 * time.Second)
+		_, err := cache.LookupIPAddr(ctx, "sip.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), backend.lookups.Load())
+
+		ips, err := cache.LookupIP(ctx, "ip6", "sip.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, []net.IP{net.ParseIP("2001:db8::1")}, ips)
+		assert.Equal(t, int32(3), backend.lookups.Load())
+
+		// TTL 0 is not cached
+		backend.ttl = 0
+		cache.Flush()
+		cache.LookupIPAddr(ctx, "sip.example.com")
+		cache.LookupIPAddr(ctx, "sip.example.com")
+		assert.Equal(t, int32(5), backend.lookups.Load())
+		assert.Equal(t, 0, cache.Stats().Entries)
+	})
+
+	t.Run("DefaultTTL", func(t *testing.T) {
+		backend := newBackend()
+		// Hide TTL lookups like with net.Resolver
+		cache := NewDNSCache(&struct{ DNSResolver }{backend}, WithDNSCacheTTL(10*time.Second))
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		cache.LookupIPAddr(ctx, "sip.example.com")
+		now = now.Add(5 * time.Second)
+		cache.LookupIPAddr(ctx, "sip.example.com")
+		assert.Equal(t, int32(1), backend.lookups.Load())
+
+		now = now.Add(6 * time.Second)
+		cache.LookupIPAddr(ctx, "sip.example.com")
+		assert.Equal(t, int32(2), backend.lookups.Load())
+
+		// Backend does not support NAPTR
+		_, err := cache.LookupNAPTR(ctx, "example.com")
+		require.True(t, isDNSNotFound(err))
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		backend := newBackend()
+		cache := NewDNSCache(backend, WithDNSCacheNegativeTTL(5*time.Second))
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		_, err := cache.LookupIPAddr(ctx, "unknown.example.com")
+		require.True(t, isDNSNotFound(err))
+		_, err = cache.LookupIPAddr(ctx, "unknown.example.com")
+		require.True(t, isDNSNotFound(err))
+		assert.Equal(t, int32(1), backend.lookups.Load())
+		assert.Equal(t, uint64(1), cache.Stats().NegativeHits)
+
+		now = now.Add(6 * time.Second)
+		backend.hosts["unknown.example.com"] = []net.IP{net.ParseIP("10.0.0.2")}
+		ips, err := cache.LookupIPAddr(ctx, "unknown.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.2", ips[0].IP.String())
+	})
+
+	t.Run("StaticHosts", func(t *testing.T) {
+		backend := newBackend()
+		cache := NewDNSCache(backend, WithDNSCacheHosts(map[string][]net.IP{
+			"example.com": {net.ParseIP("10.0.0.9")},
+		}))
+
+		// Static host skips SRV so server is located by A lookup
+		r := NewServerResolver(cache)
+		targets, err := r.Resolve(ctx, Uri{Scheme: "sip", Host: "example.com"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"udp:10.0.0.9:5060"}, targetStrings(targets))
+		assert.Equal(t, int32(0), backend.lookups.Load())
+		assert.Equal(t, uint64(1), cache.Stats().StaticHits)
+
+		cache.SetHost("example.com")
+		targets, err = r.Resolve(ctx, Uri{Scheme: "sip", Host: "example.com"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "udp:10.0.0.1:5060", targets[0].String())
+	})
+}
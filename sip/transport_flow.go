@@ -0,0 +1,260 @@
+package sip
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTransportFlowFailed is returned when flow connection does not exist anymore or keep alive failed.
+	// Proxy should respond with 430 Flow Failed
+	// https://datatracker.ietf.org/doc/html/rfc5626#section-5.3
+	ErrTransportFlowFailed = errors.New("flow failed")
+	// ErrTransportFlowTokenInvalid is returned when flow token is not created by this transport layer
+	ErrTransportFlowTokenInvalid = errors.New("invalid flow token")
+)
+
+// flowTokenMACSize is truncated HMAC size, same as HMAC-SHA1-80 in RFC example
+const flowTokenMACSize = 10
+
+// Flow is RFC 5626 flow. It is transport association between UA and edge proxy
+// identified by transport, remote address and local address of connection.
+// LocalAddr can be empty in which case any connection to remote address matches flow.
+// https://datatracker.ietf.org/doc/html/rfc5626#section-3.1
+type Flow struct {
+	Transport  string
+	LocalAddr  string
+	RemoteAddr string
+}
+
+func (f Flow) String() string {
+	return NetworkToLower(f.Transport) + ":" + f.LocalAddr + "->" + f.RemoteAddr
+}
+
+// keepAliveConnection is connection that supports RFC 5626 keep alives
+type keepAliveConnection interface {
+	// keepAlive sends ping to raddr and waits for pong.
+	// Timers T1 and T2 are used for retransmission over unreliable transport
+	keepAlive(ctx context.Context, raddr string, timers Timers) error
+}
+
+// stunKeepAlive implements STUN binding keep alive for UDP connection.
+// As UDP connection is shared, pending requests are matched by STUN transaction ID.
+// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4.2
+type stunKeepAlive struct {
+	stunMu  sync.Mutex
+	pending map[stunTxID]chan netip.AddrPort
+	// mapped keeps last reflexive address per remote address to detect NAT rebinding
+	mapped map[string]netip.AddrPort
+}
+
+func (k *stunKeepAlive) stunResponse(id stunTxID, mapped netip.AddrPort) {
+	k.stunMu.Lock()
+	ch, exists := k.pending[id]
+	delete(k.pending, id)
+	k.stunMu.Unlock()
+	if exists {
+		ch <- mapped
+	}
+}
+
+func (k *stunKeepAlive) ping(ctx context.Context, raddr string, timers Timers, writeTo func(b []byte, addr net.Addr) (int, error)) error {
+	addr, err := net.ResolveUDPAddr("udp", raddr)
+	if err != nil {
+		return err
+	}
+
+	id := newStunTxID()
+	ch := make(chan netip.AddrPort, 1)
+	k.stunMu.Lock()
+	if k.pending == nil {
+		k.pending = make(map[stunTxID]chan netip.AddrPort)
+		k.mapped = make(map[string]netip.AddrPort)
+	}
+	k.pending[id] = ch
+	k.stunMu.Unlock()
+	defer func() {
+		k.stunMu.Lock()
+		delete(k.pending, id)
+		k.stunMu.Unlock()
+	}()
+
+	req := stunMessage(stunBindingRequest, id, nil)
+	// Retransmit like STUN over UDP with doubling RTO
+	rto := timers.T1
+	for {
+		if _, err := writeTo(req, addr); err != nil {
+			return fmt.Errorf("%w: %w", ErrTransportFlowFailed, err)
+		}
+
+		select {
+		case mapped := <-ch:
+			k.stunMu.Lock()
+			prev, exists := k.mapped[raddr]
+			k.mapped[raddr] = mapped
+			k.stunMu.Unlock()
+			// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4.2
+			// If the reflexive address changed, flow must be considered failed
+			if exists && prev != mapped {
+				return fmt.Errorf("%w: NAT binding changed from %s to %s", ErrTransportFlowFailed, prev, mapped)
+			}
+			return nil
+		case <-time.After(rto):
+			rto = min(2*rto, timers.T2)
+		case <-ctx.Done():
+			return fmt.Errorf("%w: STUN response not received: %w", ErrTransportFlowFailed, ctx.Err())
+		}
+	}
+}
+
+// transportPool returns connection pool of transport
+func (l *TransportLayer) transportPool(network string) *connectionPool {
+	switch network {
+	case "udp":
+		return l.udp.pool
+	case "tcp":
+		return l.tcp.pool
+	case "tls":
+		return l.tls.pool
+	case "ws":
+		return l.ws.pool
+	case "wss":
+		return l.wss.pool
+	}
+	return nil
+}
+
+// MessageFlow returns flow on which message is received.
+// Edge proxy should use this on REGISTER to build flow token.
+func (l *TransportLayer) MessageFlow(msg Message) Flow {
+	network := NetworkToLower(msg.Transport())
+	f := Flow{
+		Transport:  network,
+		RemoteAddr: msg.Source(),
+	}
+	if pool := l.transportPool(network); pool != nil {
+		if c := pool.getUnref(f.RemoteAddr); c != nil {
+			f.LocalAddr = c.LocalAddr().String()
+		}
+	}
+	return f
+}
+
+// Flows returns all flows for network currently in connection pool
+func (l *TransportLayer) Flows(network string) []Flow {
+	network = NetworkToLower(network)
+	pool := l.transportPool(network)
+	if pool == nil {
+		return nil
+	}
+
+	flows := pool.flows()
+	for i := range flows {
+		flows[i].Transport = network
+	}
+	return flows
+}
+
+// FlowConnection returns connection of flow. It never creates new connection,
+// instead it returns ErrTransportFlowFailed if flow does not exist anymore.
+// Connection reference is increased so make sure you call TryClose after finish
+func (l *TransportLayer) FlowConnection(f Flow) (Connection, error) {
+	network := NetworkToLower(f.Transport)
+	transport := l.getTransport(network)
+	if transport == nil {
+		return nil, fmt.Errorf("transport %s is not supported", network)
+	}
+
+	c := transport.GetConnection(f.RemoteAddr)
+	if c == nil {
+		return nil, fmt.Errorf("%w: no connection for %s", ErrTransportFlowFailed, f)
+	}
+
+	if f.LocalAddr != "" && c.LocalAddr().String() != f.LocalAddr {
+		// Connection to same remote exists but it is not one flow was created with
+		c.TryClose()
+		return nil, fmt.Errorf("%w: connection changed for %s", ErrTransportFlowFailed, f)
+	}
+	return c, nil
+}
+
+// timers returns timers profile of transaction layer using this transport layer or package timers
+func (l *TransportLayer) timers() Timers {
+	if l.timersProfile != nil {
+		return l.timersProfile()
+	}
+	return DefaultTimers()
+}
+
+// FlowKeepAlive sends single keep alive over flow and waits for response until ctx is done.
+// Reliable transports use double CRLF ping and single CRLF pong, and UDP uses STUN binding request.
+// Error wraps ErrTransportFlowFailed in case pong is not received, in which case UA should register again.
+// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4
+func (l *TransportLayer) FlowKeepAlive(ctx context.Context, f Flow) error {
+	c, err := l.FlowConnection(f)
+	if err != nil {
+		return err
+	}
+	defer c.TryClose()
+
+	ka, ok := c.(keepAliveConnection)
+	if !ok {
+		return fmt.Errorf("connection of %s does not support keep alive", f)
+	}
+
+	err = ka.keepAlive(ctx, f.RemoteAddr, l.timers())
+	if err != nil && IsReliable(f.Transport) {
+		// Peer is dead. Closing connection removes it from pool and
+		// makes sure that new registration does not reuse it
+		c.Close()
+	}
+	return err
+}
+
+// FlowToken creates flow token which edge proxy can place in user part of Path or Record-Route URI.
+// Token is signed so only this transport layer, or one with same key, can parse it.
+// https://datatracker.ietf.org/doc/html/rfc5626#section-5.2
+func (l *TransportLayer) FlowToken(f Flow) string {
+	payload := NetworkToLower(f.Transport) + "|" + f.LocalAddr + "|" + f.RemoteAddr
+	mac := hmac.New(sha256.New, l.flowKey)
+	mac.Write([]byte(payload))
+	token := append(mac.Sum(nil)[:flowTokenMACSize], payload...)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// ParseFlowToken returns flow from token created with FlowToken
+func (l *TransportLayer) ParseFlowToken(token string) (Flow, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) <= flowTokenMACSize {
+		return Flow{}, ErrTransportFlowTokenInvalid
+	}
+
+	sum, payload := data[:flowTokenMACSize], data[flowTokenMACSize:]
+	mac := hmac.New(sha256.New, l.flowKey)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)[:flowTokenMACSize]) {
+		return Flow{}, ErrTransportFlowTokenInvalid
+	}
+
+	parts := strings.SplitN(string(payload), "|", 3)
+	if len(parts) != 3 {
+		return Flow{}, ErrTransportFlowTokenInvalid
+	}
+	return Flow{Transport: parts[0], LocalAddr: parts[1], RemoteAddr: parts[2]}, nil
+}
+
+func newFlowTokenKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
@@ -0,0 +1,192 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowToken(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	f := Flow{Transport: "TCP", LocalAddr: "127.0.0.1:5060", RemoteAddr: "10.0.0.1:34567"}
+
+	token := tp.FlowToken(f)
+	flow, err := tp.ParseFlowToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, Flow{Transport: "tcp", LocalAddr: "127.0.0.1:5060", RemoteAddr: "10.0.0.1:34567"}, flow)
+
+	// Token must be valid in URI user part
+	uri := Uri{User: token, Host: "edge.sipgo.com"}
+	var parsed Uri
+	require.NoError(t, ParseUri(uri.String(), &parsed))
+	assert.Equal(t, token, parsed.User)
+
+	t.Run("Tampered", func(t *testing.T) {
+		data := []byte(token)
+		data[len(data)-1] ^= 1
+		_, err := tp.ParseFlowToken(string(data))
+		require.ErrorIs(t, err, ErrTransportFlowTokenInvalid)
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		other := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+		_, err := other.ParseFlowToken(token)
+		require.ErrorIs(t, err, ErrTransportFlowTokenInvalid)
+
+		shared := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerFlowTokenKey([]byte("edge")))
+		shared2 := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerFlowTokenKey([]byte("edge")))
+		flow, err := shared2.ParseFlowToken(shared.FlowToken(f))
+		require.NoError(t, err)
+		assert.Equal(t, f.RemoteAddr, flow.RemoteAddr)
+	})
+}
+
+func TestTransportLayerFlowTCP(t *testing.T) {
+	// NOTE it creates real network connection
+	server := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer server.Close()
+	client := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer client.Close()
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go server.ServeTCP(l)
+
+	serverAddr := l.Addr().(*net.TCPAddr)
+	req := NewRequest(OPTIONS, Uri{Host: "127.0.0.1", Port: serverAddr.Port})
+	req.AppendHeader(&ViaHeader{Host: "127.0.0.1", Port: 0})
+	req.SetTransport("TCP")
+	conn, err := client.ClientRequestConnection(context.TODO(), req)
+	require.NoError(t, err)
+
+	flows := client.Flows("TCP")
+	require.Len(t, flows, 1)
+	assert.Equal(t, Flow{Transport: "tcp", LocalAddr: conn.LocalAddr().String(), RemoteAddr: serverAddr.String()}, flows[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, client.FlowKeepAlive(ctx, flows[0]))
+
+	// Edge proxy sees client flow and can ping it
+	require.Eventually(t, func() bool { return len(server.Flows("tcp")) == 1 }, 2*time.Second, 10*time.Millisecond)
+	serverFlow := server.Flows("tcp")[0]
+	assert.Equal(t, conn.LocalAddr().String(), serverFlow.RemoteAddr)
+	require.NoError(t, server.FlowKeepAlive(ctx, serverFlow))
+
+	t.Run("SetFlow", func(t *testing.T) {
+		req := NewRequest(OPTIONS, Uri{Host: "client.sipgo.com"})
+		req.AppendHeader(&ViaHeader{Host: "127.0.0.1", Port: 0})
+		req.SetFlow(serverFlow)
+		assert.Equal(t, "TCP", req.Transport())
+		assert.Equal(t, serverFlow.RemoteAddr, req.Destination())
+
+		c, err := server.ClientRequestConnection(context.TODO(), req)
+		require.NoError(t, err)
+		defer c.TryClose()
+		assert.Equal(t, serverFlow.LocalAddr, c.LocalAddr().String())
+	})
+
+	t.Run("FlowFailed", func(t *testing.T) {
+		req := NewRequest(OPTIONS, Uri{Host: "client.sipgo.com"})
+		req.AppendHeader(&ViaHeader{Host: "127.0.0.1", Port: 0})
+		req.SetFlow(Flow{Transport: "tcp", RemoteAddr: "127.0.0.1:1"})
+		_, err := server.ClientRequestConnection(context.TODO(), req)
+		require.ErrorIs(t, err, ErrTransportFlowFailed)
+
+		changed := serverFlow
+		changed.LocalAddr = "127.0.0.1:1"
+		_, err = server.FlowConnection(changed)
+		require.ErrorIs(t, err, ErrTransportFlowFailed)
+	})
+}
+
+func TestTransportLayerFlowUDP(t *testing.T) {
+	// NOTE it creates real network connection
+	server := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer server.Close()
+	client := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer client.Close()
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer serverConn.Close()
+	go server.ServeUDP(serverConn)
+
+	req := NewRequest(OPTIONS, Uri{Host: "127.0.0.1", Port: serverConn.LocalAddr().(*net.UDPAddr).Port})
+	req.AppendHeader(&ViaHeader{Host: "127.0.0.1", Port: 0})
+	conn, err := client.ClientRequestConnection(context.TODO(), req)
+	require.NoError(t, err)
+	defer conn.TryClose()
+
+	flows := client.Flows("udp")
+	require.Len(t, flows, 1)
+	assert.Equal(t, serverConn.LocalAddr().String(), flows[0].RemoteAddr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, client.FlowKeepAlive(ctx, flows[0]))
+	// Binding is same
+	require.NoError(t, client.FlowKeepAlive(ctx, flows[0]))
+}
+
+func TestStunKeepAliveNATRebinding(t *testing.T) {
+	k := &stunKeepAlive{}
+	mapped := netip.MustParseAddrPort("[2001:db8::1]:5060")
+	writeTo := func(b []byte, addr net.Addr) (int, error) {
+		require.True(t, isStunMessage(b))
+		typ, id, _ := parseStunMessage(b)
+		require.Equal(t, uint16(stunBindingRequest), typ)
+
+		// Loop through encoding as real response
+		res := stunBindingSuccess(id, net.UDPAddrFromAddrPort(mapped))
+		_, resID, attrs := parseStunMessage(res)
+		addrPort, ok := stunMappedAddress(attrs, resID)
+		require.True(t, ok)
+		go k.stunResponse(resID, addrPort)
+		return len(b), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, k.ping(ctx, "127.0.0.1:5060", DefaultTimers(), writeTo))
+	assert.Equal(t, mapped, k.mapped["127.0.0.1:5060"])
+
+	mapped = netip.MustParseAddrPort("[2001:db8::2]:5060")
+	require.ErrorIs(t, k.ping(ctx, "127.0.0.1:5060", DefaultTimers(), writeTo), ErrTransportFlowFailed)
+}
+
+func TestStunKeepAliveTimers(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+	timers := NewTimers(10*time.Millisecond, 20*time.Millisecond, 50*time.Millisecond)
+	txl := NewTransactionLayer(tp, WithTransactionLayerTimers(timers))
+	defer txl.Close()
+	// Flow keep alive uses timers profile of transaction layer
+	require.Equal(t, timers, tp.timers())
+
+	// Ping is retransmitted with T1 doubling up to T2 until ctx is done
+	var mu sync.Mutex
+	var sent []time.Time
+	writeTo := func(b []byte, addr net.Addr) (int, error) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		return len(b), nil
+	}
+	k := &stunKeepAlive{}
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, k.ping(ctx, "127.0.0.1:5060", tp.timers(), writeTo), ErrTransportFlowFailed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 0, 10, 30, 50, 70... ms. With package T1 only single ping would be sent
+	assert.GreaterOrEqual(t, len(sent), 4)
+}
@@ -0,0 +1,222 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var crlfPing = []byte("\r\n\r\n")
+
+// ConnectionKeepAlive configures idle timeout and liveness probing of reliable transport connections
+type ConnectionKeepAlive struct {
+	// IdleTimeout closes connection when no SIP message is sent or received for this duration.
+	// 0 disables idle timeout
+	IdleTimeout time.Duration
+	// PingInterval sends double CRLF ping when connection is idle for this duration.
+	// 0 disables pings
+	PingInterval time.Duration
+	// PongTimeout is time to wait for pong before peer is considered dead and connection is closed.
+	// Default is 10s
+	PongTimeout time.Duration
+}
+
+func (ka ConnectionKeepAlive) enabled() bool {
+	return ka.IdleTimeout > 0 || ka.PingInterval > 0
+}
+
+func (ka ConnectionKeepAlive) pongTimeout() time.Duration {
+	if ka.PongTimeout > 0 {
+		return ka.PongTimeout
+	}
+	// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4.1
+	return 10 * time.Second
+}
+
+// ConnectionPoolStats are connection pool metrics of transport
+type ConnectionPoolStats struct {
+	Transport string
+	// Connections is number of connections in pool
+	Connections int
+	// IdleClosed is number of connections closed due to idle timeout
+	IdleClosed uint64
+	// DeadClosed is number of connections closed as peer did not respond to ping
+	DeadClosed uint64
+}
+
+// crlfKeepAlive implements double CRLF ping and single CRLF pong for stream connections
+// and tracks connection activity for idle timeout
+// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4.1
+type crlfKeepAlive struct {
+	pongMu sync.Mutex
+	pong   chan struct{}
+	// activity is unix nano time of last SIP message sent or received
+	activity atomic.Int64
+}
+
+func (k *crlfKeepAlive) touch() {
+	k.activity.Store(time.Now().UnixNano())
+}
+
+func (k *crlfKeepAlive) pongChan() chan struct{} {
+	k.pongMu.Lock()
+	defer k.pongMu.Unlock()
+	if k.pong == nil {
+		k.pong = make(chan struct{}, 1)
+	}
+	return k.pong
+}
+
+func (k *crlfKeepAlive) pongReceived() {
+	select {
+	case k.pongChan() <- struct{}{}:
+	default:
+	}
+}
+
+// readCRLF handles CRLF read between messages. Every double CRLF is ping which is answered with pong
+// and single CRLF is pong for our ping
+func (k *crlfKeepAlive) readCRLF(crlf int, w io.Writer) error {
+	for ; crlf >= 2; crlf -= 2 {
+		if _, err := w.Write(crlfPing[:2]); err != nil {
+			return err
+		}
+	}
+	if crlf == 1 {
+		k.pongReceived()
+	}
+	return nil
+}
+
+func (k *crlfKeepAlive) ping(ctx context.Context, w io.Writer) error {
+	pong := k.pongChan()
+	// Drain late pong from previous ping
+	select {
+	case <-pong:
+	default:
+	}
+
+	if _, err := w.Write(crlfPing); err != nil {
+		return fmt.Errorf("%w: %w", ErrTransportFlowFailed, err)
+	}
+
+	select {
+	case <-pong:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: pong not received: %w", ErrTransportFlowFailed, ctx.Err())
+	}
+}
+
+// monitor pings idle connection and closes it on idle timeout or when peer does not respond.
+// Closing connection stops read loop, which removes connection from pool and fires connection close handler.
+// It runs until done is closed
+func (k *crlfKeepAlive) monitor(conf ConnectionKeepAlive, conn Connection, pool *connectionPool, log *slog.Logger, done <-chan struct{}) {
+	ka, ok := conn.(keepAliveConnection)
+	if !ok {
+		return
+	}
+
+	lastPing := time.Now()
+	for {
+		now := time.Now()
+		last := time.Unix(0, k.activity.Load())
+		wait := time.Duration(1<<63 - 1)
+
+		if conf.IdleTimeout > 0 {
+			idle := now.Sub(last)
+			if idle >= conf.IdleTimeout {
+				log.Debug("Closing idle connection", "laddr", conn.LocalAddr().String(), "idle", idle)
+				pool.idleClosed.Add(1)
+				conn.Close()
+				return
+			}
+			wait = conf.IdleTimeout - idle
+		}
+
+		if conf.PingInterval > 0 {
+			if lastPing.After(last) {
+				last = lastPing
+			}
+			since := now.Sub(last)
+			if since >= conf.PingInterval {
+				ctx, cancel := context.WithTimeout(context.Background(), conf.pongTimeout())
+				// Ping over reliable connection is not retransmitted, so timers are not needed
+				err := ka.keepAlive(ctx, "", Timers{})
+				cancel()
+				if err != nil {
+					select {
+					case <-done:
+						// Connection closed meanwhile
+						return
+					default:
+					}
+					log.Info("Peer not responding to ping, closing connection", "laddr", conn.LocalAddr().String(), "error", err)
+					pool.deadClosed.Add(1)
+					conn.Close()
+					return
+				}
+				lastPing = time.Now()
+				continue
+			}
+			wait = min(wait, conf.PingInterval-since)
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// WithTransportLayerConnectionKeepAlive configures idle timeout and CRLF pings
+// for connections of reliable transport network (tcp, tls, ws, wss).
+func WithTransportLayerConnectionKeepAlive(network string, ka ConnectionKeepAlive) TransportLayerOption {
+	return func(l *TransportLayer) {
+		if l.connKeepAlive == nil {
+			l.connKeepAlive = make(map[string]ConnectionKeepAlive)
+		}
+		l.connKeepAlive[NetworkToLower(network)] = ka
+	}
+}
+
+func (l *TransportLayer) withConnectionKeepAlive() {
+	for network, ka := range l.connKeepAlive {
+		switch network {
+		case "tcp":
+			l.tcp.keepAlive = ka
+		case "tls":
+			l.tls.keepAlive = ka
+		case "ws":
+			l.ws.keepAlive = ka
+		case "wss":
+			l.wss.keepAlive = ka
+		default:
+			l.log.Warn("Connection keep alive is not supported for network", "network", network)
+		}
+	}
+}
+
+// ConnectionPoolStats returns connection pool metrics of every transport
+func (l *TransportLayer) ConnectionPoolStats() []ConnectionPoolStats {
+	networks := []string{"udp", "tcp", "tls", "ws", "wss"}
+	stats := make([]ConnectionPoolStats, 0, len(networks))
+	for _, network := range networks {
+		pool := l.transportPool(network)
+		if pool == nil {
+			continue
+		}
+		stats = append(stats, ConnectionPoolStats{
+			Transport:   network,
+			Connections: pool.connections(),
+			IdleClosed:  pool.idleClosed.Load(),
+			DeadClosed:  pool.deadClosed.Load(),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,117 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTCPKeepAliveConn(t *testing.T, ka ConnectionKeepAlive, handler MessageHandler) (*TransportTCP, net.Conn, chan struct{}) {
+	tcp := &TransportTCP{keepAlive: ka}
+	tcp.init(NewParser())
+
+	closed := make(chan struct{})
+	tcp.onConnClose = func(conn Connection) {
+		close(closed)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	conn := &TCPConnection{
+		Conn:     serverConn,
+		refcount: 1,
+	}
+	tcp.pool.Add("client", conn)
+	go tcp.readConnection(conn, "server", "client", handler)
+	return tcp, clientConn, closed
+}
+
+func TestTransportTCPKeepAlive(t *testing.T) {
+	t.Run("InboundPing", func(t *testing.T) {
+		msgs := make(chan Message, 1)
+		_, client, _ := testTCPKeepAliveConn(t, ConnectionKeepAlive{}, func(msg Message) {
+			msgs <- msg
+		})
+
+		go client.Write(append(testRawOptions("ping"), crlfPing...))
+		buf := make([]byte, 10)
+		n, err := client.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "\r\n", string(buf[:n]))
+		assert.Equal(t, "ping", (<-msgs).CallID().Value())
+	})
+
+	t.Run("Pong", func(t *testing.T) {
+		tcp, client, closed := testTCPKeepAliveConn(t, ConnectionKeepAlive{
+			PingInterval: 20 * time.Millisecond,
+			PongTimeout:  200 * time.Millisecond,
+		}, nil)
+
+		// Answer few pings and then stop
+		buf := make([]byte, 10)
+		for range 3 {
+			n, err := client.Read(buf)
+			require.NoError(t, err)
+			require.Equal(t, "\r\n\r\n", string(buf[:n]))
+			_, err = client.Write(crlfPing[:2])
+			require.NoError(t, err)
+		}
+
+		go func() {
+			for {
+				if _, err := client.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected dead peer connection to be closed")
+		}
+		assert.Equal(t, uint64(1), tcp.pool.deadClosed.Load())
+		assert.Equal(t, 0, tcp.pool.connections())
+	})
+
+	t.Run("IdleTimeout", func(t *testing.T) {
+		tcp, _, closed := testTCPKeepAliveConn(t, ConnectionKeepAlive{
+			IdleTimeout: 50 * time.Millisecond,
+		}, nil)
+
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected idle connection to be closed")
+		}
+		assert.Equal(t, uint64(1), tcp.pool.idleClosed.Load())
+	})
+}
+
+func TestTransportLayerConnectionPoolStats(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerConnectionKeepAlive("TCP", ConnectionKeepAlive{
+		IdleTimeout: time.Minute,
+	}))
+	defer tp.Close()
+	assert.Equal(t, time.Minute, tp.tcp.keepAlive.IdleTimeout)
+	assert.False(t, tp.tls.keepAlive.enabled())
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer serverConn.Close()
+
+	req := NewRequest(OPTIONS, Uri{Host: "127.0.0.1", Port: serverConn.LocalAddr().(*net.UDPAddr).Port})
+	req.AppendHeader(&ViaHeader{Host: "127.0.0.1", Port: 0})
+	conn, err := tp.ClientRequestConnection(context.TODO(), req)
+	require.NoError(t, err)
+	defer conn.TryClose()
+
+	stats := tp.ConnectionPoolStats()
+	require.Len(t, stats, 5)
+	assert.Equal(t, ConnectionPoolStats{Transport: "udp", Connections: 1}, stats[0])
+	assert.Equal(t, ConnectionPoolStats{Transport: "tcp"}, stats[1])
+}
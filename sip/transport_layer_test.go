@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -325,6 +326,15 @@ func TestTransportLayerDefaultPort(t *testing.T) {
 	}
 }
 
+func TestTransportLayerNilResolver(t *testing.T) {
+	tp := NewTransportLayer(nil, NewParser(), nil)
+	defer tp.Close()
+
+	addr := Addr{}
+	require.NoError(t, tp.resolveAddrIP(context.TODO(), "localhost", &addr))
+	assert.NotNil(t, addr.IP)
+}
+
 func TestTransportLayerResolving(t *testing.T) {
 	// NOTE it creates real network connection
 
@@ -336,3 +346,203 @@ func TestTransportLayerResolving(t *testing.T) {
 	assert.True(t, addr.IP.To4() != nil)
 	assert.Equal(t, "127.0.0.1:0", addr.String())
 }
+
+type testCustomAddr string
+
+func (a testCustomAddr) Network() string { return "pipe" }
+func (a testCustomAddr) String() string  { return string(a) }
+
+type testCustomConn struct {
+	raddr  Addr
+	msgs   chan Message
+	closed bool
+}
+
+func (c *testCustomConn) LocalAddr() net.Addr        { return testCustomAddr("pipe-local") }
+func (c *testCustomConn) WriteMsg(msg Message) error { c.msgs <- msg; return nil }
+func (c *testCustomConn) Ref(i int) int              { return 1 }
+func (c *testCustomConn) TryClose() (int, error)     { return 1, nil }
+func (c *testCustomConn) Close() error               { c.closed = true; return nil }
+
+type testCustomTransport struct {
+	conns   map[string]*testCustomConn
+	onClose func(conn Connection)
+	served  bool
+}
+
+func (t *testCustomTransport) Network() string { return "PIPE" }
+
+func (t *testCustomTransport) GetConnection(addr string) Connection {
+	if c, exists := t.conns[addr]; exists {
+		return c
+	}
+	return nil
+}
+
+func (t *testCustomTransport) CreateConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error) {
+	c := &testCustomConn{raddr: raddr, msgs: make(chan Message, 1)}
+	t.conns[raddr.String()] = c
+	return c, nil
+}
+
+func (t *testCustomTransport) Serve(l net.Listener, handler MessageHandler) error {
+	t.served = true
+	return nil
+}
+
+func (t *testCustomTransport) OnConnectionClose(h func(conn Connection)) {
+	t.onClose = h
+}
+
+func (t *testCustomTransport) Close() error {
+	for _, c := range t.conns {
+		c.Close()
+	}
+	return nil
+}
+
+func TestTransportLayerRegisterTransport(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	custom := &testCustomTransport{conns: make(map[string]*testCustomConn)}
+	require.NoError(t, tp.RegisterTransport("PIPE", custom))
+	require.Error(t, tp.RegisterTransport("pipe", custom))
+	require.Error(t, tp.RegisterTransport("TCP", custom))
+
+	closed := make(chan Connection, 1)
+	tp.OnConnectionClose(func(conn Connection) { closed <- conn })
+
+	req := NewRequest(OPTIONS, Uri{Host: "b2bua", UriParams: HeaderParams{{"transport", "pipe"}}})
+	req.AppendHeader(&ViaHeader{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: "PIPE", Params: NewParams()})
+	require.NoError(t, tp.WriteMsg(req))
+
+	// Destination is not DNS resolved
+	c := custom.conns["b2bua:5060"]
+	require.NotNil(t, c)
+	assert.Equal(t, "b2bua", c.raddr.Hostname)
+	msg := <-c.msgs
+	assert.Equal(t, req, msg)
+	assert.True(t, strings.HasSuffix(req.Via().Host, ".invalid"))
+
+	conn, err := tp.ClientRequestConnection(context.TODO(), req)
+	require.NoError(t, err)
+	assert.Equal(t, c, conn)
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	require.NoError(t, tp.Serve("pipe", l))
+	assert.True(t, custom.served)
+	assert.Equal(t, []int{l.Addr().(*net.TCPAddr).Port}, tp.ListenPorts("PIPE"))
+
+	custom.onClose(c)
+	assert.Equal(t, c, <-closed)
+
+	tp.Close()
+	assert.True(t, c.closed)
+}
+
+func TestTransportLayerUDPLargeRequest(t *testing.T) {
+	// NOTE it creates real network connection
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcpPort := ln.Addr().(*net.TCPAddr).Port
+
+	newRequest := func(port int, bodySize int) *Request {
+		req := NewRequest(MESSAGE, Uri{Host: "127.0.0.1", Port: port})
+		req.AppendHeader(&ViaHeader{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: "UDP", Host: "127.0.0.1", Params: NewParams()})
+		req.AppendHeader(NewHeader("Call-ID", "large"))
+		req.AppendHeader(&CSeqHeader{SeqNo: 1, MethodName: MESSAGE})
+		req.SetBody([]byte(strings.Repeat("a", bodySize)))
+		return req
+	}
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+	go tp.ServeTCP(ln)
+
+	t.Run("SmallStaysUDP", func(t *testing.T) {
+		req := newRequest(tcpPort, 100)
+		conn, err := tp.ClientRequestConnection(context.TODO(), req)
+		require.NoError(t, err)
+		defer conn.TryClose()
+		assert.IsType(t, &UDPConnection{}, conn)
+		assert.Equal(t, "UDP", req.Via().Transport)
+	})
+
+	t.Run("SwitchTCP", func(t *testing.T) {
+		req := newRequest(tcpPort, UDPMTUSize)
+		conn, err := tp.ClientRequestConnection(context.TODO(), req)
+		require.NoError(t, err)
+		defer conn.TryClose()
+		assert.IsType(t, &TCPConnection{}, conn)
+		assert.Equal(t, "TCP", req.Transport())
+		assert.Equal(t, "TCP", req.Via().Transport)
+		assert.True(t, IsReliable(req.Transport()))
+	})
+
+	t.Run("FallbackUDP", func(t *testing.T) {
+		// Nothing is listening on TCP port
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		req := newRequest(port, UDPMTUSize)
+		conn, err := tp.ClientRequestConnection(context.TODO(), req)
+		require.NoError(t, err)
+		defer conn.TryClose()
+		assert.IsType(t, &UDPConnection{}, conn)
+		assert.Equal(t, "UDP", req.Transport())
+		assert.Equal(t, "UDP", req.Via().Transport)
+		require.NoError(t, conn.WriteMsg(req))
+
+		// Without TCP failure large message is still rejected
+		req = newRequest(port, UDPMTUSize)
+		req.SetTransport("UDP")
+		require.ErrorIs(t, conn.WriteMsg(req), ErrUDPMTUCongestion)
+	})
+
+	t.Run("MTU", func(t *testing.T) {
+		tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerUDPMTU(9000))
+		defer tp.Close()
+
+		req := newRequest(tcpPort, UDPMTUSize)
+		conn, err := tp.ClientRequestConnection(context.TODO(), req)
+		require.NoError(t, err)
+		defer conn.TryClose()
+		assert.IsType(t, &UDPConnection{}, conn)
+		require.NoError(t, conn.WriteMsg(req))
+	})
+}
+
+func TestRequestSizeEstimate(t *testing.T) {
+	msg := "INVITE sip:bob@example.com;transport=udp SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776asdhds;rport\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"To: Bob <sip:bob@example.com>\r\n" +
+		"From: \"Alice A\" <sip:alice:secret@example.com:5080>;tag=1928301774\r\n" +
+		"Call-ID: a84b4c76e66710@pc33.example.com\r\n" +
+		"CSeq: 314159 INVITE\r\n" +
+		"Contact: <sip:alice@10.0.0.1;ob>;expires=3600\r\n" +
+		"Route: <sip:proxy.example.com;lr>\r\n" +
+		"Supported: timer, 100rel\r\n" +
+		"Content-Type: application/sdp\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"v=0\r\n"
+
+	parsed, err := NewParser().ParseSIP([]byte(msg))
+	require.NoError(t, err)
+	req := parsed.(*Request)
+	// Make sure typed headers are estimated
+	req.Via()
+	req.From()
+	req.To()
+	req.Contact()
+	req.Route()
+
+	size := len(req.String())
+	estimate := requestSizeEstimate(req)
+	assert.GreaterOrEqual(t, estimate, size)
+	assert.Less(t, estimate, size+100)
+}
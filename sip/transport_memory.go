@@ -0,0 +1,141 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+var (
+	errMemoryConnRefused   = errors.New("connection refused")
+	errMemoryAddrInUse     = errors.New("address already in use")
+	errMemoryListenerClose = errors.New("listener closed")
+)
+
+// MemoryNetwork is in process network for memory transport. Connections dialed to listener
+// address are connected with net.Pipe, so no sockets are used.
+type MemoryNetwork struct {
+	mu        sync.Mutex
+	listeners map[string]*memoryListener
+	port      int
+}
+
+// NewMemoryNetwork creates in process network
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		listeners: make(map[string]*memoryListener),
+		port:      49152,
+	}
+}
+
+// Listen creates listener on addr in host:port format
+func (n *MemoryNetwork) Listen(addr string) (net.Listener, error) {
+	if _, _, err := ParseAddr(addr); err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "memory", Err: err}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, exists := n.listeners[addr]; exists {
+		return nil, &net.OpError{Op: "listen", Net: "memory", Addr: memoryAddr(addr), Err: errMemoryAddrInUse}
+	}
+
+	l := &memoryListener{
+		net:    n,
+		addr:   memoryAddr(addr),
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	n.listeners[addr] = l
+	return l, nil
+}
+
+// Dial connects to listener on addr. Local address is host memory with ephemeral port
+func (n *MemoryNetwork) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	n.mu.Lock()
+	l, exists := n.listeners[addr]
+	n.port++
+	laddr := memoryAddr("memory:" + strconv.Itoa(n.port))
+	n.mu.Unlock()
+	if !exists {
+		return nil, &net.OpError{Op: "dial", Net: "memory", Addr: memoryAddr(addr), Err: errMemoryConnRefused}
+	}
+
+	client, server := net.Pipe()
+	select {
+	case l.conns <- &memoryConn{Conn: server, laddr: l.addr, raddr: laddr}:
+		return &memoryConn{Conn: client, laddr: laddr, raddr: l.addr}, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "dial", Net: "memory", Addr: memoryAddr(addr), Err: errMemoryConnRefused}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+func (a memoryAddr) String() string  { return string(a) }
+
+type memoryConn struct {
+	net.Conn
+	laddr memoryAddr
+	raddr memoryAddr
+}
+
+func (c *memoryConn) LocalAddr() net.Addr  { return c.laddr }
+func (c *memoryConn) RemoteAddr() net.Addr { return c.raddr }
+
+type memoryListener struct {
+	net       *MemoryNetwork
+	addr      memoryAddr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "accept", Net: "memory", Addr: l.addr, Err: net.ErrClosed}
+	}
+}
+
+func (l *memoryListener) Close() error {
+	err := errMemoryListenerClose
+	l.closeOnce.Do(func() {
+		l.net.mu.Lock()
+		delete(l.net.listeners, string(l.addr))
+		l.net.mu.Unlock()
+		close(l.closed)
+		err = nil
+	})
+	return err
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// TransportMemory is stream transport over MemoryNetwork. It allows user agents in same process
+// to exchange SIP messages without sockets, which makes tests deterministic.
+// It must be registered on transport layer with RegisterTransport under network "memory"
+// and request destination is listener address.
+type TransportMemory struct {
+	*streamTransport
+}
+
+// NewTransportMemory creates memory transport on network
+func NewTransportMemory(n *MemoryNetwork, par *Parser) *TransportMemory {
+	t := &TransportMemory{
+		streamTransport: newStreamTransport("memory", par),
+	}
+	t.dial = func(ctx context.Context, raddr Addr) (net.Conn, error) {
+		return n.Dial(ctx, raddr.String())
+	}
+	return t
+}
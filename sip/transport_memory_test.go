@@ -0,0 +1,83 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStreamTransportExchange sends OPTIONS from client to server transport layer and waits response
+func testStreamTransportExchange(t *testing.T, network string, server *TransportLayer, client *TransportLayer, dest string) {
+	server.OnMessage(func(msg Message) {
+		req, ok := msg.(*Request)
+		if !ok {
+			return
+		}
+		assert.Equal(t, NetworkToUpper(network), req.Transport())
+		res := NewResponseFromRequest(req, StatusOK, "OK", nil)
+		assert.NoError(t, server.WriteMsg(res))
+	})
+
+	responses := make(chan *Response, 1)
+	client.OnMessage(func(msg Message) {
+		if res, ok := msg.(*Response); ok {
+			responses <- res
+		}
+	})
+
+	req := NewRequest(OPTIONS, Uri{Host: "server"})
+	req.AppendHeader(&ViaHeader{ProtocolName: "SIP", ProtocolVersion: "2.0", Transport: NetworkToUpper(network), Params: NewParams()})
+	req.AppendHeader(NewHeader("Call-ID", "stream-"+network))
+	req.AppendHeader(&CSeqHeader{SeqNo: 1, MethodName: OPTIONS})
+	req.SetBody(nil)
+	req.SetTransport(NetworkToUpper(network))
+	req.SetDestination(dest)
+	require.NoError(t, client.WriteMsg(req))
+
+	select {
+	case res := <-responses:
+		assert.Equal(t, StatusOK, res.StatusCode)
+		assert.Equal(t, "stream-"+network, res.CallID().Value())
+	case <-time.After(2 * time.Second):
+		t.Fatal("response not received")
+	}
+}
+
+func TestTransportMemory(t *testing.T) {
+	mem := NewMemoryNetwork()
+	server := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer server.Close()
+	client := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer client.Close()
+	require.NoError(t, server.RegisterTransport("memory", NewTransportMemory(mem, NewParser())))
+	require.NoError(t, client.RegisterTransport("memory", NewTransportMemory(mem, NewParser())))
+
+	l, err := mem.Listen("server:5060")
+	require.NoError(t, err)
+	_, err = mem.Listen("server:5060")
+	require.Error(t, err)
+	go server.Serve("memory", l)
+
+	testStreamTransportExchange(t, "memory", server, client, "server:5060")
+	assert.Equal(t, []int{5060}, server.ListenPorts("memory"))
+
+	closed := make(chan Connection, 1)
+	server.OnConnectionClose(func(conn Connection) { closed <- conn })
+	conn, err := client.GetConnection("memory", "server:5060")
+	require.NoError(t, err)
+	conn.TryClose()
+	require.NoError(t, conn.Close())
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server connection close not notified")
+	}
+
+	require.NoError(t, l.Close())
+	_, err = mem.Dial(context.TODO(), "server:5060")
+	require.Error(t, err)
+}
@@ -0,0 +1,427 @@
+package sip
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is token bucket limit. Zero Rate is unlimited
+type RateLimit struct {
+	// Rate is number of requests per second
+	Rate float64
+	// Burst is bucket size. Default 1
+	Burst int
+}
+
+// RateLimitConfig configures per source rate limiting and flood protection.
+// Source is IP address of remote side.
+type RateLimitConfig struct {
+	// Limits are token buckets per request method per source
+	Limits map[RequestMethod]RateLimit
+	// Default is limit per source for methods not in Limits
+	Default RateLimit
+	// FromUserLimits are token buckets per request method per From user, shared by all sources.
+	// Useful against REGISTER brute force of single account from many addresses
+	FromUserLimits map[RequestMethod]RateLimit
+
+	// BanAfter is number of rejected requests within BanWindow after which source is banned. 0 disables
+	BanAfter int
+	// BanWindow is window for counting rejected requests. Default 1 minute
+	BanWindow time.Duration
+	// BanDuration is ban duration. Default 10 minutes
+	BanDuration time.Duration
+
+	// Allow is list of networks which are never limited
+	Allow []netip.Prefix
+	// Deny is list of networks which are always dropped
+	Deny []netip.Prefix
+	// DenyUserAgents are User-Agent substrings (case insensitive) like "friendly-scanner".
+	// Matched source is banned
+	DenyUserAgents []string
+
+	// OnReject is called for every dropped message. It must not block
+	OnReject func(r RateLimitRejection)
+}
+
+// RateLimitReason is reason of dropped message
+type RateLimitReason int
+
+const (
+	RateLimitReasonDenied RateLimitReason = iota + 1
+	RateLimitReasonBanned
+	RateLimitReasonUserAgent
+	RateLimitReasonRate
+	RateLimitReasonFromUser
+)
+
+func (r RateLimitReason) String() string {
+	switch r {
+	case RateLimitReasonDenied:
+		return "denied"
+	case RateLimitReasonBanned:
+		return "banned"
+	case RateLimitReasonUserAgent:
+		return "user agent"
+	case RateLimitReasonRate:
+		return "rate"
+	case RateLimitReasonFromUser:
+		return "from user rate"
+	}
+	return "unknown"
+}
+
+// RateLimitRejection describes dropped message
+type RateLimitRejection struct {
+	Transport string
+	// Source is remote address
+	Source string
+	// Method is empty for responses and closed connections
+	Method   RequestMethod
+	FromUser string
+	Reason   RateLimitReason
+}
+
+// RateLimiter drops messages before they reach transaction layer.
+// For UDP messages are dropped before parsing, and for stream transports abusive connections are closed.
+// It is set with WithTransportLayerRateLimiter
+type RateLimiter struct {
+	conf       RateLimitConfig
+	userAgents []string
+	scanHeader bool
+
+	mu        sync.Mutex
+	sources   map[string]*rateLimitSource
+	users     map[string]*rateLimitSource
+	nextPurge time.Time
+}
+
+type rateLimitSource struct {
+	buckets     map[RequestMethod]*tokenBucket
+	violations  int
+	windowStart time.Time
+	bannedUntil time.Time
+	lastSeen    time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) allow(l RateLimit, now time.Time) bool {
+	burst := float64(max(l.Burst, 1))
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// NewRateLimiter creates rate limiter
+func NewRateLimiter(conf RateLimitConfig) *RateLimiter {
+	if conf.BanWindow <= 0 {
+		conf.BanWindow = time.Minute
+	}
+	if conf.BanDuration <= 0 {
+		conf.BanDuration = 10 * time.Minute
+	}
+	rl := &RateLimiter{
+		conf:       conf,
+		scanHeader: len(conf.DenyUserAgents) > 0 || len(conf.FromUserLimits) > 0,
+		sources:    make(map[string]*rateLimitSource),
+		users:      make(map[string]*rateLimitSource),
+	}
+	for _, ua := range conf.DenyUserAgents {
+		rl.userAgents = append(rl.userAgents, strings.ToLower(ua))
+	}
+	return rl
+}
+
+// Ban bans source host (IP address) for duration
+func (rl *RateLimiter) Ban(host string, d time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.source(host, time.Now()).bannedUntil = time.Now().Add(d)
+}
+
+// Unban removes ban of source host
+func (rl *RateLimiter) Unban(host string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if s, exists := rl.sources[host]; exists {
+		s.bannedUntil = time.Time{}
+		s.violations = 0
+	}
+}
+
+// Banned checks is source host banned
+func (rl *RateLimiter) Banned(host string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	s, exists := rl.sources[host]
+	return exists && time.Now().Before(s.bannedUntil)
+}
+
+// source returns source entry. Caller must hold lock
+func (rl *RateLimiter) source(host string, now time.Time) *rateLimitSource {
+	s, exists := rl.sources[host]
+	if !exists {
+		s = &rateLimitSource{buckets: make(map[RequestMethod]*tokenBucket)}
+		rl.sources[host] = s
+	}
+	s.lastSeen = now
+	return s
+}
+
+// rateLimitMessage is message info needed for limiting
+type rateLimitMessage struct {
+	request   bool
+	method    RequestMethod
+	userAgent string
+	fromUser  string
+}
+
+// allowConn checks can connection from source be accepted
+func (rl *RateLimiter) allowConn(transport string, src string) bool {
+	ok, _ := rl.check(transport, src, nil)
+	return ok
+}
+
+// allowPacket checks raw message before parsing. Unknown data is passed to parser
+func (rl *RateLimiter) allowPacket(transport string, src string, data []byte) bool {
+	msg, valid := rateLimitScan(data, rl.scanHeader)
+	if !valid {
+		ok, _ := rl.check(transport, src, nil)
+		return ok
+	}
+	ok, _ := rl.check(transport, src, &msg)
+	return ok
+}
+
+// allowMessage checks parsed message. It returns closeConn if source is banned or denied
+func (rl *RateLimiter) allowMessage(transport string, src string, m Message) (ok bool, closeConn bool) {
+	msg := rateLimitMessage{}
+	if req, isReq := m.(*Request); isReq {
+		msg.request = true
+		msg.method = req.Method
+		if h := req.GetHeader("User-Agent"); h != nil {
+			msg.userAgent = h.Value()
+		}
+		if h := req.From(); h != nil {
+			msg.fromUser = h.Address.User
+		}
+	}
+	return rl.check(transport, src, &msg)
+}
+
+func (rl *RateLimiter) check(transport string, src string, msg *rateLimitMessage) (ok bool, closeConn bool) {
+	host := src
+	if h, _, err := net.SplitHostPort(src); err == nil {
+		host = h
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ip = ip.Unmap()
+		if rateLimitContains(rl.conf.Allow, ip) {
+			return true, false
+		}
+		if rateLimitContains(rl.conf.Deny, ip) {
+			rl.reject(transport, src, msg, RateLimitReasonDenied)
+			return false, true
+		}
+	}
+
+	reason := rl.limit(host, msg)
+	if reason == 0 {
+		return true, false
+	}
+	rl.reject(transport, src, msg, reason)
+	return false, reason != RateLimitReasonRate && reason != RateLimitReasonFromUser
+}
+
+// limit returns reason if message must be dropped
+func (rl *RateLimiter) limit(host string, msg *rateLimitMessage) RateLimitReason {
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.purge(now)
+
+	s := rl.source(host, now)
+	if now.Before(s.bannedUntil) {
+		return RateLimitReasonBanned
+	}
+	if msg == nil || !msg.request {
+		return 0
+	}
+
+	if msg.userAgent != "" && len(rl.userAgents) > 0 {
+		ua := strings.ToLower(msg.userAgent)
+		if slices.ContainsFunc(rl.userAgents, func(s string) bool { return strings.Contains(ua, s) }) {
+			s.bannedUntil = now.Add(rl.conf.BanDuration)
+			return RateLimitReasonUserAgent
+		}
+	}
+
+	var reason RateLimitReason
+	if l, exists := rl.conf.Limits[msg.method]; exists {
+		if !rateLimitBucket(s, msg.method, l, now) {
+			reason = RateLimitReasonRate
+		}
+	} else if l := rl.conf.Default; l.Rate > 0 {
+		if !rateLimitBucket(s, msg.method, l, now) {
+			reason = RateLimitReasonRate
+		}
+	}
+
+	if l, exists := rl.conf.FromUserLimits[msg.method]; exists && reason == 0 && msg.fromUser != "" {
+		u, exists := rl.users[msg.fromUser]
+		if !exists {
+			u = &rateLimitSource{buckets: make(map[RequestMethod]*tokenBucket)}
+			rl.users[msg.fromUser] = u
+		}
+		u.lastSeen = now
+		if !rateLimitBucket(u, msg.method, l, now) {
+			reason = RateLimitReasonFromUser
+		}
+	}
+
+	if reason == 0 || rl.conf.BanAfter <= 0 {
+		return reason
+	}
+
+	if now.Sub(s.windowStart) > rl.conf.BanWindow {
+		s.windowStart = now
+		s.violations = 0
+	}
+	s.violations++
+	if s.violations >= rl.conf.BanAfter {
+		s.violations = 0
+		s.bannedUntil = now.Add(rl.conf.BanDuration)
+		return RateLimitReasonBanned
+	}
+	return reason
+}
+
+func (rl *RateLimiter) reject(transport string, src string, msg *rateLimitMessage, reason RateLimitReason) {
+	if rl.conf.OnReject == nil {
+		return
+	}
+	r := RateLimitRejection{
+		Transport: transport,
+		Source:    src,
+		Reason:    reason,
+	}
+	if msg != nil {
+		r.Method = msg.method
+		r.FromUser = msg.fromUser
+	}
+	rl.conf.OnReject(r)
+}
+
+// purge removes idle entries. Caller must hold lock
+func (rl *RateLimiter) purge(now time.Time) {
+	if now.Before(rl.nextPurge) {
+		return
+	}
+	idle := max(time.Minute, rl.conf.BanWindow)
+	for k, s := range rl.sources {
+		if now.Sub(s.lastSeen) > idle && now.After(s.bannedUntil) {
+			delete(rl.sources, k)
+		}
+	}
+	for k, u := range rl.users {
+		if now.Sub(u.lastSeen) > idle {
+			delete(rl.users, k)
+		}
+	}
+	rl.nextPurge = now.Add(time.Minute)
+}
+
+func rateLimitBucket(s *rateLimitSource, method RequestMethod, l RateLimit, now time.Time) bool {
+	if l.Rate <= 0 {
+		return true
+	}
+	b, exists := s.buckets[method]
+	if !exists {
+		b = &tokenBucket{}
+		s.buckets[method] = b
+	}
+	return b.allow(l, now)
+}
+
+func rateLimitContains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitScan reads method and optionally User-Agent and From user from raw message without parsing.
+// It returns false if data does not look like SIP message
+func rateLimitScan(data []byte, headers bool) (msg rateLimitMessage, valid bool) {
+	line, rest, found := bytes.Cut(data, []byte("\n"))
+	if !found {
+		return msg, false
+	}
+	line = bytes.TrimRight(line, "\r")
+	if bytes.HasPrefix(line, []byte("SIP/")) {
+		return msg, true
+	}
+	method, _, found := bytes.Cut(line, []byte(" "))
+	if !found || len(method) == 0 {
+		return msg, false
+	}
+	msg.request = true
+	msg.method = RequestMethod(method)
+
+	for headers && len(rest) > 0 {
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			// End of headers
+			break
+		}
+		name, value, found := bytes.Cut(line, []byte(":"))
+		if !found {
+			continue
+		}
+		name = bytes.TrimSpace(name)
+		switch {
+		case bytes.EqualFold(name, []byte("User-Agent")):
+			msg.userAgent = string(bytes.TrimSpace(value))
+		case bytes.EqualFold(name, []byte("From")), bytes.EqualFold(name, []byte("f")):
+			msg.fromUser = rateLimitScanUser(value)
+		}
+	}
+	return msg, true
+}
+
+func rateLimitScanUser(value []byte) string {
+	for _, scheme := range []string{"sip:", "sips:"} {
+		i := bytes.Index(value, []byte(scheme))
+		if i < 0 {
+			continue
+		}
+		uri := value[i+len(scheme):]
+		end := bytes.IndexAny(uri, "@>;")
+		if end < 0 || uri[end] != '@' {
+			return ""
+		}
+		return string(uri[:end])
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+package sip
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRateLimitRequest(method string, userAgent string, fromUser string) []byte {
+	return []byte(strings.Join([]string{
+		method + " sip:example.com SIP/2.0",
+		"Via: SIP/2.0/UDP 127.0.0.1:5066;branch=" + GenerateBranch(),
+		"f: <sip:" + fromUser + "@example.com>;tag=1234",
+		"To: <sip:" + fromUser + "@example.com>",
+		"Call-ID: " + GenerateTagN(16),
+		"CSeq: 1 " + method,
+		"User-Agent: " + userAgent,
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n"))
+}
+
+func TestRateLimitScan(t *testing.T) {
+	msg, valid := rateLimitScan(testRateLimitRequest("REGISTER", "friendly-scanner", "100"), true)
+	require.True(t, valid)
+	assert.Equal(t, rateLimitMessage{request: true, method: REGISTER, userAgent: "friendly-scanner", fromUser: "100"}, msg)
+
+	msg, valid = rateLimitScan(testRateLimitRequest("REGISTER", "friendly-scanner", "100"), false)
+	require.True(t, valid)
+	assert.Equal(t, rateLimitMessage{request: true, method: REGISTER}, msg)
+
+	msg, valid = rateLimitScan([]byte("SIP/2.0 200 OK\r\nContent-Length: 0\r\n\r\n"), true)
+	require.True(t, valid)
+	assert.False(t, msg.request)
+
+	_, valid = rateLimitScan([]byte("garbage"), true)
+	assert.False(t, valid)
+
+	assert.Equal(t, "", rateLimitScanUser([]byte("<sip:example.com>;tag=1")))
+	assert.Equal(t, "alice", rateLimitScanUser([]byte(`"Alice" <sips:alice@example.com>`)))
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("Method", func(t *testing.T) {
+		var rejections []RateLimitRejection
+		rl := NewRateLimiter(RateLimitConfig{
+			Limits:   map[RequestMethod]RateLimit{REGISTER: {Rate: 0.001, Burst: 2}},
+			OnReject: func(r RateLimitRejection) { rejections = append(rejections, r) },
+		})
+		data := testRateLimitRequest("REGISTER", "test", "100")
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.1:5060", data))
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.1:5060", data))
+		assert.False(t, rl.allowPacket("UDP", "10.0.0.1:5060", data))
+		// Other source and method have own bucket
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.2:5060", data))
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.1:5060", testRateLimitRequest("OPTIONS", "test", "100")))
+		// Responses are not limited
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.1:5060", []byte("SIP/2.0 200 OK\r\n\r\n")))
+
+		require.Len(t, rejections, 1)
+		assert.Equal(t, RateLimitRejection{Transport: "UDP", Source: "10.0.0.1:5060", Method: REGISTER, Reason: RateLimitReasonRate}, rejections[0])
+	})
+
+	t.Run("Ban", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimitConfig{
+			Default:     RateLimit{Rate: 0.001, Burst: 1},
+			BanAfter:    2,
+			BanDuration: time.Minute,
+		})
+		data := testRateLimitRequest("INVITE", "test", "100")
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.1:5060", data))
+		ok, closeConn := rl.check("TCP", "10.0.0.1:5060", &rateLimitMessage{request: true, method: INVITE})
+		assert.False(t, ok)
+		assert.False(t, closeConn)
+		ok, closeConn = rl.check("TCP", "10.0.0.1:5060", &rateLimitMessage{request: true, method: INVITE})
+		assert.False(t, ok)
+		assert.True(t, closeConn)
+
+		assert.True(t, rl.Banned("10.0.0.1"))
+		assert.False(t, rl.allowConn("TCP", "10.0.0.1:5070"))
+		assert.False(t, rl.allowPacket("UDP", "10.0.0.1:5060", []byte("SIP/2.0 200 OK\r\n\r\n")))
+
+		rl.Unban("10.0.0.1")
+		assert.True(t, rl.allowConn("TCP", "10.0.0.1:5070"))
+		rl.Ban("10.0.0.3", time.Minute)
+		assert.False(t, rl.allowConn("TCP", "10.0.0.3:5070"))
+	})
+
+	t.Run("UserAgent", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimitConfig{DenyUserAgents: []string{"Friendly-Scanner"}})
+		assert.False(t, rl.allowPacket("UDP", "10.0.0.1:5060", testRateLimitRequest("OPTIONS", "friendly-scanner", "100")))
+		assert.True(t, rl.Banned("10.0.0.1"))
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.2:5060", testRateLimitRequest("OPTIONS", "sipgo", "100")))
+	})
+
+	t.Run("FromUser", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimitConfig{FromUserLimits: map[RequestMethod]RateLimit{REGISTER: {Rate: 0.001, Burst: 1}}})
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.1:5060", testRateLimitRequest("REGISTER", "test", "100")))
+		// Same user from other address
+		assert.False(t, rl.allowPacket("UDP", "10.0.0.2:5060", testRateLimitRequest("REGISTER", "test", "100")))
+		assert.True(t, rl.allowPacket("UDP", "10.0.0.2:5060", testRateLimitRequest("REGISTER", "test", "101")))
+	})
+
+	t.Run("AllowDeny", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimitConfig{
+			Default: RateLimit{Rate: 0.001, Burst: 1},
+			Allow:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+			Deny:    []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")},
+		})
+		data := testRateLimitRequest("INVITE", "test", "100")
+		for i := 0; i < 3; i++ {
+			assert.True(t, rl.allowPacket("UDP", "10.0.0.1:5060", data))
+		}
+		assert.False(t, rl.allowConn("TCP", "192.168.1.1:5060"))
+		ok, closeConn := rl.check("TCP", "192.168.1.1:5060", &rateLimitMessage{request: true, method: INVITE})
+		assert.False(t, ok)
+		assert.True(t, closeConn)
+	})
+}
+
+func TestTransportLayerRateLimiter(t *testing.T) {
+	t.Run("UDP", func(t *testing.T) {
+		// NOTE it creates real network connection
+		l, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerRateLimiter(NewRateLimiter(RateLimitConfig{
+			Limits: map[RequestMethod]RateLimit{REGISTER: {Rate: 0.001, Burst: 1}},
+		})))
+		defer tp.Close()
+		received := make(chan Message, 10)
+		tp.OnMessage(func(msg Message) { received <- msg })
+		go tp.ServeUDP(l)
+
+		conn, err := net.Dial("udp", l.LocalAddr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		for i := 0; i < 3; i++ {
+			_, err := conn.Write(testRateLimitRequest("REGISTER", "test", "100"))
+			require.NoError(t, err)
+		}
+		_, err = conn.Write(testRateLimitRequest("OPTIONS", "test", "100"))
+		require.NoError(t, err)
+
+		msg := <-received
+		assert.Equal(t, REGISTER, msg.(*Request).Method)
+		msg = <-received
+		assert.Equal(t, OPTIONS, msg.(*Request).Method)
+		select {
+		case msg := <-received:
+			t.Fatalf("unexpected message %s", msg.String())
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		mem := NewMemoryNetwork()
+		tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerRateLimiter(NewRateLimiter(RateLimitConfig{
+			DenyUserAgents: []string{"friendly-scanner"},
+		})))
+		defer tp.Close()
+		require.NoError(t, tp.RegisterTransport("memory", NewTransportMemory(mem, NewParser())))
+		received := make(chan Message, 10)
+		tp.OnMessage(func(msg Message) { received <- msg })
+
+		l, err := mem.Listen("uas:5060")
+		require.NoError(t, err)
+		go tp.Serve("memory", l)
+
+		conn, err := mem.Dial(context.TODO(), "uas:5060")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write(testRateLimitRequest("OPTIONS", "sipgo", "100"))
+		require.NoError(t, err)
+		msg := <-received
+		assert.Equal(t, OPTIONS, msg.(*Request).Method)
+
+		// Scanner connection is closed
+		_, err = conn.Write(testRateLimitRequest("OPTIONS", "friendly-scanner", "100"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 100))
+		require.ErrorIs(t, err, io.EOF)
+		assert.Empty(t, received)
+	})
+}
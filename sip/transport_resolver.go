@@ -0,0 +1,442 @@
+package sip
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrServerResolverNoTargets is returned when server location did not resolve any target
+	ErrServerResolverNoTargets = errors.New("no targets resolved")
+)
+
+// DefaultBlacklistTTL is time target stays blacklisted after failure
+var DefaultBlacklistTTL = 30 * time.Second
+
+// DNSResolver is DNS resolver used by transport layer for locating servers.
+// *net.Resolver implements this interface.
+type DNSResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupIP(ctx context.Context, network string, host string) ([]net.IP, error)
+	// LookupSRV is same as net.Resolver.LookupSRV. With empty service and proto name is looked up directly
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// NAPTR is DNS NAPTR record
+// https://datatracker.ietf.org/doc/html/rfc3403#section-4.1
+type NAPTR struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// DNSNAPTRResolver can be implemented by DNSResolver to support NAPTR lookups.
+// Standard library resolver does not support NAPTR, in which case transport is selected with SRV lookups
+type DNSNAPTRResolver interface {
+	LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error)
+}
+
+// ServerTarget is located server with transport and address to which request should be sent
+type ServerTarget struct {
+	// Transport is lower case network like udp, tcp, tls
+	Transport string
+	Addr      Addr
+}
+
+func (t ServerTarget) String() string {
+	return t.Transport + ":" + t.Addr.String()
+}
+
+// naptrServices maps NAPTR services to transports
+// https://datatracker.ietf.org/doc/html/rfc3263#section-4.1
+// https://datatracker.ietf.org/doc/html/rfc7118#section-9
+var naptrServices = map[string]string{
+	"SIP+D2U":  "udp",
+	"SIP+D2T":  "tcp",
+	"SIPS+D2T": "tls",
+	"SIP+D2W":  "ws",
+	"SIPS+D2W": "wss",
+}
+
+// ServerResolver locates SIP servers as described in RFC 3263.
+// It resolves URI to ordered list of targets which should be tried in order
+// and keeps blacklist of failed targets.
+type ServerResolver struct {
+	dns          DNSResolver
+	log          *slog.Logger
+	blacklistTTL time.Duration
+	preferIP     int // 0 - no preference , 1 -ip4, 2 - ip6
+
+	mu        sync.Mutex
+	blacklist map[string]time.Time
+}
+
+type ServerResolverOption func(r *ServerResolver)
+
+// WithServerResolverBlacklistTTL sets for how long failed target is moved at end of target list
+// Default: DefaultBlacklistTTL
+func WithServerResolverBlacklistTTL(ttl time.Duration) ServerResolverOption {
+	return func(r *ServerResolver) {
+		r.blacklistTTL = ttl
+	}
+}
+
+func WithServerResolverLogger(logger *slog.Logger) ServerResolverOption {
+	return func(r *ServerResolver) {
+		if logger != nil {
+			r.log = logger.With("caller", "ServerResolver")
+		}
+	}
+}
+
+// NewServerResolver creates server resolver.
+func NewServerResolver(dns DNSResolver, opts ...ServerResolverOption) *ServerResolver {
+	r := &ServerResolver{
+		dns:          dns,
+		log:          DefaultLogger().With("caller", "ServerResolver"),
+		blacklistTTL: DefaultBlacklistTTL,
+		preferIP:     1,
+		blacklist:    make(map[string]time.Time),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	if r.blacklistTTL <= 0 {
+		r.blacklistTTL = DefaultBlacklistTTL
+	}
+	return r
+}
+
+// Resolve returns ordered list of targets for uri. Transport can be passed to force transport,
+// otherwise transport is taken from uri transport param or selected with NAPTR and SRV lookups.
+// Blacklisted targets are not removed, but moved at end of list.
+// https://datatracker.ietf.org/doc/html/rfc3263#section-4
+func (r *ServerResolver) Resolve(ctx context.Context, uri Uri, transport string) ([]ServerTarget, error) {
+	host := uri.Host
+	if uri.UriParams != nil {
+		if maddr, ok := uri.UriParams.Get("maddr"); ok && maddr != "" {
+			host = maddr
+		}
+		if transport == "" {
+			if val, ok := uri.UriParams.Get("transport"); ok {
+				transport = val
+			}
+		}
+	}
+	host = uriNetIP(host)
+	transport = NetworkToLower(transport)
+
+	sips := uri.IsEncrypted()
+	if sips {
+		switch transport {
+		case "tcp":
+			transport = "tls"
+		case "ws":
+			transport = "wss"
+		}
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc3263#section-4.1
+	// If target is numeric IP or port is present, no NAPTR and SRV lookups are done
+	ip, err := netip.ParseAddr(host)
+	if err == nil || uri.Port > 0 {
+		if transport == "" {
+			transport = defaultTransport(sips)
+		}
+		port := uri.Port
+		if port == 0 {
+			port = DefaultPort(transport)
+		}
+
+		if err == nil {
+			ipBytes := ip.As16()
+			return []ServerTarget{{Transport: transport, Addr: Addr{IP: net.IP(ipBytes[:]), Port: port, Hostname: host, Zone: ip.Zone()}}}, nil
+		}
+
+		targets, err := r.resolveHost(ctx, transport, host, port)
+		if err != nil {
+			return nil, err
+		}
+		return r.order(targets), nil
+	}
+
+	var targets []ServerTarget
+	if transport == "" {
+		targets = r.resolveNAPTR(ctx, host, sips)
+	}
+
+	if len(targets) == 0 {
+		// https://datatracker.ietf.org/doc/html/rfc3263#section-4.1
+		// If no NAPTR records are found, the client constructs SRV queries for those transport protocols it supports
+		transports := []string{transport}
+		if transport == "" {
+			transports = []string{"udp", "tcp", "tls"}
+			if sips {
+				transports = []string{"tls"}
+			}
+		}
+
+		for _, tp := range transports {
+			service, proto, ok := srvService(tp, sips)
+			if !ok {
+				continue
+			}
+			targets = append(targets, r.resolveSRV(ctx, tp, "_"+service+"._"+proto+"."+host)...)
+		}
+	}
+
+	if len(targets) == 0 {
+		// https://datatracker.ietf.org/doc/html/rfc3263#section-4.2
+		// If no SRV records were found, the client performs an A or AAAA record lookup of the domain name
+		if transport == "" {
+			transport = defaultTransport(sips)
+		}
+		targets, err = r.resolveHost(ctx, transport, host, DefaultPort(transport))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.order(targets), nil
+}
+
+// Blacklist marks target as failed for ttl. If ttl is 0 resolver blacklist TTL is used.
+// https://datatracker.ietf.org/doc/html/rfc3263#section-4.3
+func (r *ServerResolver) Blacklist(t ServerTarget, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = r.blacklistTTL
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blacklist[t.String()] = time.Now().Add(ttl)
+}
+
+// IsBlacklisted checks is target currently blacklisted
+func (r *ServerResolver) IsBlacklisted(t ServerTarget) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.isBlacklisted(t.String(), time.Now())
+}
+
+func (r *ServerResolver) isBlacklisted(key string, now time.Time) bool {
+	expiry, exists := r.blacklist[key]
+	if !exists {
+		return false
+	}
+	if now.After(expiry) {
+		delete(r.blacklist, key)
+		return false
+	}
+	return true
+}
+
+// order removes duplicate targets and moves blacklisted targets at end
+func (r *ServerResolver) order(targets []ServerTarget) []ServerTarget {
+	now := time.Now()
+	seen := make(map[string]struct{}, len(targets))
+	ordered := make([]ServerTarget, 0, len(targets))
+	var blacklisted []ServerTarget
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range targets {
+		key := t.String()
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if r.isBlacklisted(key, now) {
+			blacklisted = append(blacklisted, t)
+			continue
+		}
+		ordered = append(ordered, t)
+	}
+	return append(ordered, blacklisted...)
+}
+
+func (r *ServerResolver) resolveNAPTR(ctx context.Context, host string, sips bool) []ServerTarget {
+	naptrResolver, ok := r.dns.(DNSNAPTRResolver)
+	if !ok {
+		return nil
+	}
+
+	records, err := naptrResolver.LookupNAPTR(ctx, host)
+	if err != nil {
+		r.log.Debug("NAPTR lookup failed", "host", host, "error", err)
+		return nil
+	}
+
+	// Only records with S flag leading to SRV lookup and supported transports are used
+	// https://datatracker.ietf.org/doc/html/rfc3263#section-4.1
+	records = slices.DeleteFunc(slices.Clone(records), func(rec *NAPTR) bool {
+		if !strings.EqualFold(rec.Flags, "s") {
+			return true
+		}
+		service := strings.ToUpper(rec.Service)
+		if sips && !strings.HasPrefix(service, "SIPS+") {
+			return true
+		}
+		_, exists := naptrServices[service]
+		return !exists
+	})
+	slices.SortStableFunc(records, func(a, b *NAPTR) int {
+		if c := cmp.Compare(a.Order, b.Order); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Preference, b.Preference)
+	})
+
+	var targets []ServerTarget
+	for _, rec := range records {
+		transport := naptrServices[strings.ToUpper(rec.Service)]
+		targets = append(targets, r.resolveSRV(ctx, transport, rec.Replacement)...)
+	}
+	return targets
+}
+
+func (r *ServerResolver) resolveSRV(ctx context.Context, transport string, name string) []ServerTarget {
+	_, records, err := r.dns.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		r.log.Debug("SRV lookup failed", "name", name, "error", err)
+		return nil
+	}
+
+	var targets []ServerTarget
+	for _, rec := range orderSRV(records) {
+		// https://datatracker.ietf.org/doc/html/rfc2782
+		// A Target of "." means that the service is decidedly not available at this domain.
+		if rec.Target == "." || rec.Target == "" {
+			continue
+		}
+		t, err := r.resolveHost(ctx, transport, strings.TrimSuffix(rec.Target, "."), int(rec.Port))
+		if err != nil {
+			r.log.Debug("SRV target resolving failed", "target", rec.Target, "error", err)
+			continue
+		}
+		targets = append(targets, t...)
+	}
+	return targets
+}
+
+// resolveHost does A/AAAA lookup and returns target for every IP, with preferred IP version first
+func (r *ServerResolver) resolveHost(ctx context.Context, transport string, host string, port int) ([]ServerTarget, error) {
+	ips, err := r.dns.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%w: host %q has no ip addr", ErrServerResolverNoTargets, host)
+	}
+
+	if r.preferIP > 0 {
+		slices.SortStableFunc(ips, func(a, b net.IPAddr) int {
+			aIP4, bIP4 := a.IP.To4() != nil, b.IP.To4() != nil
+			if aIP4 == bIP4 {
+				return 0
+			}
+			if aIP4 == (r.preferIP == 1) {
+				return -1
+			}
+			return 1
+		})
+	}
+
+	targets := make([]ServerTarget, 0, len(ips))
+	for _, ip := range ips {
+		targets = append(targets, ServerTarget{
+			Transport: transport,
+			Addr:      Addr{IP: ip.IP, Port: port, Zone: ip.Zone, Hostname: host},
+		})
+	}
+	return targets, nil
+}
+
+// ServerResolver returns RFC 3263 server resolver of transport layer
+func (l *TransportLayer) ServerResolver() *ServerResolver {
+	return l.resolver
+}
+
+// ResolveTargets returns ordered list of targets for request based on first Route or Request-URI.
+// Transport set with SetTransport or transport uri param is not changed by resolving.
+// https://datatracker.ietf.org/doc/html/rfc3263#section-4
+func (l *TransportLayer) ResolveTargets(ctx context.Context, req *Request) ([]ServerTarget, error) {
+	uri := req.Recipient
+	if hdr := req.Route(); hdr != nil {
+		uri = hdr.Address
+	}
+	return l.resolver.Resolve(ctx, uri, req.MessageData.Transport())
+}
+
+// orderSRV sorts records by priority and randomizes by weight within same priority
+// https://datatracker.ietf.org/doc/html/rfc2782
+func orderSRV(records []*net.SRV) []*net.SRV {
+	records = slices.Clone(records)
+	slices.SortStableFunc(records, func(a, b *net.SRV) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+
+	for i := 0; i < len(records); {
+		j := i + 1
+		for j < len(records) && records[j].Priority == records[i].Priority {
+			j++
+		}
+		shuffleSRVByWeight(records[i:j])
+		i = j
+	}
+	return records
+}
+
+func shuffleSRVByWeight(records []*net.SRV) {
+	sum := 0
+	for _, rec := range records {
+		sum += int(rec.Weight)
+	}
+	for sum > 0 && len(records) > 1 {
+		s := 0
+		n := rand.Intn(sum)
+		for i := range records {
+			s += int(records[i].Weight)
+			if s > n {
+				records[0], records[i] = records[i], records[0]
+				break
+			}
+		}
+		sum -= int(records[0].Weight)
+		records = records[1:]
+	}
+}
+
+// srvService returns SRV service and proto for transport.
+// https://datatracker.ietf.org/doc/html/rfc3263#section-4.1
+func srvService(transport string, sips bool) (string, string, bool) {
+	switch transport {
+	case "udp":
+		return "sip", "udp", !sips
+	case "tcp":
+		return "sip", "tcp", !sips
+	case "tls":
+		return "sips", "tcp", true
+	}
+	// No SRV defined for websocket
+	return "", "", false
+}
+
+func defaultTransport(sips bool) string {
+	if sips {
+		return "tls"
+	}
+	return "udp"
+}
@@ -0,0 +1,220 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDNSResolver struct {
+	hosts map[string][]net.IP
+	srv   map[string][]*net.SRV
+	naptr map[string][]*NAPTR
+
+	ttl     time.Duration
+	lookups atomic.Int32
+}
+
+func (r *fakeDNSResolver) LookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	ips, err := r.LookupIPAddr(ctx, host)
+	return ips, r.ttl, err
+}
+
+func (r *fakeDNSResolver) LookupSRVTTL(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+	_, records, err := r.LookupSRV(ctx, "", "", name)
+	return records, r.ttl, err
+}
+
+func (r *fakeDNSResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups.Add(1)
+	ips, exists := r.hosts[host]
+	if !exists {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	}
+	return addrs, nil
+}
+
+func (r *fakeDNSResolver) LookupIP(ctx context.Context, network string, host string) ([]net.IP, error) {
+	ips, exists := r.hosts[host]
+	if !exists {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+func (r *fakeDNSResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups.Add(1)
+	if service != "" || proto != "" {
+		name = "_" + service + "._" + proto + "." + name
+	}
+	records, exists := r.srv[name]
+	if !exists {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, records, nil
+}
+
+func (r *fakeDNSResolver) LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	r.lookups.Add(1)
+	records, exists := r.naptr[name]
+	if !exists {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func targetStrings(targets []ServerTarget) []string {
+	res := make([]string, 0, len(targets))
+	for _, t := range targets {
+		res = append(res, t.String())
+	}
+	return res
+}
+
+func TestServerResolver(t *testing.T) {
+	dns := &fakeDNSResolver{
+		hosts: map[string][]net.IP{
+			"sip1.example.com": {net.ParseIP("10.0.0.1")},
+			"sip2.example.com": {net.ParseIP("2001:db8::2"), net.ParseIP("10.0.0.2")},
+			"sip3.example.com": {net.ParseIP("10.0.0.3")},
+			"a.example.com":    {net.ParseIP("10.0.0.4")},
+		},
+		srv: map[string][]*net.SRV{
+			"_sips._tcp.example.com": {
+				{Target: "sip1.example.com.", Port: 5061, Priority: 10},
+			},
+			"_sip._udp.example.com": {
+				{Target: "sip3.example.com.", Port: 5080, Priority: 20},
+				{Target: "sip2.example.com.", Port: 5060, Priority: 10},
+			},
+			"_sip._tcp.example.com": {
+				{Target: ".", Port: 5060, Priority: 10},
+			},
+		},
+		naptr: map[string][]*NAPTR{
+			"example.com": {
+				{Order: 20, Preference: 10, Flags: "S", Service: "SIP+D2U", Replacement: "_sip._udp.example.com"},
+				{Order: 10, Preference: 10, Flags: "s", Service: "SIPS+D2T", Replacement: "_sips._tcp.example.com"},
+				{Order: 10, Preference: 5, Flags: "s", Service: "SIP+D2S", Replacement: "_sip._sctp.example.com"},
+			},
+		},
+	}
+	r := NewServerResolver(dns)
+	ctx := context.Background()
+
+	t.Run("NAPTR", func(t *testing.T) {
+		targets, err := r.Resolve(ctx, Uri{Scheme: "sip", Host: "example.com"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"tls:10.0.0.1:5061",
+			"udp:10.0.0.2:5060",
+			"udp:[2001:db8::2]:5060",
+			"udp:10.0.0.3:5080",
+		}, targetStrings(targets))
+		assert.Equal(t, "sip1.example.com", targets[0].Addr.Hostname)
+
+		targets, err = r.Resolve(ctx, Uri{Scheme: "sips", Host: "example.com"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tls:10.0.0.1:5061"}, targetStrings(targets))
+	})
+
+	t.Run("SRV", func(t *testing.T) {
+		// Transport is not selected with NAPTR when set
+		targets, err := r.Resolve(ctx, Uri{Scheme: "sip", Host: "example.com", UriParams: HeaderParams{{"transport", "udp"}}}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"udp:10.0.0.2:5060",
+			"udp:[2001:db8::2]:5060",
+			"udp:10.0.0.3:5080",
+		}, targetStrings(targets))
+
+		// Without NAPTR support all transports are queried
+		r := NewServerResolver(&struct{ DNSResolver }{dns})
+		targets, err = r.Resolve(ctx, Uri{Scheme: "sip", Host: "example.com"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"udp:10.0.0.2:5060",
+			"udp:[2001:db8::2]:5060",
+			"udp:10.0.0.3:5080",
+			"tls:10.0.0.1:5061",
+		}, targetStrings(targets))
+	})
+
+	t.Run("A", func(t *testing.T) {
+		targets, err := r.Resolve(ctx, Uri{Scheme: "sip", Host: "a.example.com"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"udp:10.0.0.4:5060"}, targetStrings(targets))
+
+		targets, err = r.Resolve(ctx, Uri{Scheme: "sips", Host: "a.example.com"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tls:10.0.0.4:5061"}, targetStrings(targets))
+
+		// Port present skips SRV
+		targets, err = r.Resolve(ctx, Uri{Scheme: "sip", Host: "sip3.example.com", Port: 5090}, "TCP")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tcp:10.0.0.3:5090"}, targetStrings(targets))
+
+		_, err = r.Resolve(ctx, Uri{Scheme: "sip", Host: "unknown.example.com"}, "")
+		require.Error(t, err)
+	})
+
+	t.Run("NumericIP", func(t *testing.T) {
+		targets, err := r.Resolve(ctx, Uri{Scheme: "sips", Host: "127.0.0.1", UriParams: HeaderParams{{"transport", "tcp"}}}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tls:127.0.0.1:5061"}, targetStrings(targets))
+
+		targets, err = r.Resolve(ctx, Uri{Scheme: "sip", Host: "[::1]", Port: 5070}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"udp:[::1]:5070"}, targetStrings(targets))
+	})
+
+	t.Run("Blacklist", func(t *testing.T) {
+		r := NewServerResolver(dns, WithServerResolverBlacklistTTL(50*time.Millisecond))
+		uri := Uri{Scheme: "sip", Host: "example.com", UriParams: HeaderParams{{"transport", "udp"}}}
+		targets, err := r.Resolve(ctx, uri, "")
+		require.NoError(t, err)
+
+		r.Blacklist(targets[0], 0)
+		assert.True(t, r.IsBlacklisted(targets[0]))
+		blacklisted, err := r.Resolve(ctx, uri, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"udp:[2001:db8::2]:5060",
+			"udp:10.0.0.3:5080",
+			"udp:10.0.0.2:5060",
+		}, targetStrings(blacklisted))
+
+		require.Eventually(t, func() bool { return !r.IsBlacklisted(targets[0]) }, time.Second, 10*time.Millisecond)
+		targets, err = r.Resolve(ctx, uri, "")
+		require.NoError(t, err)
+		assert.Equal(t, "udp:10.0.0.2:5060", targets[0].String())
+	})
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "c", Priority: 20, Weight: 0},
+		{Target: "b", Priority: 10, Weight: 1},
+		{Target: "a", Priority: 10, Weight: 100},
+		{Target: "d", Priority: 5, Weight: 0},
+	}
+
+	for range 20 {
+		ordered := orderSRV(records)
+		require.Len(t, ordered, 4)
+		assert.Equal(t, "d", ordered[0].Target)
+		assert.ElementsMatch(t, []string{"a", "b"}, []string{ordered[1].Target, ordered[2].Target})
+		assert.Equal(t, "c", ordered[3].Target)
+	}
+	// Original order must not be changed
+	assert.Equal(t, "c", records[0].Target)
+}
@@ -0,0 +1,116 @@
+package sip
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"net/netip"
+)
+
+// Minimal STUN (RFC 5389) support needed for SIP Outbound keep-alives over UDP.
+// https://datatracker.ietf.org/doc/html/rfc5626#section-4.4.2
+const (
+	stunHeaderSize  = 20
+	stunMagicCookie = 0x2112A442
+
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+
+	stunAttrXorMappedAddress = 0x0020
+)
+
+type stunTxID [12]byte
+
+func newStunTxID() stunTxID {
+	var id stunTxID
+	rand.Read(id[:])
+	return id
+}
+
+// isStunMessage checks is packet STUN message.
+// SIP message always starts with letter so first 2 zero bits and magic cookie are enough to demultiplex
+func isStunMessage(data []byte) bool {
+	if len(data) < stunHeaderSize || data[0]&0xC0 != 0 {
+		return false
+	}
+	if binary.BigEndian.Uint32(data[4:8]) != stunMagicCookie {
+		return false
+	}
+	return int(binary.BigEndian.Uint16(data[2:4]))+stunHeaderSize == len(data)
+}
+
+func parseStunMessage(data []byte) (typ uint16, id stunTxID, attrs []byte) {
+	typ = binary.BigEndian.Uint16(data[0:2])
+	copy(id[:], data[8:20])
+	return typ, id, data[stunHeaderSize:]
+}
+
+func stunMessage(typ uint16, id stunTxID, attrs []byte) []byte {
+	data := make([]byte, stunHeaderSize, stunHeaderSize+len(attrs))
+	binary.BigEndian.PutUint16(data[0:2], typ)
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(attrs)))
+	binary.BigEndian.PutUint32(data[4:8], stunMagicCookie)
+	copy(data[8:20], id[:])
+	return append(data, attrs...)
+}
+
+// stunXorAddress is used for encoding and decoding XOR-MAPPED-ADDRESS
+// https://datatracker.ietf.org/doc/html/rfc5389#section-15.2
+func stunXorAddress(ip []byte, id stunTxID) {
+	var key [16]byte
+	binary.BigEndian.PutUint32(key[0:4], stunMagicCookie)
+	copy(key[4:], id[:])
+	for i := range ip {
+		ip[i] ^= key[i]
+	}
+}
+
+func stunBindingSuccess(id stunTxID, raddr *net.UDPAddr) []byte {
+	ip := raddr.IP.To4()
+	family := byte(0x01)
+	if ip == nil {
+		ip = raddr.IP.To16()
+		family = 0x02
+	}
+	ip = append([]byte(nil), ip...)
+	stunXorAddress(ip, id)
+
+	attr := make([]byte, 8, 8+len(ip))
+	binary.BigEndian.PutUint16(attr[0:2], stunAttrXorMappedAddress)
+	binary.BigEndian.PutUint16(attr[2:4], uint16(4+len(ip)))
+	attr[5] = family
+	binary.BigEndian.PutUint16(attr[6:8], uint16(raddr.Port)^(stunMagicCookie>>16))
+	attr = append(attr, ip...)
+	return stunMessage(stunBindingResponse, id, attr)
+}
+
+// stunMappedAddress reads XOR-MAPPED-ADDRESS attribute from binding response
+func stunMappedAddress(attrs []byte, id stunTxID) (netip.AddrPort, bool) {
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:2])
+		length := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+length {
+			return netip.AddrPort{}, false
+		}
+		value := attrs[4 : 4+length]
+		// Attributes are padded to 4 bytes
+		attrs = attrs[min(len(attrs), 4+(length+3)&^3):]
+
+		if typ != stunAttrXorMappedAddress || length < 8 {
+			continue
+		}
+
+		ip := append([]byte(nil), value[4:]...)
+		if (value[1] == 0x01 && len(ip) != 4) || (value[1] == 0x02 && len(ip) != 16) {
+			return netip.AddrPort{}, false
+		}
+		stunXorAddress(ip, id)
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			return netip.AddrPort{}, false
+		}
+		port := binary.BigEndian.Uint16(value[2:4]) ^ (stunMagicCookie >> 16)
+		return netip.AddrPortFrom(addr, port), true
+	}
+	return netip.AddrPort{}, false
+}
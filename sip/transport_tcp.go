@@ -19,12 +19,14 @@ type TransportTCP struct {
 	log             *slog.Logger
 	connectionReuse bool
 	readFilter      TransportReadFilter
+	limiter         *RateLimiter
 
 	pool *connectionPool
 
 	DialerCreate func(laddr net.Addr) net.Dialer
 
 	onConnClose func(conn Connection)
+	keepAlive   ConnectionKeepAlive
 }
 
 func (t *TransportTCP) init(par *Parser) {
@@ -67,6 +69,10 @@ func (t *TransportTCP) Serve(l net.Listener, handler MessageHandler) error {
 			t.log.Debug("Fail to accept conenction", "error", err)
 			return err
 		}
+		if t.limiter != nil && !t.limiter.allowConn(t.Network(), conn.RemoteAddr().String()) {
+			conn.Close()
+			continue
+		}
 		t.initConnection(conn, conn.RemoteAddr().String(), handler)
 	}
 }
@@ -164,6 +170,20 @@ func (t *TransportTCP) readConnection(conn *TCPConnection, laddr string, raddr s
 
 	// Create stream parser context
 	par := t.parser.NewSIPStream()
+	// https://datatracker.ietf.org/doc/html/rfc5626#section-3.5.1
+	par.OnKeepAlive = func(crlf int) {
+		t.log.Debug("Keep alive CRLF received", "raddr", raddr)
+		if err := conn.readCRLF(crlf, conn); err != nil {
+			t.log.Error("Failed to pong keep alive", "error", err)
+		}
+	}
+
+	conn.touch()
+	if t.keepAlive.enabled() {
+		done := make(chan struct{})
+		defer close(done)
+		go conn.monitor(t.keepAlive, conn, t.pool, t.log, done)
+	}
 
 	for {
 		num, err := conn.Read(buf)
@@ -198,28 +218,26 @@ func (t *TransportTCP) readConnection(conn *TCPConnection, laddr string, raddr s
 			data = filtered
 		}
 
-		// Check is keep alive
-		datalen := len(data)
-		if datalen <= 4 {
-			// One or 2 CRLF
-			// https://datatracker.ietf.org/doc/html/rfc5626#section-3.5.1
-			if len(bytes.Trim(data, "\r\n")) == 0 {
-				t.log.Debug("Keep alive CRLF received")
-				if datalen == 4 {
-					// 2 CRLF is ping
-					if _, err := conn.Write(data[:2]); err != nil {
-						t.log.Error("Failed to pong keep alive", "error", err)
-						return
-					}
-				}
-				continue
-			}
-		}
-
 		// TODO fallback to parseFull if message size limit is set
 
 		// t.log.Debug().Str("raddr", raddr).Str("data", string(data)).Msg("new message")
-		t.parseStream(par, data, raddr, handler)
+		// Keep alive CRLF are handled by stream parser
+		abusive := false
+		t.parseStream(par, data, raddr, func(msg Message) {
+			conn.touch()
+			if t.limiter != nil {
+				ok, closeConn := t.limiter.allowMessage(t.Network(), raddr, msg)
+				abusive = abusive || closeConn
+				if !ok {
+					return
+				}
+			}
+			handler(msg)
+		})
+		if abusive {
+			t.log.Debug("Closing connection of limited source", "raddr", raddr)
+			return
+		}
 	}
 }
 
@@ -241,11 +259,16 @@ func (t *TransportTCP) parseStream(par *ParserStream, data []byte, src string, h
 
 type TCPConnection struct {
 	net.Conn
+	crlfKeepAlive
 
 	mu       sync.RWMutex
 	refcount int
 }
 
+func (c *TCPConnection) keepAlive(ctx context.Context, raddr string, timers Timers) error {
+	return c.ping(ctx, c)
+}
+
 func (c *TCPConnection) Ref(i int) int {
 	c.mu.Lock()
 	c.refcount += i
@@ -301,6 +324,7 @@ func (c *TCPConnection) Write(b []byte) (n int, err error) {
 }
 
 func (c *TCPConnection) WriteMsg(msg Message) error {
+	c.touch()
 	buf := bufPool.Get().(*bytes.Buffer)
 	defer bufPool.Put(buf)
 	buf.Reset()
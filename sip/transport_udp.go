@@ -11,6 +11,8 @@ import (
 )
 
 var (
+	// UDPMTUSize is default path MTU of UDP transport. Requests within 200 bytes of MTU are sent over TCP
+	// as per RFC 3261 18.1.1. Use WithTransportLayerUDPMTU to set it per transport layer.
 	UDPMTUSize = 1500
 
 	ErrUDPMTUCongestion = errors.New("size of packet larger than MTU")
@@ -24,6 +26,9 @@ type TransportUDP struct {
 	log             *slog.Logger
 	connectionReuse bool
 	readFilter      TransportReadFilter
+	limiter         *RateLimiter
+	// mtu is path MTU. If not set UDPMTUSize is used
+	mtu int
 }
 
 func (t *TransportUDP) init(par *Parser) {
@@ -42,6 +47,14 @@ func (t *TransportUDP) Network() string {
 	return "UDP"
 }
 
+// MTU returns path MTU used for checking message size
+func (t *TransportUDP) MTU() int {
+	if t.mtu > 0 {
+		return t.mtu
+	}
+	return UDPMTUSize
+}
+
 func (t *TransportUDP) Close() error {
 	return t.pool.Clear()
 	// Closing listeners is caller thing.
@@ -57,6 +70,7 @@ func (t *TransportUDP) Serve(conn net.PacketConn, handler MessageHandler) error
 		PacketConn: conn,
 		PacketAddr: conn.LocalAddr().String(),
 		Listener:   true,
+		mtu:        t.mtu,
 	}
 
 	t.pool.Add(c.PacketAddr, c)
@@ -104,6 +118,7 @@ func (t *TransportUDP) createConnection(ctx context.Context, laddr Addr, raddr A
 			PacketAddr: udpconn.LocalAddr().String(),
 			// 1 ref for current return , 2 ref for reader
 			refcount: 2 + TransportIdleConnection,
+			mtu:      t.mtu,
 		}
 		t.log.Debug("New connection", "raddr", addr)
 		go t.readUDPConnection(c, addr, c.PacketAddr, handler)
@@ -174,6 +189,15 @@ func (t *TransportUDP) readListenerConnection(conn *UDPConnection, laddr string,
 			data = filtered
 		}
 
+		if t.limiter != nil && !t.limiter.allowPacket(t.Network(), rastr, data) {
+			continue
+		}
+
+		if isStunMessage(data) {
+			t.handleStun(conn, data, raddr)
+			continue
+		}
+
 		if lastRaddr != rastr {
 			// In most cases we are in single connection mode so no need to keep adding in pool
 			// In case of server and multiple UDP listeners, this makes sure right one is used
@@ -214,6 +238,27 @@ func (t *TransportUDP) readListenerConnection(conn *UDPConnection, laddr string,
 	}
 } */
 
+// handleStun responds to STUN binding requests and passes binding responses to keep alive.
+// https://datatracker.ietf.org/doc/html/rfc5626#section-8
+func (t *TransportUDP) handleStun(conn *UDPConnection, data []byte, raddr net.Addr) {
+	typ, id, attrs := parseStunMessage(data)
+	switch typ {
+	case stunBindingRequest:
+		udpAddr, ok := raddr.(*net.UDPAddr)
+		if !ok {
+			return
+		}
+		if _, err := conn.WriteTo(stunBindingSuccess(id, udpAddr), raddr); err != nil {
+			t.log.Error("Failed to respond STUN binding request", "raddr", raddr.String(), "error", err)
+		}
+	case stunBindingResponse:
+		mapped, _ := stunMappedAddress(attrs, id)
+		conn.stunResponse(id, mapped)
+	default:
+		t.log.Debug("Unsupported STUN message", "type", typ)
+	}
+}
+
 func (t *TransportUDP) parseAndHandle(data []byte, src string, handler MessageHandler) {
 	// Check is keep alive
 	if len(data) <= 4 {
@@ -243,6 +288,13 @@ type UDPConnection struct {
 
 	mu       sync.RWMutex
 	refcount int
+	mtu      int
+
+	stunKeepAlive
+}
+
+func (c *UDPConnection) keepAlive(ctx context.Context, raddr string, timers Timers) error {
+	return c.ping(ctx, raddr, timers, c.WriteTo)
 }
 
 func (c *UDPConnection) close() error {
@@ -317,6 +369,15 @@ func (c *UDPConnection) WriteTo(b []byte, addr net.Addr) (n int, err error) {
 	return n, err
 }
 
+// maxMessageSize is message size limit of congestion controlled transport, RFC 3261 18.1.1
+func (c *UDPConnection) maxMessageSize() int {
+	mtu := c.mtu
+	if mtu <= 0 {
+		mtu = UDPMTUSize
+	}
+	return mtu - 200
+}
+
 func (c *UDPConnection) WriteMsg(msg Message) error {
 	buf := bufPool.Get().(*bytes.Buffer)
 	defer bufPool.Put(buf)
@@ -324,8 +385,11 @@ func (c *UDPConnection) WriteMsg(msg Message) error {
 	msg.StringWrite(buf)
 	data := buf.Bytes()
 
-	if len(data) > UDPMTUSize-200 {
-		return ErrUDPMTUCongestion
+	if len(data) > c.maxMessageSize() {
+		// Request which failed to be sent over TCP is allowed up to max datagram size
+		if req, ok := msg.(*Request); !ok || !req.udpLarge {
+			return ErrUDPMTUCongestion
+		}
 	}
 
 	var n int
@@ -0,0 +1,140 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// streamTransport is stream transport with custom dialer. It reuses TCP stream parsing and connection handling
+type streamTransport struct {
+	*TransportTCP
+
+	dial func(ctx context.Context, raddr Addr) (net.Conn, error)
+	// accepted can wrap accepted connection
+	accepted func(conn net.Conn) net.Conn
+}
+
+func newStreamTransport(network string, par *Parser) *streamTransport {
+	t := &streamTransport{
+		TransportTCP: &TransportTCP{
+			log:             DefaultLogger().With("caller", "Transport<"+NetworkToUpper(network)+">"),
+			connectionReuse: true,
+		},
+	}
+	t.TransportTCP.init(par)
+	t.transport = NetworkToUpper(network)
+	return t
+}
+
+func (t *streamTransport) String() string {
+	return "Transport<" + t.transport + ">"
+}
+
+// OnConnectionClose implements TransportConnectionNotifier
+func (t *streamTransport) OnConnectionClose(h func(conn Connection)) {
+	t.onConnClose = h
+}
+
+func (t *streamTransport) setRateLimiter(rl *RateLimiter) {
+	t.limiter = rl
+}
+
+// Serve accepts connections on listener
+func (t *streamTransport) Serve(l net.Listener, handler MessageHandler) error {
+	t.log.Debug("begin listening on", "network", t.Network(), "laddr", l.Addr().String())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			t.log.Debug("Fail to accept conenction", "error", err)
+			return err
+		}
+		if t.accepted != nil {
+			conn = t.accepted(conn)
+		}
+		if t.limiter != nil && !t.limiter.allowConn(t.Network(), conn.RemoteAddr().String()) {
+			conn.Close()
+			continue
+		}
+
+		// Accepted connections share listener local address, so only remote address is used as key
+		raddr := conn.RemoteAddr().String()
+		t.log.Debug("New connection", "raddr", raddr)
+		c := &TCPConnection{
+			Conn:     conn,
+			refcount: 1 + TransportIdleConnection,
+		}
+		t.pool.Add(raddr, c)
+		go t.readConnection(c, raddr, raddr, handler)
+	}
+}
+
+func (t *streamTransport) CreateConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error) {
+	isNew := false
+	conn, err := t.pool.addSingleflight(raddr, laddr, t.connectionReuse, func() (Connection, error) {
+		t.log.Debug("Dialing new connection", "raddr", raddr.String())
+		conn, err := t.dial(ctx, raddr)
+		if err != nil {
+			return nil, fmt.Errorf("%s dial err=%w", t, err)
+		}
+
+		c := &TCPConnection{
+			Conn:     conn,
+			refcount: 2 + TransportIdleConnection, // 1 returning + 1 reading + Idle
+		}
+		isNew = true
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := conn.(*TCPConnection)
+	if isNew {
+		go t.readConnection(c, c.LocalAddr().String(), raddr.String(), handler)
+	}
+	return c, nil
+}
+
+// TransportUnix is stream transport over unix domain sockets, useful for talking to local sidecar.
+// It must be registered on transport layer with RegisterTransport under network "unix".
+// Request destination is socket path, which can be set with SetDestination or mapped with DialPath.
+// Local address of connection is not host:port, so Via sent-by is random .invalid host unless set by client.
+type TransportUnix struct {
+	*streamTransport
+
+	// DialPath returns socket path for remote address. Default is raddr Hostname
+	DialPath func(raddr Addr) string
+}
+
+// NewTransportUnix creates unix socket transport
+func NewTransportUnix(par *Parser) *TransportUnix {
+	t := &TransportUnix{
+		streamTransport: newStreamTransport("unix", par),
+		DialPath: func(raddr Addr) string {
+			return raddr.Hostname
+		},
+	}
+	t.dial = func(ctx context.Context, raddr Addr) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", t.DialPath(raddr))
+		if err != nil {
+			return nil, err
+		}
+		// Client socket is unnamed, so it gets unique name to be distinguished in connection pool
+		return &unixConn{Conn: conn, laddr: &net.UnixAddr{Name: "@" + GenerateTagN(16), Net: "unix"}, raddr: conn.RemoteAddr()}, nil
+	}
+	t.accepted = func(conn net.Conn) net.Conn {
+		return &unixConn{Conn: conn, laddr: conn.LocalAddr(), raddr: &net.UnixAddr{Name: "@" + GenerateTagN(16), Net: "unix"}}
+	}
+	return t
+}
+
+type unixConn struct {
+	net.Conn
+	laddr net.Addr
+	raddr net.Addr
+}
+
+func (c *unixConn) LocalAddr() net.Addr  { return c.laddr }
+func (c *unixConn) RemoteAddr() net.Addr { return c.raddr }
@@ -0,0 +1,26 @@
+package sip
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportUnix(t *testing.T) {
+	server := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer server.Close()
+	client := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer client.Close()
+	require.NoError(t, server.RegisterTransport("unix", NewTransportUnix(NewParser())))
+	require.NoError(t, client.RegisterTransport("unix", NewTransportUnix(NewParser())))
+
+	path := filepath.Join(t.TempDir(), "sip.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+	go server.Serve("unix", l)
+
+	testStreamTransportExchange(t, "unix", server, client, path)
+}
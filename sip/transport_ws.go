@@ -28,6 +28,7 @@ type TransportWS struct {
 	log        *slog.Logger
 	transport  string
 	readFilter TransportReadFilter
+	limiter    *RateLimiter
 
 	connectionReuse bool
 
@@ -41,6 +42,7 @@ type TransportWS struct {
 	DialURI func(host string) string
 
 	onConnClose func(conn Connection)
+	keepAlive   ConnectionKeepAlive
 }
 
 func newWSTransport(par *Parser) *TransportWS {
@@ -136,6 +138,10 @@ func (t *TransportWS) Serve(l net.Listener, handler MessageHandler) error {
 		}
 
 		raddr := conn.RemoteAddr().String()
+		if t.limiter != nil && !t.limiter.allowConn(t.Network(), raddr) {
+			conn.Close()
+			continue
+		}
 
 		log.Debug("New connection accept", "addr", raddr)
 
@@ -190,6 +196,13 @@ func (t *TransportWS) readConnection(conn *WSConnection, laddr string, raddr str
 	// Create stream parser context
 	par := t.parser.NewSIPStream()
 
+	conn.touch()
+	if t.keepAlive.enabled() {
+		done := make(chan struct{})
+		defer close(done)
+		go conn.monitor(t.keepAlive, conn, t.pool, t.log, done)
+	}
+
 	for {
 		num, err := conn.Read(buf)
 		if err != nil {
@@ -236,11 +249,30 @@ func (t *TransportWS) readConnection(conn *WSConnection, laddr string, raddr str
 			//One or 2 CRLF
 			if len(bytes.Trim(data, "\r\n")) == 0 {
 				log.Debug("Keep alive CRLF received")
+				if err := conn.readCRLF(len(data)/2, conn); err != nil {
+					log.Error("Failed to pong keep alive", "error", err)
+					return
+				}
 				continue
 			}
 		}
 
-		t.parseStream(par, data, raddr, handler)
+		conn.touch()
+		abusive := false
+		t.parseStream(par, data, raddr, func(msg Message) {
+			if t.limiter != nil {
+				ok, closeConn := t.limiter.allowMessage(t.Network(), raddr, msg)
+				abusive = abusive || closeConn
+				if !ok {
+					return
+				}
+			}
+			handler(msg)
+		})
+		if abusive {
+			log.Debug("Closing connection of limited source", "raddr", raddr)
+			return
+		}
 	}
 
 }
@@ -314,12 +346,17 @@ func (t *TransportWS) CreateConnection(ctx context.Context, laddr Addr, raddr Ad
 
 type WSConnection struct {
 	net.Conn
+	crlfKeepAlive
 
 	clientSide bool
 	mu         sync.RWMutex
 	refcount   int
 }
 
+func (c *WSConnection) keepAlive(ctx context.Context, raddr string, timers Timers) error {
+	return c.ping(ctx, c)
+}
+
 func (c *WSConnection) Ref(i int) int {
 	c.mu.Lock()
 	c.refcount += i
@@ -446,6 +483,7 @@ func (c *WSConnection) Write(b []byte) (n int, err error) {
 }
 
 func (c *WSConnection) WriteMsg(msg Message) error {
+	c.touch()
 	buf := bufPool.Get().(*bytes.Buffer)
 	defer bufPool.Put(buf)
 	buf.Reset()
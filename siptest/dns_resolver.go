@@ -0,0 +1,94 @@
+package siptest
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// DNSResolver is in memory DNS resolver implementing sip.DNSResolver, sip.DNSNAPTRResolver and sip.DNSTTLResolver.
+// Records are looked up by name without trailing dot. SRV records are keyed by full name
+// like _sip._udp.example.com
+type DNSResolver struct {
+	Hosts map[string][]net.IP
+	SRV   map[string][]*net.SRV
+	NAPTR map[string][]*sip.NAPTR
+	// TTL is returned for all records
+	TTL time.Duration
+}
+
+func (r *DNSResolver) LookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	ips, err := r.LookupIPAddr(ctx, host)
+	return ips, r.TTL, err
+}
+
+func (r *DNSResolver) LookupSRVTTL(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+	_, records, err := r.LookupSRV(ctx, "", "", name)
+	return records, r.TTL, err
+}
+
+func (r *DNSResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, exists := r.Hosts[dnsName(host)]
+	if !exists {
+		return nil, dnsNotFound(host)
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	}
+	return addrs, nil
+}
+
+func (r *DNSResolver) LookupIP(ctx context.Context, network string, host string) ([]net.IP, error) {
+	ips, exists := r.Hosts[dnsName(host)]
+	if !exists {
+		return nil, dnsNotFound(host)
+	}
+
+	res := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		switch {
+		case network == "ip4" && ip.To4() == nil:
+		case network == "ip6" && ip.To4() != nil:
+		default:
+			res = append(res, ip)
+		}
+	}
+	if len(res) == 0 {
+		return nil, dnsNotFound(host)
+	}
+	return res, nil
+}
+
+func (r *DNSResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+	target = dnsName(target)
+
+	records, exists := r.SRV[target]
+	if !exists {
+		return "", nil, dnsNotFound(target)
+	}
+	return target, records, nil
+}
+
+func (r *DNSResolver) LookupNAPTR(ctx context.Context, name string) ([]*sip.NAPTR, error) {
+	records, exists := r.NAPTR[dnsName(name)]
+	if !exists {
+		return nil, dnsNotFound(name)
+	}
+	return records, nil
+}
+
+func dnsName(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
+
+func dnsNotFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
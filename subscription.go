@@ -0,0 +1,67 @@
+package sipgo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	ErrSubscriptionBadEvent         = errors.New("bad event")
+	ErrSubscriptionIntervalTooBrief = errors.New("subscription interval too brief")
+	ErrSubscriptionRejected         = errors.New("subscription rejected")
+)
+
+const (
+	SubscriptionDefaultExpires = 3600 * time.Second
+)
+
+// ErrSubscriptionTerminated is cause of subscription termination. Reason is one of sip.SubscriptionReason values
+// or empty if subscription is terminated locally without reason
+type ErrSubscriptionTerminated struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e ErrSubscriptionTerminated) Error() string {
+	if e.Reason == "" {
+		return "subscription terminated"
+	}
+	return fmt.Sprintf("subscription terminated with reason: %s", e.Reason)
+}
+
+// EventPackage defines event package like presence, dialog or message-summary built on top of
+// subscriptions. It is used by Notifier to authorize subscriptions and build NOTIFY body.
+// https://datatracker.ietf.org/doc/html/rfc6665#section-5
+type EventPackage interface {
+	// Name is event package name matched with Event header
+	Name() string
+	// Subscribe is called on initial and refreshing SUBSCRIBE. It returns subscription state
+	// sip.SubscriptionStateActive or sip.SubscriptionStatePending.
+	// Returning error rejects SUBSCRIBE with 403 Forbidden
+	Subscribe(sub *NotifierSubscription, req *sip.Request) (string, error)
+	// Body returns current resource state as NOTIFY body. Nil body means NOTIFY is sent without body
+	Body(sub *NotifierSubscription) (contentType string, body []byte, err error)
+}
+
+// subscriptionExpires reads Expires header. Returns def if header does not exist
+func subscriptionExpires(msg sip.Message, def time.Duration) (time.Duration, error) {
+	hdrs := msg.GetHeaders("Expires")
+	if len(hdrs) == 0 {
+		return def, nil
+	}
+	sec, err := strconv.ParseUint(strings.TrimSpace(hdrs[0].Value()), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Expires header: %w", err)
+	}
+	return time.Duration(sec) * time.Second, nil
+}
+
+func subscriptionExpiresHeader(expires time.Duration) *sip.ExpiresHeader {
+	h := sip.ExpiresHeader(expires.Seconds())
+	return &h
+}
@@ -0,0 +1,430 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+type NotifierOption func(n *Notifier)
+
+// WithNotifierEventPackage adds supported event package. SUBSCRIBE for other events is rejected with 489 Bad Event
+func WithNotifierEventPackage(pkg EventPackage) NotifierOption {
+	return func(n *Notifier) {
+		n.packages[pkg.Name()] = pkg
+	}
+}
+
+// WithNotifierExpires sets default, minimum and maximum subscription expiration.
+// Requests below min are rejected with 423 Interval Too Brief, above max are shortened.
+func WithNotifierExpires(def time.Duration, min time.Duration, max time.Duration) NotifierOption {
+	return func(n *Notifier) {
+		n.defaultExpires = def
+		n.minExpires = min
+		n.maxExpires = max
+	}
+}
+
+// Notifier handles SUBSCRIBE requests and manages subscription dialogs on notifier side.
+// https://datatracker.ietf.org/doc/html/rfc6665#section-4.2
+//
+// Usage:
+//
+//	n := NewNotifier(client, contactHDR, WithNotifierEventPackage(presence))
+//	srv.OnSubscribe(func(req *sip.Request, tx sip.ServerTransaction) {
+//		sub, err := n.ReadSubscribe(req, tx)
+//	})
+//
+// Experimental
+type Notifier struct {
+	ua             DialogUA
+	packages       map[string]EventPackage
+	defaultExpires time.Duration
+	minExpires     time.Duration
+	maxExpires     time.Duration
+	log            *slog.Logger
+
+	subscriptions sync.Map
+}
+
+func NewNotifier(client *Client, contactHDR sip.ContactHeader, options ...NotifierOption) *Notifier {
+	n := &Notifier{
+		ua: DialogUA{
+			Client:     client,
+			ContactHDR: contactHDR,
+		},
+		packages:       make(map[string]EventPackage),
+		defaultExpires: SubscriptionDefaultExpires,
+		minExpires:     60 * time.Second,
+		maxExpires:     24 * time.Hour,
+		log:            client.log.With("caller", "Notifier"),
+	}
+
+	for _, o := range options {
+		o(n)
+	}
+	return n
+}
+
+// AllowEvents returns Allow-Events header with supported event packages
+func (n *Notifier) AllowEvents() *sip.AllowEventsHeader {
+	h := make(sip.AllowEventsHeader, 0, len(n.packages))
+	for name := range n.packages {
+		h = append(h, name)
+	}
+	slices.Sort(h)
+	return &h
+}
+
+// Subscriptions returns active and pending subscriptions for event package
+func (n *Notifier) Subscriptions(event string) []*NotifierSubscription {
+	subs := []*NotifierSubscription{}
+	n.subscriptions.Range(func(key, value any) bool {
+		sub := value.(*NotifierSubscription)
+		if sub.Event.Event == event {
+			subs = append(subs, sub)
+		}
+		return true
+	})
+	return subs
+}
+
+// MatchSubscription finds subscription for in dialog request
+func (n *Notifier) MatchSubscription(req *sip.Request) (*NotifierSubscription, error) {
+	id, err := sip.DialogIDFromRequestUAS(req)
+	if err != nil {
+		return nil, errors.Join(ErrDialogOutsideDialog, err)
+	}
+
+	val, ok := n.subscriptions.Load(id)
+	if !ok {
+		return nil, ErrDialogDoesNotExists
+	}
+	return val.(*NotifierSubscription), nil
+}
+
+// ReadSubscribe should read from your OnSubscribe handler.
+// It creates new subscription or refreshes existing one and sends NOTIFY with current state.
+// SUBSCRIBE with Expires 0 terminates subscription.
+func (n *Notifier) ReadSubscribe(req *sip.Request, tx sip.ServerTransaction) (*NotifierSubscription, error) {
+	ev := req.Event()
+	var pkg EventPackage
+	if ev != nil {
+		pkg = n.packages[ev.Event]
+	}
+	if pkg == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadEvent, "Bad Event", nil)
+		res.AppendHeader(n.AllowEvents())
+		return nil, errors.Join(ErrSubscriptionBadEvent, tx.Respond(res))
+	}
+
+	expires, err := subscriptionExpires(req, n.defaultExpires)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - Invalid Expires", nil)
+		return nil, errors.Join(err, tx.Respond(res))
+	}
+
+	if expires > 0 && expires < n.minExpires {
+		res := sip.NewResponseFromRequest(req, sip.StatusIntervalToBrief, "Interval Too Brief", nil)
+		res.AppendHeader(sip.NewHeader("Min-Expires", strconv.Itoa(int(n.minExpires.Seconds()))))
+		return nil, errors.Join(ErrSubscriptionIntervalTooBrief, tx.Respond(res))
+	}
+	expires = min(expires, n.maxExpires)
+
+	if to := req.To(); to != nil && to.Params.Has("tag") {
+		// Refresh within existing subscription dialog
+		sub, err := n.MatchSubscription(req)
+		if err != nil {
+			res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+			return nil, errors.Join(err, tx.Respond(res))
+		}
+		return sub, sub.readRefresh(req, tx, expires)
+	}
+
+	if req.Contact() == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - Missing Contact", nil)
+		return nil, errors.Join(ErrDialogInviteNoContact, tx.Respond(res))
+	}
+
+	// As we are modifying request we need to perform clone to avoid transaction races
+	subReq := req.Clone()
+	subReq.To().Params.Add("tag", sip.GenerateTagN(16))
+	id, err := sip.DialogIDFromRequestUAS(subReq)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &NotifierSubscription{
+		ID:               id,
+		SubscribeRequest: subReq,
+		Event:            ev.Clone(),
+		n:                n,
+		pkg:              pkg,
+		remoteTarget:     *subReq.Contact().Address.Clone(),
+	}
+	sub.dialog = &DialogServerSession{
+		Dialog: Dialog{
+			ID:            id,
+			InviteRequest: subReq,
+		},
+		ua: &n.ua,
+	}
+	sub.dialog.Init()
+
+	state, err := pkg.Subscribe(sub, subReq)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusForbidden, "Forbidden", nil)
+		return nil, errors.Join(ErrSubscriptionRejected, err, tx.Respond(res))
+	}
+	sub.setState(state)
+
+	res := sip.NewResponseFromRequest(subReq, sip.StatusOK, "OK", nil)
+	res.AppendHeader(subscriptionExpiresHeader(expires))
+	res.AppendHeader(&n.ua.ContactHDR)
+	sub.dialog.InviteResponse = res
+	if err := tx.Respond(res); err != nil {
+		return nil, err
+	}
+	sub.dialog.setState(sip.DialogStateConfirmed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.ua.Client.timers().TimerF)
+	defer cancel()
+	if expires == 0 {
+		// Fetching current state. Subscription is terminated with first NOTIFY
+		// https://datatracker.ietf.org/doc/html/rfc6665#section-4.4.3
+		return sub, sub.Terminate(ctx, sip.SubscriptionReasonTimeout)
+	}
+
+	n.subscriptions.Store(id, sub)
+	sub.resetExpiry(expires)
+
+	// Initial NOTIFY must be sent immediately after accepting subscription
+	return sub, sub.Notify(ctx)
+}
+
+// NotifierSubscription is subscription dialog on notifier side
+type NotifierSubscription struct {
+	ID string
+	// SubscribeRequest is SUBSCRIBE that created subscription with added our To tag.
+	// Use it only as read only
+	SubscribeRequest *sip.Request
+	Event            *sip.EventHeader
+
+	n      *Notifier
+	pkg    EventPackage
+	dialog *DialogServerSession
+
+	// notifyMu serializes NOTIFY requests within dialog
+	notifyMu sync.Mutex
+
+	mu           sync.Mutex
+	state        string
+	remoteTarget sip.Uri
+	expiresAt    time.Time
+	timer        *time.Timer
+}
+
+// State returns subscription state active, pending or terminated
+func (s *NotifierSubscription) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Expires returns time left until subscription expires
+func (s *NotifierSubscription) Expires() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return max(time.Until(s.expiresAt), 0)
+}
+
+// Context is canceled when subscription is terminated
+func (s *NotifierSubscription) Context() context.Context {
+	return s.dialog.Context()
+}
+
+// Err returns error that caused subscription termination
+func (s *NotifierSubscription) Err() error {
+	return s.dialog.err()
+}
+
+// Activate moves pending subscription to active state and notifies subscriber
+func (s *NotifierSubscription) Activate(ctx context.Context) error {
+	s.mu.Lock()
+	if s.state == sip.SubscriptionStateTerminated {
+		s.mu.Unlock()
+		return ErrSubscriptionTerminated{}
+	}
+	s.state = sip.SubscriptionStateActive
+	s.mu.Unlock()
+	return s.Notify(ctx)
+}
+
+// Notify sends NOTIFY with current resource state returned by event package
+func (s *NotifierSubscription) Notify(ctx context.Context) error {
+	s.mu.Lock()
+	if s.state == sip.SubscriptionStateTerminated {
+		s.mu.Unlock()
+		return ErrSubscriptionTerminated{}
+	}
+	h := &sip.SubscriptionStateHeader{State: s.state, Params: sip.NewParams()}
+	h.Params.Add("expires", strconv.Itoa(int(max(time.Until(s.expiresAt), 0).Seconds())))
+	s.mu.Unlock()
+
+	return s.notify(ctx, h)
+}
+
+// Terminate sends final NOTIFY with terminated state and reason. Reason is one of sip.SubscriptionReason values
+// or empty. Subscription is removed even if NOTIFY fails
+func (s *NotifierSubscription) Terminate(ctx context.Context, reason string) error {
+	s.mu.Lock()
+	if s.state == sip.SubscriptionStateTerminated {
+		s.mu.Unlock()
+		return nil
+	}
+	s.state = sip.SubscriptionStateTerminated
+	s.mu.Unlock()
+
+	h := &sip.SubscriptionStateHeader{State: sip.SubscriptionStateTerminated}
+	if reason != "" {
+		h.Params = sip.NewParams()
+		h.Params.Add("reason", reason)
+	}
+
+	s.end(ErrSubscriptionTerminated{Reason: reason})
+	return s.notify(ctx, h)
+}
+
+func (s *NotifierSubscription) notify(ctx context.Context, state *sip.SubscriptionStateHeader) error {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+
+	s.mu.Lock()
+	req := sip.NewRequest(sip.NOTIFY, *s.remoteTarget.Clone())
+	s.mu.Unlock()
+	req.AppendHeader(s.Event.Clone())
+	req.AppendHeader(state)
+
+	contentType, body, err := s.pkg.Body(s)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.AppendHeader(sip.NewHeader("Content-Type", contentType))
+		req.SetBody(body)
+	}
+
+	res, err := s.dialog.Do(ctx, req)
+	if err != nil {
+		if ctx.Err() == nil {
+			// Timeout or transport error removes subscription
+			// https://datatracker.ietf.org/doc/html/rfc6665#section-4.2.2
+			s.end(err)
+		}
+		return err
+	}
+
+	if !res.IsSuccess() {
+		if res.StatusCode == sip.StatusCallTransactionDoesNotExists || res.StatusCode == sip.StatusRequestTimeout {
+			s.end(&ErrDialogResponse{Res: res})
+		}
+		return &ErrDialogResponse{Res: res}
+	}
+	return nil
+}
+
+// readRefresh handles SUBSCRIBE within subscription dialog
+func (s *NotifierSubscription) readRefresh(req *sip.Request, tx sip.ServerTransaction, expires time.Duration) error {
+	if err := s.dialog.ReadRequest(req, tx); err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusInternalServerError, "Server Internal Error", nil)
+		return errors.Join(err, tx.Respond(res))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.n.ua.Client.timers().TimerF)
+	defer cancel()
+
+	if expires == 0 {
+		// Unsubscribe
+		res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		res.AppendHeader(subscriptionExpiresHeader(0))
+		res.AppendHeader(&s.n.ua.ContactHDR)
+		if err := tx.Respond(res); err != nil {
+			return err
+		}
+		return s.Terminate(ctx, sip.SubscriptionReasonTimeout)
+	}
+
+	state, err := s.pkg.Subscribe(s, req)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusForbidden, "Forbidden", nil)
+		return errors.Join(ErrSubscriptionRejected, err, tx.Respond(res), s.Terminate(ctx, sip.SubscriptionReasonRejected))
+	}
+
+	s.setState(state)
+	if cont := req.Contact(); cont != nil {
+		// Target refresh
+		s.mu.Lock()
+		s.remoteTarget = *cont.Address.Clone()
+		s.mu.Unlock()
+	}
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	res.AppendHeader(subscriptionExpiresHeader(expires))
+	res.AppendHeader(&s.n.ua.ContactHDR)
+	if err := tx.Respond(res); err != nil {
+		return err
+	}
+
+	s.resetExpiry(expires)
+	return s.Notify(ctx)
+}
+
+func (s *NotifierSubscription) setState(state string) {
+	if state == "" {
+		state = sip.SubscriptionStateActive
+	}
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+func (s *NotifierSubscription) resetExpiry(expires time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == sip.SubscriptionStateTerminated {
+		return
+	}
+
+	s.expiresAt = time.Now().Add(expires)
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(expires, s.onExpire)
+}
+
+func (s *NotifierSubscription) onExpire() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.n.ua.Client.timers().TimerF)
+	defer cancel()
+	if err := s.Terminate(ctx, sip.SubscriptionReasonTimeout); err != nil {
+		s.n.log.Info("Subscription expired NOTIFY failed", "error", err)
+	}
+}
+
+// end terminates subscription locally without sending NOTIFY
+func (s *NotifierSubscription) end(cause error) {
+	s.mu.Lock()
+	s.state = sip.SubscriptionStateTerminated
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+
+	s.n.subscriptions.Delete(s.ID)
+	s.dialog.endWithCause(cause)
+}
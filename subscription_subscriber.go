@@ -0,0 +1,503 @@
+package sipgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+type SubscribeOptions struct {
+	// Expires requested from notifier. Default is SubscriptionDefaultExpires
+	Expires time.Duration
+
+	// OnNotify is called for every NOTIFY received within subscription
+	OnNotify func(sub *SubscriberSubscription, req *sip.Request)
+
+	// OnFork is called when NOTIFY from other notifier creates new subscription due to forked SUBSCRIBE.
+	// Forked subscription is rejected with 481 if OnFork is nil or returns false.
+	// https://datatracker.ietf.org/doc/html/rfc6665#section-4.1.2.4
+	OnFork func(sub *SubscriberSubscription) bool
+
+	// For digest authentication
+	Username string
+	Password string
+}
+
+// Subscriber creates subscriptions and handles NOTIFY requests on subscriber side.
+// https://datatracker.ietf.org/doc/html/rfc6665#section-4.1
+//
+// Usage:
+//
+//	s := NewSubscriber(client, contactHDR)
+//	srv.OnNotify(func(req *sip.Request, tx sip.ServerTransaction) {
+//		s.ReadNotify(req, tx)
+//	})
+//	sub, err := s.Subscribe(ctx, recipient, "presence", SubscribeOptions{})
+//
+// Experimental
+type Subscriber struct {
+	ua  DialogUA
+	log *slog.Logger
+
+	subscriptions sync.Map
+	// pending are sent SUBSCRIBE requests that can still create subscription with NOTIFY
+	pending sync.Map
+}
+
+func NewSubscriber(client *Client, contactHDR sip.ContactHeader) *Subscriber {
+	return &Subscriber{
+		ua: DialogUA{
+			Client:     client,
+			ContactHDR: contactHDR,
+		},
+		log: client.log.With("caller", "Subscriber"),
+	}
+}
+
+// subscribeGroup tracks all subscriptions created by single SUBSCRIBE
+type subscribeGroup struct {
+	req   *sip.Request
+	event *sip.EventHeader
+	opts  SubscribeOptions
+
+	mu      sync.Mutex
+	dialogs map[string]*SubscriberSubscription
+}
+
+func subscribeGroupKey(callID string, localTag string) string {
+	return callID + sip.TxSeperator + localTag
+}
+
+// Subscribe sends SUBSCRIBE for event package and waits final response.
+func (s *Subscriber) Subscribe(ctx context.Context, recipient sip.Uri, event string, opts SubscribeOptions, headers ...sip.Header) (*SubscriberSubscription, error) {
+	req := sip.NewRequest(sip.SUBSCRIBE, recipient)
+	if recipient.UriParams != nil {
+		if tran, _ := recipient.UriParams.Get("transport"); tran != "" {
+			req.SetTransport(tran)
+		}
+	}
+
+	req.AppendHeader(&sip.EventHeader{Event: event})
+	for _, h := range headers {
+		req.AppendHeader(h)
+	}
+	return s.WriteSubscribe(ctx, req, opts)
+}
+
+// WriteSubscribe sends custom SUBSCRIBE request. Request must have Event header.
+// Subscription is returned on 2xx response or in case NOTIFY created it before.
+func (s *Subscriber) WriteSubscribe(ctx context.Context, req *sip.Request, opts SubscribeOptions) (*SubscriberSubscription, error) {
+	ev := req.Event()
+	if ev == nil {
+		return nil, fmt.Errorf("missing Event header")
+	}
+
+	if opts.Expires <= 0 {
+		opts.Expires = SubscriptionDefaultExpires
+	}
+	if req.GetHeader("Expires") == nil {
+		req.AppendHeader(subscriptionExpiresHeader(opts.Expires))
+	}
+	expires, err := subscriptionExpires(req, opts.Expires)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Contact() == nil {
+		req.AppendHeader(&s.ua.ContactHDR)
+	}
+
+	// Build request before sending as NOTIFY can arrive before response
+	if err := clientRequestBuildReq(s.ua.Client, req); err != nil {
+		return nil, err
+	}
+	tag, _ := req.From().Params.Get("tag")
+	key := subscribeGroupKey(req.CallID().Value(), tag)
+	g := &subscribeGroup{
+		req:     req,
+		event:   ev,
+		opts:    opts,
+		dialogs: make(map[string]*SubscriberSubscription),
+	}
+	s.pending.Store(key, g)
+	defer func() {
+		// Forked NOTIFY can create subscriptions until 64*T1 after final response
+		time.AfterFunc(64*s.ua.Client.timers().T1, func() { s.pending.Delete(key) })
+	}()
+
+	res, err := s.ua.Client.Do(ctx, req)
+	if err == nil && (res.StatusCode == sip.StatusUnauthorized || res.StatusCode == sip.StatusProxyAuthRequired) && opts.Password != "" {
+		res, err = s.ua.Client.DoDigestAuth(ctx, req, res, DigestAuth{
+			Username: opts.Username,
+			Password: opts.Password,
+		})
+	}
+	if err != nil {
+		// NOTIFY confirms subscription even if response is lost
+		if sub := g.first(); sub != nil {
+			return sub, nil
+		}
+		return nil, err
+	}
+
+	if !res.IsSuccess() {
+		for _, sub := range g.all() {
+			sub.end(&ErrDialogResponse{Res: res})
+		}
+		return nil, &ErrDialogResponse{Res: res}
+	}
+
+	id, err := sip.DialogIDFromResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := s.loadOrCreate(g, id, res)
+	if !sub.store() {
+		// NOTIFY terminated subscription before response
+		return sub, nil
+	}
+	if expires > 0 {
+		granted, _ := subscriptionExpires(res, expires)
+		sub.scheduleRefresh(granted)
+	}
+	return sub, nil
+}
+
+// MatchSubscription finds subscription for in dialog request
+func (s *Subscriber) MatchSubscription(req *sip.Request) (*SubscriberSubscription, error) {
+	id, err := sip.DialogIDFromRequestUAC(req)
+	if err != nil {
+		return nil, errors.Join(ErrDialogOutsideDialog, err)
+	}
+
+	val, ok := s.subscriptions.Load(id)
+	if !ok {
+		return nil, ErrDialogDoesNotExists
+	}
+	return val.(*SubscriberSubscription), nil
+}
+
+// ReadNotify should read from your OnNotify handler.
+// NOTIFY for unknown subscription is responded with 481.
+func (s *Subscriber) ReadNotify(req *sip.Request, tx sip.ServerTransaction) error {
+	sub, err := s.MatchSubscription(req)
+	if err == nil {
+		return sub.readNotify(req, tx)
+	}
+
+	// NOTIFY can create subscription before 2xx is received or due to forked SUBSCRIBE
+	sub, err = s.readNotifyNew(req)
+	if err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil)
+		return errors.Join(err, tx.Respond(res))
+	}
+	return sub.readNotify(req, tx)
+}
+
+func (s *Subscriber) readNotifyNew(req *sip.Request) (*SubscriberSubscription, error) {
+	id, err := sip.DialogIDFromRequestUAC(req)
+	if err != nil {
+		return nil, errors.Join(ErrDialogOutsideDialog, err)
+	}
+
+	tag, _ := req.To().Params.Get("tag")
+	val, ok := s.pending.Load(subscribeGroupKey(req.CallID().Value(), tag))
+	if !ok {
+		return nil, ErrDialogDoesNotExists
+	}
+	g := val.(*subscribeGroup)
+	if ev := req.Event(); ev == nil || !ev.Match(g.event) {
+		return nil, ErrDialogDoesNotExists
+	}
+
+	sub, fork := s.loadOrCreate(g, id, notifyDialogResponse(req))
+	if fork && (g.opts.OnFork == nil || !g.opts.OnFork(sub)) {
+		g.remove(id)
+		return nil, ErrDialogDoesNotExists
+	}
+	sub.store()
+	return sub, nil
+}
+
+// loadOrCreate returns subscription within SUBSCRIBE group. Fork is true if subscription is created
+// and group already has one
+func (s *Subscriber) loadOrCreate(g *subscribeGroup, id string, res *sip.Response) (sub *SubscriberSubscription, fork bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if sub := g.dialogs[id]; sub != nil {
+		return sub, false
+	}
+
+	sub = &SubscriberSubscription{
+		ID:               id,
+		SubscribeRequest: g.req,
+		Event:            g.event,
+		s:                s,
+		opts:             g.opts,
+		state:            sip.SubscriptionStatePending,
+		remoteTarget:     *g.req.Recipient.Clone(),
+	}
+	if cont := res.Contact(); cont != nil {
+		sub.remoteTarget = *cont.Address.Clone()
+	}
+
+	sub.dialog = &DialogClientSession{
+		Dialog: Dialog{
+			ID:             id,
+			InviteRequest:  g.req,
+			InviteResponse: res,
+		},
+		UA: &s.ua,
+	}
+	sub.dialog.Init()
+	// NOTIFY has own CSeq space of notifier
+	sub.dialog.remoteCSeqNo.Store(0)
+	sub.dialog.setState(sip.DialogStateConfirmed)
+
+	fork = len(g.dialogs) > 0
+	g.dialogs[id] = sub
+	return sub, fork
+}
+
+func (g *subscribeGroup) first() *SubscriberSubscription {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, sub := range g.dialogs {
+		return sub
+	}
+	return nil
+}
+
+func (g *subscribeGroup) all() []*SubscriberSubscription {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	subs := make([]*SubscriberSubscription, 0, len(g.dialogs))
+	for _, sub := range g.dialogs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+func (g *subscribeGroup) remove(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.dialogs, id)
+}
+
+// notifyDialogResponse builds response as it would be received on SUBSCRIBE
+// in order to establish dialog from NOTIFY
+func notifyDialogResponse(req *sip.Request) *sip.Response {
+	res := sip.NewResponse(sip.StatusOK, "OK")
+	to := req.From().AsTo()
+	res.AppendHeader(&to)
+	if cont := req.Contact(); cont != nil {
+		res.AppendHeader(cont.Clone())
+	}
+	// Route set is reversed same as from response
+	sip.CopyHeaders("Record-Route", req, res)
+	res.SetSource(req.Source())
+	return res
+}
+
+// SubscriberSubscription is subscription dialog on subscriber side
+type SubscriberSubscription struct {
+	ID    string
+	Event *sip.EventHeader
+	// SubscribeRequest is SUBSCRIBE that created subscription. Use it only as read only
+	SubscribeRequest *sip.Request
+
+	s      *Subscriber
+	opts   SubscribeOptions
+	dialog *DialogClientSession
+
+	// reqMu serializes SUBSCRIBE requests within dialog
+	reqMu sync.Mutex
+
+	mu           sync.Mutex
+	state        string
+	remoteTarget sip.Uri
+	timer        *time.Timer
+}
+
+// State returns subscription state active, pending or terminated
+func (s *SubscriberSubscription) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Context is canceled when subscription is terminated
+func (s *SubscriberSubscription) Context() context.Context {
+	return s.dialog.Context()
+}
+
+// Err returns error that caused subscription termination. Termination by notifier is ErrSubscriptionTerminated
+func (s *SubscriberSubscription) Err() error {
+	return s.dialog.err()
+}
+
+// Refresh sends SUBSCRIBE within dialog to extend subscription
+func (s *SubscriberSubscription) Refresh(ctx context.Context) error {
+	return s.subscribe(ctx, s.opts.Expires)
+}
+
+// Unsubscribe sends SUBSCRIBE with Expires 0. Subscription is terminated with final NOTIFY
+// or after 64*T1 if it is not received
+func (s *SubscriberSubscription) Unsubscribe(ctx context.Context) error {
+	if err := s.subscribe(ctx, 0); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(64*s.s.ua.Client.timers().T1, func() {
+		s.end(ErrSubscriptionTerminated{})
+	})
+	return nil
+}
+
+func (s *SubscriberSubscription) subscribe(ctx context.Context, expires time.Duration) error {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	if s.State() == sip.SubscriptionStateTerminated {
+		return ErrSubscriptionTerminated{}
+	}
+
+	s.mu.Lock()
+	req := sip.NewRequest(sip.SUBSCRIBE, *s.remoteTarget.Clone())
+	s.mu.Unlock()
+	req.AppendHeader(s.Event.Clone())
+	req.AppendHeader(subscriptionExpiresHeader(expires))
+
+	res, err := s.dialog.Do(ctx, req)
+	if err == nil && (res.StatusCode == sip.StatusUnauthorized || res.StatusCode == sip.StatusProxyAuthRequired) && s.opts.Password != "" {
+		res, err = s.s.ua.Client.DoDigestAuth(ctx, req, res, DigestAuth{
+			Username: s.opts.Username,
+			Password: s.opts.Password,
+		})
+		// Digest auth increases CSeq on request
+		s.dialog.lastCSeqNo.Store(req.CSeq().SeqNo)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !res.IsSuccess() {
+		// https://datatracker.ietf.org/doc/html/rfc6665#section-4.1.2.2
+		if res.StatusCode == sip.StatusCallTransactionDoesNotExists || res.StatusCode == sip.StatusRequestTimeout {
+			s.end(&ErrDialogResponse{Res: res})
+		}
+		return &ErrDialogResponse{Res: res}
+	}
+
+	if expires > 0 {
+		granted, _ := subscriptionExpires(res, expires)
+		s.scheduleRefresh(granted)
+	}
+	return nil
+}
+
+func (s *SubscriberSubscription) readNotify(req *sip.Request, tx sip.ServerTransaction) error {
+	if err := s.dialog.ReadRequest(req, tx); err != nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusInternalServerError, "Server Internal Error", nil)
+		return errors.Join(err, tx.Respond(res))
+	}
+
+	if ev := req.Event(); ev == nil || !ev.Match(s.Event) {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadEvent, "Bad Event", nil)
+		return errors.Join(ErrSubscriptionBadEvent, tx.Respond(res))
+	}
+
+	ss := req.SubscriptionState()
+	if ss == nil {
+		res := sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request - Missing Subscription-State", nil)
+		return errors.Join(fmt.Errorf("missing Subscription-State header"), tx.Respond(res))
+	}
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	if err := tx.Respond(res); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.state = ss.State
+	if cont := req.Contact(); cont != nil {
+		// Target refresh
+		s.remoteTarget = *cont.Address.Clone()
+	}
+	s.mu.Unlock()
+
+	if s.opts.OnNotify != nil {
+		s.opts.OnNotify(s, req)
+	}
+
+	if ss.State == sip.SubscriptionStateTerminated {
+		retry, _ := ss.RetryAfter()
+		s.end(ErrSubscriptionTerminated{
+			Reason:     ss.Reason(),
+			RetryAfter: time.Duration(retry) * time.Second,
+		})
+		return nil
+	}
+
+	if expires, ok := ss.Expires(); ok {
+		s.scheduleRefresh(time.Duration(expires) * time.Second)
+	}
+	return nil
+}
+
+func (s *SubscriberSubscription) scheduleRefresh(expires time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == sip.SubscriptionStateTerminated {
+		return
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(registerRefreshInterval(expires, s.s.ua.Client.timers().TimerF), s.onRefresh)
+}
+
+func (s *SubscriberSubscription) onRefresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.s.ua.Client.timers().TimerF)
+	defer cancel()
+	if err := s.Refresh(ctx); err != nil {
+		s.s.log.Info("Subscription refresh failed", "error", err)
+	}
+}
+
+// store adds subscription to subscriber for matching requests. It returns false if subscription is terminated
+func (s *SubscriberSubscription) store() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == sip.SubscriptionStateTerminated {
+		return false
+	}
+	s.s.subscriptions.LoadOrStore(s.ID, s)
+	return true
+}
+
+// end terminates subscription locally
+func (s *SubscriberSubscription) end(cause error) {
+	s.mu.Lock()
+	s.state = sip.SubscriptionStateTerminated
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	// Deleted under lock so store can not add it back
+	s.s.subscriptions.Delete(s.ID)
+	s.mu.Unlock()
+
+	s.dialog.endWithCause(cause)
+}
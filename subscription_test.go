@@ -0,0 +1,324 @@
+package sipgo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEventPackage struct {
+	mu     sync.Mutex
+	state  string
+	status string
+}
+
+func (p *testEventPackage) Name() string { return "presence" }
+
+func (p *testEventPackage) Subscribe(sub *NotifierSubscription, req *sip.Request) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, nil
+}
+
+func (p *testEventPackage) Body(sub *NotifierSubscription) (string, []byte, error) {
+	if sub.State() == sip.SubscriptionStatePending {
+		return "", nil, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return "text/plain", []byte(p.status), nil
+}
+
+// respondTx forwards responses to client transaction
+type respondTx struct {
+	*siptest.ServerTxRecorder
+	w *siptest.ClientTxResponder
+}
+
+func (tx *respondTx) Respond(res *sip.Response) error {
+	tx.w.Receive(res)
+	return tx.ServerTxRecorder.Respond(res)
+}
+
+func TestSubscription(t *testing.T) {
+	pkg := &testEventPackage{state: sip.SubscriptionStatePending, status: "open"}
+
+	var notifier *Notifier
+	var subscriber *Subscriber
+	notifier = NewNotifier(
+		testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+			require.Equal(t, sip.NOTIFY, req.Method)
+			subscriber.ReadNotify(req, &respondTx{siptest.NewServerTxRecorder(req), w})
+		}),
+		sip.ContactHeader{Address: sip.Uri{User: "notifier", Host: "127.0.0.1", Port: 5060}},
+		WithNotifierEventPackage(pkg),
+		WithNotifierExpires(600*time.Second, time.Second, 3600*time.Second),
+	)
+
+	subscribes := make(chan *NotifierSubscription, 10)
+	subscriber = NewSubscriber(
+		testClientResponder(t, func(req *sip.Request, w *siptest.ClientTxResponder) {
+			require.Equal(t, sip.SUBSCRIBE, req.Method)
+			sub, err := notifier.ReadSubscribe(req, &respondTx{siptest.NewServerTxRecorder(req), w})
+			require.NoError(t, err)
+			subscribes <- sub
+		}),
+		sip.ContactHeader{Address: sip.Uri{User: "subscriber", Host: "127.0.0.2", Port: 5060}},
+	)
+
+	notifies := make(chan *sip.Request, 10)
+	sub, err := subscriber.Subscribe(context.TODO(), sip.Uri{User: "alice", Host: "127.0.0.1"}, "presence", SubscribeOptions{
+		OnNotify: func(sub *SubscriberSubscription, req *sip.Request) {
+			notifies <- req
+		},
+	})
+	require.NoError(t, err)
+	nsub := <-subscribes
+
+	// Initial NOTIFY with pending state
+	notify := <-notifies
+	assert.Equal(t, sip.SubscriptionStatePending, notify.SubscriptionState().State)
+	assert.Empty(t, notify.Body())
+	assert.Equal(t, "presence", notify.Event().Event)
+	assert.Equal(t, "subscriber", notify.Recipient.User)
+	assert.Equal(t, sub.ID, nsub.ID)
+	assert.Equal(t, SubscriptionDefaultExpires, nsub.Expires().Round(time.Second))
+	require.Eventually(t, func() bool { return sub.State() == sip.SubscriptionStatePending }, time.Second, 10*time.Millisecond)
+
+	t.Run("Activate", func(t *testing.T) {
+		pkg.mu.Lock()
+		pkg.state = sip.SubscriptionStateActive
+		pkg.mu.Unlock()
+		require.NoError(t, nsub.Activate(context.TODO()))
+		notify := <-notifies
+		assert.Equal(t, sip.SubscriptionStateActive, notify.SubscriptionState().State)
+		assert.Equal(t, "open", string(notify.Body()))
+		assert.Equal(t, sip.SubscriptionStateActive, sub.State())
+	})
+
+	t.Run("Notify", func(t *testing.T) {
+		pkg.mu.Lock()
+		pkg.status = "closed"
+		pkg.mu.Unlock()
+		require.Len(t, notifier.Subscriptions("presence"), 1)
+		require.NoError(t, notifier.Subscriptions("presence")[0].Notify(context.TODO()))
+		notify := <-notifies
+		assert.Equal(t, "closed", string(notify.Body()))
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		require.NoError(t, sub.Refresh(context.TODO()))
+		assert.Equal(t, nsub, <-subscribes)
+		notify := <-notifies
+		assert.Equal(t, sip.SubscriptionStateActive, notify.SubscriptionState().State)
+		expires, _ := notify.SubscriptionState().Expires()
+		assert.InDelta(t, 3600, expires, 1)
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		require.NoError(t, sub.Unsubscribe(context.TODO()))
+		<-subscribes
+		notify := <-notifies
+		assert.Equal(t, sip.SubscriptionStateTerminated, notify.SubscriptionState().State)
+		assert.Equal(t, sip.SubscriptionReasonTimeout, notify.SubscriptionState().Reason())
+
+		<-sub.Context().Done()
+		assert.Equal(t, ErrSubscriptionTerminated{Reason: sip.SubscriptionReasonTimeout}, sub.Err())
+		assert.Equal(t, ErrSubscriptionTerminated{Reason: sip.SubscriptionReasonTimeout}, nsub.Err())
+		assert.Empty(t, notifier.Subscriptions("presence"))
+		_, err := subscriber.MatchSubscription(notify)
+		assert.ErrorIs(t, err, ErrDialogDoesNotExists)
+	})
+}
+
+func TestNotifierReadSubscribe(t *testing.T) {
+	notifies := make(chan *sip.Request, 10)
+	client := testClient(t, func(req *sip.Request) *sip.Response {
+		notifies <- req
+		return sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+	})
+	pkg := &testEventPackage{state: sip.SubscriptionStateActive, status: "open"}
+	notifier := NewNotifier(client, sip.ContactHeader{Address: sip.Uri{Host: "127.0.0.1", Port: 5060}},
+		WithNotifierEventPackage(pkg),
+		WithNotifierExpires(600*time.Second, 60*time.Second, 3600*time.Second),
+	)
+
+	newSubscribe := func(event string, expires string) *sip.Request {
+		req, _, _ := createTestInvite(t, "sip:alice@127.0.0.1", "udp", "127.0.0.2:5060")
+		req.Method = sip.SUBSCRIBE
+		req.ReplaceHeader(&sip.CSeqHeader{SeqNo: 1, MethodName: sip.SUBSCRIBE})
+		req.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "bob", Host: "127.0.0.2", Port: 5060}})
+		req.AppendHeader(sip.NewHeader("Event", event))
+		req.AppendHeader(sip.NewHeader("Expires", expires))
+		return req
+	}
+
+	t.Run("BadEvent", func(t *testing.T) {
+		req := newSubscribe("dialog", "600")
+		tx := siptest.NewServerTxRecorder(req)
+		_, err := notifier.ReadSubscribe(req, tx)
+		require.ErrorIs(t, err, ErrSubscriptionBadEvent)
+
+		res := tx.Result()
+		require.Len(t, res, 1)
+		assert.Equal(t, sip.StatusBadEvent, res[0].StatusCode)
+		assert.Equal(t, "presence", res[0].AllowEvents().Value())
+	})
+
+	t.Run("IntervalTooBrief", func(t *testing.T) {
+		req := newSubscribe("presence", "10")
+		tx := siptest.NewServerTxRecorder(req)
+		_, err := notifier.ReadSubscribe(req, tx)
+		require.ErrorIs(t, err, ErrSubscriptionIntervalTooBrief)
+
+		res := tx.Result()
+		require.Len(t, res, 1)
+		assert.Equal(t, sip.StatusIntervalToBrief, res[0].StatusCode)
+		assert.Equal(t, "60", res[0].GetHeader("Min-Expires").Value())
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		req := newSubscribe("presence", "600")
+		req.To().Params.Add("tag", "unknown")
+		tx := siptest.NewServerTxRecorder(req)
+		_, err := notifier.ReadSubscribe(req, tx)
+		require.ErrorIs(t, err, ErrDialogDoesNotExists)
+		assert.Equal(t, sip.StatusCallTransactionDoesNotExists, tx.Result()[0].StatusCode)
+	})
+
+	t.Run("Fetch", func(t *testing.T) {
+		req := newSubscribe("presence", "0")
+		tx := siptest.NewServerTxRecorder(req)
+		sub, err := notifier.ReadSubscribe(req, tx)
+		require.NoError(t, err)
+
+		res := tx.Result()
+		require.Len(t, res, 1)
+		assert.Equal(t, sip.StatusOK, res[0].StatusCode)
+		assert.Equal(t, "0", res[0].GetHeader("Expires").Value())
+
+		notify := <-notifies
+		assert.Equal(t, "Subscription-State: terminated;reason=timeout", notify.SubscriptionState().String())
+		assert.Equal(t, "open", string(notify.Body()))
+		assert.Equal(t, sip.SubscriptionStateTerminated, sub.State())
+		assert.Empty(t, notifier.Subscriptions("presence"))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		req := newSubscribe("presence", "600")
+		tx := siptest.NewServerTxRecorder(req)
+		sub, err := notifier.ReadSubscribe(req, tx)
+		require.NoError(t, err)
+
+		notify := <-notifies
+		assert.Equal(t, sip.SubscriptionStateActive, notify.SubscriptionState().State)
+		assert.Equal(t, "bob", notify.Recipient.User)
+		assert.Equal(t, tx.Result()[0].To().Params, notify.From().Params)
+
+		sub.resetExpiry(50 * time.Millisecond)
+		notify = <-notifies
+		assert.Equal(t, sip.SubscriptionReasonTimeout, notify.SubscriptionState().Reason())
+		<-sub.Context().Done()
+		assert.Empty(t, notifier.Subscriptions("presence"))
+	})
+}
+
+func TestSubscriberFork(t *testing.T) {
+	var subscribe *sip.Response
+	client := testClient(t, func(req *sip.Request) *sip.Response {
+		res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		res.AppendHeader(sip.NewHeader("Expires", "600"))
+		subscribe = res
+		return res
+	})
+
+	newNotify := func(remoteTag string, cseq uint32) (*sip.Request, *siptest.ServerTxRecorder) {
+		req := sip.NewRequest(sip.NOTIFY, sip.Uri{User: "subscriber", Host: "127.0.0.2"})
+		req.AppendHeader(sip.NewHeader("Via", "SIP/2.0/UDP 127.0.0.1:5060;branch="+sip.GenerateBranch()))
+		from := subscribe.To().AsFrom()
+		from.Params = sip.NewParams()
+		from.Params.Add("tag", remoteTag)
+		req.AppendHeader(&from)
+		to := subscribe.From().AsTo()
+		req.AppendHeader(&to)
+		req.AppendHeader(sip.HeaderClone(subscribe.CallID()))
+		req.AppendHeader(&sip.CSeqHeader{SeqNo: cseq, MethodName: sip.NOTIFY})
+		req.AppendHeader(&sip.ContactHeader{Address: sip.Uri{User: "notifier-" + remoteTag, Host: "127.0.0.1"}})
+		req.AppendHeader(&sip.EventHeader{Event: "presence"})
+		req.AppendHeader(&sip.SubscriptionStateHeader{State: sip.SubscriptionStateActive})
+		return req, siptest.NewServerTxRecorder(req)
+	}
+
+	t.Run("TerminatedBeforeResponse", func(t *testing.T) {
+		var subscriber *Subscriber
+		client := testClient(t, func(req *sip.Request) *sip.Response {
+			res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+			res.AppendHeader(sip.NewHeader("Expires", "600"))
+			subscribe = res
+
+			// NOTIFY with terminated state is received before response
+			tag, _ := res.To().Params.Get("tag")
+			notify, tx := newNotify(tag, 1)
+			notify.ReplaceHeader(&sip.SubscriptionStateHeader{State: sip.SubscriptionStateTerminated, Params: sip.HeaderParams{{K: "reason", V: "noresource"}}})
+			require.NoError(t, subscriber.ReadNotify(notify, tx))
+			return res
+		})
+		subscriber = NewSubscriber(client, sip.ContactHeader{Address: sip.Uri{User: "subscriber", Host: "127.0.0.2"}})
+		sub, err := subscriber.Subscribe(context.TODO(), sip.Uri{User: "alice", Host: "127.0.0.1"}, "presence", SubscribeOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, sip.SubscriptionStateTerminated, sub.State())
+
+		_, exists := subscriber.subscriptions.Load(sub.ID)
+		assert.False(t, exists)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		subscriber := NewSubscriber(client, sip.ContactHeader{Address: sip.Uri{User: "subscriber", Host: "127.0.0.2"}})
+		sub, err := subscriber.Subscribe(context.TODO(), sip.Uri{User: "alice", Host: "127.0.0.1"}, "presence", SubscribeOptions{})
+		require.NoError(t, err)
+
+		first, _ := subscribe.To().Params.Get("tag")
+		req, tx := newNotify(first, 1)
+		require.NoError(t, subscriber.ReadNotify(req, tx))
+		assert.Equal(t, sip.StatusOK, tx.Result()[0].StatusCode)
+		assert.Equal(t, sip.SubscriptionStateActive, sub.State())
+
+		req, tx = newNotify("forked", 1)
+		require.ErrorIs(t, subscriber.ReadNotify(req, tx), ErrDialogDoesNotExists)
+		assert.Equal(t, sip.StatusCallTransactionDoesNotExists, tx.Result()[0].StatusCode)
+	})
+
+	t.Run("Accepted", func(t *testing.T) {
+		subscriber := NewSubscriber(client, sip.ContactHeader{Address: sip.Uri{User: "subscriber", Host: "127.0.0.2"}})
+		forks := make(chan *SubscriberSubscription, 1)
+		sub, err := subscriber.Subscribe(context.TODO(), sip.Uri{User: "alice", Host: "127.0.0.1"}, "presence", SubscribeOptions{
+			OnFork: func(sub *SubscriberSubscription) bool {
+				forks <- sub
+				return true
+			},
+		})
+		require.NoError(t, err)
+
+		req, tx := newNotify("forked", 1)
+		require.NoError(t, subscriber.ReadNotify(req, tx))
+		assert.Equal(t, sip.StatusOK, tx.Result()[0].StatusCode)
+
+		fork := <-forks
+		assert.NotEqual(t, sub.ID, fork.ID)
+		assert.Equal(t, "notifier-forked", fork.remoteTarget.User)
+
+		// NOTIFY terminates only forked subscription
+		req, tx = newNotify("forked", 2)
+		req.ReplaceHeader(&sip.SubscriptionStateHeader{State: sip.SubscriptionStateTerminated, Params: sip.HeaderParams{{K: "reason", V: "noresource"}}})
+		require.NoError(t, subscriber.ReadNotify(req, tx))
+		<-fork.Context().Done()
+		assert.Equal(t, ErrSubscriptionTerminated{Reason: sip.SubscriptionReasonNoresource}, fork.Err())
+		assert.NoError(t, sub.Context().Err())
+	})
+}
@@ -1,7 +1,9 @@
 package sipgo
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"net"
 
 	"github.com/emiago/sipgo/sip"
@@ -10,11 +12,12 @@ import (
 type UserAgent struct {
 	name        string
 	hostname    string
-	dnsResolver *net.Resolver
+	dnsResolver sip.DNSResolver
 	tlsConfig   *tls.Config
 	parser      *sip.Parser
 	txOptions   []sip.TransactionLayerOption
 	tpOptions   []sip.TransportLayerOption
+	udpMTU      int
 	tp          *sip.TransportLayer
 	tx          *sip.TransactionLayer
 }
@@ -38,8 +41,9 @@ func WithUserAgentHostname(hostname string) UserAgentOption {
 	}
 }
 
-// WithUserAgentDNSResolver allows customizing default DNS resolver for transport layer
-func WithUserAgentDNSResolver(r *net.Resolver) UserAgentOption {
+// WithUserAgentDNSResolver allows customizing default DNS resolver for transport layer.
+// Resolver implementing sip.DNSNAPTRResolver enables NAPTR lookups for server location
+func WithUserAgentDNSResolver(r sip.DNSResolver) UserAgentOption {
 	return func(s *UserAgent) error {
 		s.dnsResolver = r
 		return nil
@@ -80,6 +84,16 @@ func WithUserAgentTransportLayerOptions(o ...sip.TransportLayerOption) UserAgent
 	}
 }
 
+// WithUserAgentUDPMTU sets path MTU for UDP. Requests within 200 bytes of MTU are sent over TCP
+// as per RFC 3261 18.1.1, and over UDP in case TCP connection fails.
+// Default: sip.UDPMTUSize
+func WithUserAgentUDPMTU(mtu int) UserAgentOption {
+	return func(s *UserAgent) error {
+		s.udpMTU = mtu
+		return nil
+	}
+}
+
 // NewUA creates User Agent
 // User Agent will create transport and transaction layer
 // Check options for customizing user agent
@@ -97,7 +111,12 @@ func NewUA(options ...UserAgentOption) (*UserAgent, error) {
 		}
 	}
 
-	ua.tp = sip.NewTransportLayer(ua.dnsResolver, ua.parser, ua.tlsConfig, ua.tpOptions...)
+	tpOptions := ua.tpOptions
+	if ua.udpMTU > 0 {
+		tpOptions = append(tpOptions[:len(tpOptions):len(tpOptions)], sip.WithTransportLayerUDPMTU(ua.udpMTU))
+	}
+
+	ua.tp = sip.NewTransportLayer(ua.dnsResolver, ua.parser, ua.tlsConfig, tpOptions...)
 	ua.tx = sip.NewTransactionLayer(ua.tp, ua.txOptions...)
 	return ua, nil
 }
@@ -110,6 +129,17 @@ func (ua *UserAgent) Close() error {
 	return ua.tp.Close()
 }
 
+// Shutdown gracefully stops user agent, similar to http.Server.Shutdown.
+// New requests outside dialog are rejected with 503 and Retry-After, while existing transactions
+// and requests within dialog are processed until all transactions terminate or ctx is done.
+// Listeners are then closed, followed by closing connections.
+// Established dialogs are not awaited and should be ended by application before.
+func (ua *UserAgent) Shutdown(ctx context.Context) error {
+	err := ua.tx.Shutdown(ctx)
+	err = errors.Join(err, ua.tp.CloseListeners())
+	return errors.Join(err, ua.tp.Close())
+}
+
 func (ua *UserAgent) Name() string {
 	return ua.name
 }